@@ -64,6 +64,7 @@ import (
 	activatornet "knative.dev/serving/pkg/activator/net"
 	apiconfig "knative.dev/serving/pkg/apis/config"
 	asmetrics "knative.dev/serving/pkg/autoscaler/metrics"
+	"knative.dev/serving/pkg/deployment"
 	pkghttp "knative.dev/serving/pkg/http"
 	"knative.dev/serving/pkg/logging"
 	"knative.dev/serving/pkg/networking"
@@ -84,6 +85,12 @@ type config struct {
 	// TODO: run loadtests using these flags to determine optimal default values.
 	MaxIdleProxyConns        int `split_words:"true" default:"1000"`
 	MaxIdleProxyConnsPerHost int `split_words:"true" default:"100"`
+
+	// EnableLoadMetrics reports the requests in flight and the ones held
+	// waiting for a backend as metrics, both in total and for the
+	// LoadMetricsMaxRevisions revisions with the most requests in flight.
+	EnableLoadMetrics       bool `split_words:"true" default:"false"`
+	LoadMetricsMaxRevisions int  `split_words:"true" default:"10"`
 }
 
 func main() {
@@ -190,9 +197,13 @@ func main() {
 		}
 	})
 
+	throttlerUpdater := configmap.TypeFilter(&deployment.ActivatorConfig{})(func(_ string, value interface{}) {
+		throttler.UpdateConfig(value.(*deployment.ActivatorConfig))
+	})
+
 	// Set up our config store
 	configMapWatcher := configmapinformer.NewInformedWatcher(kubeClient, system.Namespace())
-	configStore := activatorconfig.NewStore(logger, tracerUpdater)
+	configStore := activatorconfig.NewStore(logger, tracerUpdater, throttlerUpdater)
 	configStore.WatchConfigs(configMapWatcher)
 
 	statCh := make(chan []asmetrics.StatMessage)
@@ -209,9 +220,18 @@ func main() {
 	concurrencyReporter := activatorhandler.NewConcurrencyReporter(ctx, env.PodName, statCh)
 	go concurrencyReporter.Run(ctx.Done())
 
+	var handlerOpts []activatorhandler.Option
+	var loadReporter *activatorhandler.LoadReporter
+	if env.EnableLoadMetrics {
+		loadReporter = activatorhandler.NewLoadReporter(env.PodName, env.LoadMetricsMaxRevisions)
+		go loadReporter.Run(ctx.Done())
+		handlerOpts = append(handlerOpts, activatorhandler.WithLoadReporter(loadReporter))
+	}
+
 	// Create activation handler chain
 	// Note: innermost handlers are specified first, ie. the last handler in the chain will be executed first
-	ah := activatorhandler.New(ctx, throttler, transport, networkConfig.EnableMeshPodAddressability, logger, tlsEnabled)
+	ah := activatorhandler.New(ctx, throttler, transport, networkConfig.EnableMeshPodAddressability, logger, tlsEnabled,
+		handlerOpts...)
 	ah = handler.NewTimeoutHandler(ah, "activator request timeout", func(r *http.Request) (time.Duration, time.Duration, time.Duration) {
 		if rev := activatorhandler.RevisionFrom(r.Context()); rev != nil {
 			var responseStartTimeout = 0 * time.Second
@@ -229,6 +249,12 @@ func main() {
 			apiconfig.DefaultRevisionIdleTimeoutSeconds * time.Second
 	})
 	ah = concurrencyReporter.Handler(ah)
+	// Hold the requests of the revisions beyond the concurrent cold starts
+	// limit before reporting them, so that they are not scaled from zero yet.
+	ah = activatorhandler.NewColdStartLimiter(throttler, ah)
+	if loadReporter != nil {
+		ah = loadReporter.Handler(ah)
+	}
 	ah = activatorhandler.NewTracingHandler(ah)
 	reqLogHandler, err := pkghttp.NewRequestLogHandler(ah, logging.NewSyncFileWriter(os.Stdout), "",
 		requestLogTemplateInputGetter, false /*enableProbeRequestLog*/)
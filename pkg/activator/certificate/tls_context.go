@@ -19,13 +19,18 @@ package certificate
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net"
 
+	"go.uber.org/zap"
 	"knative.dev/networking/pkg/certificates"
+	"knative.dev/pkg/logging/logkey"
 	pkgnet "knative.dev/pkg/network"
+	activatorconfig "knative.dev/serving/pkg/activator/config"
 	"knative.dev/serving/pkg/activator/handler"
+	"knative.dev/serving/pkg/deployment"
 )
 
 // TLSContext returns DialTLSContextFunc.
@@ -50,19 +55,72 @@ func dialTLSContext(ctx context.Context, network, addr string, cr *CertCache) (n
 	san := certificates.DataPlaneUserSAN(revID.Namespace)
 
 	tlsConf.VerifyConnection = verifySAN(san)
-	return pkgnet.DialTLSWithBackOff(ctx, network, addr, tlsConf)
+	if activatorconfig.FromContext(ctx).BackendTLSVerification == deployment.BackendTLSVerificationPermissive {
+		// The built-in verification cannot be made non-fatal, so skip it and run
+		// the same checks ourselves, only logging their failures.
+		tlsConf.InsecureSkipVerify = true
+		tlsConf.VerifyConnection = logOnly(cr.logger.With(zap.String(logkey.Key, revID.String()), zap.String("address", addr)),
+			verifyChain(tlsConf.RootCAs, tlsConf.ServerName), tlsConf.VerifyConnection)
+	}
+
+	conn, err := pkgnet.DialTLSWithBackOff(ctx, network, addr, tlsConf)
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return nil, fmt.Errorf("failed to verify the TLS certificate of revision %s at %s: %w", revID, addr, err)
+	}
+	return conn, err
 }
 
-func verifySAN(san string) func(tls.ConnectionState) error {
+// logOnly runs the verifications in order and logs the first failure instead
+// of returning it.
+func logOnly(logger *zap.SugaredLogger, verifications ...func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		for _, verify := range verifications {
+			if err := verify(cs); err != nil {
+				logger.Warnw("Ignoring failed TLS verification of the backend", zap.Error(err))
+				return nil
+			}
+		}
+		return nil
+	}
+}
+
+// verifyChain does the certificate chain and host name verification which is
+// done by crypto/tls unless InsecureSkipVerify is set.
+func verifyChain(roots *x509.CertPool, serverName string) func(tls.ConnectionState) error {
 	return func(cs tls.ConnectionState) error {
 		if len(cs.PeerCertificates) == 0 {
 			return errors.New("no PeerCertificates provided")
 		}
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			DNSName:       serverName,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+}
+
+// verifySAN checks the peer certificate contains the given SAN. Failures are
+// returned as a tls.CertificateVerificationError, like the ones of the
+// built-in verification.
+func verifySAN(san string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return &tls.CertificateVerificationError{Err: errors.New("no PeerCertificates provided")}
+		}
 		for _, name := range cs.PeerCertificates[0].DNSNames {
 			if name == san {
 				return nil
 			}
 		}
-		return fmt.Errorf("san %q does not have a matching name in %v", san, cs.PeerCertificates[0].DNSNames)
+		return &tls.CertificateVerificationError{
+			UnverifiedCertificates: cs.PeerCertificates,
+			Err:                    fmt.Errorf("san %q does not have a matching name in %v", san, cs.PeerCertificates[0].DNSNames),
+		}
 	}
 }
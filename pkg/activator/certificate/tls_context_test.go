@@ -17,10 +17,25 @@ limitations under the License.
 package certificate
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
 	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ltesting "knative.dev/pkg/logging/testing"
+	pkghandler "knative.dev/pkg/network/handlers"
+	activatorconfig "knative.dev/serving/pkg/activator/config"
+	"knative.dev/serving/pkg/activator/handler"
+	"knative.dev/serving/pkg/deployment"
 )
 
 // TestVerifySAN tests verifySAN.
@@ -70,3 +85,73 @@ func TestVerifySAN(t *testing.T) {
 		})
 	}
 }
+
+func TestDialTLSContextVerification(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     deployment.BackendTLSVerification
+		wantCode int
+	}{{
+		name:     "strict",
+		mode:     deployment.BackendTLSVerificationStrict,
+		wantCode: http.StatusBadGateway,
+	}, {
+		name:     "permissive",
+		mode:     deployment.BackendTLSVerificationPermissive,
+		wantCode: http.StatusOK,
+	}}
+
+	// The server's certificate is trusted, but doesn't carry the SAN of the
+	// revision's namespace.
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(backend.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(backend.Certificate())
+
+	logger := ltesting.TestLogger(t)
+	cr := &CertCache{
+		TLSConf: tls.Config{
+			RootCAs:    roots,
+			ServerName: "example.com",
+			MinVersion: tls.VersionTLS13,
+		},
+		logger: logger,
+	}
+	target, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal("Failed to parse the backend URL:", err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := activatorconfig.NewStore(logger)
+			store.OnConfigChanged(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: deployment.ConfigName,
+				},
+				Data: map[string]string{
+					deployment.ActivatorBackendTLSVerificationKey: string(test.mode),
+				},
+			})
+			ctx := store.ToContext(context.Background())
+			ctx = handler.WithRevisionAndID(ctx, nil, types.NamespacedName{Namespace: "ns", Name: "rev"})
+
+			proxy := httputil.NewSingleHostReverseProxy(target)
+			proxy.Transport = &http.Transport{DialTLSContext: cr.TLSContext()}
+			proxy.ErrorHandler = pkghandler.Error(logger)
+
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com", nil).WithContext(ctx))
+
+			if got := rec.Code; got != test.wantCode {
+				t.Errorf("Code = %d, want: %d", got, test.wantCode)
+			}
+			if test.wantCode == http.StatusBadGateway {
+				const want = "failed to verify the TLS certificate of revision ns/rev"
+				if got := rec.Body.String(); !strings.Contains(got, want) {
+					t.Errorf("Body = %q wanted to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
@@ -20,9 +20,11 @@ import (
 	"context"
 
 	"go.uber.org/atomic"
+	corev1 "k8s.io/api/core/v1"
 	netcfg "knative.dev/networking/pkg/config"
 	"knative.dev/pkg/configmap"
 	tracingconfig "knative.dev/pkg/tracing/config"
+	"knative.dev/serving/pkg/deployment"
 )
 
 type cfgKey struct{}
@@ -31,11 +33,23 @@ type cfgKey struct{}
 type Config struct {
 	Tracing *tracingconfig.Config
 	Network *netcfg.Config
+
+	// ActivatorConfig is the configuration of the activator in the
+	// config-deployment.
+	deployment.ActivatorConfig
+}
+
+// newActivatorConfigFromConfigMap parses the configuration of the activator
+// from the config-deployment.
+func newActivatorConfigFromConfigMap(cm *corev1.ConfigMap) (*deployment.ActivatorConfig, error) {
+	return deployment.NewActivatorConfigFromMap(cm.Data)
 }
 
-// FromContext obtains a Config injected into the passed context.
+// FromContext obtains a Config injected into the passed context, or nil if
+// there is none.
 func FromContext(ctx context.Context) *Config {
-	return ctx.Value(cfgKey{}).(*Config)
+	cfg, _ := ctx.Value(cfgKey{}).(*Config)
+	return cfg
 }
 
 // Store loads/unloads our untyped configuration.
@@ -53,7 +67,9 @@ func NewStore(logger configmap.Logger, onAfterStore ...func(name string, value i
 	// Append an update function to run after a ConfigMap has updated to update the
 	// current state of the Config.
 	onAfterStore = append(onAfterStore, func(_ string, _ interface{}) {
-		c := &Config{}
+		c := &Config{
+			ActivatorConfig: *deployment.DefaultActivatorConfig(),
+		}
 		tracing := s.UntypedLoad(tracingconfig.ConfigName)
 		if tracing != nil {
 			c.Tracing = tracing.(*tracingconfig.Config).DeepCopy()
@@ -66,6 +82,9 @@ func NewStore(logger configmap.Logger, onAfterStore ...func(name string, value i
 		if network != nil {
 			c.Network = network.(*netcfg.Config).DeepCopy()
 		}
+		if ac, ok := s.UntypedLoad(deployment.ConfigName).(*deployment.ActivatorConfig); ok && ac != nil {
+			c.ActivatorConfig = *ac.DeepCopy()
+		}
 		s.current.Store(c)
 	})
 	s.UntypedStore = configmap.NewUntypedStore(
@@ -74,6 +93,7 @@ func NewStore(logger configmap.Logger, onAfterStore ...func(name string, value i
 		configmap.Constructors{
 			tracingconfig.ConfigName: tracingconfig.NewTracingConfigFromConfigMap,
 			netcfg.ConfigMapName:     netcfg.NewConfigFromConfigMap,
+			deployment.ConfigName:    newActivatorConfigFromConfigMap,
 		},
 		onAfterStore...,
 	)
@@ -19,12 +19,15 @@ package config
 import (
 	"context"
 	"testing"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	netcfg "knative.dev/networking/pkg/config"
 	ltesting "knative.dev/pkg/logging/testing"
 	tracingconfig "knative.dev/pkg/tracing/config"
+	"knative.dev/serving/pkg/activator"
+	"knative.dev/serving/pkg/deployment"
 )
 
 var tracingConfig = &corev1.ConfigMap{
@@ -60,6 +63,24 @@ func TestStore(t *testing.T) {
 	if got, want := cfg.Network.DefaultIngressClass, "random.ingress.networking.knative.dev"; got != want {
 		t.Fatalf("Networking.In = %v, want %v", got, want)
 	}
+	if got, want := cfg.BackendTLSVerification, deployment.BackendTLSVerificationStrict; got != want {
+		t.Fatalf("BackendTLSVerification = %v, want %v", got, want)
+	}
+	if got, want := cfg.ProxyHeader, deployment.DefaultActivatorProxyHeader; got != want {
+		t.Fatalf("ProxyHeader = %v, want %v", got, want)
+	}
+	if got, want := cfg.ProxyHeader.Value, activator.Name; got != want {
+		t.Fatalf("ProxyHeader.Value = %v, want %v", got, want)
+	}
+	if got, want := cfg.LoadBalancingPolicy, deployment.LoadBalancingPolicyDefault; got != want {
+		t.Fatalf("LoadBalancingPolicy = %v, want %v", got, want)
+	}
+	if cfg.PreferLocalZone {
+		t.Fatal("PreferLocalZone = true, want false")
+	}
+	if got, want := cfg.CapacityShrinkPolicy, deployment.ShrinkPolicyGraceful; got != want {
+		t.Fatalf("CapacityShrinkPolicy = %v, want %v", got, want)
+	}
 
 	newConfig := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
@@ -78,6 +99,58 @@ func TestStore(t *testing.T) {
 	if got, want := cfg.Tracing.Backend, tracingconfig.Zipkin; got != want {
 		t.Fatalf("Tracing.Backend = %v, want %v", got, want)
 	}
+
+	store.OnConfigChanged(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: deployment.ConfigName,
+		},
+		Data: map[string]string{
+			deployment.ActivatorProxyHeaderValueKey:        "mesh-friendly",
+			deployment.ActivatorEndpointsRetryIntervalKey:  "100ms",
+			deployment.ActivatorEndpointsMaxWaitKey:        "5s",
+			deployment.ActivatorColdStartQueueLengthKey:    "100",
+			deployment.ActivatorMaxConcurrentColdStartsKey: "4",
+			deployment.ActivatorLoadBalancingPolicyKey:     string(deployment.LoadBalancingPolicyConsistentHash),
+			deployment.ActivatorLoadBalancingHashHeaderKey: "X-Session-Id",
+			deployment.ActivatorPreferLocalZoneKey:         "true",
+			deployment.ActivatorCapacityShrinkPolicyKey:    "lazy",
+			deployment.ActivatorBackendTLSVerificationKey:  "permissive",
+		},
+	})
+
+	ctx = store.ToContext(context.Background())
+	cfg = FromContext(ctx)
+
+	if got, want := cfg.BackendTLSVerification, deployment.BackendTLSVerificationPermissive; got != want {
+		t.Fatalf("BackendTLSVerification = %v, want %v", got, want)
+	}
+	if got, want := cfg.EndpointsRetryInterval, 100*time.Millisecond; got != want {
+		t.Fatalf("EndpointsRetryInterval = %v, want %v", got, want)
+	}
+	if got, want := cfg.EndpointsMaxWait, 5*time.Second; got != want {
+		t.Fatalf("EndpointsMaxWait = %v, want %v", got, want)
+	}
+	if got, want := cfg.ColdStartQueueLength, 100; got != want {
+		t.Fatalf("ColdStartQueueLength = %v, want %v", got, want)
+	}
+	if got, want := cfg.MaxConcurrentColdStarts, 4; got != want {
+		t.Fatalf("MaxConcurrentColdStarts = %v, want %v", got, want)
+	}
+	if got, want := cfg.ProxyHeader, (deployment.ProxyHeader{Name: "K-Proxy-Request", Value: "mesh-friendly"}); got != want {
+		t.Fatalf("ProxyHeader = %v, want %v", got, want)
+	}
+	if got, want := cfg.LoadBalancingPolicy, deployment.LoadBalancingPolicyConsistentHash; got != want {
+		t.Fatalf("LoadBalancingPolicy = %v, want %v", got, want)
+	}
+	if got, want := cfg.LoadBalancingHashHeader, "X-Session-Id"; got != want {
+		t.Fatalf("LoadBalancingHashHeader = %v, want %v", got, want)
+	}
+	if !cfg.PreferLocalZone {
+		t.Fatal("PreferLocalZone = false, want true")
+	}
+	if got, want := cfg.CapacityShrinkPolicy, deployment.ShrinkPolicyLazy; got != want {
+		t.Fatalf("CapacityShrinkPolicy = %v, want %v", got, want)
+	}
 }
 
 func BenchmarkStoreToContext(b *testing.B) {
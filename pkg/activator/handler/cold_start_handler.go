@@ -0,0 +1,137 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	activatorconfig "knative.dev/serving/pkg/activator/config"
+)
+
+// BackendChecker tells whether a revision currently has backends.
+type BackendChecker interface {
+	HasBackends(revID types.NamespacedName) bool
+}
+
+// ColdStartLimiter caps the number of revisions without backends whose
+// requests are let through at the same time, as set by the
+// MaxConcurrentColdStarts of the activator config. It is meant to wrap the
+// handlers reporting the request concurrency, so that the revisions held back
+// are not scaled from zero until a slot frees up.
+//
+// A revision takes a slot with the first request arriving while it has no
+// backends, and keeps it until all the requests let through on its behalf are
+// done. The requests of revisions with backends are never held.
+type ColdStartLimiter struct {
+	backends BackendChecker
+	next     http.Handler
+
+	mux sync.Mutex
+	// starting holds the number of requests in flight of each revision
+	// holding a slot.
+	starting map[types.NamespacedName]int
+	// freed is closed, and replaced, whenever a slot frees up.
+	freed chan struct{}
+}
+
+// NewColdStartLimiter creates a ColdStartLimiter in front of next.
+func NewColdStartLimiter(backends BackendChecker, next http.Handler) *ColdStartLimiter {
+	return &ColdStartLimiter{
+		backends: backends,
+		next:     next,
+		starting: make(map[types.NamespacedName]int),
+		freed:    make(chan struct{}),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (l *ColdStartLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg := activatorconfig.FromContext(r.Context())
+	if cfg.MaxConcurrentColdStarts <= 0 {
+		l.next.ServeHTTP(w, r)
+		return
+	}
+
+	release, err := l.acquire(r.Context(), RevIDFrom(r.Context()), cfg)
+	if err != nil {
+		if clientCancelled(r, err) {
+			w.WriteHeader(statusClientClosedRequest)
+			return
+		}
+		w.Header().Set("Retry-After", coldStartRetryAfter)
+		http.Error(w, "too many concurrent cold starts", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	l.next.ServeHTTP(w, r)
+}
+
+// acquire waits until the request of the given revision may proceed, for at
+// most the EndpointsMaxWait of cfg if set. The returned function must be
+// called once the request is done.
+func (l *ColdStartLimiter) acquire(ctx context.Context, revID types.NamespacedName, cfg *activatorconfig.Config) (func(), error) {
+	if cfg.EndpointsMaxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.EndpointsMaxWait)
+		defer cancel()
+	}
+
+	for {
+		l.mux.Lock()
+		if n, ok := l.starting[revID]; ok {
+			l.starting[revID] = n + 1
+			l.mux.Unlock()
+			return func() { l.release(revID) }, nil
+		}
+		if l.backends.HasBackends(revID) {
+			l.mux.Unlock()
+			return func() {}, nil
+		}
+		if len(l.starting) < cfg.MaxConcurrentColdStarts {
+			l.starting[revID] = 1
+			l.mux.Unlock()
+			return func() { l.release(revID) }, nil
+		}
+		freed := l.freed
+		l.mux.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// release ends a request of the given revision, freeing its slot if it was
+// the last one.
+func (l *ColdStartLimiter) release(revID types.NamespacedName) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.starting[revID] > 1 {
+		l.starting[revID]--
+		return
+	}
+	delete(l.starting, revID)
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/logging"
+	rtesting "knative.dev/pkg/reconciler/testing"
+	activatorconfig "knative.dev/serving/pkg/activator/config"
+	"knative.dev/serving/pkg/deployment"
+)
+
+type fakeBackendChecker map[types.NamespacedName]bool
+
+func (f fakeBackendChecker) HasBackends(revID types.NamespacedName) bool {
+	return f[revID]
+}
+
+func coldStartLimiterContext(t *testing.T, data map[string]string) context.Context {
+	ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
+	t.Cleanup(cancel)
+
+	configStore := activatorconfig.NewStore(logging.FromContext(ctx))
+	configStore.OnConfigChanged(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: deployment.ConfigName},
+		Data:       data,
+	})
+	return configStore.ToContext(ctx)
+}
+
+func TestColdStartLimiter(t *testing.T) {
+	var (
+		revA = types.NamespacedName{Namespace: testNamespace, Name: "rev-a"}
+		revB = types.NamespacedName{Namespace: testNamespace, Name: "rev-b"}
+		revC = types.NamespacedName{Namespace: testNamespace, Name: "rev-c"}
+	)
+	ctx := coldStartLimiterContext(t, map[string]string{deployment.ActivatorMaxConcurrentColdStartsKey: "1"})
+
+	// The requests block in the handler until unblocked, reporting the
+	// revision they were let through for.
+	arrived := make(chan types.NamespacedName, 10)
+	unblock := make(chan struct{})
+	limiter := NewColdStartLimiter(fakeBackendChecker{revC: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- RevIDFrom(r.Context())
+		<-unblock
+	}))
+
+	serve := func(revID types.NamespacedName) <-chan int {
+		done := make(chan int, 1)
+		go func() {
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+			limiter.ServeHTTP(resp, req.WithContext(WithRevisionAndID(ctx, nil, revID)))
+			done <- resp.Code
+		}()
+		return done
+	}
+	expectArrival := func(want types.NamespacedName) {
+		t.Helper()
+		select {
+		case got := <-arrived:
+			if got != want {
+				t.Fatalf("Request of %v let through, want: %v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Request of %v was not let through", want)
+		}
+	}
+
+	// The first revision takes the only slot.
+	doneA := serve(revA)
+	expectArrival(revA)
+
+	// The other revisions without backends wait for the slot...
+	doneB := serve(revB)
+	select {
+	case got := <-arrived:
+		t.Fatalf("Request of %v let through while the slot was taken", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// ...while the further requests of the starting revision and the ones of
+	// revisions with backends are let through.
+	doneA2 := serve(revA)
+	expectArrival(revA)
+	doneC := serve(revC)
+	expectArrival(revC)
+
+	// Once the requests of the starting revision are done, the waiting
+	// revision gets the slot.
+	close(unblock)
+	for _, done := range []<-chan int{doneA, doneA2, doneC, doneB} {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("StatusCode = %d, want: %d", code, http.StatusOK)
+		}
+	}
+	expectArrival(revB)
+
+	if len(limiter.starting) != 0 {
+		t.Errorf("Slots still taken after all requests are done: %v", limiter.starting)
+	}
+}
+
+func TestColdStartLimiterMaxWait(t *testing.T) {
+	var (
+		revA = types.NamespacedName{Namespace: testNamespace, Name: "rev-a"}
+		revB = types.NamespacedName{Namespace: testNamespace, Name: "rev-b"}
+	)
+	ctx := coldStartLimiterContext(t, map[string]string{
+		deployment.ActivatorMaxConcurrentColdStartsKey: "1",
+		deployment.ActivatorEndpointsMaxWaitKey:        "50ms",
+	})
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+	arrived := make(chan struct{})
+	limiter := NewColdStartLimiter(fakeBackendChecker{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-unblock
+	}))
+
+	go limiter.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodGet, "http://example.com", nil).WithContext(WithRevisionAndID(ctx, nil, revA)))
+	<-arrived
+
+	// The request of the other revision is shed once it waited for too long.
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	limiter.ServeHTTP(resp, req.WithContext(WithRevisionAndID(ctx, nil, revB)))
+	if got, want := resp.Code, http.StatusServiceUnavailable; got != want {
+		t.Errorf("StatusCode = %d, want: %d", got, want)
+	}
+	if got, want := resp.Header().Get("Retry-After"), coldStartRetryAfter; got != want {
+		t.Errorf("Retry-After = %q, want: %q", got, want)
+	}
+}
+
+func TestColdStartLimiterDisabled(t *testing.T) {
+	ctx := coldStartLimiterContext(t, nil)
+
+	var served int
+	limiter := NewColdStartLimiter(fakeBackendChecker{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+	}))
+	for i := 0; i < 3; i++ {
+		revID := types.NamespacedName{Namespace: testNamespace, Name: "rev-" + string(rune('a'+i))}
+		req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		limiter.ServeHTTP(httptest.NewRecorder(), req.WithContext(WithRevisionAndID(ctx, nil, revID)))
+	}
+	if served != 3 {
+		t.Errorf("Served %d requests, want: 3", served)
+	}
+}
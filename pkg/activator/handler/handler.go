@@ -26,6 +26,7 @@ import (
 
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/trace"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/types"
 
@@ -37,13 +38,38 @@ import (
 	"knative.dev/pkg/tracing/propagation/tracecontextb3"
 	"knative.dev/serving/pkg/activator"
 	activatorconfig "knative.dev/serving/pkg/activator/config"
+	activatornet "knative.dev/serving/pkg/activator/net"
 	apiconfig "knative.dev/serving/pkg/apis/config"
+	"knative.dev/serving/pkg/deployment"
 	pkghttp "knative.dev/serving/pkg/http"
 	"knative.dev/serving/pkg/networking"
 	"knative.dev/serving/pkg/queue"
 	"knative.dev/serving/pkg/reconciler/serverlessservice/resources/names"
 )
 
+// errHeldRequestBytesExceeded indicates that holding a request would exceed the
+// configured budget of bytes held across all waiting requests.
+var errHeldRequestBytesExceeded = errors.New("activator held request bytes limit exceeded")
+
+// unknownContentLengthReservation is how many bytes of the held request budget
+// a request with an unknown content length, e.g. a chunked one, reserves.
+const unknownContentLengthReservation = 1 << 20
+
+// coldStartRetryAfter is the Retry-After, in seconds, of the requests rejected
+// because the cold start queue of their revision is full.
+const coldStartRetryAfter = "1"
+
+// statusClientClosedRequest is the non-standard status code, as used by
+// nginx, recorded for the requests the client cancelled before they were
+// answered. The client never sees it.
+const statusClientClosedRequest = 499
+
+// clientCancelled returns whether err is due to the client cancelling the
+// request r, e.g. by closing the connection.
+func clientCancelled(r *http.Request, err error) bool {
+	return errors.Is(err, context.Canceled) && errors.Is(r.Context().Err(), context.Canceled)
+}
+
 // Throttler is the interface that Handler calls to Try to proxy the user request.
 type Throttler interface {
 	Try(ctx context.Context, revID types.NamespacedName, fn func(string) error) error
@@ -59,11 +85,29 @@ type activationHandler struct {
 	bufferPool       httputil.BufferPool
 	logger           *zap.SugaredLogger
 	tls              bool
+
+	// heldRequestBytes is the part of the MaxHeldRequestBytes budget reserved
+	// by the requests waiting for capacity.
+	heldRequestBytes atomic.Int64
+
+	// loadReporter, if set, tracks the requests held waiting for a backend.
+	loadReporter *LoadReporter
+}
+
+// Option configures optional behavior of the activation handler.
+type Option func(*activationHandler)
+
+// WithLoadReporter reports the requests held while waiting for a backend to
+// become available to the given LoadReporter.
+func WithLoadReporter(lr *LoadReporter) Option {
+	return func(a *activationHandler) {
+		a.loadReporter = lr
+	}
 }
 
 // New constructs a new http.Handler that deals with revision activation.
-func New(_ context.Context, t Throttler, transport http.RoundTripper, usePassthroughLb bool, logger *zap.SugaredLogger, tlsEnabled bool) http.Handler {
-	return &activationHandler{
+func New(_ context.Context, t Throttler, transport http.RoundTripper, usePassthroughLb bool, logger *zap.SugaredLogger, tlsEnabled bool, opts ...Option) http.Handler {
+	a := &activationHandler{
 		transport: transport,
 		tracingTransport: &ochttp.Transport{
 			Base:        transport,
@@ -75,6 +119,10 @@ func New(_ context.Context, t Throttler, transport http.RoundTripper, usePassthr
 		logger:           logger,
 		tls:              tlsEnabled,
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 func (a *activationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -85,16 +133,35 @@ func (a *activationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if tracingEnabled {
 		tryContext, trySpan = trace.StartSpan(r.Context(), "throttler_try")
 	}
+	if config.LoadBalancingPolicy == deployment.LoadBalancingPolicyConsistentHash {
+		if key := r.Header.Get(config.LoadBalancingHashHeader); key != "" {
+			tryContext = activatornet.WithLoadBalancingKey(tryContext, key)
+		}
+	}
 
 	revID := RevIDFrom(r.Context())
+	release, ok := a.holdRequestBytes(config.MaxHeldRequestBytes, r.ContentLength)
+	if !ok {
+		trySpan.End()
+		a.logger.Warnw("Rejecting request, held request bytes limit exceeded", zap.String(logkey.Key, revID.String()))
+		http.Error(w, errHeldRequestBytesExceeded.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+	unhold := a.loadReporter.hold(r.Context())
+	defer unhold()
+
 	if err := a.throttler.Try(tryContext, revID, func(dest string) error {
 		trySpan.End()
+		// The request is no longer held once it is proxied.
+		release()
+		unhold()
 
 		proxyCtx, proxySpan := r.Context(), (*trace.Span)(nil)
 		if tracingEnabled {
 			proxyCtx, proxySpan = trace.StartSpan(r.Context(), "activator_proxy")
 		}
-		a.proxyRequest(revID, w, r.WithContext(proxyCtx), dest, tracingEnabled, a.usePassthroughLb)
+		a.proxyRequest(revID, w, r.WithContext(proxyCtx), dest, config.ProxyHeader, tracingEnabled, a.usePassthroughLb)
 		proxySpan.End()
 
 		return nil
@@ -103,9 +170,19 @@ func (a *activationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		trySpan.Annotate([]trace.Attribute{trace.StringAttribute("activator.throttler.error", err.Error())}, "ThrottlerTry")
 		trySpan.End()
 
+		// The client gave up waiting before the request reached the upstream.
+		if clientCancelled(r, err) {
+			a.logger.Debugw("Client cancelled the request while waiting for capacity", zap.String(logkey.Key, revID.String()))
+			w.WriteHeader(statusClientClosedRequest)
+			return
+		}
+
 		a.logger.Errorw("Throttler try error", zap.String(logkey.Key, revID.String()), zap.Error(err))
 
-		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, queue.ErrRequestQueueFull) {
+		if errors.Is(err, activatornet.ErrColdStartQueueFull) {
+			w.Header().Set("Retry-After", coldStartRetryAfter)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		} else if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, queue.ErrRequestQueueFull) {
 			http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		} else {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -113,10 +190,38 @@ func (a *activationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// holdRequestBytes reserves n bytes of the held request budget, which is
+// budget bytes in total. The returned function releases the reservation and is
+// safe to call more than once. Requests with an unknown content length reserve
+// unknownContentLengthReservation bytes, at most the whole budget.
+func (a *activationHandler) holdRequestBytes(budget, n int64) (func(), bool) {
+	if budget <= 0 || n == 0 {
+		return noop, true
+	}
+	if n < 0 {
+		n = min(unknownContentLengthReservation, budget)
+	}
+	if a.heldRequestBytes.Add(n) > budget {
+		a.heldRequestBytes.Sub(n)
+		return noop, false
+	}
+	released := false
+	return func() {
+		if !released {
+			released = true
+			a.heldRequestBytes.Sub(n)
+		}
+	}, true
+}
+
+func noop() {}
+
 func (a *activationHandler) proxyRequest(revID types.NamespacedName, w http.ResponseWriter,
-	r *http.Request, target string, tracingEnabled bool, usePassthroughLb bool) {
+	r *http.Request, target string, proxyHeader deployment.ProxyHeader, tracingEnabled bool, usePassthroughLb bool) {
 	netheader.RewriteHostIn(r)
-	r.Header.Set(netheader.ProxyKey, activator.Name)
+	if proxyHeader.Name != "" {
+		r.Header.Set(proxyHeader.Name, proxyHeader.Value)
+	}
 
 	// Set up the reverse proxy.
 	hostOverride := pkghttp.NoHostOverride
@@ -138,6 +243,13 @@ func (a *activationHandler) proxyRequest(revID types.NamespacedName, w http.Resp
 	}
 	proxy.FlushInterval = netproxy.FlushInterval
 	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		// The upstream request shares the context of the client's, so it is
+		// cancelled along with it.
+		if clientCancelled(req, err) {
+			a.logger.Debugw("Client cancelled the request while proxying", zap.String(logkey.Key, revID.String()))
+			w.WriteHeader(statusClientClosedRequest)
+			return
+		}
 		pkghandler.Error(a.logger.With(zap.String(logkey.Key, revID.String())))(w, req, err)
 	}
 
@@ -25,6 +25,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
@@ -40,9 +41,11 @@ import (
 	tracetesting "knative.dev/pkg/tracing/testing"
 	"knative.dev/serving/pkg/activator"
 	activatorconfig "knative.dev/serving/pkg/activator/config"
+	activatornet "knative.dev/serving/pkg/activator/net"
 	activatortest "knative.dev/serving/pkg/activator/testing"
 	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
+	"knative.dev/serving/pkg/deployment"
 	"knative.dev/serving/pkg/queue"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -78,6 +81,8 @@ func TestActivationHandler(t *testing.T) {
 		probeCode int
 		probeResp []string
 		throttler Throttler
+
+		wantRetryAfter string
 	}{{
 		name:      "active endpoint",
 		wantBody:  wantBody,
@@ -99,6 +104,12 @@ func TestActivationHandler(t *testing.T) {
 		wantBody:  "pending request queue full\n",
 		wantCode:  http.StatusServiceUnavailable,
 		throttler: fakeThrottler{err: queue.ErrRequestQueueFull},
+	}, {
+		name:           "cold start overflow",
+		wantBody:       "cold start request queue is full\n",
+		wantCode:       http.StatusServiceUnavailable,
+		wantRetryAfter: "1",
+		throttler:      fakeThrottler{err: activatornet.ErrColdStartQueueFull},
 	}}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -147,40 +158,252 @@ func TestActivationHandler(t *testing.T) {
 			if string(gotBody) != test.wantBody {
 				t.Errorf("Response body = %q, want: %q", gotBody, test.wantBody)
 			}
+			if got := resp.Header().Get("Retry-After"); got != test.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want: %q", got, test.wantRetryAfter)
+			}
 		})
 	}
 }
 
-func TestActivationHandlerProxyHeader(t *testing.T) {
-	interceptCh := make(chan *http.Request, 1)
+type blockingThrottler struct {
+	held    chan struct{}
+	release chan struct{}
+}
+
+func (bt blockingThrottler) Try(_ context.Context, _ types.NamespacedName, f func(string) error) error {
+	bt.held <- struct{}{}
+	<-bt.release
+	return f("10.10.10.10:1234")
+}
+
+func TestActivationHandlerMaxHeldRequestBytes(t *testing.T) {
+	const (
+		bodySize = 1024
+		requests = 5
+	)
+
+	tests := []struct {
+		name   string
+		budget int64
+		body   func() io.Reader
+	}{{
+		name: "known content length",
+		// Leaves room for exactly two held requests.
+		budget: 2*bodySize + bodySize/2,
+		body: func() io.Reader {
+			return bytes.NewReader(make([]byte, bodySize))
+		},
+	}, {
+		name: "unknown content length",
+		// Leaves room for exactly two held requests, whatever their actual size.
+		budget: 2*unknownContentLengthReservation + bodySize,
+		body: func() io.Reader {
+			// Hides the size of the body, as for a chunked request.
+			return io.NopCloser(bytes.NewReader(make([]byte, bodySize)))
+		},
+	}}
+
 	rt := pkgnet.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
-		interceptCh <- r
-		fake := httptest.NewRecorder()
-		return fake.Result(), nil
+		return httptest.NewRecorder().Result(), nil
 	})
 
-	ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
-	defer cancel()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
+			defer cancel()
 
-	handler := New(ctx, fakeThrottler{}, rt, false /*usePassthroughLb*/, logging.FromContext(ctx), false /* TLS */)
+			throttler := blockingThrottler{
+				held:    make(chan struct{}, requests),
+				release: make(chan struct{}),
+			}
+			handler := New(ctx, throttler, rt, false /*usePassthroughLb*/, logging.FromContext(ctx), false /* TLS */)
 
-	writer := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodPost, "http://example.com", nil)
+			configStore := setupConfigStore(t, logging.FromContext(ctx))
+			configStore.OnConfigChanged(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: deployment.ConfigName,
+				},
+				Data: map[string]string{
+					deployment.ActivatorMaxHeldRequestBytesKey: strconv.FormatInt(test.budget, 10),
+				},
+			})
+			reqCtx := configStore.ToContext(ctx)
+			reqCtx = WithRevisionAndID(reqCtx, nil, types.NamespacedName{Namespace: testNamespace, Name: testRevName})
 
-	// Set up config store to populate context.
+			codes := make(chan int, requests)
+			for i := 0; i < requests; i++ {
+				go func() {
+					resp := httptest.NewRecorder()
+					req := httptest.NewRequest(http.MethodPost, "http://example.com", test.body())
+					handler.ServeHTTP(resp, req.WithContext(reqCtx))
+					codes <- resp.Code
+				}()
+			}
+
+			// Two requests fit the budget and are held, the rest are rejected.
+			for i := 0; i < 2; i++ {
+				select {
+				case <-throttler.held:
+				case <-time.After(5 * time.Second):
+					t.Fatal("Timed out waiting for request to be held")
+				}
+			}
+			for i := 0; i < requests-2; i++ {
+				if got := <-codes; got != http.StatusServiceUnavailable {
+					t.Errorf("Rejected request code = %d, want: %d", got, http.StatusServiceUnavailable)
+				}
+			}
+
+			// Releasing the held requests lets them through and frees the budget.
+			close(throttler.release)
+			for i := 0; i < 2; i++ {
+				if got := <-codes; got != http.StatusOK {
+					t.Errorf("Held request code = %d, want: %d", got, http.StatusOK)
+				}
+			}
+			if got := handler.(*activationHandler).heldRequestBytes.Load(); got != 0 {
+				t.Errorf("heldRequestBytes = %d, want: 0", got)
+			}
+		})
+	}
+}
+
+type ctxThrottler struct {
+	held chan struct{}
+}
+
+func (ct ctxThrottler) Try(ctx context.Context, _ types.NamespacedName, _ func(string) error) error {
+	close(ct.held)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestActivationHandlerClientCancellation(t *testing.T) {
+	ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
+	defer cancel()
 	configStore := setupConfigStore(t, logging.FromContext(ctx))
-	ctx = configStore.ToContext(req.Context())
-	ctx = WithRevisionAndID(ctx, nil, types.NamespacedName{Namespace: testNamespace, Name: testRevName})
 
-	handler.ServeHTTP(writer, req.WithContext(ctx))
+	t.Run("while proxying", func(t *testing.T) {
+		sent, upstreamCancelled := make(chan struct{}), make(chan struct{})
+		rt := pkgnet.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			close(sent)
+			<-r.Context().Done()
+			close(upstreamCancelled)
+			return nil, r.Context().Err()
+		})
+		handler := New(ctx, fakeThrottler{}, rt, false /*usePassthroughLb*/, logging.FromContext(ctx), false /* TLS */)
 
-	select {
-	case httpReq := <-interceptCh:
-		if got := httpReq.Header.Get(netheader.ProxyKey); got != activator.Name {
-			t.Errorf("Header %q = %q, want: %q", netheader.ProxyKey, got, activator.Name)
+		reqCtx, cancelReq := context.WithCancel(configStore.ToContext(context.Background()))
+		reqCtx = WithRevisionAndID(reqCtx, nil, types.NamespacedName{Namespace: testNamespace, Name: testRevName})
+		resp := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "http://example.com", nil).WithContext(reqCtx))
+		}()
+
+		<-sent
+		cancelReq()
+		select {
+		case <-upstreamCancelled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("The upstream request was not cancelled along with the client's")
 		}
-	case <-time.After(1 * time.Second):
-		t.Error("Timed out waiting for a request to be intercepted")
+		<-done
+		if resp.Code != statusClientClosedRequest {
+			t.Errorf("Code = %d, want: %d", resp.Code, statusClientClosedRequest)
+		}
+	})
+
+	t.Run("while waiting for capacity", func(t *testing.T) {
+		rt := pkgnet.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			t.Error("The cancelled request was proxied")
+			return nil, errors.New("unexpected request")
+		})
+		throttler := ctxThrottler{held: make(chan struct{})}
+		handler := New(ctx, throttler, rt, false /*usePassthroughLb*/, logging.FromContext(ctx), false /* TLS */)
+
+		reqCtx, cancelReq := context.WithCancel(configStore.ToContext(context.Background()))
+		reqCtx = WithRevisionAndID(reqCtx, nil, types.NamespacedName{Namespace: testNamespace, Name: testRevName})
+		resp := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "http://example.com", nil).WithContext(reqCtx))
+		}()
+
+		<-throttler.held
+		cancelReq()
+		<-done
+		if resp.Code != statusClientClosedRequest {
+			t.Errorf("Code = %d, want: %d", resp.Code, statusClientClosedRequest)
+		}
+	})
+}
+
+func TestActivationHandlerProxyHeader(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      map[string]string
+		wantName  string
+		wantValue string
+	}{{
+		name:      "default",
+		wantName:  netheader.ProxyKey,
+		wantValue: activator.Name,
+	}, {
+		name: "customized",
+		data: map[string]string{
+			deployment.ActivatorProxyHeaderNameKey:  "X-Knative-Proxy",
+			deployment.ActivatorProxyHeaderValueKey: "kn-activator",
+		},
+		wantName:  "X-Knative-Proxy",
+		wantValue: "kn-activator",
+	}, {
+		name:     "suppressed",
+		data:     map[string]string{deployment.ActivatorProxyHeaderNameKey: ""},
+		wantName: netheader.ProxyKey,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			interceptCh := make(chan *http.Request, 1)
+			rt := pkgnet.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				interceptCh <- r
+				fake := httptest.NewRecorder()
+				return fake.Result(), nil
+			})
+
+			ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
+			defer cancel()
+
+			handler := New(ctx, fakeThrottler{}, rt, false /*usePassthroughLb*/, logging.FromContext(ctx), false /* TLS */)
+
+			writer := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "http://example.com", nil)
+
+			// Set up config store to populate context.
+			configStore := setupConfigStore(t, logging.FromContext(ctx))
+			configStore.OnConfigChanged(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: deployment.ConfigName,
+				},
+				Data: tc.data,
+			})
+			ctx = configStore.ToContext(req.Context())
+			ctx = WithRevisionAndID(ctx, nil, types.NamespacedName{Namespace: testNamespace, Name: testRevName})
+
+			handler.ServeHTTP(writer, req.WithContext(ctx))
+
+			select {
+			case httpReq := <-interceptCh:
+				if got := httpReq.Header.Get(tc.wantName); got != tc.wantValue {
+					t.Errorf("Header %q = %q, want: %q", tc.wantName, got, tc.wantValue)
+				}
+			case <-time.After(1 * time.Second):
+				t.Error("Timed out waiting for a request to be intercepted")
+			}
+		})
 	}
 }
 
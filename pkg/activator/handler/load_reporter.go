@@ -0,0 +1,186 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opencensus.io/tag"
+	"k8s.io/apimachinery/pkg/types"
+	pkgmetrics "knative.dev/pkg/metrics"
+	"knative.dev/serving/pkg/activator"
+	"knative.dev/serving/pkg/apis/serving"
+	"knative.dev/serving/pkg/metrics"
+)
+
+// revisionLoad holds the number of requests of a revision currently in flight
+// and held, guarded by the LoadReporter's mutex.
+type revisionLoad struct {
+	reporterCtx context.Context
+	inFlight    int64
+	held        int64
+}
+
+// LoadReporter tracks the requests currently in flight through the activator
+// and the ones held waiting for a backend, and reports them as metrics.
+// The per-revision breakdown is limited to the maxRevisions revisions with the
+// most requests in flight, to bound the cardinality of the metrics.
+type LoadReporter struct {
+	podName      string
+	maxRevisions int
+	reporterCtx  context.Context
+
+	mux       sync.Mutex
+	inFlight  int64
+	held      int64
+	revisions map[types.NamespacedName]*revisionLoad
+
+	// reported holds the reporting contexts of the revisions reported by the
+	// last report, so they can be zeroed once they drop out of the report.
+	// It is only accessed by report, which is single-threaded.
+	reported map[types.NamespacedName]context.Context
+}
+
+// NewLoadReporter creates a LoadReporter reporting the load of at most
+// maxRevisions revisions individually.
+func NewLoadReporter(podName string, maxRevisions int) *LoadReporter {
+	// The only possible error is an invalid tag value, and the pod name is
+	// always a valid one.
+	reporterCtx, _ := tag.New(context.Background(),
+		tag.Upsert(metrics.PodKey, podName), tag.Upsert(metrics.ContainerKey, activator.Name))
+	return &LoadReporter{
+		podName:      podName,
+		maxRevisions: maxRevisions,
+		reporterCtx:  reporterCtx,
+		revisions:    make(map[types.NamespacedName]*revisionLoad),
+		reported:     make(map[types.NamespacedName]context.Context),
+	}
+}
+
+// update adds the given deltas to the load of the revision of the request
+// context.
+func (lr *LoadReporter) update(ctx context.Context, inFlight, held int64) {
+	key := RevIDFrom(ctx)
+
+	lr.mux.Lock()
+	defer lr.mux.Unlock()
+
+	load := lr.revisions[key]
+	if load == nil {
+		rev := RevisionFrom(ctx)
+		reporterCtx, _ := metrics.PodRevisionContext(lr.podName, activator.Name, key.Namespace,
+			rev.Labels[serving.ServiceLabelKey], rev.Labels[serving.ConfigurationLabelKey], key.Name)
+		load = &revisionLoad{reporterCtx: reporterCtx}
+		lr.revisions[key] = load
+	}
+	load.inFlight += inFlight
+	load.held += held
+	lr.inFlight += inFlight
+	lr.held += held
+
+	if load.inFlight == 0 && load.held == 0 {
+		delete(lr.revisions, key)
+	}
+}
+
+// hold marks the request of the given context as held waiting for a backend.
+// The returned function marks it as no longer held and is safe to call more
+// than once. It is safe to call on a nil LoadReporter.
+func (lr *LoadReporter) hold(ctx context.Context) func() {
+	if lr == nil {
+		return noop
+	}
+	lr.update(ctx, 0, 1)
+	released := false
+	return func() {
+		if !released {
+			released = true
+			lr.update(ctx, 0, -1)
+		}
+	}
+}
+
+// report records the current load as metrics.
+func (lr *LoadReporter) report() {
+	type keyedLoad struct {
+		key  types.NamespacedName
+		load revisionLoad
+	}
+
+	lr.mux.Lock()
+	inFlight, held := lr.inFlight, lr.held
+	loads := make([]keyedLoad, 0, len(lr.revisions))
+	for key, load := range lr.revisions {
+		loads = append(loads, keyedLoad{key: key, load: *load})
+	}
+	lr.mux.Unlock()
+
+	pkgmetrics.RecordBatch(lr.reporterCtx, inFlightRequestsM.M(inFlight), heldRequestsM.M(held))
+
+	sort.Slice(loads, func(i, j int) bool {
+		if loads[i].load.inFlight != loads[j].load.inFlight {
+			return loads[i].load.inFlight > loads[j].load.inFlight
+		}
+		if loads[i].load.held != loads[j].load.held {
+			return loads[i].load.held > loads[j].load.held
+		}
+		return loads[i].key.String() < loads[j].key.String()
+	})
+	if len(loads) > lr.maxRevisions {
+		loads = loads[:lr.maxRevisions]
+	}
+
+	previous := lr.reported
+	lr.reported = make(map[types.NamespacedName]context.Context, len(loads))
+	for _, l := range loads {
+		pkgmetrics.RecordBatch(l.load.reporterCtx,
+			revisionInFlightRequestsM.M(l.load.inFlight), revisionHeldRequestsM.M(l.load.held))
+		lr.reported[l.key] = l.load.reporterCtx
+		delete(previous, l.key)
+	}
+	for _, reporterCtx := range previous {
+		pkgmetrics.RecordBatch(reporterCtx, revisionInFlightRequestsM.M(0), revisionHeldRequestsM.M(0))
+	}
+}
+
+// Run reports the load every second until stopCh is closed.
+func (lr *LoadReporter) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(reportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			lr.report()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// Handler returns a handler that records the requests in flight.
+func (lr *LoadReporter) Handler(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lr.update(r.Context(), 1, 0)
+		defer lr.update(r.Context(), -1, 0)
+
+		next.ServeHTTP(w, r)
+	}
+}
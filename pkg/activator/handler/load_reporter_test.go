@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opencensus.io/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/metrics/metricstest"
+	pkgnet "knative.dev/pkg/network"
+	rtesting "knative.dev/pkg/reconciler/testing"
+	"knative.dev/serving/pkg/activator"
+	"knative.dev/serving/pkg/metrics"
+)
+
+func TestLoadReporter(t *testing.T) {
+	reset()
+	defer reset()
+
+	const podName = "the-best-activator"
+	lr := NewLoadReporter(podName, 1 /*maxRevisions*/)
+
+	ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
+	defer cancel()
+
+	rt := pkgnet.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return httptest.NewRecorder().Result(), nil
+	})
+	throttler := blockingThrottler{
+		held:    make(chan struct{}, 2),
+		release: make(chan struct{}),
+	}
+	// Requests of the busy revision are held by the throttler.
+	busy := lr.Handler(New(ctx, throttler, rt, false /*usePassthroughLb*/, logging.FromContext(ctx), false, /* TLS */
+		WithLoadReporter(lr)))
+
+	// Requests of the quiet revision are in flight without being held.
+	quietSeen, quietRelease := make(chan struct{}), make(chan struct{})
+	quiet := lr.Handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		quietSeen <- struct{}{}
+		<-quietRelease
+	}))
+
+	configStore := setupConfigStore(t, logging.FromContext(ctx))
+	busyRev, quietRev := revision(testNamespace, "busy"), revision(testNamespace, "quiet")
+	busyCtx := WithRevisionAndID(configStore.ToContext(ctx), busyRev, types.NamespacedName{Namespace: testNamespace, Name: busyRev.Name})
+	quietCtx := WithRevisionAndID(configStore.ToContext(ctx), quietRev, types.NamespacedName{Namespace: testNamespace, Name: quietRev.Name})
+
+	done := make(chan struct{}, 3)
+	for i := 0; i < 2; i++ {
+		go func() {
+			busy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil).WithContext(busyCtx))
+			done <- struct{}{}
+		}()
+	}
+	go func() {
+		quiet.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil).WithContext(quietCtx))
+		done <- struct{}{}
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-throttler.held:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for request to be held")
+		}
+	}
+	<-quietSeen
+
+	lr.report()
+
+	wantTags := map[string]string{
+		metrics.LabelPodName:       podName,
+		metrics.LabelContainerName: activator.Name,
+	}
+	busyResource := &resource.Resource{
+		Type: "knative_revision",
+		Labels: map[string]string{
+			metrics.LabelRevisionName:      busyRev.Name,
+			metrics.LabelNamespaceName:     testNamespace,
+			metrics.LabelServiceName:       "service-" + busyRev.Name,
+			metrics.LabelConfigurationName: "config-" + busyRev.Name,
+		},
+	}
+
+	// Only the revision with the most requests in flight is broken down.
+	metricstest.AssertMetric(t,
+		metricstest.IntMetric(inFlightRequestsM.Name(), 3, wantTags),
+		metricstest.IntMetric(heldRequestsM.Name(), 2, wantTags),
+		metricstest.IntMetric(revisionInFlightRequestsM.Name(), 2, wantTags).WithResource(busyResource),
+		metricstest.IntMetric(revisionHeldRequestsM.Name(), 2, wantTags).WithResource(busyResource))
+
+	close(throttler.release)
+	close(quietRelease)
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+
+	lr.report()
+
+	// The revision dropping out of the report is zeroed.
+	metricstest.AssertMetric(t,
+		metricstest.IntMetric(inFlightRequestsM.Name(), 0, wantTags),
+		metricstest.IntMetric(heldRequestsM.Name(), 0, wantTags),
+		metricstest.IntMetric(revisionInFlightRequestsM.Name(), 0, wantTags).WithResource(busyResource),
+		metricstest.IntMetric(revisionHeldRequestsM.Name(), 0, wantTags).WithResource(busyResource))
+}
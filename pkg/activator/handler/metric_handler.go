@@ -17,6 +17,8 @@ limitations under the License.
 package handler
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"time"
 
@@ -57,6 +59,9 @@ func (h *MetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			pkgmetrics.RecordBatch(reporterCtx, responseTimeInMsecM.M(float64(latency.Milliseconds())), requestCountM.M(1))
 			panic(err)
 		}
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			pkgmetrics.Record(reporterCtx, clientCancelledRequestCountM.M(1))
+		}
 		reporterCtx := metrics.AugmentWithResponse(reporterCtx, rr.ResponseCode)
 		pkgmetrics.RecordBatch(reporterCtx, responseTimeInMsecM.M(float64(latency.Milliseconds())), requestCountM.M(1))
 	}()
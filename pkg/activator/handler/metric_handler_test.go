@@ -120,8 +120,42 @@ func TestRequestMetricHandler(t *testing.T) {
 	}
 }
 
+func TestRequestMetricHandlerClientCancelled(t *testing.T) {
+	defer reset()
+	rev := revision(testNamespace, testRevName)
+	reqCtx, cancel := context.WithCancel(WithRevisionAndID(context.Background(), rev, types.NamespacedName{Namespace: testNamespace, Name: testRevName}))
+	handler := NewMetricHandler("testPod", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(statusClientClosedRequest)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil).WithContext(reqCtx))
+
+	wantResource := &resource.Resource{
+		Type: "knative_revision",
+		Labels: map[string]string{
+			metrics.LabelNamespaceName:     rev.Namespace,
+			metrics.LabelServiceName:       rev.Labels[serving.ServiceLabelKey],
+			metrics.LabelConfigurationName: rev.Labels[serving.ConfigurationLabelKey],
+			metrics.LabelRevisionName:      rev.Name,
+		},
+	}
+	metricstest.AssertMetric(t, metricstest.IntMetric(clientCancelledRequestCountM.Name(), 1, map[string]string{
+		metrics.LabelPodName:       "testPod",
+		metrics.LabelContainerName: activator.Name,
+	}).WithResource(wantResource))
+	// The request is recorded, but not as a successful one.
+	metricstest.AssertMetric(t, metricstest.IntMetric(requestCountM.Name(), 1, map[string]string{
+		metrics.LabelPodName:           "testPod",
+		metrics.LabelContainerName:     activator.Name,
+		metrics.LabelResponseCode:      strconv.Itoa(statusClientClosedRequest),
+		metrics.LabelResponseCodeClass: "4xx",
+	}).WithResource(wantResource))
+}
+
 func reset() {
-	metricstest.Unregister(requestConcurrencyM.Name(), requestCountM.Name(), responseTimeInMsecM.Name())
+	metricstest.Unregister(requestConcurrencyM.Name(), requestCountM.Name(), clientCancelledRequestCountM.Name(), responseTimeInMsecM.Name(),
+		inFlightRequestsM.Name(), heldRequestsM.Name(), revisionInFlightRequestsM.Name(), revisionHeldRequestsM.Name())
 	register()
 }
 
@@ -34,11 +34,32 @@ var (
 		"request_count",
 		"The number of requests that are routed to Activator",
 		stats.UnitDimensionless)
+	clientCancelledRequestCountM = stats.Int64(
+		"client_cancelled_request_count",
+		"The number of requests routed to Activator which the client cancelled before they were answered",
+		stats.UnitDimensionless)
 	responseTimeInMsecM = stats.Float64(
 		"request_latencies",
 		"The response time in millisecond",
 		stats.UnitMilliseconds)
 
+	inFlightRequestsM = stats.Int64(
+		"in_flight_requests",
+		"The number of requests currently in flight through the Activator",
+		stats.UnitDimensionless)
+	heldRequestsM = stats.Int64(
+		"held_requests",
+		"The number of requests currently held by the Activator waiting for a backend",
+		stats.UnitDimensionless)
+	revisionInFlightRequestsM = stats.Int64(
+		"revision_in_flight_requests",
+		"The number of requests of the revision currently in flight through the Activator",
+		stats.UnitDimensionless)
+	revisionHeldRequestsM = stats.Int64(
+		"revision_held_requests",
+		"The number of requests of the revision currently held by the Activator waiting for a backend",
+		stats.UnitDimensionless)
+
 	// NOTE: 0 should not be used as boundary. See
 	// https://github.com/census-ecosystem/opencensus-go-exporter-stackdriver/issues/98
 	defaultLatencyDistribution = view.Distribution(5, 10, 20, 40, 60, 80, 100, 150, 200, 250, 300, 350, 400, 450, 500, 600, 700, 800, 900, 1000, 2000, 5000, 10000, 20000, 50000, 100000)
@@ -65,12 +86,42 @@ func register() {
 			Aggregation: view.Count(),
 			TagKeys:     []tag.Key{metrics.PodKey, metrics.ContainerKey, metrics.ResponseCodeKey, metrics.ResponseCodeClassKey},
 		},
+		&view.View{
+			Description: "The number of requests routed to Activator which the client cancelled before they were answered",
+			Measure:     clientCancelledRequestCountM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{metrics.PodKey, metrics.ContainerKey},
+		},
 		&view.View{
 			Description: "The response time in millisecond",
 			Measure:     responseTimeInMsecM,
 			Aggregation: defaultLatencyDistribution,
 			TagKeys:     []tag.Key{metrics.PodKey, metrics.ContainerKey, metrics.ResponseCodeKey, metrics.ResponseCodeClassKey},
 		},
+		&view.View{
+			Description: "The number of requests currently in flight through the Activator",
+			Measure:     inFlightRequestsM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{metrics.PodKey, metrics.ContainerKey},
+		},
+		&view.View{
+			Description: "The number of requests currently held by the Activator waiting for a backend",
+			Measure:     heldRequestsM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{metrics.PodKey, metrics.ContainerKey},
+		},
+		&view.View{
+			Description: "The number of requests of the revision currently in flight through the Activator",
+			Measure:     revisionInFlightRequestsM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{metrics.PodKey, metrics.ContainerKey},
+		},
+		&view.View{
+			Description: "The number of requests of the revision currently held by the Activator waiting for a backend",
+			Measure:     revisionHeldRequestsM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{metrics.PodKey, metrics.ContainerKey},
+		},
 	); err != nil {
 		panic(err)
 	}
@@ -21,6 +21,7 @@ import (
 	"strconv"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	"knative.dev/networking/pkg/apis/networking"
@@ -92,6 +93,30 @@ func endpointsToDests(endpoints *corev1.Endpoints, portName string) (ready, notR
 	return ready, notReady
 }
 
+// endpointSliceToZones takes an endpoint slice and a port name and returns the
+// zones of the ready l4 dests in the endpoint slice if it has that port, keyed
+// by dest. Dests without a zone are omitted.
+func endpointSliceToZones(eps *discoveryv1.EndpointSlice, portName string) map[string]string {
+	zones := make(map[string]string)
+	for _, port := range eps.Ports {
+		if port.Name == nil || *port.Name != portName || port.Port == nil {
+			continue
+		}
+		portStr := strconv.Itoa(int(*port.Port))
+		for _, ep := range eps.Endpoints {
+			// A nil ready condition is to be interpreted as ready.
+			if ep.Zone == nil || (ep.Conditions.Ready != nil && !*ep.Conditions.Ready) {
+				continue
+			}
+			for _, addr := range ep.Addresses {
+				zones[net.JoinHostPort(addr, portStr)] = *ep.Zone
+			}
+		}
+		break
+	}
+	return zones
+}
+
 // getServicePort takes a service and a protocol and returns the port number of
 // the port named for that protocol. If the port is not found then ok is false.
 func getServicePort(protocol networking.ProtocolType, svc *corev1.Service) (int, bool) {
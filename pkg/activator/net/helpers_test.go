@@ -22,8 +22,10 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"knative.dev/networking/pkg/apis/networking"
+	"knative.dev/pkg/ptr"
 )
 
 func TestEndpointsToDests(t *testing.T) {
@@ -153,6 +155,38 @@ func TestEndpointsToDests(t *testing.T) {
 	}
 }
 
+func TestEndpointSliceToZones(t *testing.T) {
+	eps := &discoveryv1.EndpointSlice{
+		Endpoints: []discoveryv1.Endpoint{{
+			Addresses: []string{"128.0.0.1"},
+			Zone:      ptr.String("zone-a"),
+		}, {
+			Addresses:  []string{"128.0.0.2"},
+			Conditions: discoveryv1.EndpointConditions{Ready: ptr.Bool(true)},
+		}, {
+			Addresses:  []string{"128.0.0.3"},
+			Conditions: discoveryv1.EndpointConditions{Ready: ptr.Bool(false)},
+			Zone:       ptr.String("zone-a"),
+		}, {
+			Addresses:  []string{"128.0.0.4"},
+			Conditions: discoveryv1.EndpointConditions{Ready: ptr.Bool(true)},
+			Zone:       ptr.String("zone-b"),
+		}},
+		Ports: []discoveryv1.EndpointPort{{
+			Name: ptr.String(networking.ServicePortNameH2C),
+			Port: ptr.Int32(4321),
+		}, {
+			Name: ptr.String(networking.ServicePortNameHTTP1),
+			Port: ptr.Int32(1234),
+		}},
+	}
+
+	want := map[string]string{"128.0.0.1:1234": "zone-a", "128.0.0.4:1234": "zone-b"}
+	if got := endpointSliceToZones(eps, networking.ServicePortNameHTTP1); !cmp.Equal(got, want) {
+		t.Error("Got unexpected zones (-want, +got):", cmp.Diff(want, got))
+	}
+}
+
 func TestGetServicePort(t *testing.T) {
 	for _, tc := range []struct {
 		name     string
@@ -20,7 +20,9 @@ package net
 
 import (
 	"context"
+	"hash/fnv"
 	"math/rand"
+	"sort"
 	"sync"
 )
 
@@ -116,3 +118,80 @@ func newRoundRobinPolicy() lbPolicy {
 		return noop, nil
 	}
 }
+
+type lbKeyCtxKey struct{}
+
+// WithLoadBalancingKey returns a context making the throttler route the
+// request with the consistent-hash policy keyed on key.
+func WithLoadBalancingKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, lbKeyCtxKey{}, key)
+}
+
+// loadBalancingKeyFrom returns the consistent-hash key of the request, or
+// an empty string if it has none.
+func loadBalancingKeyFrom(ctx context.Context) string {
+	key, _ := ctx.Value(lbKeyCtxKey{}).(string)
+	return key
+}
+
+// consistentHashLBPolicy picks the target with the highest rendezvous hash of
+// the key and its dest, so that requests with the same key hit the same target
+// as long as it is available. When targets come and go, only the keys of the
+// removed targets, and the share of keys won by the new ones, move. If the
+// preferred target has no capacity right now, the next one in the key's order
+// is tried.
+func consistentHashLBPolicy(ctx context.Context, key string, targets []*podTracker) (func(), *podTracker) {
+	if len(targets) == 0 {
+		return noop, nil
+	}
+	// Finding the preferred target takes a single pass, which is all it takes
+	// as long as it has capacity.
+	best, bestScore := 0, rendezvousHash(key, targets[0].dest)
+	for i := 1; i < len(targets); i++ {
+		if score := rendezvousHash(key, targets[i].dest); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if cb, ok := targets[best].Reserve(ctx); ok {
+		return cb, targets[best]
+	}
+
+	// Otherwise the other targets are tried in the key's order.
+	type scoredTarget struct {
+		score   uint64
+		tracker *podTracker
+	}
+	scored := make([]scoredTarget, 0, len(targets)-1)
+	for i, t := range targets {
+		if i != best {
+			scored = append(scored, scoredTarget{score: rendezvousHash(key, t.dest), tracker: t})
+		}
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+
+	for _, s := range scored {
+		if cb, ok := s.tracker.Reserve(ctx); ok {
+			return cb, s.tracker
+		}
+	}
+	return noop, nil
+}
+
+// rendezvousHash returns the score of dest for key.
+func rendezvousHash(key, dest string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(dest))
+	// FNV mixes the last bytes poorly, and dests often only differ in those,
+	// so finish with the murmur3 finalizer.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
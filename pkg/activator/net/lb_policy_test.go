@@ -260,6 +260,79 @@ func TestRoundRobin(t *testing.T) {
 	})
 }
 
+func TestConsistentHash(t *testing.T) {
+	t.Run("same key same tracker", func(t *testing.T) {
+		podTrackers := makeTrackers(10, 0)
+		cb, want := consistentHashLBPolicy(context.Background(), "session-1", podTrackers)
+		cb()
+		for i := 0; i < 100; i++ {
+			cb, pt := consistentHashLBPolicy(context.Background(), "session-1", podTrackers)
+			cb()
+			if pt != want {
+				t.Fatalf("Tracker = %v, want: %v", pt, want)
+			}
+		}
+	})
+	t.Run("different keys distribute", func(t *testing.T) {
+		podTrackers := makeTrackers(10, 0)
+		counts := map[string]int{}
+		for i := 0; i < 1000; i++ {
+			cb, pt := consistentHashLBPolicy(context.Background(), fmt.Sprint("session-", i), podTrackers)
+			cb()
+			counts[pt.dest]++
+		}
+		for _, pt := range podTrackers {
+			// The expected count is 100, with a standard deviation of ~9.5.
+			if got := counts[pt.dest]; got < 50 || got > 150 {
+				t.Errorf("Tracker %v got %d of 1000 keys, want about 100", pt, got)
+			}
+		}
+	})
+	t.Run("removing a tracker only moves its keys", func(t *testing.T) {
+		podTrackers := makeTrackers(10, 0)
+		before := map[string]*podTracker{}
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprint("session-", i)
+			cb, pt := consistentHashLBPolicy(context.Background(), key, podTrackers)
+			cb()
+			before[key] = pt
+		}
+
+		removed := podTrackers[3]
+		remaining := append(podTrackers[:3:3], podTrackers[4:]...)
+		for key, was := range before {
+			cb, pt := consistentHashLBPolicy(context.Background(), key, remaining)
+			cb()
+			if was != removed && pt != was {
+				t.Errorf("Key %s moved from %v to %v", key, was, pt)
+			}
+		}
+	})
+	t.Run("full tracker falls back to the next one", func(t *testing.T) {
+		podTrackers := makeTrackers(3, 1)
+		releaseFirst, first := consistentHashLBPolicy(context.Background(), "session-1", podTrackers)
+		cb, second := consistentHashLBPolicy(context.Background(), "session-1", podTrackers)
+		t.Cleanup(cb)
+		if second == nil || second == first {
+			t.Fatalf("Tracker = %v, want one other than %v", second, first)
+		}
+		cb, _ = consistentHashLBPolicy(context.Background(), "session-1", podTrackers)
+		t.Cleanup(cb)
+		_, pt := consistentHashLBPolicy(context.Background(), "session-1", podTrackers)
+		if pt != nil {
+			t.Fatal("Wanted nil, got: ", pt)
+		}
+
+		// Once the preferred tracker frees up, it is picked again.
+		releaseFirst()
+		cb, pt = consistentHashLBPolicy(context.Background(), "session-1", podTrackers)
+		t.Cleanup(cb)
+		if pt != first {
+			t.Fatalf("Tracker = %v, want: %v", pt, first)
+		}
+	})
+}
+
 func BenchmarkPolicy(b *testing.B) {
 	for _, test := range []struct {
 		name   string
@@ -276,6 +349,11 @@ func BenchmarkPolicy(b *testing.B) {
 	}, {
 		name:   "round-robin",
 		policy: newRoundRobinPolicy(),
+	}, {
+		name: "consistent-hash",
+		policy: func(ctx context.Context, targets []*podTracker) (func(), *podTracker) {
+			return consistentHashLBPolicy(ctx, "session", targets)
+		},
 	}} {
 		for _, n := range []int{1, 2, 3, 10, 100} {
 			b.Run(fmt.Sprintf("%s-%d-trackers-sequential", test.name, n), func(b *testing.B) {
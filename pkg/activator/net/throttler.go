@@ -18,31 +18,43 @@ package net
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"sort"
 	"sync"
+	"time"
 
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	discoveryv1listers "k8s.io/client-go/listers/discovery/v1"
 	"k8s.io/client-go/tools/cache"
 
 	pkgnet "knative.dev/networking/pkg/apis/networking"
 	netcfg "knative.dev/networking/pkg/config"
 	endpointsinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/endpoints"
+	endpointsliceinformer "knative.dev/pkg/client/injection/kube/informers/discovery/v1/endpointslice"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/logging/logkey"
 	"knative.dev/pkg/reconciler"
+	"knative.dev/pkg/system"
+	activatorconfig "knative.dev/serving/pkg/activator/config"
 	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	revisioninformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/revision"
 	servinglisters "knative.dev/serving/pkg/client/listers/serving/v1"
+	"knative.dev/serving/pkg/deployment"
 	"knative.dev/serving/pkg/networking"
 	"knative.dev/serving/pkg/queue"
 )
@@ -61,6 +73,10 @@ const (
 	revisionMaxConcurrency = queue.MaxBreakerCapacity
 )
 
+// ErrColdStartQueueFull is returned when a request of a revision without
+// endpoints is rejected because the cold start queue of the revision is full.
+var ErrColdStartQueueFull = errors.New("cold start request queue is full")
+
 func newPodTracker(dest string, b breaker) *podTracker {
 	tracker := &podTracker{
 		dest: dest,
@@ -103,11 +119,11 @@ func (p *podTracker) Capacity() int {
 	return p.b.Capacity()
 }
 
-func (p *podTracker) UpdateConcurrency(c int) {
+func (p *podTracker) UpdateConcurrency(c int) error {
 	if p.b == nil {
-		return
+		return nil
 	}
-	p.b.UpdateConcurrency(c)
+	return p.b.UpdateConcurrency(c)
 }
 
 func (p *podTracker) Reserve(ctx context.Context) (func(), bool) {
@@ -120,7 +136,7 @@ func (p *podTracker) Reserve(ctx context.Context) (func(), bool) {
 type breaker interface {
 	Capacity() int
 	Maybe(ctx context.Context, thunk func()) error
-	UpdateConcurrency(int)
+	UpdateConcurrency(int) error
 	Reserve(ctx context.Context) (func(), bool)
 }
 
@@ -147,6 +163,12 @@ type revisionThrottler struct {
 	// therefore need to recalculate capacity
 	backendCount int
 
+	// hasBackends is whether the revision currently has backends, read on the
+	// request path, and coldStartQueued the number of requests waiting for a
+	// dest which arrived while it had none.
+	hasBackends     atomic.Bool
+	coldStartQueued atomic.Int32
+
 	// This is a breaker for the revision as a whole.
 	breaker breaker
 
@@ -157,6 +179,14 @@ type revisionThrottler struct {
 	// This is a subset of podTrackers.
 	assignedTrackers []*podTracker
 
+	// The assigned trackers in the zone of this Activator, preferred if
+	// configured so. This is a subset of assignedTrackers.
+	localTrackers []*podTracker
+
+	// localDests are the dests in the zone of this Activator. They are only
+	// accessed by the goroutine handling the updates.
+	localDests sets.Set[string]
+
 	// If we don't have a healthy clusterIPTracker this is set to nil, otherwise
 	// it is the l4dest for this revision's private clusterIP.
 	clusterIPTracker *podTracker
@@ -212,19 +242,63 @@ func (rt *revisionThrottler) acquireDest(ctx context.Context) (func(), *podTrack
 	if rt.clusterIPTracker != nil {
 		return noop, rt.clusterIPTracker
 	}
+	if key := loadBalancingKeyFrom(ctx); key != "" {
+		return consistentHashLBPolicy(ctx, key, rt.assignedTrackers)
+	}
+	if cfg := activatorconfig.FromContext(ctx); cfg != nil && cfg.PreferLocalZone && len(rt.localTrackers) > 0 {
+		if cb, tracker := rt.lbPolicy(ctx, rt.localTrackers); tracker != nil {
+			return cb, tracker
+		}
+	}
 	return rt.lbPolicy(ctx, rt.assignedTrackers)
 }
 
 func (rt *revisionThrottler) try(ctx context.Context, function func(string) error) error {
+	var (
+		retryInterval, maxWait time.Duration
+		coldStartQueueLength   int
+	)
+	if cfg := activatorconfig.FromContext(ctx); cfg != nil {
+		retryInterval, maxWait = cfg.EndpointsRetryInterval, cfg.EndpointsMaxWait
+		coldStartQueueLength = cfg.ColdStartQueueLength
+	}
+
+	// Bound the requests queued while the revision has no backends, e.g. when
+	// scaling from zero, independently of the breaker's queue depth.
+	dequeue := noop
+	if coldStartQueueLength > 0 && !rt.hasBackends.Load() {
+		if int(rt.coldStartQueued.Inc()) > coldStartQueueLength {
+			rt.coldStartQueued.Dec()
+			return ErrColdStartQueueFull
+		}
+		var once sync.Once
+		dequeue = func() { once.Do(func() { rt.coldStartQueued.Dec() }) }
+		defer dequeue()
+	}
+
+	// Bound the time spent waiting for a dest, but not the one spent in function.
+	waitCtx := ctx
+	if maxWait > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, maxWait)
+		defer cancel()
+	}
+	waitErr := func(err error) error {
+		if maxWait > 0 && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("no endpoint of revision %s became available within %v: %w", rt.revID, maxWait, err)
+		}
+		return err
+	}
+
 	var ret error
 
-	// Retrying infinitely as long as we receive no dest. Outer semaphore and inner
+	// Retrying as long as we receive no dest. Outer semaphore and inner
 	// pod capacity are not changed atomically, hence they can race each other. We
 	// "reenqueue" requests should that happen.
 	reenqueue := true
 	for reenqueue {
 		reenqueue = false
-		if err := rt.breaker.Maybe(ctx, func() {
+		if err := rt.breaker.Maybe(waitCtx, func() {
 			cb, tracker := rt.acquireDest(ctx)
 			if tracker == nil {
 				// This can happen if individual requests raced each other or if pod
@@ -233,10 +307,19 @@ func (rt *revisionThrottler) try(ctx context.Context, function func(string) erro
 				return
 			}
 			defer cb()
+			// The request is no longer queued once it has a dest.
+			dequeue()
 			// We already reserved a guaranteed spot. So just execute the passed functor.
 			ret = function(tracker.dest)
 		}); err != nil {
-			return err
+			return waitErr(err)
+		}
+		if reenqueue && retryInterval > 0 {
+			select {
+			case <-waitCtx.Done():
+				return waitErr(waitCtx.Err())
+			case <-time.After(retryInterval):
+			}
 		}
 	}
 	return ret
@@ -279,7 +362,9 @@ func (rt *revisionThrottler) resetTrackers() {
 	}
 	for _, t := range rt.podTrackers {
 		// Reset to default.
-		t.UpdateConcurrency(rt.containerConcurrency)
+		if err := t.UpdateConcurrency(rt.containerConcurrency); err != nil {
+			rt.logger.Errorw("Failed to reset the pod tracker capacity", zap.Error(err))
+		}
 	}
 }
 
@@ -312,10 +397,17 @@ func (rt *revisionThrottler) updateCapacity(backendCount int) {
 			assigned = assignSlice(rt.podTrackers, ai, ac, rt.containerConcurrency)
 		}
 		rt.logger.Debugf("Trackers %d/%d: assignment: %v", ai, ac, assigned)
+		var local []*podTracker
+		for _, t := range assigned {
+			if rt.localDests.Has(t.dest) {
+				local = append(local, t)
+			}
+		}
 		// The actual write out of the assigned trackers has to be under lock.
 		rt.mux.Lock()
 		defer rt.mux.Unlock()
 		rt.assignedTrackers = assigned
+		rt.localTrackers = local
 		return len(assigned)
 	}()
 
@@ -324,7 +416,10 @@ func (rt *revisionThrottler) updateCapacity(backendCount int) {
 		capacity, backendCount, ai, ac)
 
 	rt.backendCount = backendCount
-	rt.breaker.UpdateConcurrency(capacity)
+	rt.hasBackends.Store(backendCount > 0)
+	if err := rt.breaker.UpdateConcurrency(capacity); err != nil {
+		rt.logger.Errorw("Failed to update the revision capacity", zap.Error(err))
+	}
 }
 
 func (rt *revisionThrottler) updateThrottlerState(backendCount int, trackers []*podTracker, clusterIPDest *podTracker) {
@@ -452,20 +547,26 @@ type Throttler struct {
 	revisionThrottlers      map[types.NamespacedName]*revisionThrottler
 	revisionThrottlersMutex sync.RWMutex
 	revisionLister          servinglisters.RevisionLister
-	ipAddress               string // The IP address of this activator.
+	ipAddress               string      // The IP address of this activator.
+	preferLocalZone         atomic.Bool // Whether the pods in the zone of this activator are preferred.
+	lazyShrink              atomic.Bool // Whether the revision breakers shrink lazily.
+	endpointsLister         corev1listers.EndpointsLister
+	endpointSliceLister     discoveryv1listers.EndpointSliceLister // Tells the zones of the pods and of this activator.
 	logger                  *zap.SugaredLogger
 	epsUpdateCh             chan *corev1.Endpoints
 }
 
-// NewThrottler creates a new Throttler
+// NewThrottler creates a new Throttler.
 func NewThrottler(ctx context.Context, ipAddr string) *Throttler {
 	revisionInformer := revisioninformer.Get(ctx)
 	t := &Throttler{
-		revisionThrottlers: make(map[types.NamespacedName]*revisionThrottler),
-		revisionLister:     revisionInformer.Lister(),
-		ipAddress:          ipAddr,
-		logger:             logging.FromContext(ctx),
-		epsUpdateCh:        make(chan *corev1.Endpoints),
+		revisionThrottlers:  make(map[types.NamespacedName]*revisionThrottler),
+		revisionLister:      revisionInformer.Lister(),
+		ipAddress:           ipAddr,
+		endpointsLister:     endpointsinformer.Get(ctx).Lister(),
+		endpointSliceLister: endpointsliceinformer.Get(ctx).Lister(),
+		logger:              logging.FromContext(ctx),
+		epsUpdateCh:         make(chan *corev1.Endpoints),
 	}
 
 	// Watch revisions to create throttler with backlog immediately and delete
@@ -513,6 +614,25 @@ func (t *Throttler) run(updateCh <-chan revisionDestsUpdate) {
 	}
 }
 
+// UpdateConfig applies the settings of the activator which take effect
+// outside of the requests. The revisions pick up a change of PreferLocalZone
+// with their next endpoints update.
+func (t *Throttler) UpdateConfig(cfg *deployment.ActivatorConfig) {
+	t.preferLocalZone.Store(cfg.PreferLocalZone)
+	// The revision throttlers created from now on pick up the new policy, the
+	// existing ones are updated below.
+	lazy := cfg.CapacityShrinkPolicy == deployment.ShrinkPolicyLazy
+	t.lazyShrink.Store(lazy)
+
+	t.revisionThrottlersMutex.RLock()
+	defer t.revisionThrottlersMutex.RUnlock()
+	for _, rt := range t.revisionThrottlers {
+		if b, ok := rt.breaker.(*queue.Breaker); ok {
+			b.SetLazyShrink(lazy)
+		}
+	}
+}
+
 // Try waits for capacity and then executes function, passing in a l4 dest to send a request
 func (t *Throttler) Try(ctx context.Context, revID types.NamespacedName, function func(string) error) error {
 	rt, err := t.getOrCreateRevisionThrottler(revID)
@@ -522,6 +642,15 @@ func (t *Throttler) Try(ctx context.Context, revID types.NamespacedName, functio
 	return rt.try(ctx, function)
 }
 
+// HasBackends returns whether the revision currently has backends to proxy its
+// requests to. Revisions this Throttler doesn't know of have none.
+func (t *Throttler) HasBackends(revID types.NamespacedName) bool {
+	t.revisionThrottlersMutex.RLock()
+	rt, ok := t.revisionThrottlers[revID]
+	t.revisionThrottlersMutex.RUnlock()
+	return ok && rt.hasBackends.Load()
+}
+
 func (t *Throttler) getOrCreateRevisionThrottler(revID types.NamespacedName) (*revisionThrottler, error) {
 	// First, see if we can succeed with just an RLock. This is in the request path so optimizing
 	// for this case is important
@@ -545,7 +674,11 @@ func (t *Throttler) getOrCreateRevisionThrottler(revID types.NamespacedName) (*r
 			revID,
 			int(rev.Spec.GetContainerConcurrency()),
 			pkgnet.ServicePortName(rev.GetProtocol()),
-			queue.BreakerParams{QueueDepth: breakerQueueDepth, MaxConcurrency: revisionMaxConcurrency},
+			queue.BreakerParams{
+				QueueDepth:     breakerQueueDepth,
+				MaxConcurrency: revisionMaxConcurrency,
+				LazyShrink:     t.lazyShrink.Load(),
+			},
 			t.logger,
 		)
 		t.revisionThrottlers[revID] = revThrottler
@@ -593,10 +726,64 @@ func (t *Throttler) handleUpdate(update revisionDestsUpdate) {
 			t.logger.Errorw("Failed to get revision throttler", zap.Error(err), zap.String(logkey.Key, update.Rev.String()))
 		}
 	} else {
+		// Telling the pods in the zone of this activator takes endpoint slice
+		// lookups, only done when they are preferred.
+		if update.ClusterIPDest == "" && t.preferLocalZone.Load() {
+			rt.localDests = t.localDests(update.Rev, rt.protocol)
+		} else {
+			rt.localDests = nil
+		}
 		rt.handleUpdate(update)
 	}
 }
 
+// zone returns the zone of this activator, as recorded in the endpoint slices
+// of the activator service, or an empty string if unknown.
+func (t *Throttler) zone() string {
+	eps, err := t.endpointSliceLister.EndpointSlices(system.Namespace()).List(labels.SelectorFromSet(labels.Set{
+		discoveryv1.LabelServiceName: networking.ActivatorServiceName,
+	}))
+	if err != nil {
+		t.logger.Errorw("Failed to list the activator endpoint slices", zap.Error(err))
+		return ""
+	}
+	for _, ep := range eps {
+		for _, e := range ep.Endpoints {
+			if e.Zone != nil && slices.Contains(e.Addresses, t.ipAddress) {
+				return *e.Zone
+			}
+		}
+	}
+	return ""
+}
+
+// localDests returns the ready dests of the given revision which are in the
+// zone of this activator. It is empty if the zone of this activator is not
+// known.
+func (t *Throttler) localDests(rev types.NamespacedName, portName string) sets.Set[string] {
+	zone := t.zone()
+	if zone == "" {
+		return nil
+	}
+	eps, err := t.endpointSliceLister.EndpointSlices(rev.Namespace).List(labels.SelectorFromSet(labels.Set{
+		serving.RevisionLabelKey:  rev.Name,
+		networking.ServiceTypeKey: string(networking.ServiceTypePrivate),
+	}))
+	if err != nil {
+		t.logger.Errorw("Failed to list endpoint slices", zap.Error(err), zap.String(logkey.Key, rev.String()))
+		return nil
+	}
+	local := sets.New[string]()
+	for _, ep := range eps {
+		for dest, z := range endpointSliceToZones(ep, portName) {
+			if z == zone {
+				local.Insert(dest)
+			}
+		}
+	}
+	return local
+}
+
 func (t *Throttler) handlePubEpsUpdate(eps *corev1.Endpoints) {
 	t.logger.Infof("Public EPS updates: %#v", eps)
 
@@ -727,7 +914,7 @@ func zeroOrOne(x int) int32 {
 }
 
 // UpdateConcurrency sets the concurrency of the breaker
-func (ib *infiniteBreaker) UpdateConcurrency(cc int) {
+func (ib *infiniteBreaker) UpdateConcurrency(cc int) error {
 	rcc := zeroOrOne(cc)
 	// We lock here to make sure two scale up events don't
 	// stomp on each other's feet.
@@ -744,6 +931,7 @@ func (ib *infiniteBreaker) UpdateConcurrency(cc int) {
 			close(ib.broadcast)
 		}
 	}
+	return nil
 }
 
 // Maybe executes thunk when capacity is available
@@ -20,14 +20,17 @@ import (
 	"context"
 	"errors"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/google/go-cmp/cmp"
+	"go.uber.org/atomic"
 	"golang.org/x/sync/errgroup"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -36,13 +39,18 @@ import (
 	pkgnet "knative.dev/networking/pkg/apis/networking"
 	fakekubeclient "knative.dev/pkg/client/injection/kube/client/fake"
 	fakeendpointsinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/endpoints/fake"
+	fakeendpointsliceinformer "knative.dev/pkg/client/injection/kube/informers/discovery/v1/endpointslice/fake"
 	. "knative.dev/pkg/logging/testing"
+	"knative.dev/pkg/ptr"
 	rtesting "knative.dev/pkg/reconciler/testing"
+	"knative.dev/pkg/system"
+	activatorconfig "knative.dev/serving/pkg/activator/config"
 	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	fakeservingclient "knative.dev/serving/pkg/client/injection/client/fake"
 	revisioninformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/revision"
 	fakerevisioninformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/revision/fake"
+	"knative.dev/serving/pkg/deployment"
 	"knative.dev/serving/pkg/networking"
 	"knative.dev/serving/pkg/queue"
 )
@@ -607,6 +615,216 @@ func trackerDestSet(ts []*podTracker) sets.Set[string] {
 	return ret
 }
 
+func TestThrottlerEndpointsWait(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         map[string]string
+		endpointsAt  int // The attempt at which an endpoint shows up, zero for never.
+		wantErr      string
+		minAttempts  int
+		maxAttempts  int
+		minElapsed   time.Duration
+		wantDeadline bool
+	}{{
+		name: "endpoint shows up",
+		data: map[string]string{
+			deployment.ActivatorEndpointsRetryIntervalKey: "20ms",
+			deployment.ActivatorEndpointsMaxWaitKey:       "10s",
+		},
+		endpointsAt: 3,
+		minAttempts: 3,
+		maxAttempts: 3,
+		minElapsed:  40 * time.Millisecond,
+	}, {
+		name: "max wait exceeded",
+		data: map[string]string{
+			deployment.ActivatorEndpointsRetryIntervalKey: "20ms",
+			deployment.ActivatorEndpointsMaxWaitKey:       "110ms",
+		},
+		wantErr:      "no endpoint of revision " + testNamespace + "/" + testRevision + " became available within 110ms",
+		minAttempts:  2,
+		maxAttempts:  6,
+		minElapsed:   110 * time.Millisecond,
+		wantDeadline: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := TestLogger(t)
+			revName := types.NamespacedName{Namespace: testNamespace, Name: testRevision}
+			rt := newRevisionThrottler(revName, 1 /*cc*/, pkgnet.ServicePortNameHTTP1,
+				queue.BreakerParams{QueueDepth: 10, MaxConcurrency: 10, InitialCapacity: 1}, logger)
+
+			// The breaker admits the request, but the revision has no endpoint
+			// until the given attempt.
+			var attempts atomic.Int32
+			rt.lbPolicy = func(context.Context, []*podTracker) (func(), *podTracker) {
+				if n := attempts.Inc(); test.endpointsAt == 0 || int(n) < test.endpointsAt {
+					return noop, nil
+				}
+				return noop, newPodTracker("10.0.0.1:8012", nil)
+			}
+
+			store := activatorconfig.NewStore(logger)
+			store.OnConfigChanged(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: deployment.ConfigName},
+				Data:       test.data,
+			})
+			ctx := store.ToContext(context.Background())
+
+			var gotDest string
+			start := time.Now()
+			err := rt.try(ctx, func(dest string) error {
+				gotDest = dest
+				return nil
+			})
+			elapsed := time.Since(start)
+
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatal("try() =", err)
+				}
+				if gotDest != "10.0.0.1:8012" {
+					t.Errorf("dest = %q, want: %q", gotDest, "10.0.0.1:8012")
+				}
+			} else if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("try() = %v, wanted an error containing %q", err, test.wantErr)
+			}
+			if got := errors.Is(err, context.DeadlineExceeded); got != test.wantDeadline {
+				t.Errorf("errors.Is(err, context.DeadlineExceeded) = %v, want: %v", got, test.wantDeadline)
+			}
+			if got := int(attempts.Load()); got < test.minAttempts || got > test.maxAttempts {
+				t.Errorf("attempts = %d, want between %d and %d", got, test.minAttempts, test.maxAttempts)
+			}
+			if elapsed < test.minElapsed {
+				t.Errorf("elapsed = %v, want at least %v", elapsed, test.minElapsed)
+			}
+		})
+	}
+}
+
+func TestThrottlerColdStartQueueLength(t *testing.T) {
+	const (
+		queueLength = 3
+		burst       = 5
+	)
+	logger := TestLogger(t)
+	revName := types.NamespacedName{Namespace: testNamespace, Name: testRevision}
+	rt := newRevisionThrottler(revName, 0 /*cc*/, pkgnet.ServicePortNameHTTP1,
+		queue.BreakerParams{QueueDepth: breakerQueueDepth, MaxConcurrency: revisionMaxConcurrency}, logger)
+
+	store := activatorconfig.NewStore(logger)
+	store.OnConfigChanged(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: deployment.ConfigName},
+		Data:       map[string]string{deployment.ActivatorColdStartQueueLengthKey: strconv.Itoa(queueLength)},
+	})
+	ctx := store.ToContext(context.Background())
+
+	// A burst of requests arrives while the revision is still scaling from
+	// zero, so they all wait for a dest.
+	errs := make(chan error, burst)
+	for i := 0; i < burst; i++ {
+		go func() {
+			errs <- rt.try(ctx, func(string) error { return nil })
+		}()
+	}
+
+	// The excess requests are shed right away.
+	for i := 0; i < burst-queueLength; i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrColdStartQueueFull) {
+				t.Fatalf("try() = %v, want: %v", err, ErrColdStartQueueFull)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Excess requests were not shed")
+		}
+	}
+	select {
+	case err := <-errs:
+		t.Fatal("Queued request returned before the revision had a backend:", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The queued requests are served once the backend is up.
+	rt.updateThrottlerState(1, []*podTracker{newPodTracker("10.0.0.1:8012", nil)}, nil)
+	for i := 0; i < queueLength; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatal("try() =", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Queued requests were not served")
+		}
+	}
+
+	// Requests aren't limited by the cold start queue once there's a backend.
+	if got := rt.coldStartQueued.Load(); got != 0 {
+		t.Errorf("coldStartQueued = %d, want: 0", got)
+	}
+	for i := 0; i < burst; i++ {
+		if err := rt.try(ctx, func(string) error { return nil }); err != nil {
+			t.Fatal("try() =", err)
+		}
+	}
+}
+
+func TestThrottlerCapacityShrinkPolicy(t *testing.T) {
+	ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
+	defer cancel()
+
+	revA := types.NamespacedName{Namespace: testNamespace, Name: "rev-a"}
+	revB := types.NamespacedName{Namespace: testNamespace, Name: "rev-b"}
+	for _, revID := range []types.NamespacedName{revA, revB} {
+		fakerevisioninformer.Get(ctx).Informer().GetIndexer().Add(revisionCC1(revID, pkgnet.ProtocolHTTP1))
+	}
+	throttler := NewThrottler(ctx, "130.0.0.2")
+	lazyShrink := func(revID types.NamespacedName) bool {
+		rt, err := throttler.getOrCreateRevisionThrottler(revID)
+		if err != nil {
+			t.Fatal("RevisionThrottler can't be found:", err)
+		}
+		return rt.breaker.(*queue.Breaker).Params().LazyShrink
+	}
+	if lazyShrink(revA) {
+		t.Error("LazyShrink = true with the graceful policy")
+	}
+
+	// The configured policy applies to the existing revisions right away, and
+	// to the ones created afterwards.
+	throttler.UpdateConfig(&deployment.ActivatorConfig{CapacityShrinkPolicy: deployment.ShrinkPolicyLazy})
+	for _, revID := range []types.NamespacedName{revA, revB} {
+		if !lazyShrink(revID) {
+			t.Errorf("LazyShrink(%v) = false with the lazy policy", revID)
+		}
+	}
+}
+
+func TestThrottlerHasBackends(t *testing.T) {
+	logger := TestLogger(t)
+	revName := types.NamespacedName{Namespace: testNamespace, Name: testRevision}
+
+	ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
+	defer cancel()
+
+	throttler := newTestThrottler(ctx)
+	if throttler.HasBackends(revName) {
+		t.Error("HasBackends() = true for an unknown revision, want false")
+	}
+
+	rt := newRevisionThrottler(revName, 0 /*cc*/, pkgnet.ServicePortNameHTTP1, testBreakerParams, logger)
+	throttler.revisionThrottlers[revName] = rt
+	if throttler.HasBackends(revName) {
+		t.Error("HasBackends() = true for a revision scaled to zero, want false")
+	}
+
+	throttler.handleUpdate(revisionDestsUpdate{Rev: revName, Dests: sets.New("ip0")})
+	if !throttler.HasBackends(revName) {
+		t.Error("HasBackends() = false for a revision with a backend, want true")
+	}
+}
+
 func TestPodAssignmentFinite(t *testing.T) {
 	// An e2e verification test of pod assignment and capacity
 	// computations.
@@ -661,6 +879,44 @@ func TestPodAssignmentFinite(t *testing.T) {
 	}
 }
 
+func TestAcquireDestConsistentHash(t *testing.T) {
+	logger := TestLogger(t)
+	revName := types.NamespacedName{Namespace: testNamespace, Name: testRevision}
+
+	ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
+	defer cancel()
+
+	throttler := newTestThrottler(ctx)
+	rt := newRevisionThrottler(revName, 0 /*cc*/, pkgnet.ServicePortNameHTTP1, testBreakerParams, logger)
+	throttler.revisionThrottlers[revName] = rt
+	throttler.handleUpdate(revisionDestsUpdate{
+		Rev:   revName,
+		Dests: sets.New("ip1", "ip2", "ip3", "ip4", "ip5"),
+	})
+
+	keyCtx := WithLoadBalancingKey(context.Background(), "session-1")
+	cb, want := rt.acquireDest(keyCtx)
+	cb()
+	for i := 0; i < 20; i++ {
+		cb, got := rt.acquireDest(keyCtx)
+		cb()
+		if got != want {
+			t.Fatalf("acquireDest() = %v, want: %v", got, want)
+		}
+	}
+
+	// Requests without a key are spread by the default policy.
+	dests := sets.New[string]()
+	for i := 0; i < 100; i++ {
+		cb, got := rt.acquireDest(context.Background())
+		cb()
+		dests.Insert(got.dest)
+	}
+	if dests.Len() < 2 {
+		t.Errorf("acquireDest() without key only picked %v", sets.List(dests))
+	}
+}
+
 func TestPodAssignmentInfinite(t *testing.T) {
 	logger := TestLogger(t)
 	revName := types.NamespacedName{Namespace: testNamespace, Name: testRevision}
@@ -897,6 +1153,107 @@ func TestMultipleActivators(t *testing.T) {
 	}
 }
 
+func TestThrottlerPreferLocalZone(t *testing.T) {
+	ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
+	defer cancel()
+
+	revID := types.NamespacedName{Namespace: testNamespace, Name: testRevision}
+	fakerevisioninformer.Get(ctx).Informer().GetIndexer().Add(revisionCC1(revID, pkgnet.ProtocolHTTP1))
+	fakeendpointsliceinformer.Get(ctx).Informer().GetIndexer().Add(&discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testRevision + "-private-abcde",
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				networking.ServiceTypeKey: string(networking.ServiceTypePrivate),
+				serving.RevisionLabelKey:  testRevision,
+			},
+		},
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"128.0.0.1"}, Zone: ptr.String("zone-b")},
+			{Addresses: []string{"128.0.0.2"}, Zone: ptr.String("zone-a")},
+		},
+		Ports: []discoveryv1.EndpointPort{{Name: ptr.String(pkgnet.ServicePortNameHTTP1), Port: ptr.Int32(1234)}},
+	})
+
+	tests := []struct {
+		name   string
+		zone   string // The zone of the activator, unknown if empty.
+		prefer bool
+		// The dests of consecutive requests, each pod having room for one.
+		want []string
+	}{{
+		name:   "local zone preferred, then other zones",
+		zone:   "zone-a",
+		prefer: true,
+		want:   []string{"128.0.0.2:1234", "128.0.0.1:1234"},
+	}, {
+		name:   "no local endpoints",
+		zone:   "zone-c",
+		prefer: true,
+		want:   []string{"128.0.0.1:1234", "128.0.0.2:1234"},
+	}, {
+		name:   "unknown zone",
+		prefer: true,
+		want:   []string{"128.0.0.1:1234", "128.0.0.2:1234"},
+	}, {
+		name: "not preferred",
+		zone: "zone-a",
+		want: []string{"128.0.0.1:1234", "128.0.0.2:1234"},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := activatorconfig.NewStore(TestLogger(t))
+			store.OnConfigChanged(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: deployment.ConfigName},
+				Data:       map[string]string{deployment.ActivatorPreferLocalZoneKey: strconv.FormatBool(tc.prefer)},
+			})
+			reqCtx := store.ToContext(context.Background())
+
+			// The zone of the activator is the one of its endpoint.
+			activatorEndpoint := discoveryv1.Endpoint{Addresses: []string{"130.0.0.2"}}
+			if tc.zone != "" {
+				activatorEndpoint.Zone = ptr.String(tc.zone)
+			}
+			fakeendpointsliceinformer.Get(ctx).Informer().GetIndexer().Add(&discoveryv1.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      networking.ActivatorServiceName + "-abcde",
+					Namespace: system.Namespace(),
+					Labels:    map[string]string{discoveryv1.LabelServiceName: networking.ActivatorServiceName},
+				},
+				Endpoints: []discoveryv1.Endpoint{activatorEndpoint},
+			})
+
+			throttler := NewThrottler(ctx, "130.0.0.2")
+			throttler.UpdateConfig(&activatorconfig.FromContext(reqCtx).ActivatorConfig)
+			throttler.handleUpdate(revisionDestsUpdate{
+				Rev:   revID,
+				Dests: sets.New("128.0.0.1:1234", "128.0.0.2:1234"),
+			})
+			rt, err := throttler.getOrCreateRevisionThrottler(revID)
+			if err != nil {
+				t.Fatal("RevisionThrottler can't be found:", err)
+			}
+			if !tc.prefer && rt.localDests != nil {
+				t.Errorf("localDests = %v, want none to be looked up", rt.localDests)
+			}
+
+			var got []string
+			for range tc.want {
+				cb, tracker := rt.acquireDest(reqCtx)
+				if tracker == nil {
+					t.Fatal("No dest acquired")
+				}
+				defer cb()
+				got = append(got, tracker.dest)
+			}
+			if !cmp.Equal(got, tc.want) {
+				t.Errorf("Dests = %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestInfiniteBreakerCreation(t *testing.T) {
 	// This test verifies that we use infiniteBreaker when CC==0.
 	tttl := newRevisionThrottler(types.NamespacedName{Namespace: "a", Name: "b"}, 0, /*cc*/
@@ -49,6 +49,11 @@ const (
 
 	// AllowHTTPFullDuplexFeatureKey gates the use of http1 full duplex per workload
 	AllowHTTPFullDuplexFeatureKey = "features.knative.dev/http-full-duplex"
+
+	// UpstreamProtocolDetectionFeatureKey overrides per workload whether the
+	// queue proxy detects the protocol of the user container, with the value
+	// 'enabled' or 'disabled'
+	UpstreamProtocolDetectionFeatureKey = "features.knative.dev/upstream-protocol-detection"
 )
 
 func defaultFeaturesConfig() *Features {
@@ -268,6 +268,8 @@ func PodSpecMask(ctx context.Context, in *corev1.PodSpec) *corev1.PodSpec {
 	// This list is unnecessary, but added here for clarity
 	out.RestartPolicy = ""
 	out.TerminationGracePeriodSeconds = nil
+	// Revision pods are managed by a Deployment, whose pod template the API
+	// server rejects with an active deadline.
 	out.ActiveDeadlineSeconds = nil
 	out.NodeName = ""
 	out.HostNetwork = false
@@ -40,6 +40,20 @@ const (
 	// from automatically deleting the revision.
 	RevisionPreservedAnnotationKey = GroupName + "/no-gc"
 
+	// RevisionReconcilePausedAnnotationKey is the annotation key used for pausing
+	// the reconciliation of the resources owned by a Revision.
+	RevisionReconcilePausedAnnotationKey = GroupName + "/reconcile-paused"
+
+	// DeploymentPausedAnnotationKey is the annotation key used for creating
+	// and keeping the Deployment of a Revision paused, e.g. for staged rollouts.
+	DeploymentPausedAnnotationKey = GroupName + "/deployment-paused"
+
+	// ImageLabelsAnnotationDomain is the domain of the Revision status annotation
+	// keys holding the exported labels of its container images. The keys are
+	// prefixed with the container name and suffixed with the label name, e.g.
+	// `user-container.image-labels.serving.knative.dev/org.opencontainers.image.revision`.
+	ImageLabelsAnnotationDomain = "image-labels." + GroupName
+
 	// RouteLabelKey is the label key attached to a Configuration indicating by
 	// which Route it is configured as traffic target.
 	// The key is also attached to Revision resources to indicate they are directly
@@ -137,6 +151,29 @@ const (
 	// QueueSidecarEphemeralStorageResourceLimitAnnotationKey is the explicit value of the ephemeral storage limit for queue-proxy's limit resources
 	QueueSidecarEphemeralStorageResourceLimitAnnotationKey = "queue.sidecar." + GroupName + "/ephemeral-storage-resource-limit"
 
+	// QueueSidecarOverloadStatusCodeAnnotationKey is the status code queue-proxy answers requests
+	// rejected because the revision is overloaded with, instead of 503.
+	QueueSidecarOverloadStatusCodeAnnotationKey = "queue.sidecar." + GroupName + "/overload-status-code"
+
+	// QueueSidecarOverloadBodyAnnotationKey is the body queue-proxy answers requests rejected
+	// because the revision is overloaded with, instead of the error message.
+	QueueSidecarOverloadBodyAnnotationKey = "queue.sidecar." + GroupName + "/overload-body"
+
+	// QueueSidecarMaintenanceAnnotationKey, if true, makes queue-proxy answer the requests of
+	// the revision with the maintenance response of the config-deployment, without forwarding
+	// them to the user container.
+	QueueSidecarMaintenanceAnnotationKey = "queue.sidecar." + GroupName + "/maintenance"
+
+	// QueueSidecarResourceRationaleAnnotationKey is the pod annotation describing how the
+	// queue-proxy's resources were computed from the ones of the user container. It is
+	// purely diagnostic and only set if enabled in the config-deployment.
+	QueueSidecarResourceRationaleAnnotationKey = "queue.sidecar." + GroupName + "/resource-rationale"
+
+	// QueueSidecarDependencyHealthCheckAnnotationKey is a dependency of the revision, given as
+	// an http(s):// URL or a tcp://host:port target, which queue-proxy checks as part of its
+	// readiness, so that the revision isn't routed to while the dependency is unreachable.
+	QueueSidecarDependencyHealthCheckAnnotationKey = "queue.sidecar." + GroupName + "/dependency-health-check"
+
 	// VisibilityClusterLocal is the label value for VisibilityLabelKey
 	// that will result to the Route/KService getting a cluster local
 	// domain suffix.
@@ -199,6 +236,18 @@ var (
 	QueueSidecarEphemeralStorageResourceLimitAnnotation = kmap.KeyPriority{
 		QueueSidecarEphemeralStorageResourceLimitAnnotationKey,
 	}
+	QueueSidecarOverloadStatusCodeAnnotation = kmap.KeyPriority{
+		QueueSidecarOverloadStatusCodeAnnotationKey,
+	}
+	QueueSidecarOverloadBodyAnnotation = kmap.KeyPriority{
+		QueueSidecarOverloadBodyAnnotationKey,
+	}
+	QueueSidecarMaintenanceAnnotation = kmap.KeyPriority{
+		QueueSidecarMaintenanceAnnotationKey,
+	}
+	QueueSidecarDependencyHealthCheckAnnotation = kmap.KeyPriority{
+		QueueSidecarDependencyHealthCheckAnnotationKey,
+	}
 	ProgressDeadlineAnnotation = kmap.KeyPriority{
 		ProgressDeadlineAnnotationKey,
 	}
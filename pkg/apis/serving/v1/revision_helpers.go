@@ -157,6 +157,13 @@ func (r *Revision) GetProtocol() net.ProtocolType {
 	return net.ProtocolHTTP1
 }
 
+// IsTemporarilyUnroutable returns true if the traffic should be routed around
+// the revision until it recovers.
+func (rs *RevisionStatus) IsTemporarilyUnroutable() bool {
+	c := revisionCondSet.Manage(rs).GetCondition(RevisionConditionTemporarilyUnroutable)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
+
 // IsActivationRequired returns true if activation is required.
 func (rs *RevisionStatus) IsActivationRequired() bool {
 	c := revisionCondSet.Manage(rs).GetCondition(RevisionConditionActive)
@@ -18,6 +18,8 @@ package v1
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -34,6 +36,38 @@ const (
 	// as false if the a container image for the revision is missing.
 	ReasonContainerMissing = "ContainerMissing"
 
+	// ReasonRequiredImageLabelMissing defines the reason for marking container
+	// healthiness status as false if a container image lacks a required label.
+	ReasonRequiredImageLabelMissing = "RequiredImageLabelMissing"
+
+	// ReasonDeniedImageLabel defines the reason for marking container
+	// healthiness status as false if a container image carries a denied label.
+	ReasonDeniedImageLabel = "DeniedImageLabel"
+
+	// ReasonImageLayerMissing defines the reason for marking container
+	// healthiness status as false if a container image references a layer
+	// missing from its registry.
+	ReasonImageLayerMissing = "ImageLayerMissing"
+
+	// ReasonImagePullSecretsUnavailable defines the reason for marking
+	// container healthiness status as false if the image pull secrets needed
+	// to resolve the container images to digests cannot be read.
+	ReasonImagePullSecretsUnavailable = "ImagePullSecretsUnavailable"
+
+	// ReasonImageResolutionTimeout defines the reason for marking container
+	// healthiness status as false if resolving a container image to a digest
+	// timed out, e.g. due to a transient network issue.
+	ReasonImageResolutionTimeout = "ImageResolutionTimeout"
+
+	// ReasonImageUnauthorized defines the reason for marking container
+	// healthiness status as false if the registry denied access to a
+	// container image.
+	ReasonImageUnauthorized = "ImageUnauthorized"
+
+	// ReasonImageNotFound defines the reason for marking container healthiness
+	// status as false if a container image doesn't exist in its registry.
+	ReasonImageNotFound = "ImageNotFound"
+
 	// ReasonResolvingDigests defines the reason for marking container healthiness status
 	// as unknown if the digests for the container images are being resolved.
 	ReasonResolvingDigests = "ResolvingDigests"
@@ -49,6 +83,36 @@ const (
 	// ReasonProgressDeadlineExceeded defines the reason for marking revision availability
 	// status as false if progress has exceeded the deadline.
 	ReasonProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+
+	// ReasonReconcilePaused defines the reason for marking the reconciliation of
+	// the revision as paused.
+	ReasonReconcilePaused = "ReconcilePaused"
+
+	// ReasonPortCollision defines the reason for marking revision availability
+	// status as false if two containers of its pods expose the same port.
+	ReasonPortCollision = "PortCollision"
+
+	// ReasonLimitRangeViolation defines the reason for marking revision
+	// availability status as false if the resources of its queue-proxy
+	// violate a LimitRange of its namespace.
+	ReasonLimitRangeViolation = "LimitRangeViolation"
+
+	// ReasonDeploymentPaused defines the reason for marking revision availability
+	// status as unknown while its deployment is paused.
+	ReasonDeploymentPaused = "DeploymentPaused"
+
+	// ReasonDigestResolutionFailed defines the reason for marking the revision
+	// as temporarily unroutable if its image digests could not be resolved.
+	ReasonDigestResolutionFailed = "DigestResolutionFailed"
+
+	// ReasonSlowStartup defines the reason for marking the progress deadline
+	// of the revision as too short if its startup probes may outlast it.
+	ReasonSlowStartup = "SlowStartup"
+
+	// ReasonInvalidProgressDeadline defines the reason for marking the
+	// progress deadline annotation of the revision as ignored if it is
+	// invalid or exceeds the configured maximum.
+	ReasonInvalidProgressDeadline = "InvalidProgressDeadline"
 )
 
 // RevisionConditionActive is not part of the RevisionConditionSet because we can have Inactive Ready Revisions (scale to zero)
@@ -83,6 +147,18 @@ func (r *Revision) IsFailed() bool {
 		rs.GetCondition(RevisionConditionReady).IsFalse()
 }
 
+// IsReconcilePaused returns true if the reconciliation of the resources owned
+// by the revision is paused through the reconcile-paused annotation.
+func (r *Revision) IsReconcilePaused() bool {
+	return strings.EqualFold(r.Annotations[serving.RevisionReconcilePausedAnnotationKey], "true")
+}
+
+// IsDeploymentPaused returns true if the deployment of the revision is paused
+// through the deployment-paused annotation.
+func (r *Revision) IsDeploymentPaused() bool {
+	return strings.EqualFold(r.Annotations[serving.DeploymentPausedAnnotationKey], "true")
+}
+
 // GetContainerConcurrency returns the container concurrency. If
 // container concurrency is not set, the default value will be returned.
 // We use the original default (0) here for backwards compatibility.
@@ -97,6 +173,20 @@ func (rs *RevisionSpec) GetContainerConcurrency() int64 {
 	return *rs.ContainerConcurrency
 }
 
+// SetImageLabels records the given labels of the image of the named container
+// as annotations on the revision status.
+func (rs *RevisionStatus) SetImageLabels(container string, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	if rs.Annotations == nil {
+		rs.Annotations = make(map[string]string, len(labels))
+	}
+	for label, value := range labels {
+		rs.Annotations[container+"."+serving.ImageLabelsAnnotationDomain+"/"+label] = value
+	}
+}
+
 // InitializeConditions sets the initial values to the conditions.
 func (rs *RevisionStatus) InitializeConditions() {
 	revisionCondSet.Manage(rs).InitializeConditions()
@@ -117,6 +207,65 @@ func (rs *RevisionStatus) MarkActiveUnknown(reason, message string) {
 	revisionCondSet.Manage(rs).MarkUnknown(RevisionConditionActive, reason, message)
 }
 
+// MarkReconcilePaused marks ReconcilePaused status on revision as True.
+func (rs *RevisionStatus) MarkReconcilePaused() {
+	revisionCondSet.Manage(rs).MarkTrueWithReason(RevisionConditionReconcilePaused, ReasonReconcilePaused,
+		"Reconciliation of the owned resources is paused by the %s annotation", serving.RevisionReconcilePausedAnnotationKey)
+}
+
+// MarkReconcileResumed removes the ReconcilePaused status from the revision.
+func (rs *RevisionStatus) MarkReconcileResumed() {
+	revisionCondSet.Manage(rs).ClearCondition(RevisionConditionReconcilePaused)
+}
+
+// MarkDeploymentPaused marks ResourcesAvailable status on revision as Unknown,
+// since its deployment is paused and doesn't roll out.
+func (rs *RevisionStatus) MarkDeploymentPaused() {
+	revisionCondSet.Manage(rs).MarkUnknown(RevisionConditionResourcesAvailable, ReasonDeploymentPaused,
+		"The deployment is paused by the %s annotation", serving.DeploymentPausedAnnotationKey)
+}
+
+// MarkTemporarilyUnroutable marks TemporarilyUnroutable status on revision as
+// True, since its image digests could not be resolved.
+func (rs *RevisionStatus) MarkTemporarilyUnroutable(message string) {
+	revisionCondSet.Manage(rs).MarkTrueWithReason(RevisionConditionTemporarilyUnroutable, ReasonDigestResolutionFailed, message)
+}
+
+// MarkRoutable removes the TemporarilyUnroutable status from the revision.
+func (rs *RevisionStatus) MarkRoutable() {
+	revisionCondSet.Manage(rs).ClearCondition(RevisionConditionTemporarilyUnroutable)
+}
+
+// MarkProgressDeadlineTooShort marks ProgressDeadlineTooShort status on
+// revision as True, since its startup may take longer than its progress
+// deadline. It is merely advisory and doesn't affect its readiness.
+func (rs *RevisionStatus) MarkProgressDeadlineTooShort(startup, deadline time.Duration) {
+	revisionCondSet.Manage(rs).MarkTrueWithReason(RevisionConditionProgressDeadlineTooShort, ReasonSlowStartup,
+		"The startup probes may take up to %v to succeed, longer than the progress deadline of %v; consider raising it with the %s annotation",
+		startup, deadline, serving.ProgressDeadlineAnnotationKey)
+}
+
+// MarkProgressDeadlineSufficient removes the ProgressDeadlineTooShort status
+// from the revision.
+func (rs *RevisionStatus) MarkProgressDeadlineSufficient() {
+	revisionCondSet.Manage(rs).ClearCondition(RevisionConditionProgressDeadlineTooShort)
+}
+
+// MarkProgressDeadlineIgnored marks ProgressDeadlineIgnored status on revision
+// as True, since its progress deadline annotation is ignored in favor of the
+// given default for the reason of the message. It is merely advisory and
+// doesn't affect its readiness.
+func (rs *RevisionStatus) MarkProgressDeadlineIgnored(deadline time.Duration, message string) {
+	revisionCondSet.Manage(rs).MarkTrueWithReason(RevisionConditionProgressDeadlineIgnored, ReasonInvalidProgressDeadline,
+		"%s; using the default progress deadline of %v instead", message, deadline)
+}
+
+// MarkProgressDeadlineHonored removes the ProgressDeadlineIgnored status from
+// the revision.
+func (rs *RevisionStatus) MarkProgressDeadlineHonored() {
+	revisionCondSet.Manage(rs).ClearCondition(RevisionConditionProgressDeadlineIgnored)
+}
+
 // MarkContainerHealthyTrue marks ContainerHealthy status on revision as True
 func (rs *RevisionStatus) MarkContainerHealthyTrue() {
 	revisionCondSet.Manage(rs).MarkTrue(RevisionConditionContainerHealthy)
@@ -20,11 +20,13 @@ import (
 	"fmt"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"knative.dev/pkg/apis"
@@ -34,6 +36,7 @@ import (
 	"knative.dev/pkg/ptr"
 	autoscalingv1alpha1 "knative.dev/serving/pkg/apis/autoscaling/v1alpha1"
 	"knative.dev/serving/pkg/apis/config"
+	"knative.dev/serving/pkg/apis/serving"
 )
 
 func TestRevisionDuckTypes(t *testing.T) {
@@ -339,6 +342,162 @@ func TestTypicalFlowWithContainerMissing(t *testing.T) {
 	apistest.CheckConditionOngoing(r, RevisionConditionReady, t)
 }
 
+func TestReconcilePausedAndResumed(t *testing.T) {
+	r := &RevisionStatus{}
+	r.InitializeConditions()
+	r.MarkContainerHealthyTrue()
+	r.MarkResourcesAvailableTrue()
+
+	r.MarkReconcilePaused()
+	apistest.CheckConditionSucceeded(r, RevisionConditionReconcilePaused, t)
+	if got := r.GetCondition(RevisionConditionReconcilePaused); got.Reason != ReasonReconcilePaused {
+		t.Errorf("Reason = %q, want %q", got.Reason, ReasonReconcilePaused)
+	}
+	apistest.CheckConditionSucceeded(r, RevisionConditionReady, t)
+
+	r.MarkReconcileResumed()
+	if got := r.GetCondition(RevisionConditionReconcilePaused); got != nil {
+		t.Errorf("GetCondition(ReconcilePaused) = %v, want nil", got)
+	}
+	apistest.CheckConditionSucceeded(r, RevisionConditionReady, t)
+}
+
+func TestTemporarilyUnroutable(t *testing.T) {
+	r := &RevisionStatus{}
+	r.InitializeConditions()
+	if r.IsTemporarilyUnroutable() {
+		t.Error("IsTemporarilyUnroutable() = true, want false")
+	}
+
+	r.MarkContainerHealthyFalse(ReasonContainerMissing, "failed to resolve image to digest")
+	r.MarkTemporarilyUnroutable("failed to resolve image to digest")
+	apistest.CheckConditionSucceeded(r, RevisionConditionTemporarilyUnroutable, t)
+	if got := r.GetCondition(RevisionConditionTemporarilyUnroutable); got.Reason != ReasonDigestResolutionFailed {
+		t.Errorf("Reason = %q, want %q", got.Reason, ReasonDigestResolutionFailed)
+	}
+	if !r.IsTemporarilyUnroutable() {
+		t.Error("IsTemporarilyUnroutable() = false, want true")
+	}
+
+	r.MarkRoutable()
+	if got := r.GetCondition(RevisionConditionTemporarilyUnroutable); got != nil {
+		t.Errorf("GetCondition(TemporarilyUnroutable) = %v, want nil", got)
+	}
+	if r.IsTemporarilyUnroutable() {
+		t.Error("IsTemporarilyUnroutable() = true, want false")
+	}
+}
+
+func TestProgressDeadlineTooShort(t *testing.T) {
+	r := &RevisionStatus{}
+	r.InitializeConditions()
+	r.MarkContainerHealthyTrue()
+	r.MarkResourcesAvailableTrue()
+
+	r.MarkProgressDeadlineTooShort(15*time.Minute, 10*time.Minute)
+	apistest.CheckConditionSucceeded(r, RevisionConditionProgressDeadlineTooShort, t)
+	if got := r.GetCondition(RevisionConditionProgressDeadlineTooShort); got.Reason != ReasonSlowStartup {
+		t.Errorf("Reason = %q, want %q", got.Reason, ReasonSlowStartup)
+	}
+	apistest.CheckConditionSucceeded(r, RevisionConditionReady, t)
+
+	r.MarkProgressDeadlineSufficient()
+	if got := r.GetCondition(RevisionConditionProgressDeadlineTooShort); got != nil {
+		t.Errorf("GetCondition(ProgressDeadlineTooShort) = %v, want nil", got)
+	}
+	apistest.CheckConditionSucceeded(r, RevisionConditionReady, t)
+}
+
+func TestProgressDeadlineIgnored(t *testing.T) {
+	r := &RevisionStatus{}
+	r.InitializeConditions()
+	r.MarkContainerHealthyTrue()
+	r.MarkResourcesAvailableTrue()
+
+	r.MarkProgressDeadlineIgnored(10*time.Minute, "the progress deadline annotation exceeds the maximum")
+	apistest.CheckConditionSucceeded(r, RevisionConditionProgressDeadlineIgnored, t)
+	if got := r.GetCondition(RevisionConditionProgressDeadlineIgnored); got.Reason != ReasonInvalidProgressDeadline {
+		t.Errorf("Reason = %q, want %q", got.Reason, ReasonInvalidProgressDeadline)
+	}
+	apistest.CheckConditionSucceeded(r, RevisionConditionReady, t)
+
+	r.MarkProgressDeadlineHonored()
+	if got := r.GetCondition(RevisionConditionProgressDeadlineIgnored); got != nil {
+		t.Errorf("GetCondition(ProgressDeadlineIgnored) = %v, want nil", got)
+	}
+	apistest.CheckConditionSucceeded(r, RevisionConditionReady, t)
+}
+
+func TestSetImageLabels(t *testing.T) {
+	r := &RevisionStatus{}
+	r.SetImageLabels("user-container", nil)
+	if r.Annotations != nil {
+		t.Errorf("Annotations = %v, want nil", r.Annotations)
+	}
+
+	r.SetImageLabels("user-container", map[string]string{"org.opencontainers.image.revision": "abc123"})
+	r.SetImageLabels("sidecar", map[string]string{"build-id": "42"})
+	want := map[string]string{
+		"user-container.image-labels.serving.knative.dev/org.opencontainers.image.revision": "abc123",
+		"sidecar.image-labels.serving.knative.dev/build-id":                                 "42",
+	}
+	if !cmp.Equal(r.Annotations, want) {
+		t.Error("Annotations (-want, +got):", cmp.Diff(want, r.Annotations))
+	}
+}
+
+func TestIsReconcilePaused(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+	}{{
+		name: "no annotation",
+	}, {
+		name:        "paused",
+		annotations: map[string]string{serving.RevisionReconcilePausedAnnotationKey: "true"},
+		want:        true,
+	}, {
+		name:        "paused ignoring case",
+		annotations: map[string]string{serving.RevisionReconcilePausedAnnotationKey: "True"},
+		want:        true,
+	}, {
+		name:        "not paused",
+		annotations: map[string]string{serving.RevisionReconcilePausedAnnotationKey: "false"},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Revision{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			if got := r.IsReconcilePaused(); got != tc.want {
+				t.Errorf("IsReconcilePaused() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsDeploymentPaused(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+	}{{
+		name: "no annotation",
+	}, {
+		name:        "paused",
+		annotations: map[string]string{serving.DeploymentPausedAnnotationKey: "true"},
+		want:        true,
+	}, {
+		name:        "not paused",
+		annotations: map[string]string{serving.DeploymentPausedAnnotationKey: "false"},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Revision{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			if got := r.IsDeploymentPaused(); got != tc.want {
+				t.Errorf("IsDeploymentPaused() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestTypicalFlowWithSuspendResume(t *testing.T) {
 	r := &RevisionStatus{}
 	r.InitializeConditions()
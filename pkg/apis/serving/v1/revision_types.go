@@ -116,6 +116,24 @@ const (
 
 	// RevisionConditionActive is set when the revision is receiving traffic.
 	RevisionConditionActive apis.ConditionType = "Active"
+
+	// RevisionConditionReconcilePaused is set when the reconciliation of the
+	// resources owned by the revision is paused.
+	RevisionConditionReconcilePaused apis.ConditionType = "ReconcilePaused"
+
+	// RevisionConditionTemporarilyUnroutable is set when the revision should
+	// temporarily be routed around, e.g. because its image digests cannot be
+	// resolved yet.
+	RevisionConditionTemporarilyUnroutable apis.ConditionType = "TemporarilyUnroutable"
+
+	// RevisionConditionProgressDeadlineTooShort is set when the startup of the
+	// revision may take longer than its progress deadline.
+	RevisionConditionProgressDeadlineTooShort apis.ConditionType = "ProgressDeadlineTooShort"
+
+	// RevisionConditionProgressDeadlineIgnored is set when the progress
+	// deadline annotation of the revision is ignored, because it is invalid
+	// or exceeds the configured maximum.
+	RevisionConditionProgressDeadlineIgnored apis.ConditionType = "ProgressDeadlineIgnored"
 )
 
 // IsRevisionCondition returns true if the ConditionType is a revision condition type
@@ -125,7 +143,11 @@ func IsRevisionCondition(t apis.ConditionType) bool {
 		RevisionConditionReady,
 		RevisionConditionResourcesAvailable,
 		RevisionConditionContainerHealthy,
-		RevisionConditionActive:
+		RevisionConditionActive,
+		RevisionConditionReconcilePaused,
+		RevisionConditionTemporarilyUnroutable,
+		RevisionConditionProgressDeadlineTooShort,
+		RevisionConditionProgressDeadlineIgnored:
 		return true
 	}
 	return false
@@ -19,6 +19,7 @@ package v1
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -72,6 +73,9 @@ func (rts *RevisionTemplateSpec) Validate(ctx context.Context) *apis.FieldError
 	errs = errs.Also(validateRevisionName(ctx, rts.Name, rts.GenerateName))
 	errs = errs.Also(validateQueueSidecarResourceAnnotations(rts.Annotations).ViaField("metadata.annotations"))
 	errs = errs.Also(validateProgressDeadlineAnnotation(rts.Annotations).ViaField("metadata.annotations"))
+	errs = errs.Also(validateOverloadStatusCodeAnnotation(rts.Annotations).ViaField("metadata.annotations"))
+	errs = errs.Also(validateMaintenanceAnnotation(rts.Annotations).ViaField("metadata.annotations"))
+	errs = errs.Also(validateDependencyHealthCheckAnnotation(rts.Annotations).ViaField("metadata.annotations"))
 	return errs
 }
 
@@ -219,6 +223,53 @@ func validateQueueSidecarResourceAnnotations(m map[string]string) *apis.FieldErr
 	return errs
 }
 
+// validateOverloadStatusCodeAnnotation validates that the overload status code
+// annotation is a client or server error status code.
+func validateOverloadStatusCodeAnnotation(annos map[string]string) *apis.FieldError {
+	if k, v, ok := serving.QueueSidecarOverloadStatusCodeAnnotation.Get(annos); ok {
+		code, err := strconv.Atoi(v)
+		if err != nil {
+			return apis.ErrInvalidValue(v, k)
+		}
+		if code < 400 || code > 599 {
+			return apis.ErrOutOfBoundsValue(code, 400, 599, k)
+		}
+	}
+	return nil
+}
+
+// validateMaintenanceAnnotation validates that the maintenance annotation is
+// a boolean.
+func validateMaintenanceAnnotation(annos map[string]string) *apis.FieldError {
+	if k, v, ok := serving.QueueSidecarMaintenanceAnnotation.Get(annos); ok {
+		if _, err := strconv.ParseBool(v); err != nil {
+			return apis.ErrInvalidValue(v, k)
+		}
+	}
+	return nil
+}
+
+// validateDependencyHealthCheckAnnotation validates that the dependency health
+// check annotation is an http(s) URL or a tcp://host:port target.
+func validateDependencyHealthCheckAnnotation(annos map[string]string) *apis.FieldError {
+	if k, v, ok := serving.QueueSidecarDependencyHealthCheckAnnotation.Get(annos); ok {
+		u, err := url.Parse(v)
+		if err != nil || u.Host == "" {
+			return apis.ErrInvalidValue(v, k)
+		}
+		switch u.Scheme {
+		case "http", "https":
+		case "tcp":
+			if u.Port() == "" || (u.Path != "" && u.Path != "/") {
+				return apis.ErrInvalidValue(v, k)
+			}
+		default:
+			return apis.ErrInvalidValue(v, k)
+		}
+	}
+	return nil
+}
+
 // ValidateProgressDeadlineAnnotation validates the revision progress deadline annotation.
 func validateProgressDeadlineAnnotation(annos map[string]string) *apis.FieldError {
 	if k, v, _ := serving.ProgressDeadlineAnnotation.Get(annos); v != "" {
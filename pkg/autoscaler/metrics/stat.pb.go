@@ -57,6 +57,14 @@ type Stat struct {
 	// Time/date that the stat was generated in seconds since
 	// 1970-01-01 00:00:00.000 UTC.
 	Timestamp int64 `protobuf:"varint,7,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// Number of requests answered with a 2xx status code since last Stat, per second.
+	SuccessCount float64 `protobuf:"fixed64,8,opt,name=success_count,json=successCount,proto3" json:"success_count,omitempty"`
+	// Number of requests answered with a 3xx status code since last Stat, per second.
+	RedirectCount float64 `protobuf:"fixed64,9,opt,name=redirect_count,json=redirectCount,proto3" json:"redirect_count,omitempty"`
+	// Number of requests answered with a 4xx status code since last Stat, per second.
+	ClientErrorCount float64 `protobuf:"fixed64,10,opt,name=client_error_count,json=clientErrorCount,proto3" json:"client_error_count,omitempty"`
+	// Number of requests answered with a 5xx status code since last Stat, per second.
+	ServerErrorCount float64 `protobuf:"fixed64,11,opt,name=server_error_count,json=serverErrorCount,proto3" json:"server_error_count,omitempty"`
 }
 
 func (m *Stat) Reset()         { *m = Stat{} }
@@ -141,6 +149,34 @@ func (m *Stat) GetTimestamp() int64 {
 	return 0
 }
 
+func (m *Stat) GetSuccessCount() float64 {
+	if m != nil {
+		return m.SuccessCount
+	}
+	return 0
+}
+
+func (m *Stat) GetRedirectCount() float64 {
+	if m != nil {
+		return m.RedirectCount
+	}
+	return 0
+}
+
+func (m *Stat) GetClientErrorCount() float64 {
+	if m != nil {
+		return m.ClientErrorCount
+	}
+	return 0
+}
+
+func (m *Stat) GetServerErrorCount() float64 {
+	if m != nil {
+		return m.ServerErrorCount
+	}
+	return 0
+}
+
 // WireStatMessage is a copy of the StatMessage Golang type, exploding the fields of
 // `types.NamespacedName` to make it compatible with protobufs.
 type WireStatMessage struct {
@@ -261,30 +297,34 @@ func init() {
 func init() { proto.RegisterFile("pkg/autoscaler/metrics/stat.proto", fileDescriptor_cf216df9f6fff44c) }
 
 var fileDescriptor_cf216df9f6fff44c = []byte{
-	// 359 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x92, 0x4f, 0x4b, 0xc3, 0x30,
-	0x18, 0xc6, 0x97, 0xad, 0xee, 0x4f, 0xe6, 0x54, 0x22, 0x42, 0x86, 0x52, 0xba, 0x0d, 0xa1, 0xa7,
-	0x0d, 0xa6, 0x67, 0x0f, 0xee, 0xe2, 0x65, 0x22, 0x15, 0xf1, 0x58, 0x62, 0xf6, 0x3a, 0x8a, 0xb6,
-	0x89, 0x49, 0x2a, 0x7e, 0x0c, 0x3f, 0x96, 0x27, 0xd9, 0xd1, 0xa3, 0x6c, 0x5f, 0x44, 0x1a, 0xb3,
-	0x4d, 0xc7, 0x4e, 0x0d, 0xcf, 0xfb, 0x7b, 0x9e, 0x17, 0x9e, 0xb7, 0xb8, 0x23, 0x9f, 0xa6, 0x03,
-	0x96, 0x1b, 0xa1, 0x39, 0x7b, 0x06, 0x35, 0x48, 0xc1, 0xa8, 0x84, 0xeb, 0x81, 0x36, 0xcc, 0xf4,
-	0xa5, 0x12, 0x46, 0x90, 0x9a, 0xd3, 0xba, 0x9f, 0x65, 0xec, 0xdd, 0x1a, 0x66, 0x48, 0x1b, 0xd7,
-	0xa5, 0x98, 0xc4, 0x19, 0x4b, 0x81, 0xa2, 0x00, 0x85, 0x8d, 0xa8, 0x26, 0xc5, 0xe4, 0x9a, 0xa5,
-	0x40, 0x2e, 0xf0, 0x31, 0x7b, 0x05, 0xc5, 0xa6, 0x10, 0x73, 0x91, 0xf1, 0x5c, 0x29, 0xc8, 0x4c,
-	0xac, 0xe0, 0x25, 0x07, 0x6d, 0x34, 0x2d, 0x07, 0x28, 0x44, 0x51, 0xdb, 0x21, 0xa3, 0x15, 0x11,
-	0x39, 0x80, 0x8c, 0x71, 0x6f, 0xe9, 0x97, 0x4a, 0xbc, 0x25, 0x30, 0xd9, 0x9a, 0x53, 0xb1, 0x39,
-	0x81, 0x43, 0x6f, 0x7e, 0xc9, 0x2d, 0x71, 0x3d, 0xdc, 0x72, 0x9e, 0x98, 0x8b, 0x3c, 0x33, 0xd4,
-	0xb3, 0xc6, 0x5d, 0x27, 0x8e, 0x0a, 0x8d, 0x0c, 0xf1, 0xd1, 0x72, 0xd7, 0x7f, 0x78, 0xc7, 0xc2,
-	0x87, 0x6e, 0x18, 0xfd, 0xf5, 0x9c, 0xe2, 0x3d, 0xa9, 0x04, 0x07, 0xad, 0xe3, 0x5c, 0x9a, 0x24,
-	0x05, 0x5a, 0xb5, 0x70, 0xcb, 0xa9, 0x77, 0x56, 0x24, 0x27, 0xb8, 0x51, 0x7c, 0xb5, 0x61, 0xa9,
-	0xa4, 0xb5, 0x00, 0x85, 0x95, 0x68, 0x2d, 0x74, 0x1f, 0xf1, 0xfe, 0x7d, 0xa2, 0xa0, 0xe8, 0x74,
-	0x0c, 0x5a, 0xb3, 0xa9, 0x35, 0x14, 0xb5, 0x6a, 0xc9, 0xf8, 0xb2, 0xdb, 0xb5, 0x40, 0x08, 0xf6,
-	0x6c, 0xe9, 0x65, 0x3b, 0xb0, 0x6f, 0xd2, 0xc1, 0x5e, 0x71, 0x2c, 0x5b, 0x49, 0x73, 0xd8, 0xea,
-	0xbb, 0x6b, 0xf5, 0x8b, 0xd4, 0xc8, 0x8e, 0xba, 0x57, 0xf8, 0x60, 0x63, 0x8f, 0x26, 0xe7, 0xb8,
-	0x9e, 0xba, 0x37, 0x45, 0x41, 0x25, 0x6c, 0x0e, 0xe9, 0xca, 0xba, 0x01, 0x47, 0x2b, 0xf2, 0x92,
-	0x7e, 0xcc, 0x7d, 0x34, 0x9b, 0xfb, 0xe8, 0x7b, 0xee, 0xa3, 0xf7, 0x85, 0x5f, 0x9a, 0x2d, 0xfc,
-	0xd2, 0xd7, 0xc2, 0x2f, 0x3d, 0x54, 0xed, 0xcf, 0x72, 0xf6, 0x13, 0x00, 0x00, 0xff, 0xff, 0x6d,
-	0xc3, 0xa5, 0x6a, 0x51, 0x02, 0x00, 0x00,
+	// 423 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x92, 0xcf, 0x8a, 0x13, 0x41,
+	0x10, 0xc6, 0xd3, 0x26, 0x6e, 0x92, 0x8a, 0xd1, 0xa5, 0x45, 0x98, 0x45, 0x19, 0x66, 0xb3, 0x08,
+	0x39, 0x48, 0x02, 0xd1, 0xb3, 0x07, 0x17, 0xc1, 0xcb, 0x8a, 0xb4, 0x88, 0xc7, 0xa1, 0xed, 0x94,
+	0x61, 0x70, 0x27, 0xdd, 0x56, 0xf7, 0x2c, 0x3e, 0x86, 0x8f, 0xe5, 0x71, 0x8f, 0x1e, 0x25, 0x79,
+	0x07, 0xcf, 0xd2, 0x7f, 0x66, 0xe2, 0x2e, 0x7b, 0x9a, 0x9e, 0xaf, 0x7e, 0xf5, 0x7d, 0x3d, 0x53,
+	0x05, 0xa7, 0xe6, 0xdb, 0x66, 0x29, 0x1b, 0xa7, 0xad, 0x92, 0x97, 0x48, 0xcb, 0x1a, 0x1d, 0x55,
+	0xca, 0x2e, 0xad, 0x93, 0x6e, 0x61, 0x48, 0x3b, 0xcd, 0x87, 0x49, 0x9b, 0xfd, 0xed, 0xc3, 0xe0,
+	0xa3, 0x93, 0x8e, 0x9f, 0xc0, 0xc8, 0xe8, 0x75, 0xb9, 0x95, 0x35, 0x66, 0xac, 0x60, 0xf3, 0xb1,
+	0x18, 0x1a, 0xbd, 0x7e, 0x2f, 0x6b, 0xe4, 0xaf, 0xe1, 0xa9, 0xbc, 0x42, 0x92, 0x1b, 0x2c, 0x95,
+	0xde, 0xaa, 0x86, 0x08, 0xb7, 0xae, 0x24, 0xfc, 0xde, 0xa0, 0x75, 0x36, 0xbb, 0x57, 0xb0, 0x39,
+	0x13, 0x27, 0x09, 0x39, 0xef, 0x08, 0x91, 0x00, 0x7e, 0x01, 0x67, 0x6d, 0xbf, 0x21, 0xfd, 0xa3,
+	0xc2, 0xf5, 0x9d, 0x3e, 0xfd, 0xe0, 0x53, 0x24, 0xf4, 0x43, 0x24, 0xef, 0xb0, 0x3b, 0x83, 0x69,
+	0xea, 0x29, 0x95, 0x6e, 0xb6, 0x2e, 0x1b, 0x84, 0xc6, 0x07, 0x49, 0x3c, 0xf7, 0x1a, 0x5f, 0xc1,
+	0x93, 0x36, 0xeb, 0x26, 0x7c, 0x3f, 0xc0, 0x8f, 0x53, 0x51, 0xfc, 0xdf, 0xf3, 0x1c, 0x1e, 0x1a,
+	0xd2, 0x0a, 0xad, 0x2d, 0x1b, 0xe3, 0xaa, 0x1a, 0xb3, 0xa3, 0x00, 0x4f, 0x93, 0xfa, 0x29, 0x88,
+	0xfc, 0x19, 0x8c, 0xfd, 0xd3, 0x3a, 0x59, 0x9b, 0x6c, 0x58, 0xb0, 0x79, 0x5f, 0x1c, 0x04, 0x7f,
+	0x3b, 0xdb, 0xa8, 0x60, 0x12, 0x03, 0x47, 0xf1, 0x76, 0x49, 0xec, 0x92, 0x08, 0xd7, 0x15, 0xa1,
+	0x6a, 0xaf, 0x35, 0x8e, 0x49, 0xad, 0x1a, 0xb1, 0x17, 0xc0, 0xd5, 0x65, 0xe5, 0x7f, 0x12, 0x12,
+	0x69, 0x4a, 0x28, 0x04, 0xf4, 0x38, 0x56, 0xde, 0xfa, 0x42, 0x47, 0x5b, 0xa4, 0x2b, 0xa4, 0x1b,
+	0xf4, 0x24, 0xd2, 0xb1, 0x72, 0xa0, 0x67, 0x5f, 0xe1, 0xd1, 0xe7, 0x8a, 0xd0, 0xcf, 0xfe, 0x02,
+	0xad, 0x95, 0x9b, 0xf0, 0x61, 0x7e, 0xfc, 0xd6, 0x48, 0xd5, 0xee, 0xc0, 0x41, 0xe0, 0x1c, 0x06,
+	0xfe, 0x25, 0x8c, 0x7b, 0x2c, 0xc2, 0x99, 0x9f, 0xc2, 0xc0, 0x2f, 0x55, 0x18, 0xdd, 0x64, 0x35,
+	0x5d, 0xa4, 0xad, 0x5a, 0x78, 0x57, 0x11, 0x4a, 0xb3, 0x77, 0x70, 0x7c, 0x2b, 0xc7, 0xf2, 0x57,
+	0x30, 0xaa, 0xd3, 0x39, 0x63, 0x45, 0x7f, 0x3e, 0x59, 0x65, 0x5d, 0xeb, 0x2d, 0x58, 0x74, 0xe4,
+	0x9b, 0xec, 0xd7, 0x2e, 0x67, 0xd7, 0xbb, 0x9c, 0xfd, 0xd9, 0xe5, 0xec, 0xe7, 0x3e, 0xef, 0x5d,
+	0xef, 0xf3, 0xde, 0xef, 0x7d, 0xde, 0xfb, 0x72, 0x14, 0x96, 0xfa, 0xe5, 0xbf, 0x01, 0x00, 0x39,
+	0xa6, 0xc1, 0x84, 0xf9, 0x02, 0x00, 0x00,
 }
 
 func (m *Stat) Marshal() (dAtA []byte, err error) {
@@ -307,6 +347,30 @@ func (m *Stat) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.ServerErrorCount != 0 {
+		i -= 8
+		encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(math.Float64bits(float64(m.ServerErrorCount))))
+		i--
+		dAtA[i] = 0x59
+	}
+	if m.ClientErrorCount != 0 {
+		i -= 8
+		encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(math.Float64bits(float64(m.ClientErrorCount))))
+		i--
+		dAtA[i] = 0x51
+	}
+	if m.RedirectCount != 0 {
+		i -= 8
+		encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(math.Float64bits(float64(m.RedirectCount))))
+		i--
+		dAtA[i] = 0x49
+	}
+	if m.SuccessCount != 0 {
+		i -= 8
+		encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(math.Float64bits(float64(m.SuccessCount))))
+		i--
+		dAtA[i] = 0x41
+	}
 	if m.Timestamp != 0 {
 		i = encodeVarintStat(dAtA, i, uint64(m.Timestamp))
 		i--
@@ -477,6 +541,18 @@ func (m *Stat) Size() (n int) {
 	if m.Timestamp != 0 {
 		n += 1 + sovStat(uint64(m.Timestamp))
 	}
+	if m.SuccessCount != 0 {
+		n += 9
+	}
+	if m.RedirectCount != 0 {
+		n += 9
+	}
+	if m.ClientErrorCount != 0 {
+		n += 9
+	}
+	if m.ServerErrorCount != 0 {
+		n += 9
+	}
 	return n
 }
 
@@ -657,6 +733,50 @@ func (m *Stat) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 8:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SuccessCount", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.SuccessCount = float64(math.Float64frombits(v))
+		case 9:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RedirectCount", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.RedirectCount = float64(math.Float64frombits(v))
+		case 10:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ClientErrorCount", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.ClientErrorCount = float64(math.Float64frombits(v))
+		case 11:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ServerErrorCount", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.ServerErrorCount = float64(math.Float64frombits(v))
 		default:
 			iNdEx = preIndex
 			skippy, err := skipStat(dAtA[iNdEx:])
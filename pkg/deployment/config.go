@@ -19,18 +19,29 @@ package deployment
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/net/http/httpguts"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/yaml"
 
+	netheader "knative.dev/networking/pkg/http/header"
 	cm "knative.dev/pkg/configmap"
 	"knative.dev/pkg/ptr"
+	"knative.dev/serving/pkg/apis/serving"
+	"knative.dev/serving/pkg/networking"
 )
 
 const (
@@ -43,6 +54,14 @@ const (
 	// DeprecatedQueueSidecarImageKey is the config map key for queue sidecar image.
 	DeprecatedQueueSidecarImageKey = "queueSidecarImage"
 
+	// validateQueueSidecarImageKey is the config map key to enable parsing the
+	// queue sidecar image as an image reference when loading the config.
+	validateQueueSidecarImageKey = "validate-queue-sidecar-image"
+
+	// koImagePrefix is the prefix of the ko import paths, which are substituted
+	// with the built image references when deploying with ko.
+	koImagePrefix = "ko://"
+
 	// ProgressDeadlineDefault is the default value for the config's
 	// ProgressDeadlineSeconds. This matches the K8s default value of 600s.
 	ProgressDeadlineDefault = 600 * time.Second
@@ -50,16 +69,151 @@ const (
 	// ProgressDeadlineKey is the key to configure deployment progress deadline.
 	ProgressDeadlineKey = "progress-deadline"
 
+	// progressDeadlineAdvisoryKey is the key to configure whether the
+	// revisions whose startup probes may outlast their progress deadline are
+	// flagged by a condition.
+	progressDeadlineAdvisoryKey = "progress-deadline-advisory"
+
+	// progressDeadlineMaxKey is the key to configure the longest progress
+	// deadline the revisions can set with their annotation.
+	progressDeadlineMaxKey = "progress-deadline-max"
+
+	// configChangeResyncDelayKey is the key to configure how long the
+	// resync of all the revisions following config changes is delayed to
+	// coalesce the changes made in quick succession.
+	configChangeResyncDelayKey = "config-change-resync-delay"
+
+	// revisionHistoryLimitKey is the key to configure the number of old
+	// ReplicaSets retained by the deployments of the revisions.
+	revisionHistoryLimitKey = "revision-history-limit"
+
+	// minReadySecondsKey is the key to configure how long the pods of the
+	// revisions must be ready before they are considered available.
+	minReadySecondsKey = "min-ready-seconds"
+
+	// shareProcessNamespaceKey is the key to configure whether the containers
+	// of the revisions' pods share a single process namespace.
+	shareProcessNamespaceKey = "share-process-namespace"
+
+	// defaultPriorityClassNameKey is the key to configure the priority class
+	// of the revisions' pods not setting one themselves.
+	defaultPriorityClassNameKey = "default-priority-class-name"
+
+	// adoptExistingDeploymentsKey is the key to configure whether the
+	// revisions adopt the deployments with their name which aren't owned by
+	// anything.
+	adoptExistingDeploymentsKey = "adopt-existing-deployments"
+
 	// digestResolutionTimeoutKey is the key to configure the digest resolution timeout.
 	digestResolutionTimeoutKey = "digest-resolution-timeout"
 
+	// digestResolutionTimeoutsKey is the key to configure the digest resolution
+	// timeouts of specific registries.
+	digestResolutionTimeoutsKey = "digest-resolution-timeouts"
+
+	// digestResolutionTLSServerNamesKey is the key to configure the server
+	// names verified in the TLS handshake with specific registry hosts.
+	digestResolutionTLSServerNamesKey = "digest-resolution-tls-server-names"
+
 	// digestResolutionTimeoutDefault is the default digest resolution timeout.
 	digestResolutionTimeoutDefault = 10 * time.Second
 
+	// digestResolutionRetryBaseDelayKey and digestResolutionRetryMaxDelayKey
+	// are the keys to configure the exponential backoff of the retries of
+	// failed digest resolutions.
+	digestResolutionRetryBaseDelayKey = "digest-resolution-retry-base-delay"
+	digestResolutionRetryMaxDelayKey  = "digest-resolution-retry-max-delay"
+
+	// DigestResolutionRetryBaseDelayDefault and DigestResolutionRetryMaxDelayDefault
+	// are the default delays of the retries of failed digest resolutions.
+	DigestResolutionRetryBaseDelayDefault = 1 * time.Second
+	DigestResolutionRetryMaxDelayDefault  = 1000 * time.Second
+
+	// digestResolutionRetryQPSKey and digestResolutionRetryBurstKey are the
+	// keys to configure the token bucket pacing the retries of all the failed
+	// digest resolutions together.
+	digestResolutionRetryQPSKey   = "digest-resolution-retry-qps"
+	digestResolutionRetryBurstKey = "digest-resolution-retry-burst"
+
+	// DigestResolutionRetryQPSDefault and DigestResolutionRetryBurstDefault
+	// are the default rate and bucket size of the retries of failed digest
+	// resolutions.
+	DigestResolutionRetryQPSDefault   = 10.0
+	DigestResolutionRetryBurstDefault = 100
+
+	// digestResolutionWorkersKey is the key to configure the number of image
+	// digest resolutions which take place in parallel.
+	digestResolutionWorkersKey = "digest-resolution-workers"
+
+	// DigestResolutionWorkersDefault is the default number of digest
+	// resolution workers.
+	DigestResolutionWorkersDefault = 100
+
+	// digestResolutionBatchRegistriesKey is the key to configure the registries
+	// whose images are resolved to digests in batches.
+	digestResolutionBatchRegistriesKey = "digest-resolution-batch-registries"
+
+	// digestResolutionConcurrencyKey is the key to configure the maximum number
+	// of a revision's images which are resolved to digests in parallel.
+	digestResolutionConcurrencyKey = "digest-resolution-concurrency"
+
+	// digestResolutionNamespaceConcurrencyKey is the key to configure the
+	// maximum number of images of the revisions of a single namespace which are
+	// resolved to digests in parallel.
+	digestResolutionNamespaceConcurrencyKey = "digest-resolution-namespace-concurrency"
+
+	// digestResolutionRegistryConnectionsKey is the key to configure the
+	// maximum number of connections to a single registry host used to resolve
+	// images to digests.
+	digestResolutionRegistryConnectionsKey = "digest-resolution-registry-connections"
+
+	// digestResolutionCacheTTLKey is the key to configure how long the digest
+	// resolved for an image is reused by the revisions sharing it.
+	digestResolutionCacheTTLKey = "digest-resolution-cache-ttl"
+
+	// digestResolutionAcceptMediaTypesKey is the key to configure the manifest
+	// media types requested from the registries when resolving tags to digests.
+	digestResolutionAcceptMediaTypesKey = "digest-resolution-accept-media-types"
+
+	// digestResolutionFailureUnroutableKey is the key to configure whether the
+	// revisions whose digests cannot be resolved are marked as temporarily
+	// unroutable.
+	digestResolutionFailureUnroutableKey = "digest-resolution-failure-unroutable"
+
+	// digestResolutionVerifyLayersKey is the key to configure whether the
+	// existence of the layers of the resolved images is checked.
+	digestResolutionVerifyLayersKey = "digest-resolution-verify-layers"
+
+	// digestResolutionPreferLazyPullKey is the key to configure whether tags
+	// resolving to an index holding both a lazy-pull (eStargz or SOCI) and a
+	// regular variant of an image are resolved to the lazy-pull one.
+	digestResolutionPreferLazyPullKey = "digest-resolution-prefer-lazy-pull"
+
+	// digestResolutionIdentityHeaderKey is the key to configure whether the
+	// requests sent to the registries identify the controller replica sending
+	// them.
+	digestResolutionIdentityHeaderKey = "digest-resolution-identity-header"
+
+	// digestResolutionEventsKey is the key to configure whether the digest
+	// resolution lifecycle is recorded as events on the revisions.
+	digestResolutionEventsKey = "digest-resolution-events"
+
 	// registriesSkippingTagResolvingKey is the config map key for the set of registries
 	// (e.g. ko.local) where tags should not be resolved to digests.
 	registriesSkippingTagResolvingKey = "registries-skipping-tag-resolving"
 
+	// exportedImageLabelsKey is the config map key for the set of image labels
+	// which are recorded onto the revision status once its images are resolved.
+	exportedImageLabelsKey = "exported-image-labels"
+
+	// requiredImageLabelsKey is the config map key for the image labels, and
+	// their values, which the images of the revisions must carry.
+	requiredImageLabelsKey = "required-image-labels"
+
+	// deniedImageLabelsKey is the config map key for the image labels, and
+	// their values, which the images of the revisions must not carry.
+	deniedImageLabelsKey = "denied-image-labels"
+
 	// queueSidecar resource request keys.
 	queueSidecarCPURequestKey              = "queue-sidecar-cpu-request"
 	queueSidecarMemoryRequestKey           = "queue-sidecar-memory-request"
@@ -70,6 +224,68 @@ const (
 	queueSidecarMemoryLimitKey           = "queue-sidecar-memory-limit"
 	queueSidecarEphemeralStorageLimitKey = "queue-sidecar-ephemeral-storage-limit"
 
+	// queueSidecarGoMemLimitKey is the key to configure the Go soft memory
+	// limit of the queue sidecar, either QueueSidecarGoMemLimitAuto or a
+	// quantity of memory.
+	queueSidecarGoMemLimitKey = "queue-sidecar-gomemlimit"
+
+	// QueueSidecarGoMemLimitAuto derives the Go soft memory limit of the queue
+	// sidecar from its memory limit.
+	QueueSidecarGoMemLimitAuto = "auto"
+
+	// queueSidecar resource sanity bound keys.
+	queueSidecarCPURequestBoundKey    = "queue-sidecar-cpu-request-bound"
+	queueSidecarMemoryRequestBoundKey = "queue-sidecar-memory-request-bound"
+	queueSidecarResourceBoundScaleKey = "queue-sidecar-resource-bound-scale"
+
+	queueSidecarStrictResourceUnitsKey = "queue-sidecar-strict-resource-units"
+
+	queueSidecarResourceRationaleKey = "queue-sidecar-resource-rationale"
+
+	queueSidecarCheckLimitRangesKey = "queue-sidecar-check-limit-ranges"
+
+	queueSidecarSuppressOverloadDetailsKey = "queue-sidecar-suppress-overload-details"
+	queueSidecarQueueFullStatusCodeKey     = "queue-sidecar-queue-full-status-code"
+	queueSidecarQueueFullRetryAfterKey     = "queue-sidecar-queue-full-retry-after"
+	queueSidecarQueueFullBodyKey           = "queue-sidecar-queue-full-body"
+	queueSidecarBreakerDrainTimeoutKey     = "queue-sidecar-breaker-drain-timeout"
+	queueSidecarMaintenanceStatusCodeKey   = "queue-sidecar-maintenance-status-code"
+	queueSidecarMaintenanceBodyKey         = "queue-sidecar-maintenance-body"
+	queueSidecarMaxResponseHeadersKey      = "queue-sidecar-max-response-headers"
+	queueSidecarMaxUpstreamConnectionsKey  = "queue-sidecar-max-upstream-connections"
+	queueSidecarH2MaxConcurrentStreamsKey  = "queue-sidecar-h2-max-concurrent-streams"
+	queueSidecarMaxRequestBodyBytesKey     = "queue-sidecar-max-request-body-bytes"
+	queueSidecarSlowRequestThresholdKey    = "queue-sidecar-slow-request-threshold"
+	queueSidecarResponseHeaderTimeoutKey   = "queue-sidecar-response-header-timeout"
+	queueSidecarVersionHeaderKey           = "queue-sidecar-version-header"
+	queueSidecarCountProbeRequestsKey      = "queue-sidecar-count-probe-requests"
+	queueSidecarReportResponseClassesKey   = "queue-sidecar-report-response-classes"
+	queueSidecarReportBreakerParamsKey     = "queue-sidecar-report-breaker-params"
+	queueSidecarLivenessProbeKey           = "queue-sidecar-liveness-probe"
+
+	queueSidecarUpstreamProtocolDetectionKey = "queue-sidecar-upstream-protocol-detection"
+	queueSidecarRequestIDHeaderKey           = "queue-sidecar-request-id-header"
+
+	// queueSidecar prewarming keys.
+	queueSidecarPrewarmKey     = "queue-sidecar-prewarm"
+	queueSidecarPrewarmPathKey = "queue-sidecar-prewarm-path"
+
+	queueSidecarDrainReadinessPathKey = "queue-sidecar-drain-readiness-path"
+	queueSidecarDrainPathKey          = "queue-sidecar-drain-path"
+
+	// queueSidecar per-client concurrency limit keys.
+	queueSidecarClientConcurrencyLimitKey = "queue-sidecar-client-concurrency-limit"
+	queueSidecarClientKeyHeaderKey        = "queue-sidecar-client-key-header"
+
+	// queueSidecar memory pressure shedding keys.
+	queueSidecarMemorySheddingHighWaterMarkKey = "queue-sidecar-memory-shedding-high-water-mark"
+	queueSidecarMemorySheddingLowWaterMarkKey  = "queue-sidecar-memory-shedding-low-water-mark"
+
+	// queueSidecar security context keys.
+	queueSidecarRunAsUserKey    = "queue-sidecar-run-as-user"
+	queueSidecarRunAsGroupKey   = "queue-sidecar-run-as-group"
+	queueSidecarRunAsNonRootKey = "queue-sidecar-run-as-non-root"
+
 	// qpoptions
 	queueSidecarTokenAudiencesKey = "queue-sidecar-token-audiences"
 	queueSidecarRooCAKey          = "queue-sidecar-rootca"
@@ -77,7 +293,119 @@ const (
 	defaultAffinityTypeKey   = "default-affinity-type"
 	defaultAffinityTypeValue = PreferSpreadRevisionOverNodes
 
+	// defaultAffinityTypeOverridesKey is the config map key for the default
+	// affinity types of namespaces, overriding default-affinity-type.
+	defaultAffinityTypeOverridesKey = "default-affinity-type-overrides"
+
+	topologySpreadWhenUnsatisfiableKey = "topology-spread-when-unsatisfiable"
+
+	crossRevisionAntiAffinityKey = "cross-revision-anti-affinity"
+
+	queueSidecarHTTP10HandlingKey = "queue-sidecar-http10-handling"
+
 	RuntimeClassNameKey = "runtime-class-name"
+
+	// defaultRuntimeClassFallbackKey is the config map key for the runtime
+	// class of the revisions no runtime-class-name selector matches.
+	defaultRuntimeClassFallbackKey = "default-runtime-class-fallback"
+
+	// imagePullSecretsKey is the config map key for the image pull secrets
+	// added to the pods of every revision.
+	imagePullSecretsKey = "image-pull-secrets"
+
+	// deploymentLabelsKey is the config map key for the label templates set on
+	// the generated Deployments, and deploymentLabelsOnPodTemplateKey the key
+	// for also setting them on their pod templates.
+	deploymentLabelsKey              = "deployment-labels"
+	deploymentLabelsOnPodTemplateKey = "deployment-labels-on-pod-template"
+
+	// podLabelsKey is the config map key for the labels set on the pods of
+	// every revision, e.g. for network policies to select them.
+	podLabelsKey = "pod-labels"
+
+	// sidecarContainersKey is the config map key for the sidecar containers
+	// injected into the pods of the revisions matching their selector.
+	sidecarContainersKey = "sidecar-containers"
+
+	// defaultTolerationsKey is the config map key for the tolerations added
+	// to the pods of all revisions.
+	defaultTolerationsKey = "default-tolerations"
+
+	// defaultTopologySpreadConstraintsKey is the config map key for the
+	// topology spread constraints of the pods of the revisions not setting
+	// any.
+	defaultTopologySpreadConstraintsKey = "default-topology-spread-constraints"
+
+	// registriesResolutionRateLimitsKey is the config map key for the per
+	// registry rate limits applied to tag-to-digest resolution requests.
+	registriesResolutionRateLimitsKey = "registries-resolution-rate-limits"
+
+	// forceActivatorSelectorKey is the config map key for the label selector
+	// of the revisions which always route through the activator.
+	forceActivatorSelectorKey = "force-activator-selector"
+
+	// ActivatorProxyHeaderNameKey is the config map key for the name of the
+	// header the activator identifies itself with on the requests it proxies.
+	// An empty name suppresses the header.
+	ActivatorProxyHeaderNameKey = "activator-proxy-header-name"
+
+	// ActivatorProxyHeaderValueKey is the config map key for the value of the
+	// header the activator identifies itself with.
+	ActivatorProxyHeaderValueKey = "activator-proxy-header-value"
+
+	// ActivatorEndpointsRetryIntervalKey is the config map key for how long
+	// the activator waits before looking for an endpoint of a revision again
+	// after finding none.
+	ActivatorEndpointsRetryIntervalKey = "activator-endpoints-retry-interval"
+
+	// ActivatorEndpointsMaxWaitKey is the config map key for how long the
+	// activator waits for an endpoint of a revision to become available
+	// before failing the request.
+	ActivatorEndpointsMaxWaitKey = "activator-endpoints-max-wait"
+
+	// ActivatorColdStartQueueLengthKey is the config map key for how many
+	// requests of a revision without endpoints, e.g. scaling from zero, the
+	// activator queues before rejecting the excess ones.
+	ActivatorColdStartQueueLengthKey = "activator-cold-start-queue-length"
+
+	// ActivatorMaxConcurrentColdStartsKey is the config map key for how many
+	// revisions without endpoints the activator scales from zero at the same
+	// time, holding the requests of the other ones meanwhile.
+	ActivatorMaxConcurrentColdStartsKey = "activator-max-concurrent-cold-starts"
+
+	// ActivatorLoadBalancingPolicyKey is the config map key selecting how the
+	// activator balances the requests of a revision over its pods.
+	ActivatorLoadBalancingPolicyKey = "activator-load-balancing-policy"
+
+	// ActivatorLoadBalancingHashHeaderKey is the config map key for the name
+	// of the header keying the consistent-hash load balancing policy.
+	ActivatorLoadBalancingHashHeaderKey = "activator-load-balancing-hash-header"
+
+	// ActivatorPreferLocalZoneKey is the config map key for whether the
+	// activator prefers the pods of a revision in its own zone.
+	ActivatorPreferLocalZoneKey = "activator-prefer-local-zone"
+
+	// ActivatorCapacityShrinkPolicyKey is the config map key selecting how
+	// the activator shrinks the capacity of a revision below its requests in
+	// flight, e.g. when its pods go away.
+	ActivatorCapacityShrinkPolicyKey = "activator-capacity-shrink-policy"
+
+	// ActivatorBackendTLSVerificationKey is the config map key selecting what
+	// the activator does when the certificate of a backend fails the
+	// verification with system-internal-tls enabled.
+	ActivatorBackendTLSVerificationKey = "activator-backend-tls-verification"
+
+	// ActivatorMaxHeldRequestBytesKey is the config map key for the total size
+	// of the request bodies the activator holds while waiting for a backend.
+	ActivatorMaxHeldRequestBytesKey = "activator-max-held-request-bytes"
+
+	// rejectUnknownKeysKey is the config map key to reject the config map if
+	// it has keys that aren't in knownKeys, e.g. mistyped ones.
+	rejectUnknownKeysKey = "reject-unknown-keys"
+
+	// exampleKey is the key of the documentation of the config map, which is
+	// never parsed.
+	exampleKey = "_example"
 )
 
 var (
@@ -105,15 +433,156 @@ var (
 	// QueueSidecarEphemeralStorageLimitDefault is the default limit.ephemeral-storage to set for the
 	// queue sidecar.
 	QueueSidecarEphemeralStorageLimitDefault = resource.MustParse("1024Mi")
+
+	// strictCPUUnitsBound is the CPU quantity from which the queue sidecar's
+	// CPU is rejected with strict resource units.
+	strictCPUUnitsBound = resource.MustParse("1M")
+)
+
+// knownKeys are the keys NewConfigFromMap parses, which need to be added here
+// too for the config maps rejecting unknown keys.
+var knownKeys = sets.New(
+	// Legacy keys for backwards compatibility
+	DeprecatedQueueSidecarImageKey,
+	"progressDeadline",
+	"digestResolutionTimeout",
+	"digestResolutionWorkers",
+	"registriesSkippingTagResolving",
+	"queueSidecarCPURequest",
+	"queueSidecarMemoryRequest",
+	"queueSidecarEphemeralStorageRequest",
+	"queueSidecarCPULimit",
+	"queueSidecarMemoryLimit",
+	"queueSidecarEphemeralStorageLimit",
+
+	QueueSidecarImageKey,
+	rejectUnknownKeysKey,
+	validateQueueSidecarImageKey,
+	ProgressDeadlineKey,
+	progressDeadlineAdvisoryKey,
+	progressDeadlineMaxKey,
+	configChangeResyncDelayKey,
+	revisionHistoryLimitKey,
+	minReadySecondsKey,
+	shareProcessNamespaceKey,
+	defaultPriorityClassNameKey,
+	adoptExistingDeploymentsKey,
+	digestResolutionTimeoutKey,
+	digestResolutionTimeoutsKey,
+	digestResolutionTLSServerNamesKey,
+	digestResolutionRetryBaseDelayKey,
+	digestResolutionRetryMaxDelayKey,
+	digestResolutionRetryQPSKey,
+	digestResolutionRetryBurstKey,
+	digestResolutionWorkersKey,
+	digestResolutionBatchRegistriesKey,
+	digestResolutionConcurrencyKey,
+	digestResolutionNamespaceConcurrencyKey,
+	digestResolutionRegistryConnectionsKey,
+	digestResolutionCacheTTLKey,
+	digestResolutionAcceptMediaTypesKey,
+	digestResolutionFailureUnroutableKey,
+	digestResolutionVerifyLayersKey,
+	digestResolutionPreferLazyPullKey,
+	digestResolutionIdentityHeaderKey,
+	digestResolutionEventsKey,
+	registriesSkippingTagResolvingKey,
+	exportedImageLabelsKey,
+	requiredImageLabelsKey,
+	deniedImageLabelsKey,
+	queueSidecarCPURequestKey,
+	queueSidecarMemoryRequestKey,
+	queueSidecarEphemeralStorageRequestKey,
+	queueSidecarCPULimitKey,
+	queueSidecarMemoryLimitKey,
+	queueSidecarGoMemLimitKey,
+	queueSidecarEphemeralStorageLimitKey,
+	queueSidecarCPURequestBoundKey,
+	queueSidecarMemoryRequestBoundKey,
+	queueSidecarResourceBoundScaleKey,
+	queueSidecarResourceRationaleKey,
+	queueSidecarStrictResourceUnitsKey,
+	queueSidecarCheckLimitRangesKey,
+	queueSidecarSuppressOverloadDetailsKey,
+	queueSidecarQueueFullStatusCodeKey,
+	queueSidecarQueueFullRetryAfterKey,
+	queueSidecarQueueFullBodyKey,
+	queueSidecarBreakerDrainTimeoutKey,
+	queueSidecarMaintenanceStatusCodeKey,
+	queueSidecarMaintenanceBodyKey,
+	queueSidecarMaxResponseHeadersKey,
+	queueSidecarMaxUpstreamConnectionsKey,
+	queueSidecarH2MaxConcurrentStreamsKey,
+	queueSidecarMaxRequestBodyBytesKey,
+	queueSidecarSlowRequestThresholdKey,
+	queueSidecarResponseHeaderTimeoutKey,
+	queueSidecarVersionHeaderKey,
+	queueSidecarCountProbeRequestsKey,
+	queueSidecarReportResponseClassesKey,
+	queueSidecarReportBreakerParamsKey,
+	queueSidecarLivenessProbeKey,
+	queueSidecarUpstreamProtocolDetectionKey,
+	queueSidecarRequestIDHeaderKey,
+	queueSidecarPrewarmKey,
+	queueSidecarPrewarmPathKey,
+	queueSidecarDrainReadinessPathKey,
+	queueSidecarDrainPathKey,
+	queueSidecarClientConcurrencyLimitKey,
+	queueSidecarClientKeyHeaderKey,
+	queueSidecarMemorySheddingHighWaterMarkKey,
+	queueSidecarMemorySheddingLowWaterMarkKey,
+	queueSidecarRunAsUserKey,
+	queueSidecarRunAsGroupKey,
+	queueSidecarRunAsNonRootKey,
+	queueSidecarTokenAudiencesKey,
+	queueSidecarRooCAKey,
+	RuntimeClassNameKey,
+	defaultRuntimeClassFallbackKey,
+	sidecarContainersKey,
+	defaultTolerationsKey,
+	defaultTopologySpreadConstraintsKey,
+	registriesResolutionRateLimitsKey,
+	imagePullSecretsKey,
+	deploymentLabelsKey,
+	deploymentLabelsOnPodTemplateKey,
+	podLabelsKey,
+	forceActivatorSelectorKey,
+	ActivatorProxyHeaderNameKey,
+	ActivatorProxyHeaderValueKey,
+	ActivatorEndpointsRetryIntervalKey,
+	ActivatorEndpointsMaxWaitKey,
+	ActivatorColdStartQueueLengthKey,
+	ActivatorMaxConcurrentColdStartsKey,
+	ActivatorLoadBalancingPolicyKey,
+	ActivatorLoadBalancingHashHeaderKey,
+	ActivatorPreferLocalZoneKey,
+	ActivatorCapacityShrinkPolicyKey,
+	ActivatorBackendTLSVerificationKey,
+	ActivatorMaxHeldRequestBytesKey,
+	defaultAffinityTypeKey,
+	defaultAffinityTypeOverridesKey,
+	topologySpreadWhenUnsatisfiableKey,
+	crossRevisionAntiAffinityKey,
+	queueSidecarHTTP10HandlingKey,
 )
 
 func defaultConfig() *Config {
 	cfg := &Config{
-		ProgressDeadline:               ProgressDeadlineDefault,
-		DigestResolutionTimeout:        digestResolutionTimeoutDefault,
-		RegistriesSkippingTagResolving: sets.New("kind.local", "ko.local", "dev.local"),
-		QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
-		DefaultAffinityType:            defaultAffinityTypeValue,
+		ProgressDeadline:                  ProgressDeadlineDefault,
+		DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+		DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+		DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+		DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+		DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+		DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+		RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+		QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+		DefaultAffinityType:               defaultAffinityTypeValue,
+		TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+		CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+		QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+		QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+		QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
 	}
 	// The following code is needed for ConfigMap testing.
 	// defaultConfig must match the example in deployment.yaml which includes: `queue-sidecar-token-audiences: ""`
@@ -136,24 +605,228 @@ func (d Config) PodRuntimeClassName(lbs map[string]string) *string {
 			specificity = v.specificity()
 		}
 	}
+	// Nothing matched, not even a wildcard.
+	if specificity < 0 && d.DefaultRuntimeClassFallback != "" {
+		return ptr.String(d.DefaultRuntimeClassFallback)
+	}
 	if runtimeClassName == "" {
 		return nil
 	}
 	return ptr.String(runtimeClassName)
 }
 
+// AmbiguousRuntimeClassNames returns the pairs of runtime class names whose
+// selectors are equally specific and may both match the same revision, so
+// that the one picked only depends on the order of their names. The pairs
+// and their names are sorted.
+func (d Config) AmbiguousRuntimeClassNames() [][2]string {
+	classes := sets.List(sets.KeySet(d.RuntimeClassNames))
+	var ret [][2]string
+	for i, a := range classes {
+		for _, b := range classes[i+1:] {
+			sa, sb := d.RuntimeClassNames[a], d.RuntimeClassNames[b]
+			if sa.specificity() == sb.specificity() && sa.overlaps(&sb) {
+				ret = append(ret, [2]string{a, b})
+			}
+		}
+	}
+	return ret
+}
+
+// validateRegistryHost returns an error unless registry is a hostname,
+// optionally followed by a port, as in the references of the images.
+func validateRegistryHost(registry string) error {
+	if registry == "" {
+		return errors.New("the registry cannot be empty")
+	}
+	host := registry
+	if h, port, ok := strings.Cut(registry, ":"); ok {
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+		host = h
+	}
+	if errs := validation.IsDNS1123Subdomain(strings.ToLower(host)); len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// validateToleration returns an error unless the toleration has a legal
+// combination of key, operator, value and effect, as the API server requires
+// of the tolerations of the pods.
+func validateToleration(t corev1.Toleration) error {
+	if t.Key != "" {
+		if errs := validation.IsQualifiedName(t.Key); len(errs) > 0 {
+			return fmt.Errorf("key %q is invalid: %v", t.Key, strings.Join(errs, "; "))
+		}
+	}
+	switch t.Operator {
+	case corev1.TolerationOpEqual, "":
+		if t.Key == "" {
+			return fmt.Errorf("operator %q requires a key", corev1.TolerationOpEqual)
+		}
+		if errs := validation.IsValidLabelValue(t.Value); len(errs) > 0 {
+			return fmt.Errorf("value %q is invalid: %v", t.Value, strings.Join(errs, "; "))
+		}
+	case corev1.TolerationOpExists:
+		if t.Value != "" {
+			return fmt.Errorf("operator %q cannot have a value, was %q", corev1.TolerationOpExists, t.Value)
+		}
+	default:
+		return fmt.Errorf("unsupported operator %q", t.Operator)
+	}
+	switch t.Effect {
+	case corev1.TaintEffectNoExecute:
+	case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, "":
+		if t.TolerationSeconds != nil {
+			return fmt.Errorf("tolerationSeconds requires effect %q, was %q", corev1.TaintEffectNoExecute, t.Effect)
+		}
+	default:
+		return fmt.Errorf("unsupported effect %q", t.Effect)
+	}
+	return nil
+}
+
+// validateTopologySpreadConstraint returns an error unless the constraint
+// has a topology key, a positive maxSkew and a legal whenUnsatisfiable.
+func validateTopologySpreadConstraint(c corev1.TopologySpreadConstraint) error {
+	if c.TopologyKey == "" {
+		return errors.New("topologyKey is required")
+	}
+	if errs := validation.IsQualifiedName(c.TopologyKey); len(errs) > 0 {
+		return fmt.Errorf("topologyKey %q is invalid: %v", c.TopologyKey, strings.Join(errs, "; "))
+	}
+	if c.MaxSkew < 0 {
+		return fmt.Errorf("maxSkew must be positive, was %d", c.MaxSkew)
+	}
+	switch c.WhenUnsatisfiable {
+	case corev1.DoNotSchedule, corev1.ScheduleAnyway:
+	default:
+		return fmt.Errorf("unsupported whenUnsatisfiable %q", c.WhenUnsatisfiable)
+	}
+	if c.LabelSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(c.LabelSelector); err != nil {
+			return fmt.Errorf("labelSelector is invalid: %w", err)
+		}
+	}
+	return nil
+}
+
+// labelTemplateToken matches the tokens of the deployment-labels templates.
+var labelTemplateToken = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// isKnativeLabel returns whether the label key is in a Knative domain, and
+// hence managed by Knative.
+func isKnativeLabel(key string) bool {
+	domain, _, ok := strings.Cut(key, "/")
+	return ok && (domain == "knative.dev" || strings.HasSuffix(domain, ".knative.dev"))
+}
+
+// DeploymentLabelsFor returns the labels of the DeploymentLabels templates,
+// substituting {namespace} with the given namespace and {label:<key>} with
+// the value of the label <key> of the namespace, empty if missing. An error is
+// returned if a value isn't a valid label value after the substitution.
+func (d Config) DeploymentLabelsFor(namespace string, nsLabels map[string]string) (map[string]string, error) {
+	if len(d.DeploymentLabels) == 0 {
+		return nil, nil
+	}
+	ret := make(map[string]string, len(d.DeploymentLabels))
+	for _, key := range sets.List(sets.KeySet(d.DeploymentLabels)) {
+		template := d.DeploymentLabels[key]
+		value := labelTemplateToken.ReplaceAllStringFunc(template, func(token string) string {
+			token = token[1 : len(token)-1]
+			if token == "namespace" {
+				return namespace
+			}
+			return nsLabels[strings.TrimPrefix(token, "label:")]
+		})
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return nil, fmt.Errorf("%v %q is not a valid label value in namespace %q, was %q: %v",
+				deploymentLabelsKey, key, namespace, value, strings.Join(errs, "; "))
+		}
+		ret[key] = value
+	}
+	return ret, nil
+}
+
+// AffinityTypeForNamespace returns the default affinity type of the revisions
+// of the given namespace, which is the one of DefaultAffinityTypeOverrides if
+// any, and DefaultAffinityType otherwise.
+func (d Config) AffinityTypeForNamespace(ns string) AffinityType {
+	if t, ok := d.DefaultAffinityTypeOverrides[ns]; ok {
+		return t
+	}
+	return d.DefaultAffinityType
+}
+
+// QueueSidecarRunsAsNonRoot returns whether the queue proxy sidecar is
+// required to run as a non-root user, which it is unless
+// QueueSidecarRunAsNonRoot is false.
+func (d Config) QueueSidecarRunsAsNonRoot() bool {
+	return d.QueueSidecarRunAsNonRoot == nil || *d.QueueSidecarRunAsNonRoot
+}
+
+// SidecarContainersFor returns the SidecarContainers injected into the pods
+// of the revision with the given labels, named after their key and sorted by
+// name.
+func (d Config) SidecarContainersFor(lbs map[string]string) []corev1.Container {
+	var ret []corev1.Container
+	for _, name := range sets.List(sets.KeySet(d.SidecarContainers)) {
+		sidecar := d.SidecarContainers[name]
+		if !sidecar.Matches(lbs) {
+			continue
+		}
+		container := *sidecar.Container.DeepCopy()
+		container.Name = name
+		ret = append(ret, container)
+	}
+	return ret
+}
+
+// ForcesActivator returns whether the resource with the given labels must
+// always route through the activator, as if its target burst capacity was -1.
+func (d Config) ForcesActivator(lbs map[string]string) bool {
+	return d.ForceActivatorSelector != nil && d.ForceActivatorSelector.Matches(labels.Set(lbs))
+}
+
 type RuntimeClassNameLabelSelector struct {
 	Selector map[string]string `json:"selector,omitempty"`
+
+	// Service, if set, only matches the revisions of the service with this
+	// name, regardless of their other labels.
+	Service string `json:"service,omitempty"`
 }
 
+// specificity ranks the selectors matching the same revision: the selectors
+// with the most labels win, then the ones matching the service by name, then
+// the wildcards.
 func (s *RuntimeClassNameLabelSelector) specificity() int {
-	if s.Selector == nil {
-		return 0
+	ret := 2 * len(s.Selector)
+	if s.Service != "" {
+		ret++
+	}
+	return ret
+}
+
+// overlaps returns whether a revision may match both selectors, i.e. they
+// don't require different services or different values of the same label.
+func (s *RuntimeClassNameLabelSelector) overlaps(other *RuntimeClassNameLabelSelector) bool {
+	if s.Service != "" && other.Service != "" && s.Service != other.Service {
+		return false
+	}
+	for label, value := range s.Selector {
+		if v, ok := other.Selector[label]; ok && v != value {
+			return false
+		}
 	}
-	return len(s.Selector)
+	return true
 }
 
 func (s *RuntimeClassNameLabelSelector) Matches(labels map[string]string) bool {
+	if s.Service != "" && labels[serving.ServiceLabelKey] != s.Service {
+		return false
+	}
 	if s.Selector == nil {
 		return true
 	}
@@ -166,16 +839,41 @@ func (s *RuntimeClassNameLabelSelector) Matches(labels map[string]string) bool {
 	return true
 }
 
+// SidecarContainer is a container injected into the pods of the revisions
+// whose labels match its selector, all of them if the selector is empty.
+type SidecarContainer struct {
+	Selector  map[string]string `json:"selector,omitempty"`
+	Container corev1.Container  `json:"container"`
+}
+
+// Matches returns whether the sidecar is injected into the pods of the
+// revision with the given labels.
+func (s *SidecarContainer) Matches(lbs map[string]string) bool {
+	return labels.SelectorFromSet(s.Selector).Matches(labels.Set(lbs))
+}
+
+// RegistryRateLimit is the token bucket used to pace the tag-to-digest
+// resolution requests sent to a single registry.
+type RegistryRateLimit struct {
+	// QPS is the sustained number of resolution requests per second.
+	QPS float64 `json:"qps"`
+
+	// Burst is the maximum number of resolution requests sent at once.
+	Burst int `json:"burst"`
+}
+
 // NewConfigFromMap creates a DeploymentConfig from the supplied Map.
 func NewConfigFromMap(configMap map[string]string) (*Config, error) {
 	nc := defaultConfig()
 
-	var runtimeClassNames string
+	var affinityTypeOverrides, runtimeClassNames, sidecarContainers, defaultTolerations, defaultTopologySpreadConstraints, imagePullSecrets, deploymentLabels, podLabels, registriesResolutionRateLimits, digestResolutionTimeouts, digestResolutionTLSServerNames, goMemLimit, forceActivatorSelector, exportedImageLabels, requiredImageLabels, deniedImageLabels, acceptMediaTypes string
+	var rejectUnknownKeys bool
 	if err := cm.Parse(configMap,
 		// Legacy keys for backwards compatibility
 		cm.AsString(DeprecatedQueueSidecarImageKey, &nc.QueueSidecarImage),
 		cm.AsDuration("progressDeadline", &nc.ProgressDeadline),
 		cm.AsDuration("digestResolutionTimeout", &nc.DigestResolutionTimeout),
+		cm.AsInt("digestResolutionWorkers", &nc.DigestResolutionWorkers),
 		cm.AsStringSet("registriesSkippingTagResolving", &nc.RegistriesSkippingTagResolving),
 		cm.AsQuantity("queueSidecarCPURequest", &nc.QueueSidecarCPURequest),
 		cm.AsQuantity("queueSidecarMemoryRequest", &nc.QueueSidecarMemoryRequest),
@@ -185,29 +883,120 @@ func NewConfigFromMap(configMap map[string]string) (*Config, error) {
 		cm.AsQuantity("queueSidecarEphemeralStorageLimit", &nc.QueueSidecarEphemeralStorageLimit),
 
 		cm.AsString(QueueSidecarImageKey, &nc.QueueSidecarImage),
+		cm.AsBool(rejectUnknownKeysKey, &rejectUnknownKeys),
+		cm.AsBool(validateQueueSidecarImageKey, &nc.ValidateQueueSidecarImage),
 		cm.AsDuration(ProgressDeadlineKey, &nc.ProgressDeadline),
+		cm.AsBool(progressDeadlineAdvisoryKey, &nc.ProgressDeadlineAdvisory),
+		cm.AsDuration(progressDeadlineMaxKey, &nc.ProgressDeadlineMax),
+		cm.AsDuration(configChangeResyncDelayKey, &nc.ConfigChangeResyncDelay),
+		cm.AsInt32(revisionHistoryLimitKey, &nc.RevisionHistoryLimit),
+		cm.AsInt32(minReadySecondsKey, &nc.MinReadySeconds),
+		cm.AsBool(shareProcessNamespaceKey, &nc.ShareProcessNamespace),
+		cm.AsString(defaultPriorityClassNameKey, &nc.DefaultPriorityClassName),
+		cm.AsBool(adoptExistingDeploymentsKey, &nc.AdoptExistingDeployments),
 		cm.AsDuration(digestResolutionTimeoutKey, &nc.DigestResolutionTimeout),
+		cm.AsString(digestResolutionTimeoutsKey, &digestResolutionTimeouts),
+		cm.AsString(digestResolutionTLSServerNamesKey, &digestResolutionTLSServerNames),
+		cm.AsDuration(digestResolutionRetryBaseDelayKey, &nc.DigestResolutionRetryBaseDelay),
+		cm.AsDuration(digestResolutionRetryMaxDelayKey, &nc.DigestResolutionRetryMaxDelay),
+		cm.AsFloat64(digestResolutionRetryQPSKey, &nc.DigestResolutionRetryQPS),
+		cm.AsInt(digestResolutionRetryBurstKey, &nc.DigestResolutionRetryBurst),
+		cm.AsInt(digestResolutionWorkersKey, &nc.DigestResolutionWorkers),
+		cm.AsStringSet(digestResolutionBatchRegistriesKey, &nc.DigestResolutionBatchRegistries),
+		cm.AsInt(digestResolutionConcurrencyKey, &nc.DigestResolutionConcurrency),
+		cm.AsInt(digestResolutionNamespaceConcurrencyKey, &nc.DigestResolutionNamespaceConcurrency),
+		cm.AsInt(digestResolutionRegistryConnectionsKey, &nc.DigestResolutionRegistryConnections),
+		cm.AsDuration(digestResolutionCacheTTLKey, &nc.DigestResolutionCacheTTL),
+		cm.AsString(digestResolutionAcceptMediaTypesKey, &acceptMediaTypes),
+		cm.AsBool(digestResolutionFailureUnroutableKey, &nc.DigestResolutionFailureUnroutable),
+		cm.AsBool(digestResolutionVerifyLayersKey, &nc.DigestResolutionVerifyLayers),
+		cm.AsBool(digestResolutionPreferLazyPullKey, &nc.DigestResolutionPreferLazyPull),
+		cm.AsBool(digestResolutionIdentityHeaderKey, &nc.DigestResolutionIdentityHeader),
+		cm.AsBool(digestResolutionEventsKey, &nc.DigestResolutionEvents),
 		cm.AsStringSet(registriesSkippingTagResolvingKey, &nc.RegistriesSkippingTagResolving),
+		cm.AsString(exportedImageLabelsKey, &exportedImageLabels),
+		cm.AsString(requiredImageLabelsKey, &requiredImageLabels),
+		cm.AsString(deniedImageLabelsKey, &deniedImageLabels),
 
 		cm.AsQuantity(queueSidecarCPURequestKey, &nc.QueueSidecarCPURequest),
 		cm.AsQuantity(queueSidecarMemoryRequestKey, &nc.QueueSidecarMemoryRequest),
 		cm.AsQuantity(queueSidecarEphemeralStorageRequestKey, &nc.QueueSidecarEphemeralStorageRequest),
 		cm.AsQuantity(queueSidecarCPULimitKey, &nc.QueueSidecarCPULimit),
 		cm.AsQuantity(queueSidecarMemoryLimitKey, &nc.QueueSidecarMemoryLimit),
+		cm.AsString(queueSidecarGoMemLimitKey, &goMemLimit),
 		cm.AsQuantity(queueSidecarEphemeralStorageLimitKey, &nc.QueueSidecarEphemeralStorageLimit),
 
+		cm.AsQuantity(queueSidecarCPURequestBoundKey, &nc.QueueSidecarCPURequestBound),
+		cm.AsQuantity(queueSidecarMemoryRequestBoundKey, &nc.QueueSidecarMemoryRequestBound),
+		cm.AsInt(queueSidecarResourceBoundScaleKey, &nc.QueueSidecarResourceBoundScale),
+		cm.AsBool(queueSidecarResourceRationaleKey, &nc.QueueSidecarResourceRationale),
+		cm.AsBool(queueSidecarStrictResourceUnitsKey, &nc.QueueSidecarStrictResourceUnits),
+		cm.AsBool(queueSidecarCheckLimitRangesKey, &nc.QueueSidecarCheckLimitRanges),
+		cm.AsBool(queueSidecarSuppressOverloadDetailsKey, &nc.QueueSidecarSuppressOverloadDetails),
+		cm.AsInt(queueSidecarQueueFullStatusCodeKey, &nc.QueueSidecarQueueFullStatusCode),
+		cm.AsDuration(queueSidecarQueueFullRetryAfterKey, &nc.QueueSidecarQueueFullRetryAfter),
+		cm.AsString(queueSidecarQueueFullBodyKey, &nc.QueueSidecarQueueFullBody),
+		cm.AsDuration(queueSidecarBreakerDrainTimeoutKey, &nc.QueueSidecarBreakerDrainTimeout),
+		cm.AsInt(queueSidecarMaintenanceStatusCodeKey, &nc.QueueSidecarMaintenanceStatusCode),
+		cm.AsString(queueSidecarMaintenanceBodyKey, &nc.QueueSidecarMaintenanceBody),
+		cm.AsInt(queueSidecarMaxResponseHeadersKey, &nc.QueueSidecarMaxResponseHeaders),
+		cm.AsInt(queueSidecarMaxUpstreamConnectionsKey, &nc.QueueSidecarMaxUpstreamConnections),
+		cm.AsInt(queueSidecarH2MaxConcurrentStreamsKey, &nc.QueueSidecarH2MaxConcurrentStreams),
+		cm.AsInt64(queueSidecarMaxRequestBodyBytesKey, &nc.QueueSidecarMaxRequestBodyBytes),
+		cm.AsDuration(queueSidecarSlowRequestThresholdKey, &nc.QueueSidecarSlowRequestThreshold),
+		cm.AsDuration(queueSidecarResponseHeaderTimeoutKey, &nc.QueueSidecarResponseHeaderTimeout),
+		cm.AsBool(queueSidecarVersionHeaderKey, &nc.QueueSidecarVersionHeader),
+		cm.AsBool(queueSidecarCountProbeRequestsKey, &nc.QueueSidecarCountProbeRequests),
+		cm.AsBool(queueSidecarReportResponseClassesKey, &nc.QueueSidecarReportResponseClasses),
+		cm.AsBool(queueSidecarReportBreakerParamsKey, &nc.QueueSidecarReportBreakerParams),
+		cm.AsBool(queueSidecarLivenessProbeKey, &nc.QueueSidecarLivenessProbe),
+		cm.AsBool(queueSidecarUpstreamProtocolDetectionKey, &nc.QueueSidecarUpstreamProtocolDetection),
+		cm.AsString(queueSidecarRequestIDHeaderKey, &nc.QueueSidecarRequestIDHeader),
+		cm.AsBool(queueSidecarPrewarmKey, &nc.QueueSidecarPrewarm),
+		cm.AsString(queueSidecarPrewarmPathKey, &nc.QueueSidecarPrewarmPath),
+		cm.AsString(queueSidecarDrainReadinessPathKey, &nc.QueueSidecarDrainReadinessPath),
+		cm.AsString(queueSidecarDrainPathKey, &nc.QueueSidecarDrainPath),
+		cm.AsInt(queueSidecarClientConcurrencyLimitKey, &nc.QueueSidecarClientConcurrencyLimit),
+		cm.AsString(queueSidecarClientKeyHeaderKey, &nc.QueueSidecarClientKeyHeader),
+		cm.AsQuantity(queueSidecarMemorySheddingHighWaterMarkKey, &nc.QueueSidecarMemorySheddingHighWaterMark),
+		cm.AsQuantity(queueSidecarMemorySheddingLowWaterMarkKey, &nc.QueueSidecarMemorySheddingLowWaterMark),
+
 		cm.AsStringSet(queueSidecarTokenAudiencesKey, &nc.QueueSidecarTokenAudiences),
 		cm.AsString(queueSidecarRooCAKey, &nc.QueueSidecarRootCA),
 
 		cm.AsString(RuntimeClassNameKey, &runtimeClassNames),
+		cm.AsString(defaultRuntimeClassFallbackKey, &nc.DefaultRuntimeClassFallback),
+		cm.AsString(sidecarContainersKey, &sidecarContainers),
+		cm.AsString(defaultAffinityTypeOverridesKey, &affinityTypeOverrides),
+		cm.AsString(defaultTolerationsKey, &defaultTolerations),
+		cm.AsString(defaultTopologySpreadConstraintsKey, &defaultTopologySpreadConstraints),
+		cm.AsString(registriesResolutionRateLimitsKey, &registriesResolutionRateLimits),
+		cm.AsString(imagePullSecretsKey, &imagePullSecrets),
+		cm.AsString(deploymentLabelsKey, &deploymentLabels),
+		cm.AsBool(deploymentLabelsOnPodTemplateKey, &nc.DeploymentLabelsOnPodTemplate),
+		cm.AsString(podLabelsKey, &podLabels),
+		cm.AsString(forceActivatorSelectorKey, &forceActivatorSelector),
 	); err != nil {
 		return nil, err
 	}
 
+	if rejectUnknownKeys {
+		unknown := sets.KeySet(configMap).Difference(knownKeys).Delete(exampleKey)
+		if unknown.Len() > 0 {
+			return nil, fmt.Errorf("unknown keys %v, see %s", sets.List(unknown), rejectUnknownKeysKey)
+		}
+	}
+
 	if nc.QueueSidecarImage == "" {
 		return nil, errors.New("queue-sidecar-image cannot be empty or unset")
 	}
 
+	if nc.ValidateQueueSidecarImage && !strings.HasPrefix(nc.QueueSidecarImage, koImagePrefix) {
+		if _, err := name.ParseReference(nc.QueueSidecarImage, name.WeakValidation); err != nil {
+			return nil, fmt.Errorf("queue-sidecar-image %q is not a valid image reference: %w", nc.QueueSidecarImage, err)
+		}
+	}
+
 	if nc.ProgressDeadline <= 0 {
 		return nil, fmt.Errorf("progress-deadline cannot be a non-positive duration, was %v", nc.ProgressDeadline)
 	}
@@ -216,18 +1005,278 @@ func NewConfigFromMap(configMap map[string]string) (*Config, error) {
 		return nil, fmt.Errorf("progress-deadline must be rounded to a whole second, was: %v", nc.ProgressDeadline)
 	}
 
+	if d := nc.ProgressDeadlineMax; d < 0 || d.Truncate(time.Second) != d {
+		return nil, fmt.Errorf("%s must be a non-negative whole number of seconds, was %v", progressDeadlineMaxKey, d)
+	} else if d > 0 && d < nc.ProgressDeadline {
+		return nil, fmt.Errorf("%s cannot be shorter than %s, was %v < %v", progressDeadlineMaxKey, ProgressDeadlineKey, d, nc.ProgressDeadline)
+	}
+
+	if nc.RevisionHistoryLimit < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", revisionHistoryLimitKey, nc.RevisionHistoryLimit)
+	}
+
+	if nc.MinReadySeconds < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", minReadySecondsKey, nc.MinReadySeconds)
+	}
+	if pc := nc.DefaultPriorityClassName; pc != "" {
+		if errs := validation.IsDNS1123Subdomain(pc); len(errs) > 0 {
+			return nil, fmt.Errorf("%s %q is not a valid priority class name: %v", defaultPriorityClassNameKey, pc, strings.Join(errs, "; "))
+		}
+	}
+
 	if nc.DigestResolutionTimeout <= 0 {
 		return nil, fmt.Errorf("digest-resolution-timeout cannot be a non-positive duration, was %v", nc.DigestResolutionTimeout)
 	}
 
+	for _, registry := range sets.List(nc.RegistriesSkippingTagResolving) {
+		if err := validateRegistryHost(registry); err != nil {
+			return nil, fmt.Errorf("%v has an invalid registry %q: %w", registriesSkippingTagResolvingKey, registry, err)
+		}
+	}
+
+	var timeouts map[string]string
+	if err := yaml.Unmarshal([]byte(digestResolutionTimeouts), &timeouts); err != nil {
+		return nil, fmt.Errorf("%v cannot be parsed, please check the format: %w", digestResolutionTimeoutsKey, err)
+	}
+	for registry, timeout := range timeouts {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%v %v cannot be parsed as a duration: %w", digestResolutionTimeoutsKey, registry, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("%v %v cannot be a non-positive duration, was %v", digestResolutionTimeoutsKey, registry, d)
+		}
+		if nc.DigestResolutionTimeouts == nil {
+			nc.DigestResolutionTimeouts = make(map[string]time.Duration, len(timeouts))
+		}
+		nc.DigestResolutionTimeouts[registry] = d
+	}
+
+	if err := yaml.Unmarshal([]byte(digestResolutionTLSServerNames), &nc.DigestResolutionTLSServerNames); err != nil {
+		return nil, fmt.Errorf("%v cannot be parsed, please check the format: %w", digestResolutionTLSServerNamesKey, err)
+	}
+	for registry, serverName := range nc.DigestResolutionTLSServerNames {
+		if err := validateRegistryHost(registry); err != nil {
+			return nil, fmt.Errorf("%v has an invalid registry %q: %w", digestResolutionTLSServerNamesKey, registry, err)
+		}
+		if errs := validation.IsDNS1123Subdomain(serverName); len(errs) > 0 {
+			return nil, fmt.Errorf("%v has an invalid server name %q for registry %q: %v", digestResolutionTLSServerNamesKey, serverName, registry, strings.Join(errs, ", "))
+		}
+	}
+
+	if nc.DigestResolutionRetryBaseDelay <= 0 {
+		return nil, fmt.Errorf("%s cannot be a non-positive duration, was %v", digestResolutionRetryBaseDelayKey, nc.DigestResolutionRetryBaseDelay)
+	}
+	if nc.DigestResolutionRetryMaxDelay < nc.DigestResolutionRetryBaseDelay {
+		return nil, fmt.Errorf("%s cannot be shorter than %s, was %v", digestResolutionRetryMaxDelayKey, digestResolutionRetryBaseDelayKey, nc.DigestResolutionRetryMaxDelay)
+	}
+	if nc.DigestResolutionRetryQPS <= 0 {
+		return nil, fmt.Errorf("%s must be positive, was %v", digestResolutionRetryQPSKey, nc.DigestResolutionRetryQPS)
+	}
+	if nc.DigestResolutionRetryBurst < 1 {
+		return nil, fmt.Errorf("%s must be at least 1, was %d", digestResolutionRetryBurstKey, nc.DigestResolutionRetryBurst)
+	}
+
+	if d := nc.ConfigChangeResyncDelay; d < 0 || d.Truncate(time.Second) != d {
+		return nil, fmt.Errorf("%s must be a non-negative whole number of seconds, was %v", configChangeResyncDelayKey, d)
+	}
+
+	if nc.DigestResolutionWorkers < 1 {
+		return nil, fmt.Errorf("%s must be at least 1, was %d", digestResolutionWorkersKey, nc.DigestResolutionWorkers)
+	}
+	if nc.DigestResolutionConcurrency < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", digestResolutionConcurrencyKey, nc.DigestResolutionConcurrency)
+	}
+	if nc.DigestResolutionNamespaceConcurrency < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", digestResolutionNamespaceConcurrencyKey, nc.DigestResolutionNamespaceConcurrency)
+	}
+	if nc.DigestResolutionRegistryConnections < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", digestResolutionRegistryConnectionsKey, nc.DigestResolutionRegistryConnections)
+	}
+	if nc.DigestResolutionCacheTTL < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %v", digestResolutionCacheTTLKey, nc.DigestResolutionCacheTTL)
+	}
+
+	if nc.QueueSidecarResourceBoundScale < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", queueSidecarResourceBoundScaleKey, nc.QueueSidecarResourceBoundScale)
+	}
+	if c := nc.QueueSidecarQueueFullStatusCode; c != http.StatusServiceUnavailable && c != http.StatusTooManyRequests {
+		return nil, fmt.Errorf("%s must be %d or %d, was %d", queueSidecarQueueFullStatusCodeKey,
+			http.StatusServiceUnavailable, http.StatusTooManyRequests, c)
+	}
+	if d := nc.QueueSidecarQueueFullRetryAfter; d < 0 || d.Truncate(time.Second) != d {
+		return nil, fmt.Errorf("%s must be a non-negative whole number of seconds, was %v", queueSidecarQueueFullRetryAfterKey, d)
+	}
+	if d := nc.QueueSidecarBreakerDrainTimeout; d < 0 || d.Truncate(time.Second) != d {
+		return nil, fmt.Errorf("%s must be a non-negative whole number of seconds, was %v", queueSidecarBreakerDrainTimeoutKey, d)
+	}
+	if c := nc.QueueSidecarMaintenanceStatusCode; c < 400 || c > 599 {
+		return nil, fmt.Errorf("%s must be a client or server error status code, was %d", queueSidecarMaintenanceStatusCodeKey, c)
+	}
+	if nc.QueueSidecarMaxResponseHeaders < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", queueSidecarMaxResponseHeadersKey, nc.QueueSidecarMaxResponseHeaders)
+	}
+	if nc.QueueSidecarMaxUpstreamConnections < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", queueSidecarMaxUpstreamConnectionsKey, nc.QueueSidecarMaxUpstreamConnections)
+	}
+	if nc.QueueSidecarH2MaxConcurrentStreams < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", queueSidecarH2MaxConcurrentStreamsKey, nc.QueueSidecarH2MaxConcurrentStreams)
+	}
+	if nc.QueueSidecarMaxRequestBodyBytes < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", queueSidecarMaxRequestBodyBytesKey, nc.QueueSidecarMaxRequestBodyBytes)
+	}
+	if d := nc.QueueSidecarSlowRequestThreshold; d < 0 || d.Truncate(time.Millisecond) != d {
+		return nil, fmt.Errorf("%s must be a non-negative whole number of milliseconds, was %v", queueSidecarSlowRequestThresholdKey, d)
+	}
+	if d := nc.QueueSidecarResponseHeaderTimeout; d < 0 || d.Truncate(time.Second) != d {
+		return nil, fmt.Errorf("%s must be a non-negative whole number of seconds, was %v", queueSidecarResponseHeaderTimeoutKey, d)
+	}
+	if h := nc.QueueSidecarRequestIDHeader; h != "" && !httpguts.ValidHeaderFieldName(h) {
+		return nil, fmt.Errorf("%s is not a valid header name, was %q", queueSidecarRequestIDHeaderKey, h)
+	}
+	if p := nc.QueueSidecarPrewarmPath; p != "" && !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("%s must be an absolute path, was %q", queueSidecarPrewarmPathKey, p)
+	}
+	if p := nc.QueueSidecarDrainReadinessPath; p != "" && !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("%s must be an absolute path, was %q", queueSidecarDrainReadinessPathKey, p)
+	}
+	switch p := nc.QueueSidecarDrainPath; {
+	case p == "":
+	case !strings.HasPrefix(p, "/"):
+		return nil, fmt.Errorf("%s must be an absolute path, was %q", queueSidecarDrainPathKey, p)
+	case p == networking.QueueDrainPath || p == networking.QueueSelfHealthPath:
+		return nil, fmt.Errorf("%s is reserved by the queue proxy, was %q", queueSidecarDrainPathKey, p)
+	}
+	if nc.QueueSidecarClientConcurrencyLimit < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", queueSidecarClientConcurrencyLimitKey, nc.QueueSidecarClientConcurrencyLimit)
+	}
+	if h := nc.QueueSidecarClientKeyHeader; h != "" && !httpguts.ValidHeaderFieldName(h) {
+		return nil, fmt.Errorf("%s is not a valid header name, was %q", queueSidecarClientKeyHeaderKey, h)
+	}
+	if low := nc.QueueSidecarMemorySheddingLowWaterMark; low != nil {
+		if high := nc.QueueSidecarMemorySheddingHighWaterMark; high == nil {
+			return nil, fmt.Errorf("%s requires %s to be set", queueSidecarMemorySheddingLowWaterMarkKey, queueSidecarMemorySheddingHighWaterMarkKey)
+		} else if low.Cmp(*high) > 0 {
+			return nil, fmt.Errorf("%s cannot exceed %s, was %v > %v", queueSidecarMemorySheddingLowWaterMarkKey,
+				queueSidecarMemorySheddingHighWaterMarkKey, low, high)
+		}
+	}
+	if v, ok := configMap[queueSidecarRunAsUserKey]; ok {
+		uid, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", queueSidecarRunAsUserKey, err)
+		}
+		if errs := validation.IsValidUserID(uid); len(errs) > 0 {
+			return nil, fmt.Errorf("%s is not a valid user ID: %v", queueSidecarRunAsUserKey, strings.Join(errs, "; "))
+		}
+		nc.QueueSidecarRunAsUser = &uid
+	}
+	if v, ok := configMap[queueSidecarRunAsGroupKey]; ok {
+		gid, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", queueSidecarRunAsGroupKey, err)
+		}
+		if errs := validation.IsValidGroupID(gid); len(errs) > 0 {
+			return nil, fmt.Errorf("%s is not a valid group ID: %v", queueSidecarRunAsGroupKey, strings.Join(errs, "; "))
+		}
+		nc.QueueSidecarRunAsGroup = &gid
+	}
+	if v, ok := configMap[queueSidecarRunAsNonRootKey]; ok {
+		nonRoot, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", queueSidecarRunAsNonRootKey, err)
+		}
+		nc.QueueSidecarRunAsNonRoot = &nonRoot
+	}
+	// The kubelet refuses to start a container required to run as non-root
+	// with the root user.
+	if uid := nc.QueueSidecarRunAsUser; uid != nil && *uid == 0 && nc.QueueSidecarRunsAsNonRoot() {
+		return nil, fmt.Errorf("%s cannot be 0 unless %s is false", queueSidecarRunAsUserKey, queueSidecarRunAsNonRootKey)
+	}
+	switch goMemLimit {
+	case "":
+	case QueueSidecarGoMemLimitAuto:
+		nc.QueueSidecarGoMemLimitAuto = true
+	default:
+		q, err := resource.ParseQuantity(goMemLimit)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be %q or a quantity, was %q: %w", queueSidecarGoMemLimitKey, QueueSidecarGoMemLimitAuto, goMemLimit, err)
+		}
+		if q.Sign() <= 0 {
+			return nil, fmt.Errorf("%s must be positive, was %v", queueSidecarGoMemLimitKey, &q)
+		}
+		if nc.QueueSidecarMemoryLimit != nil && q.Cmp(*nc.QueueSidecarMemoryLimit) > 0 {
+			return nil, fmt.Errorf("%s %v cannot exceed %s %v", queueSidecarGoMemLimitKey, &q, queueSidecarMemoryLimitKey, nc.QueueSidecarMemoryLimit)
+		}
+		nc.QueueSidecarGoMemLimit = &q
+	}
+	if nc.QueueSidecarStrictResourceUnits {
+		if err := checkResourceUnits(nc); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkResourceBound(queueSidecarCPURequestKey, nc.QueueSidecarCPURequest,
+		queueSidecarCPURequestBoundKey, nc.QueueSidecarCPURequestBound, nc.QueueSidecarResourceBoundScale); err != nil {
+		return nil, err
+	}
+	if err := checkResourceBound(queueSidecarMemoryRequestKey, nc.QueueSidecarMemoryRequest,
+		queueSidecarMemoryRequestBoundKey, nc.QueueSidecarMemoryRequestBound, nc.QueueSidecarResourceBoundScale); err != nil {
+		return nil, err
+	}
+
 	if affinity, ok := configMap[defaultAffinityTypeKey]; ok {
 		switch opt := AffinityType(affinity); opt {
-		case None, PreferSpreadRevisionOverNodes:
+		case None, PreferSpreadRevisionOverNodes, SpreadRevisionOverNodes:
 			nc.DefaultAffinityType = opt
 		default:
 			return nil, fmt.Errorf("unsupported %s value: %q", defaultAffinityTypeKey, affinity)
 		}
 	}
+	var overrides map[string]string
+	if err := yaml.Unmarshal([]byte(affinityTypeOverrides), &overrides); err != nil {
+		return nil, fmt.Errorf("%v cannot be parsed, please check the format: %w", defaultAffinityTypeOverridesKey, err)
+	}
+	for namespace, affinity := range overrides {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return nil, fmt.Errorf("%v %q is not a valid namespace: %v", defaultAffinityTypeOverridesKey, namespace, strings.Join(errs, "; "))
+		}
+		switch opt := AffinityType(affinity); opt {
+		case None, PreferSpreadRevisionOverNodes, SpreadRevisionOverNodes:
+			if nc.DefaultAffinityTypeOverrides == nil {
+				nc.DefaultAffinityTypeOverrides = make(map[string]AffinityType, len(overrides))
+			}
+			nc.DefaultAffinityTypeOverrides[namespace] = opt
+		default:
+			return nil, fmt.Errorf("unsupported %s value for namespace %q: %q", defaultAffinityTypeOverridesKey, namespace, affinity)
+		}
+	}
+
+	if action, ok := configMap[topologySpreadWhenUnsatisfiableKey]; ok {
+		switch opt := corev1.UnsatisfiableConstraintAction(action); opt {
+		case corev1.ScheduleAnyway, corev1.DoNotSchedule:
+			nc.TopologySpreadWhenUnsatisfiable = opt
+		default:
+			return nil, fmt.Errorf("unsupported %s value: %q", topologySpreadWhenUnsatisfiableKey, action)
+		}
+	}
+
+	if antiAffinity, ok := configMap[crossRevisionAntiAffinityKey]; ok {
+		switch opt := CrossRevisionAntiAffinityType(antiAffinity); opt {
+		case CrossRevisionAntiAffinityNone, CrossRevisionAntiAffinityPreferred, CrossRevisionAntiAffinityRequired:
+			nc.CrossRevisionAntiAffinity = opt
+		default:
+			return nil, fmt.Errorf("unsupported %s value: %q", crossRevisionAntiAffinityKey, antiAffinity)
+		}
+	}
+
+	if handling, ok := configMap[queueSidecarHTTP10HandlingKey]; ok {
+		switch opt := HTTP10HandlingType(handling); opt {
+		case HTTP10Compatibility, HTTP10Reject:
+			nc.QueueSidecarHTTP10Handling = opt
+		default:
+			return nil, fmt.Errorf("unsupported %s value: %q", queueSidecarHTTP10HandlingKey, handling)
+		}
+	}
 	if err := yaml.Unmarshal([]byte(runtimeClassNames), &nc.RuntimeClassNames); err != nil {
 		return nil, fmt.Errorf("%v cannot be parsed, please check the format: %w", RuntimeClassNameKey, err)
 	}
@@ -240,10 +1289,438 @@ func NewConfigFromMap(configMap map[string]string) (*Config, error) {
 				return nil, fmt.Errorf("%v %v selector invalid: %w", RuntimeClassNameKey, class, err)
 			}
 		}
+		if errs := validation.IsValidLabelValue(rcn.Service); len(errs) > 0 {
+			return nil, fmt.Errorf("%v %v service invalid: %v", RuntimeClassNameKey, class, errs)
+		}
+	}
+	if fallback := nc.DefaultRuntimeClassFallback; fallback != "" {
+		if errs := apimachineryvalidation.NameIsDNSSubdomain(fallback, false); len(errs) > 0 {
+			return nil, fmt.Errorf("%v %q is not a valid runtime class name: %v", defaultRuntimeClassFallbackKey, fallback, strings.Join(errs, "; "))
+		}
+	}
+	if err := yaml.Unmarshal([]byte(sidecarContainers), &nc.SidecarContainers); err != nil {
+		return nil, fmt.Errorf("%v cannot be parsed, please check the format: %w", sidecarContainersKey, err)
+	}
+	for name, sidecar := range nc.SidecarContainers {
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return nil, fmt.Errorf("%v %q is not a valid container name: %v", sidecarContainersKey, name, strings.Join(errs, "; "))
+		}
+		if sidecar.Container.Image == "" {
+			return nil, fmt.Errorf("%v %q has no image", sidecarContainersKey, name)
+		}
+		if _, err := labels.ValidatedSelectorFromSet(sidecar.Selector); err != nil {
+			return nil, fmt.Errorf("%v %q selector invalid: %w", sidecarContainersKey, name, err)
+		}
+	}
+	if err := yaml.Unmarshal([]byte(defaultTolerations), &nc.DefaultTolerations); err != nil {
+		return nil, fmt.Errorf("%v cannot be parsed, please check the format: %w", defaultTolerationsKey, err)
+	}
+	for i, toleration := range nc.DefaultTolerations {
+		if err := validateToleration(toleration); err != nil {
+			return nil, fmt.Errorf("%v entry %d is invalid: %w", defaultTolerationsKey, i, err)
+		}
+	}
+	if err := yaml.Unmarshal([]byte(defaultTopologySpreadConstraints), &nc.DefaultTopologySpreadConstraints); err != nil {
+		return nil, fmt.Errorf("%v cannot be parsed, please check the format: %w", defaultTopologySpreadConstraintsKey, err)
+	}
+	seenConstraints := sets.New[string]()
+	for i := range nc.DefaultTopologySpreadConstraints {
+		constraint := &nc.DefaultTopologySpreadConstraints[i]
+		if constraint.MaxSkew == 0 {
+			constraint.MaxSkew = 1
+		}
+		if err := validateTopologySpreadConstraint(*constraint); err != nil {
+			return nil, fmt.Errorf("%v entry %d is invalid: %w", defaultTopologySpreadConstraintsKey, i, err)
+		}
+		// The API server rejects the pods with several constraints on the same
+		// topology key and whenUnsatisfiable.
+		key := constraint.TopologyKey + "/" + string(constraint.WhenUnsatisfiable)
+		if seenConstraints.Has(key) {
+			return nil, fmt.Errorf("%v entry %d duplicates the topologyKey %q with whenUnsatisfiable %q", defaultTopologySpreadConstraintsKey, i, constraint.TopologyKey, constraint.WhenUnsatisfiable)
+		}
+		seenConstraints.Insert(key)
+	}
+	seenSecrets := sets.New[string]()
+	for _, secret := range strings.Split(imagePullSecrets, ",") {
+		if secret = strings.TrimSpace(secret); secret == "" || seenSecrets.Has(secret) {
+			continue
+		}
+		if errs := apimachineryvalidation.NameIsDNSSubdomain(secret, false); len(errs) > 0 {
+			return nil, fmt.Errorf("%s %q is not a valid secret name: %v", imagePullSecretsKey, secret, strings.Join(errs, "; "))
+		}
+		seenSecrets.Insert(secret)
+		nc.ImagePullSecrets = append(nc.ImagePullSecrets, secret)
+	}
+	if err := yaml.Unmarshal([]byte(deploymentLabels), &nc.DeploymentLabels); err != nil {
+		return nil, fmt.Errorf("%v cannot be parsed, please check the format: %w", deploymentLabelsKey, err)
+	}
+	for key, template := range nc.DeploymentLabels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("%v %q is not a valid label key: %v", deploymentLabelsKey, key, strings.Join(errs, "; "))
+		}
+		if isKnativeLabel(key) {
+			return nil, fmt.Errorf("%v %q is a label reserved by Knative", deploymentLabelsKey, key)
+		}
+		for _, token := range labelTemplateToken.FindAllStringSubmatch(template, -1) {
+			if token[1] != "namespace" && !strings.HasPrefix(token[1], "label:") {
+				return nil, fmt.Errorf("%v %q has unsupported token %q", deploymentLabelsKey, key, token[0])
+			}
+		}
+	}
+	if err := yaml.Unmarshal([]byte(podLabels), &nc.PodLabels); err != nil {
+		return nil, fmt.Errorf("%v cannot be parsed, please check the format: %w", podLabelsKey, err)
+	}
+	for key, value := range nc.PodLabels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("%v %q is not a valid label key: %v", podLabelsKey, key, strings.Join(errs, "; "))
+		}
+		if isKnativeLabel(key) {
+			return nil, fmt.Errorf("%v %q is a label reserved by Knative", podLabelsKey, key)
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return nil, fmt.Errorf("%v %q has an invalid value %q: %v", podLabelsKey, key, value, strings.Join(errs, "; "))
+		}
+	}
+	if err := yaml.Unmarshal([]byte(registriesResolutionRateLimits), &nc.RegistriesResolutionRateLimits); err != nil {
+		return nil, fmt.Errorf("%v cannot be parsed, please check the format: %w", registriesResolutionRateLimitsKey, err)
+	}
+	for registry, limit := range nc.RegistriesResolutionRateLimits {
+		if limit.QPS <= 0 {
+			return nil, fmt.Errorf("%v %v qps must be positive, was %v", registriesResolutionRateLimitsKey, registry, limit.QPS)
+		}
+		if limit.Burst < 1 {
+			return nil, fmt.Errorf("%v %v burst must be at least 1, was %d", registriesResolutionRateLimitsKey, registry, limit.Burst)
+		}
+	}
+	if forceActivatorSelector != "" {
+		selector, err := labels.Parse(forceActivatorSelector)
+		if err != nil {
+			return nil, fmt.Errorf("%v cannot be parsed: %w", forceActivatorSelectorKey, err)
+		}
+		nc.ForceActivatorSelector = selector
+	}
+	proxyHeader, err := ActivatorProxyHeaderFromMap(configMap)
+	if err != nil {
+		return nil, err
+	}
+	nc.ActivatorProxyHeader = proxyHeader
+	// The settings of the activator are only read by the activator, they are
+	// parsed here too so that invalid ones are rejected by the webhook.
+	if _, err := NewActivatorConfigFromMap(configMap); err != nil {
+		return nil, err
+	}
+	for _, mediaType := range strings.Split(acceptMediaTypes, ",") {
+		if mediaType = strings.TrimSpace(mediaType); mediaType == "" {
+			continue
+		}
+		if mt := types.MediaType(mediaType); !mt.IsIndex() && !mt.IsImage() {
+			return nil, fmt.Errorf("%s %q is not an image manifest or index media type", digestResolutionAcceptMediaTypesKey, mediaType)
+		}
+		nc.DigestResolutionAcceptMediaTypes = append(nc.DigestResolutionAcceptMediaTypes, mediaType)
+	}
+	for _, label := range strings.Split(exportedImageLabels, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			if nc.ExportedImageLabels == nil {
+				nc.ExportedImageLabels = sets.New[string]()
+			}
+			nc.ExportedImageLabels.Insert(label)
+		}
+	}
+	for _, pair := range strings.Split(requiredImageLabels, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		label, value, ok := strings.Cut(pair, "=")
+		if label = strings.TrimSpace(label); !ok || label == "" {
+			return nil, fmt.Errorf("%s entry %q must be of the form label=value", requiredImageLabelsKey, pair)
+		}
+		if nc.RequiredImageLabels == nil {
+			nc.RequiredImageLabels = make(map[string]string)
+		}
+		nc.RequiredImageLabels[label] = strings.TrimSpace(value)
+	}
+	for _, pair := range strings.Split(deniedImageLabels, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		label, value, ok := strings.Cut(pair, "=")
+		if label = strings.TrimSpace(label); !ok || label == "" {
+			return nil, fmt.Errorf("%s entry %q must be of the form label=value", deniedImageLabelsKey, pair)
+		}
+		if nc.DeniedImageLabels == nil {
+			nc.DeniedImageLabels = make(map[string]sets.Set[string])
+		}
+		if nc.DeniedImageLabels[label] == nil {
+			nc.DeniedImageLabels[label] = sets.New[string]()
+		}
+		nc.DeniedImageLabels[label].Insert(strings.TrimSpace(value))
 	}
 	return nc, nil
 }
 
+// checkResourceBound verifies that the queue sidecar resource request, multiplied
+// by the expected number of queue sidecars sharing a node, stays within the
+// configured sanity bound. A nil request or bound disables the check.
+func checkResourceBound(requestKey string, request *resource.Quantity, boundKey string, bound *resource.Quantity, scale int) error {
+	if request == nil || bound == nil {
+		return nil
+	}
+	if scale < 1 {
+		scale = 1
+	}
+	total := request.DeepCopy()
+	total.Mul(int64(scale))
+	if total.Cmp(*bound) > 0 {
+		return fmt.Errorf("%s %v multiplied by %s %d exceeds %s %v",
+			requestKey, request, queueSidecarResourceBoundScaleKey, scale, boundKey, bound)
+	}
+	return nil
+}
+
+// checkResourceUnits rejects the queue sidecar resources whose units are most
+// likely a typo of milli (m) for mega (M), or vice versa: a memory or
+// ephemeral storage quantity that is a fraction of a byte, or a CPU quantity
+// of a million cores or more.
+func checkResourceUnits(nc *Config) error {
+	for _, r := range []struct {
+		key string
+		q   *resource.Quantity
+	}{
+		{queueSidecarMemoryRequestKey, nc.QueueSidecarMemoryRequest},
+		{queueSidecarMemoryLimitKey, nc.QueueSidecarMemoryLimit},
+		{queueSidecarEphemeralStorageRequestKey, nc.QueueSidecarEphemeralStorageRequest},
+		{queueSidecarEphemeralStorageLimitKey, nc.QueueSidecarEphemeralStorageLimit},
+	} {
+		if r.q != nil && r.q.MilliValue()%1000 != 0 {
+			return fmt.Errorf("%s %v is a fraction of a byte, did you mean mega (M) rather than milli (m)?", r.key, r.q)
+		}
+	}
+	for _, r := range []struct {
+		key string
+		q   *resource.Quantity
+	}{
+		{queueSidecarCPURequestKey, nc.QueueSidecarCPURequest},
+		{queueSidecarCPULimitKey, nc.QueueSidecarCPULimit},
+	} {
+		if r.q != nil && r.q.Cmp(strictCPUUnitsBound) >= 0 {
+			return fmt.Errorf("%s %v is a million cores or more, did you mean milli (m) rather than mega (M)?", r.key, r.q)
+		}
+	}
+	return nil
+}
+
+// ProxyHeader is the header the activator sets on the requests it proxies,
+// which the queue-proxy uses to tell them from the ones sent to it directly.
+type ProxyHeader struct {
+	// Name is the header name, empty if the header is suppressed.
+	Name string
+	// Value is the header value.
+	Value string
+}
+
+// DefaultActivatorProxyHeader is the header set by the activator unless
+// configured otherwise. Its value is the name of the activator component.
+var DefaultActivatorProxyHeader = ProxyHeader{Name: netheader.ProxyKey, Value: "activator"}
+
+// ActivatorProxyHeaderFromMap parses the header the activator identifies
+// itself with from the config map data, nil if neither of its keys is set.
+func ActivatorProxyHeaderFromMap(configMap map[string]string) (*ProxyHeader, error) {
+	_, hasName := configMap[ActivatorProxyHeaderNameKey]
+	_, hasValue := configMap[ActivatorProxyHeaderValueKey]
+	if !hasName && !hasValue {
+		return nil, nil
+	}
+	ph := DefaultActivatorProxyHeader
+	if err := cm.Parse(configMap,
+		cm.AsString(ActivatorProxyHeaderNameKey, &ph.Name),
+		cm.AsString(ActivatorProxyHeaderValueKey, &ph.Value),
+	); err != nil {
+		return nil, err
+	}
+	if ph.Name == "" {
+		return &ProxyHeader{}, nil
+	}
+	if !httpguts.ValidHeaderFieldName(ph.Name) {
+		return nil, fmt.Errorf("%s is not a valid header name, was %q", ActivatorProxyHeaderNameKey, ph.Name)
+	}
+	if ph.Value == "" || !httpguts.ValidHeaderFieldValue(ph.Value) {
+		return nil, fmt.Errorf("%s is not a valid header value, was %q", ActivatorProxyHeaderValueKey, ph.Value)
+	}
+	return &ph, nil
+}
+
+// ActivatorConfig is the configuration of the activator in the
+// config-deployment.
+type ActivatorConfig struct {
+	// ProxyHeader is the header the activator identifies itself with on the
+	// requests it proxies.
+	ProxyHeader ProxyHeader
+
+	// EndpointsRetryInterval is how long to wait before looking for an
+	// endpoint of a revision again after finding none. Zero retries as soon
+	// as the revision's capacity allows it.
+	EndpointsRetryInterval time.Duration
+
+	// EndpointsMaxWait is how long a request waits for an endpoint of its
+	// revision to become available. Zero waits until the request is done.
+	EndpointsMaxWait time.Duration
+
+	// ColdStartQueueLength is the maximum number of requests queued for a
+	// revision without endpoints. Zero means unlimited.
+	ColdStartQueueLength int
+
+	// MaxConcurrentColdStarts is the maximum number of revisions without
+	// endpoints the activator scales from zero at the same time. Zero means
+	// unlimited.
+	MaxConcurrentColdStarts int
+
+	// LoadBalancingPolicy is how the requests of a revision are balanced over
+	// its pods.
+	LoadBalancingPolicy LoadBalancingPolicy
+
+	// LoadBalancingHashHeader is the header keying the consistent-hash load
+	// balancing policy.
+	LoadBalancingHashHeader string
+
+	// PreferLocalZone routes the requests to the pods in the activator's zone
+	// while they have capacity, and to the ones in other zones otherwise.
+	PreferLocalZone bool
+
+	// CapacityShrinkPolicy is how the capacity of a revision shrinks below its
+	// requests in flight.
+	CapacityShrinkPolicy ShrinkPolicy
+
+	// BackendTLSVerification is what happens to the requests to a backend
+	// whose certificate fails the verification.
+	BackendTLSVerification BackendTLSVerification
+
+	// MaxHeldRequestBytes is the total size of the request bodies held while
+	// waiting for a backend, beyond which requests are rejected. Zero means
+	// unlimited.
+	MaxHeldRequestBytes int64
+}
+
+// LoadBalancingPolicy is the type for the activator's load balancing policy.
+type LoadBalancingPolicy string
+
+const (
+	// LoadBalancingPolicyDefault picks the policy by the container
+	// concurrency of the revision.
+	LoadBalancingPolicyDefault LoadBalancingPolicy = "default"
+
+	// LoadBalancingPolicyConsistentHash routes the requests carrying the same
+	// value in the LoadBalancingHashHeader consistently to the same pod.
+	// Requests without the header use the default policy.
+	LoadBalancingPolicyConsistentHash LoadBalancingPolicy = "consistent-hash"
+)
+
+// BackendTLSVerification is the type for the activator's reaction to a backend
+// certificate failing the verification.
+type BackendTLSVerification string
+
+const (
+	// BackendTLSVerificationStrict fails the request with a 502 when the
+	// certificate of the backend fails the verification.
+	BackendTLSVerificationStrict BackendTLSVerification = "strict"
+
+	// BackendTLSVerificationPermissive only logs the verification failures and
+	// lets the request through. It is meant to ease rolling out
+	// system-internal-tls.
+	BackendTLSVerificationPermissive BackendTLSVerification = "permissive"
+)
+
+// ShrinkPolicy is the type for how the activator shrinks the capacity of a
+// revision below its requests in flight. No policy ever evicts a request in
+// flight.
+type ShrinkPolicy string
+
+const (
+	// ShrinkPolicyGraceful applies the new capacity right away: no request is
+	// admitted until enough of the ones in flight complete to get below it.
+	ShrinkPolicyGraceful ShrinkPolicy = "graceful"
+
+	// ShrinkPolicyLazy drops the free slots right away and retires the ones
+	// held by the requests in flight as they complete, until the new capacity
+	// is reached. The capacity never drops below the requests in flight.
+	ShrinkPolicyLazy ShrinkPolicy = "lazy"
+)
+
+// DefaultActivatorConfig returns the ActivatorConfig used when the
+// config-deployment sets none of its keys.
+func DefaultActivatorConfig() *ActivatorConfig {
+	return &ActivatorConfig{
+		ProxyHeader:            DefaultActivatorProxyHeader,
+		LoadBalancingPolicy:    LoadBalancingPolicyDefault,
+		CapacityShrinkPolicy:   ShrinkPolicyGraceful,
+		BackendTLSVerification: BackendTLSVerificationStrict,
+	}
+}
+
+// NewActivatorConfigFromMap creates an ActivatorConfig from the supplied Map.
+func NewActivatorConfigFromMap(configMap map[string]string) (*ActivatorConfig, error) {
+	ac := DefaultActivatorConfig()
+	if ph, err := ActivatorProxyHeaderFromMap(configMap); err != nil {
+		return nil, err
+	} else if ph != nil {
+		ac.ProxyHeader = *ph
+	}
+	if err := cm.Parse(configMap,
+		cm.AsDuration(ActivatorEndpointsRetryIntervalKey, &ac.EndpointsRetryInterval),
+		cm.AsDuration(ActivatorEndpointsMaxWaitKey, &ac.EndpointsMaxWait),
+		cm.AsInt(ActivatorColdStartQueueLengthKey, &ac.ColdStartQueueLength),
+		cm.AsInt(ActivatorMaxConcurrentColdStartsKey, &ac.MaxConcurrentColdStarts),
+		cm.AsString(ActivatorLoadBalancingHashHeaderKey, &ac.LoadBalancingHashHeader),
+		cm.AsBool(ActivatorPreferLocalZoneKey, &ac.PreferLocalZone),
+		cm.AsInt64(ActivatorMaxHeldRequestBytesKey, &ac.MaxHeldRequestBytes),
+	); err != nil {
+		return nil, err
+	}
+	if ac.EndpointsRetryInterval < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %v", ActivatorEndpointsRetryIntervalKey, ac.EndpointsRetryInterval)
+	}
+	if ac.EndpointsMaxWait < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %v", ActivatorEndpointsMaxWaitKey, ac.EndpointsMaxWait)
+	}
+	if ac.ColdStartQueueLength < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", ActivatorColdStartQueueLengthKey, ac.ColdStartQueueLength)
+	}
+	if ac.MaxConcurrentColdStarts < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", ActivatorMaxConcurrentColdStartsKey, ac.MaxConcurrentColdStarts)
+	}
+	if ac.MaxHeldRequestBytes < 0 {
+		return nil, fmt.Errorf("%s cannot be negative, was %d", ActivatorMaxHeldRequestBytesKey, ac.MaxHeldRequestBytes)
+	}
+	if policy, ok := configMap[ActivatorLoadBalancingPolicyKey]; ok {
+		switch opt := LoadBalancingPolicy(policy); opt {
+		case LoadBalancingPolicyDefault, LoadBalancingPolicyConsistentHash:
+			ac.LoadBalancingPolicy = opt
+		default:
+			return nil, fmt.Errorf("unsupported %s value: %q", ActivatorLoadBalancingPolicyKey, policy)
+		}
+	}
+	if policy, ok := configMap[ActivatorCapacityShrinkPolicyKey]; ok {
+		switch opt := ShrinkPolicy(policy); opt {
+		case ShrinkPolicyGraceful, ShrinkPolicyLazy:
+			ac.CapacityShrinkPolicy = opt
+		default:
+			return nil, fmt.Errorf("unsupported %s value: %q", ActivatorCapacityShrinkPolicyKey, policy)
+		}
+	}
+	if mode, ok := configMap[ActivatorBackendTLSVerificationKey]; ok {
+		switch opt := BackendTLSVerification(mode); opt {
+		case BackendTLSVerificationStrict, BackendTLSVerificationPermissive:
+			ac.BackendTLSVerification = opt
+		default:
+			return nil, fmt.Errorf("unsupported %s value: %q", ActivatorBackendTLSVerificationKey, mode)
+		}
+	}
+	if ac.LoadBalancingPolicy == LoadBalancingPolicyConsistentHash && !httpguts.ValidHeaderFieldName(ac.LoadBalancingHashHeader) {
+		return nil, fmt.Errorf("%s must be a valid header name with %s %q, was %q", ActivatorLoadBalancingHashHeaderKey,
+			ActivatorLoadBalancingPolicyKey, LoadBalancingPolicyConsistentHash, ac.LoadBalancingHashHeader)
+	}
+	return ac, nil
+}
+
 // NewConfigFromConfigMap creates a DeploymentConfig from the supplied configMap.
 func NewConfigFromConfigMap(config *corev1.ConfigMap) (*Config, error) {
 	return NewConfigFromMap(config.Data)
@@ -258,6 +1735,36 @@ const (
 
 	// PreferSpreadRevisionOverNodes is used to set pod anti-affinity requirements for user workloads.
 	PreferSpreadRevisionOverNodes AffinityType = "prefer-spread-revision-over-nodes"
+
+	// SpreadRevisionOverNodes is used to set a topology spread constraint over nodes for user workloads.
+	SpreadRevisionOverNodes AffinityType = "spread-revision-over-nodes"
+)
+
+// CrossRevisionAntiAffinityType specifies how strictly the pods of all the revisions are kept
+// from sharing a node.
+type CrossRevisionAntiAffinityType string
+
+const (
+	// CrossRevisionAntiAffinityNone lets the pods of any revisions share a node.
+	CrossRevisionAntiAffinityNone CrossRevisionAntiAffinityType = "none"
+
+	// CrossRevisionAntiAffinityPreferred prefers nodes without pods of any revision.
+	CrossRevisionAntiAffinityPreferred CrossRevisionAntiAffinityType = "preferred"
+
+	// CrossRevisionAntiAffinityRequired allows at most one pod of any revision per node.
+	CrossRevisionAntiAffinityRequired CrossRevisionAntiAffinityType = "required"
+)
+
+// HTTP10HandlingType specifies how the queue proxy handles HTTP/1.0 requests.
+type HTTP10HandlingType string
+
+const (
+	// HTTP10Compatibility serves HTTP/1.0 requests, closing their connection
+	// after the response and giving them a Host if they lack one.
+	HTTP10Compatibility HTTP10HandlingType = "compatibility"
+
+	// HTTP10Reject answers HTTP/1.0 requests with a 505.
+	HTTP10Reject HTTP10HandlingType = "reject"
 )
 
 // Config includes the configurations for the controller.
@@ -266,16 +1773,198 @@ type Config struct {
 	// injected into the revision pod.
 	QueueSidecarImage string
 
+	// ValidateQueueSidecarImage makes loading the config fail if the
+	// QueueSidecarImage cannot be parsed as an image reference. The registry is
+	// not contacted, and ko:// import paths are always accepted.
+	ValidateQueueSidecarImage bool
+
 	// Repositories for which tag to digest resolving should be skipped.
 	RegistriesSkippingTagResolving sets.Set[string]
 
+	// ExportedImageLabels is the set of image config labels (e.g.
+	// org.opencontainers.image.revision) which are recorded onto the revision
+	// status annotations once its images are resolved. If empty, the image
+	// labels are not fetched at all.
+	ExportedImageLabels sets.Set[string]
+
+	// RequiredImageLabels maps the image config labels which every image of a
+	// revision must carry to their required values. A revision with an image
+	// lacking one of them fails instead of being deployed. The images from the
+	// RegistriesSkippingTagResolving are not checked.
+	RequiredImageLabels map[string]string
+
+	// ImagePullSecrets are the names of the secrets, in the namespace of each
+	// revision, added to the image pull secrets of its pods.
+	ImagePullSecrets []string
+
+	// DeploymentLabels maps the keys of the labels set on the generated
+	// Deployments to templates of their values, see DeploymentLabelsFor.
+	DeploymentLabels map[string]string
+
+	// DeploymentLabelsOnPodTemplate sets the DeploymentLabels on the pod
+	// templates of the generated Deployments as well.
+	DeploymentLabelsOnPodTemplate bool
+
+	// PodLabels are the labels set on the pods of every revision. The labels
+	// managed by Knative take precedence.
+	PodLabels map[string]string
+
+	// DeniedImageLabels maps image config labels to the values which the
+	// images of a revision must not carry, e.g. the digests of deprecated base
+	// images. A revision with an image carrying one of them fails instead of
+	// being deployed. The images from the RegistriesSkippingTagResolving are
+	// not checked.
+	DeniedImageLabels map[string]sets.Set[string]
+
+	// RegistriesResolutionRateLimits maps a registry host (e.g. index.docker.io)
+	// to the rate limit applied to the tag-to-digest resolution requests sent
+	// to it. Registries without an entry are not rate limited.
+	RegistriesResolutionRateLimits map[string]RegistryRateLimit
+
+	// ForceActivatorSelector selects the revisions which always route through
+	// the activator regardless of their traffic, as if their target burst
+	// capacity was -1. If nil, no revision is forced through the activator.
+	ForceActivatorSelector labels.Selector
+
+	// ActivatorProxyHeader is the header the activator identifies itself with
+	// on the requests it proxies, passed on to the queue-proxy. If nil,
+	// DefaultActivatorProxyHeader is used.
+	ActivatorProxyHeader *ProxyHeader
+
 	// DigestResolutionTimeout is the maximum time allowed for image digest resolution.
 	DigestResolutionTimeout time.Duration
 
+	// DigestResolutionTimeouts maps registry host prefixes to the digest
+	// resolution timeout of the images of the matching registries, the
+	// longest prefix winning, in place of DigestResolutionTimeout.
+	DigestResolutionTimeouts map[string]time.Duration
+
+	// DigestResolutionTLSServerNames maps registry hosts, with their port if
+	// any, to the server name to send and verify in the TLS handshake in place
+	// of the host, e.g. for registries reachable by IP address with a
+	// certificate for a hostname.
+	DigestResolutionTLSServerNames map[string]string
+
+	// DigestResolutionRetryBaseDelay is the delay of the first retry of a
+	// failed digest resolution, doubled on every further failure up to
+	// DigestResolutionRetryMaxDelay.
+	DigestResolutionRetryBaseDelay time.Duration
+	DigestResolutionRetryMaxDelay  time.Duration
+
+	// DigestResolutionRetryQPS and DigestResolutionRetryBurst are the rate and
+	// bucket size of the token bucket pacing the retries of all the failed
+	// digest resolutions together, on top of their individual backoff.
+	DigestResolutionRetryQPS   float64
+	DigestResolutionRetryBurst int
+
+	// DigestResolutionWorkers is the number of image digest resolutions that
+	// can take place in parallel. MaxIdleConns and MaxIdleConnsPerHost of the
+	// digest resolution's Transport are also set to this value.
+	DigestResolutionWorkers int
+
+	// DigestResolutionBatchRegistries are the registries offering a batch
+	// manifest endpoint, whose pending images are resolved to digests with a
+	// single request rather than one request each.
+	DigestResolutionBatchRegistries sets.Set[string]
+
+	// DigestResolutionConcurrency is the maximum number of a revision's images
+	// resolved to digests in parallel. Zero means unbounded.
+	DigestResolutionConcurrency int
+
+	// DigestResolutionNamespaceConcurrency is the maximum number of images of
+	// the revisions of a single namespace resolved to digests in parallel, so
+	// that the revisions of one namespace cannot take up all the resolution
+	// workers. Zero means unbounded.
+	DigestResolutionNamespaceConcurrency int
+
+	// DigestResolutionRegistryConnections is the maximum number of
+	// connections to a single registry host, dialing, active and idle ones
+	// included, so that a slow registry cannot take up the connection pool of
+	// the resolution shared by all the registries. Zero means unbounded.
+	DigestResolutionRegistryConnections int
+
+	// DigestResolutionCacheTTL is how long the digest resolved for an image
+	// and credentials is reused by the revisions sharing them, the concurrent
+	// resolutions of which are coalesced into one, so that a large rollout
+	// doesn't hit the registry for every revision. Zero disables the cache.
+	DigestResolutionCacheTTL time.Duration
+
+	// DigestResolutionAcceptMediaTypes are the manifest media types, in order
+	// of preference, sent in the Accept header of the requests resolving tags
+	// to digests. If empty, the resolver's default media types are accepted.
+	DigestResolutionAcceptMediaTypes []string
+
+	// DigestResolutionFailureUnroutable marks the revisions whose image digests
+	// cannot be resolved with the TemporarilyUnroutable condition, so that the
+	// traffic can be routed around them until the resolution succeeds.
+	DigestResolutionFailureUnroutable bool
+
+	// DigestResolutionVerifyLayers checks that every layer of the resolved
+	// images exists in the registry, failing the revision early rather than
+	// its pods failing to pull the image.
+	DigestResolutionVerifyLayers bool
+
+	// DigestResolutionPreferLazyPull resolves the tags pointing at an index
+	// holding both lazy-pull (eStargz or SOCI) and regular variants of a
+	// single-platform image to the digest of the lazy-pull variant.
+	DigestResolutionPreferLazyPull bool
+
+	// DigestResolutionIdentityHeader tags the requests sent to the registries
+	// with the name of the controller pod sending them and whether it leads
+	// the revision the image is resolved for.
+	DigestResolutionIdentityHeader bool
+
+	// DigestResolutionEvents records DigestResolutionStarted, DigestResolved
+	// and DigestResolutionFailed events on the revisions, e.g. for auditing.
+	DigestResolutionEvents bool
+
 	// ProgressDeadline is the time in seconds we wait for the deployment to
 	// be ready before considering it failed.
 	ProgressDeadline time.Duration
 
+	// ProgressDeadlineAdvisory makes the revisions whose startup probes may
+	// take longer than their progress deadline carry the
+	// ProgressDeadlineTooShort condition, without blocking them.
+	ProgressDeadlineAdvisory bool
+
+	// ProgressDeadlineMax, if positive, is the longest progress deadline the
+	// revisions can set with the serving.knative.dev/progress-deadline
+	// annotation. The revisions exceeding it get the ProgressDeadline.
+	ProgressDeadlineMax time.Duration
+
+	// ConfigChangeResyncDelay, if positive, delays the resync of all the
+	// revisions following a config change, so that the changes made within
+	// the delay trigger a single resync.
+	ConfigChangeResyncDelay time.Duration
+
+	// RevisionHistoryLimit is the number of old ReplicaSets to retain for the
+	// deployments of the revisions. It defaults to zero since every revision
+	// has its own deployment, so there is nothing to roll back to.
+	RevisionHistoryLimit int32
+
+	// MinReadySeconds is the minimum number of seconds the pods of the
+	// revisions' deployments must be ready, without any of their containers
+	// crashing, before they are considered available.
+	MinReadySeconds int32
+
+	// ShareProcessNamespace makes the containers of the revisions' pods share a
+	// single process namespace, unless the revision sets shareProcessNamespace
+	// itself. Every container can then see, signal and read the environment
+	// and filesystem of the processes of the others, the user container's
+	// included.
+	ShareProcessNamespace bool
+
+	// DefaultPriorityClassName is the priority class of the revisions' pods,
+	// unless the revision sets priorityClassName itself. Empty leaves the
+	// pods with the cluster's default priority.
+	DefaultPriorityClassName string
+
+	// AdoptExistingDeployments makes a revision adopt the deployment with its
+	// name, e.g. one created by hand while migrating a workload, and reconcile
+	// it like its own, rather than fail on the conflict. Deployments with
+	// another controller are never adopted.
+	AdoptExistingDeployments bool
+
 	// QueueSidecarCPURequest is the CPU Request to set for the queue proxy sidecar container.
 	QueueSidecarCPURequest *resource.Quantity
 
@@ -288,6 +1977,15 @@ type Config struct {
 	// QueueSidecarMemoryLimit is the Memory Limit to set for the queue proxy sidecar container.
 	QueueSidecarMemoryLimit *resource.Quantity
 
+	// QueueSidecarGoMemLimitAuto sets the Go soft memory limit (GOMEMLIMIT) of
+	// the queue proxy sidecar to 90% of its memory limit, if it has one.
+	QueueSidecarGoMemLimitAuto bool
+
+	// QueueSidecarGoMemLimit is the Go soft memory limit (GOMEMLIMIT) to set
+	// for the queue proxy sidecar. If nil, none is set, unless
+	// QueueSidecarGoMemLimitAuto is.
+	QueueSidecarGoMemLimit *resource.Quantity
+
 	// QueueSidecarEphemeralStorageRequest is the Ephemeral Storage Request to
 	// set for the queue proxy sidecar container.
 	QueueSidecarEphemeralStorageRequest *resource.Quantity
@@ -296,8 +1994,184 @@ type Config struct {
 	// for the queue proxy sidecar container.
 	QueueSidecarEphemeralStorageLimit *resource.Quantity
 
+	// QueueSidecarCPURequestBound is the sanity bound the queue proxy sidecar's
+	// CPU request, multiplied by QueueSidecarResourceBoundScale, must not exceed.
+	QueueSidecarCPURequestBound *resource.Quantity
+
+	// QueueSidecarMemoryRequestBound is the sanity bound the queue proxy sidecar's
+	// Memory request, multiplied by QueueSidecarResourceBoundScale, must not exceed.
+	QueueSidecarMemoryRequestBound *resource.Quantity
+
+	// QueueSidecarResourceBoundScale is the typical number of queue proxy sidecars
+	// expected to share a node, used when checking the resource sanity bounds.
+	QueueSidecarResourceBoundScale int
+
+	// QueueSidecarResourceRationale annotates the pods with how the queue proxy
+	// sidecar's resources were computed from the ones of the user container,
+	// when they are.
+	QueueSidecarResourceRationale bool
+
+	// QueueSidecarStrictResourceUnits rejects the queue proxy sidecar's
+	// resources whose units are likely a typo, e.g. a memory request of
+	// "654m", i.e. 0.654 bytes, rather than "654M".
+	QueueSidecarStrictResourceUnits bool
+
+	// QueueSidecarCheckLimitRanges checks the queue proxy sidecar's resources
+	// against the LimitRanges of the revision's namespace before deploying
+	// it, so that a violation fails the revision with a clear reason rather
+	// than its pods failing to be created.
+	QueueSidecarCheckLimitRanges bool
+
+	// QueueSidecarSuppressOverloadDetails makes the queue proxy sidecar reply
+	// with a generic 503 body, instead of the underlying error message, when a
+	// request is rejected because its queue is full or the wait timed out.
+	QueueSidecarSuppressOverloadDetails bool
+
+	// QueueSidecarQueueFullStatusCode is the status code the queue proxy
+	// sidecar replies with when a request is rejected because its queue is
+	// full, either 503 or 429. 429 responses carry a Retry-After header.
+	QueueSidecarQueueFullStatusCode int
+
+	// QueueSidecarQueueFullRetryAfter, if positive, is the Retry-After the
+	// queue proxy sidecar sets on the responses to requests rejected because
+	// its queue is full, whatever their status code.
+	QueueSidecarQueueFullRetryAfter time.Duration
+
+	// QueueSidecarQueueFullBody, if set, is the body the queue proxy sidecar
+	// replies with when a request is rejected because its queue is full.
+	QueueSidecarQueueFullBody string
+
+	// QueueSidecarBreakerDrainTimeout, if positive, is how long the queue
+	// proxy sidecar waits on shutdown for the requests executing in its
+	// breaker to complete, after rejecting the queued ones.
+	QueueSidecarBreakerDrainTimeout time.Duration
+
+	// QueueSidecarMaintenanceStatusCode and QueueSidecarMaintenanceBody are
+	// the status code and the body the queue proxy sidecar answers all the
+	// requests with while its revision is put into maintenance by annotation.
+	// An empty body answers with the status text.
+	QueueSidecarMaintenanceStatusCode int
+	QueueSidecarMaintenanceBody       string
+
+	// QueueSidecarMaxResponseHeaders is the maximum number of response header
+	// fields the queue proxy sidecar forwards from the user container. Zero
+	// means unlimited.
+	QueueSidecarMaxResponseHeaders int
+
+	// QueueSidecarMaxUpstreamConnections is the maximum number of simultaneous
+	// connections the queue proxy sidecar uses to the user container,
+	// independently of the container concurrency. Zero means unlimited.
+	QueueSidecarMaxUpstreamConnections int
+
+	// QueueSidecarH2MaxConcurrentStreams is the maximum number of concurrent
+	// streams the queue proxy sidecar multiplexes over its h2c connection to
+	// the user container. Zero means the transport's default, in which case
+	// the streams are only bounded by the container concurrency.
+	QueueSidecarH2MaxConcurrentStreams int
+
+	// QueueSidecarMaxRequestBodyBytes is the maximum size of the request
+	// bodies the queue proxy sidecar forwards to the user container, larger
+	// ones being answered with a 413. Zero means unlimited.
+	QueueSidecarMaxRequestBodyBytes int64
+
+	// QueueSidecarSlowRequestThreshold, if positive, makes the queue proxy
+	// sidecar log the requests taking longer than it, with the time they
+	// waited for the breaker and were served.
+	QueueSidecarSlowRequestThreshold time.Duration
+
+	// QueueSidecarResponseHeaderTimeout, if positive, is how long the queue
+	// proxy sidecar waits for the response headers of the user container
+	// before failing the request with a 504, releasing its breaker slot.
+	QueueSidecarResponseHeaderTimeout time.Duration
+
+	// QueueSidecarVersionHeader makes the queue proxy sidecar send its version
+	// in the X-Knative-Queue-Version header of the responses.
+	QueueSidecarVersionHeader bool
+
+	// QueueSidecarCountProbeRequests makes the queue proxy sidecar count the
+	// kubelet probes in the request stats reported to the autoscaler.
+	QueueSidecarCountProbeRequests bool
+
+	// QueueSidecarReportResponseClasses makes the queue proxy sidecar break
+	// the stats reported to the autoscaler down by the class of the response
+	// status codes.
+	QueueSidecarReportResponseClasses bool
+
+	// QueueSidecarReportBreakerParams makes the queue proxy sidecar log its
+	// effective breaker parameters, and expose them as gauges if request
+	// metrics are enabled, at startup and whenever they change.
+	QueueSidecarReportBreakerParams bool
+
+	// QueueSidecarLivenessProbe adds a liveness probe to the queue proxy
+	// sidecar checking its own request handling is responsive, so that a stuck
+	// queue proxy gets restarted.
+	QueueSidecarLivenessProbe bool
+
+	// QueueSidecarUpstreamProtocolDetection makes the queue proxy sidecar
+	// detect whether the user container speaks h2c or HTTP/1.1, and proxy the
+	// requests with that protocol rather than the one they came in with.
+	QueueSidecarUpstreamProtocolDetection bool
+
+	// QueueSidecarRequestIDHeader is the header in which the queue proxy
+	// sidecar propagates the request ID of each request to the user container
+	// and back in the response, generating one for requests without. If
+	// empty, request IDs are not handled.
+	QueueSidecarRequestIDHeader string
+
+	// QueueSidecarPrewarm makes the queue proxy sidecar open a connection to
+	// the user container whenever it becomes ready, so that the first request
+	// doesn't pay for the connection setup.
+	QueueSidecarPrewarm bool
+
+	// QueueSidecarPrewarmPath is the path of a warmup request the queue proxy
+	// sidecar sends instead when prewarming the user container. If empty, no
+	// request is sent.
+	QueueSidecarPrewarmPath string
+
+	// QueueSidecarDrainReadinessPath is the path on which the queue proxy
+	// sidecar answers with its readiness, turning not ready as soon as it
+	// starts draining, so that external load balancers stop sending traffic
+	// before the connections are closed. If empty, no such path is served.
+	QueueSidecarDrainReadinessPath string
+
+	// QueueSidecarDrainPath is the path on the admin port of the queue proxy
+	// sidecar which initiates the drain when requested, e.g. by a mesh sidecar
+	// coordinating the shutdown of the pod. If empty, no such path is served.
+	QueueSidecarDrainPath string
+
+	// QueueSidecarClientConcurrencyLimit is the maximum number of requests of
+	// a single client the queue proxy sidecar lets in flight at the same time,
+	// answering the others with a 429. Zero means unlimited.
+	QueueSidecarClientConcurrencyLimit int
+
+	// QueueSidecarClientKeyHeader is the header identifying the clients for the
+	// QueueSidecarClientConcurrencyLimit. If empty, or missing from a request,
+	// the client IP is used.
+	QueueSidecarClientKeyHeader string
+
+	// QueueSidecarMemorySheddingHighWaterMark is the memory usage of the queue
+	// proxy sidecar's container at which it starts rejecting new requests. If
+	// nil, requests are never shed because of memory pressure.
+	QueueSidecarMemorySheddingHighWaterMark *resource.Quantity
+
+	// QueueSidecarMemorySheddingLowWaterMark is the memory usage below which
+	// the queue proxy sidecar accepts new requests again. If nil, it is the
+	// same as the high-water mark.
+	QueueSidecarMemorySheddingLowWaterMark *resource.Quantity
+
+	// QueueSidecarRunAsUser and QueueSidecarRunAsGroup are the user and group
+	// IDs the queue proxy sidecar runs as. If nil, they are the ones of the
+	// image.
+	QueueSidecarRunAsUser  *int64
+	QueueSidecarRunAsGroup *int64
+
+	// QueueSidecarRunAsNonRoot requires the queue proxy sidecar to run as a
+	// non-root user. If nil, it is required. See QueueSidecarRunsAsNonRoot.
+	QueueSidecarRunAsNonRoot *bool
+
 	// QueueSidecarTokenAudiences is a set of strings defining required tokens  - each string represent the token audience
 	// used by the queue proxy sidecar container to create tokens for qpoptions.
+	// An empty audience, like in the default set, projects no token.
 	QueueSidecarTokenAudiences sets.Set[string]
 
 	// QueueSidecarRootCA is a root certificate to be trusted by the queue proxy sidecar  qpoptions.
@@ -307,6 +2181,42 @@ type Config struct {
 	// applied to the PodSpec of all Knative services.
 	DefaultAffinityType AffinityType
 
+	// DefaultAffinityTypeOverrides are the default affinity types of the
+	// namespaces, keyed by namespace, which take precedence over
+	// DefaultAffinityType. See AffinityTypeForNamespace.
+	DefaultAffinityTypeOverrides map[string]AffinityType
+
+	// TopologySpreadWhenUnsatisfiable is the whenUnsatisfiable behavior of the
+	// topology spread constraints applied by the SpreadRevisionOverNodes affinity type.
+	TopologySpreadWhenUnsatisfiable corev1.UnsatisfiableConstraintAction
+
+	// CrossRevisionAntiAffinity controls the pod anti-affinity term applied to
+	// all revisions, which keeps the pods of any revisions from sharing a node.
+	CrossRevisionAntiAffinity CrossRevisionAntiAffinityType
+
+	// QueueSidecarHTTP10Handling controls how the queue proxy sidecar handles
+	// the requests of HTTP/1.0 clients.
+	QueueSidecarHTTP10Handling HTTP10HandlingType
+
 	// RuntimeClassNames specifies which runtime the Pod will use
 	RuntimeClassNames map[string]RuntimeClassNameLabelSelector
+
+	// DefaultRuntimeClassFallback is the runtime class of the revisions which
+	// none of the RuntimeClassNames match, not even a wildcard. If empty, they
+	// inherit the cluster default.
+	DefaultRuntimeClassFallback string
+
+	// SidecarContainers are the containers, keyed by name, injected into the
+	// pods of the revisions matching their selector.
+	SidecarContainers map[string]SidecarContainer
+
+	// DefaultTolerations are added to the tolerations of the pods of all
+	// revisions, e.g. to schedule them onto tainted nodes.
+	DefaultTolerations []corev1.Toleration
+
+	// DefaultTopologySpreadConstraints are the topology spread constraints of
+	// the pods of the revisions which don't set any, e.g. to spread them over
+	// availability zones. The constraints without a label selector select the
+	// pods of the revision.
+	DefaultTopologySpreadConstraints []corev1.TopologySpreadConstraint
 }
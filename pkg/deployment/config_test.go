@@ -17,6 +17,7 @@ limitations under the License.
 package deployment
 
 import (
+	"net/http"
 	"strings"
 	"testing"
 	"time"
@@ -28,6 +29,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	"knative.dev/pkg/ptr"
@@ -65,6 +67,8 @@ func TestControllerConfigurationFromFile(t *testing.T) {
 		want := defaultConfig()
 		// We require QSI to be explicitly set. So do it here.
 		want.QueueSidecarImage = "ko://knative.dev/serving/cmd/queue"
+		// The example spells out the default activator proxy header.
+		want.ActivatorProxyHeader = &DefaultActivatorProxyHeader
 
 		// The following are in the example yaml, to show usage,
 		// but default is nil, i.e. inheriting k8s.
@@ -78,6 +82,65 @@ func TestControllerConfigurationFromFile(t *testing.T) {
 	}
 }
 
+func TestRejectUnknownKeys(t *testing.T) {
+	_, example := ConfigMapsFromTestFile(t, ConfigName, QueueSidecarImageKey)
+	documented := make(map[string]string, len(example.Data))
+	for k, v := range example.Data {
+		documented[k] = v
+	}
+	documented[rejectUnknownKeysKey] = "true"
+	if _, err := NewConfigFromMap(documented); err != nil {
+		t.Error("The example has keys unknown to the parser:", err)
+	}
+
+	tests := []struct {
+		name    string
+		data    map[string]string
+		wantErr bool
+	}{{
+		name: "unknown key ignored by default",
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			"queueSidecarImagee": defaultSidecarImage,
+		},
+	}, {
+		name: "unknown key ignored when lenient",
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			rejectUnknownKeysKey: "false",
+			"queueSidecarImagee": defaultSidecarImage,
+		},
+	}, {
+		name: "unknown key rejected when strict",
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			rejectUnknownKeysKey: "true",
+			"queueSidecarImagee": defaultSidecarImage,
+		},
+		wantErr: true,
+	}, {
+		name: "legacy and example keys accepted when strict",
+		data: map[string]string{
+			DeprecatedQueueSidecarImageKey: defaultSidecarImage,
+			"progressDeadline":             "5m",
+			rejectUnknownKeysKey:           "true",
+			exampleKey:                     "# documentation",
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewConfigFromMap(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewConfigFromMap() = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "queueSidecarImagee") {
+				t.Errorf("NewConfigFromMap() = %v, want the unknown key named", err)
+			}
+		})
+	}
+}
+
 func TestControllerConfiguration(t *testing.T) {
 	configTests := []struct {
 		name       string
@@ -87,13 +150,23 @@ func TestControllerConfiguration(t *testing.T) {
 	}{{
 		name: "controller configuration with no default affinity type specified",
 		wantConfig: &Config{
-			RegistriesSkippingTagResolving: sets.New("kind.local", "ko.local", "dev.local"),
-			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
-			QueueSidecarImage:              defaultSidecarImage,
-			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
-			QueueSidecarTokenAudiences:     sets.New(""),
-			ProgressDeadline:               ProgressDeadlineDefault,
-			DefaultAffinityType:            defaultAffinityTypeValue,
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
 		},
 		data: map[string]string{
 			QueueSidecarImageKey: defaultSidecarImage,
@@ -115,129 +188,2557 @@ func TestControllerConfiguration(t *testing.T) {
 	}, {
 		name: "controller configuration with the default affinity type set",
 		wantConfig: &Config{
-			RegistriesSkippingTagResolving: sets.New("kind.local", "ko.local", "dev.local"),
-			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
-			QueueSidecarImage:              defaultSidecarImage,
-			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
-			QueueSidecarTokenAudiences:     sets.New(""),
-			ProgressDeadline:               ProgressDeadlineDefault,
-			DefaultAffinityType:            defaultAffinityTypeValue,
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
 		},
 		data: map[string]string{
 			QueueSidecarImageKey:   defaultSidecarImage,
 			defaultAffinityTypeKey: string(PreferSpreadRevisionOverNodes),
 		},
+	}, {
+		name: "controller configuration with default affinity type overrides",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:  sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:         digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:  DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:   DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:        DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:      DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:         DigestResolutionWorkersDefault,
+			QueueSidecarImage:               defaultSidecarImage,
+			QueueSidecarCPURequest:          &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:      sets.New(""),
+			ProgressDeadline:                ProgressDeadlineDefault,
+			DefaultAffinityType:             defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable: corev1.ScheduleAnyway,
+			DefaultAffinityTypeOverrides: map[string]AffinityType{
+				"dev":  None,
+				"prod": SpreadRevisionOverNodes,
+			},
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:            defaultSidecarImage,
+			defaultAffinityTypeOverridesKey: "dev: none\nprod: spread-revision-over-nodes",
+		},
+	}, {
+		name:    "controller configuration with unsupported value for a default affinity type override",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:            defaultSidecarImage,
+			defaultAffinityTypeOverridesKey: "dev: coconut",
+		},
+	}, {
+		name:    "controller configuration with an invalid namespace for a default affinity type override",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:            defaultSidecarImage,
+			defaultAffinityTypeOverridesKey: "Dev_Namespace: none",
+		},
+	}, {
+		name:    "controller configuration with unparsable default affinity type overrides",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:            defaultSidecarImage,
+			defaultAffinityTypeOverridesKey: " ???; 231424 ",
+		},
 	}, {
 		name: "controller configuration with default affinity type deactivated",
 		wantConfig: &Config{
-			RegistriesSkippingTagResolving: sets.New("kind.local", "ko.local", "dev.local"),
-			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
-			QueueSidecarImage:              defaultSidecarImage,
-			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
-			QueueSidecarTokenAudiences:     sets.New(""),
-			ProgressDeadline:               ProgressDeadlineDefault,
-			DefaultAffinityType:            None,
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               None,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
 		},
 		data: map[string]string{
 			QueueSidecarImageKey:   defaultSidecarImage,
 			defaultAffinityTypeKey: string(None),
 		},
 	}, {
-		name: "controller configuration with bad registries",
+		name: "controller configuration with topology spread over nodes that must be satisfied",
 		wantConfig: &Config{
-			RegistriesSkippingTagResolving: sets.New("ko.local", ""),
-			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
-			QueueSidecarImage:              defaultSidecarImage,
-			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
-			QueueSidecarTokenAudiences:     sets.New("foo", "bar", "boo-srv"),
-			ProgressDeadline:               ProgressDeadlineDefault,
-			DefaultAffinityType:            defaultAffinityTypeValue,
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               SpreadRevisionOverNodes,
+			TopologySpreadWhenUnsatisfiable:   corev1.DoNotSchedule,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			defaultAffinityTypeKey:             string(SpreadRevisionOverNodes),
+			topologySpreadWhenUnsatisfiableKey: string(corev1.DoNotSchedule),
+		},
+	}, {
+		name: "controller configuration with required cross-revision anti-affinity",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityRequired,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:         defaultSidecarImage,
+			crossRevisionAntiAffinityKey: string(CrossRevisionAntiAffinityRequired),
+		},
+	}, {
+		name:    "controller configuration with unsupported value for cross-revision anti-affinity",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:         defaultSidecarImage,
+			crossRevisionAntiAffinityKey: "always",
 		},
+	}, {
+		name:    "controller configuration with unsupported value for topology spread whenUnsatisfiable",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			topologySpreadWhenUnsatisfiableKey: "sometimes",
+		},
+	}, {
+		name:    "controller configuration with an empty registry",
+		wantErr: true,
 		data: map[string]string{
 			QueueSidecarImageKey:              defaultSidecarImage,
-			queueSidecarTokenAudiencesKey:     "bar,foo,boo-srv",
 			registriesSkippingTagResolvingKey: "ko.local,,",
 		},
+	}, {
+		name:    "controller configuration with an invalid registry",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			registriesSkippingTagResolvingKey: "ko.local,https://gcr.io",
+		},
+	}, {
+		name:    "controller configuration with an invalid registry port",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			registriesSkippingTagResolvingKey: "localhost:http",
+		},
+	}, {
+		name: "controller configuration with registries with ports",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("ko.local", "localhost:5000", "10.0.0.1:443"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New("foo", "bar", "boo-srv"),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			queueSidecarTokenAudiencesKey:     "bar,foo,boo-srv",
+			registriesSkippingTagResolvingKey: "ko.local,localhost:5000,10.0.0.1:443",
+		},
 	}, {
 		name: "controller configuration good progress deadline",
 		wantConfig: &Config{
-			RegistriesSkippingTagResolving: sets.New("kind.local", "ko.local", "dev.local"),
-			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
-			QueueSidecarImage:              defaultSidecarImage,
-			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
-			QueueSidecarTokenAudiences:     sets.New(""),
-			ProgressDeadline:               444 * time.Second,
-			DefaultAffinityType:            defaultAffinityTypeValue,
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  444 * time.Second,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			ProgressDeadlineKey:  "444s",
+		},
+	}, {
+		name: "controller configuration with a valid queue sidecar image",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 "gcr.io/knative-releases/queue:v1.15.0",
+			ValidateQueueSidecarImage:         true,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:         "gcr.io/knative-releases/queue:v1.15.0",
+			validateQueueSidecarImageKey: "true",
+		},
+	}, {
+		name: "controller configuration with a ko queue sidecar image",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 "ko://knative.dev/serving/cmd/queue",
+			ValidateQueueSidecarImage:         true,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:         "ko://knative.dev/serving/cmd/queue",
+			validateQueueSidecarImageKey: "true",
+		},
+	}, {
+		name:    "controller configuration with a malformed queue sidecar image",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:         "gcr.io/knative-releases/Queue::latest",
+			validateQueueSidecarImageKey: "true",
+		},
+	}, {
+		name: "controller configuration with an unvalidated malformed queue sidecar image",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 "gcr.io/knative-releases/Queue::latest",
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey: "gcr.io/knative-releases/Queue::latest",
+		},
+	}, {
+		name: "controller configuration good revision history limit",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			RevisionHistoryLimit:              2,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:    defaultSidecarImage,
+			revisionHistoryLimitKey: "2",
+		},
+	}, {
+		name:    "controller configuration negative revision history limit",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:    defaultSidecarImage,
+			revisionHistoryLimitKey: "-1",
+		},
+	}, {
+		name: "controller configuration good min ready seconds",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			MinReadySeconds:                   10,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			minReadySecondsKey:   "10",
+		},
+	}, {
+		name:    "controller configuration negative min ready seconds",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			minReadySecondsKey:   "-1",
+		},
+	}, {
+		name: "controller configuration good digest resolution timeout",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           60 * time.Second,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:       defaultSidecarImage,
+			digestResolutionTimeoutKey: "60s",
+		},
+	}, {
+		name: "controller configuration with shared process namespace",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			ShareProcessNamespace:             true,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:     defaultSidecarImage,
+			shareProcessNamespaceKey: "true",
+		},
+	}, {
+		name: "controller configuration with default priority class name",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			DefaultPriorityClassName:          "serving-high-priority",
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			defaultPriorityClassNameKey: "serving-high-priority",
+		},
+	}, {
+		name: "controller configuration with unset default priority class name",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			defaultPriorityClassNameKey: "",
+		},
+	}, {
+		name:    "controller configuration with invalid default priority class name",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			defaultPriorityClassNameKey: "High_Priority",
+		},
+	}, {
+		name: "controller configuration adopting existing deployments",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			AdoptExistingDeployments:          true,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			adoptExistingDeploymentsKey: "true",
+		},
+	}, {
+		name: "controller configuration rejecting http/1.0",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Reject,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:          defaultSidecarImage,
+			queueSidecarHTTP10HandlingKey: "reject",
+		},
+	}, {
+		name:    "controller configuration with unsupported http/1.0 handling",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:          defaultSidecarImage,
+			queueSidecarHTTP10HandlingKey: "drop",
+		},
+	}, {
+		name: "controller configuration with digest resolution namespace concurrency",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:       sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:              digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:       DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:        DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:             DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:           DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:              DigestResolutionWorkersDefault,
+			DigestResolutionNamespaceConcurrency: 10,
+			QueueSidecarImage:                    defaultSidecarImage,
+			QueueSidecarCPURequest:               &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:           sets.New(""),
+			ProgressDeadline:                     ProgressDeadlineDefault,
+			DefaultAffinityType:                  defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:      corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:            CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:           HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:      http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode:    http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                    defaultSidecarImage,
+			digestResolutionNamespaceConcurrencyKey: "10",
+		},
+	}, {
+		name:    "controller configuration with negative digest resolution namespace concurrency",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                    defaultSidecarImage,
+			digestResolutionNamespaceConcurrencyKey: "-1",
+		},
+	}, {
+		name: "controller configuration with digest resolution registry connections",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:      sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:             digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:      DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:       DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:            DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:          DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:             DigestResolutionWorkersDefault,
+			DigestResolutionRegistryConnections: 10,
+			QueueSidecarImage:                   defaultSidecarImage,
+			QueueSidecarCPURequest:              &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:          sets.New(""),
+			ProgressDeadline:                    ProgressDeadlineDefault,
+			DefaultAffinityType:                 defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:     corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:           CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:          HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:     http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode:   http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                   defaultSidecarImage,
+			digestResolutionRegistryConnectionsKey: "10",
+		},
+	}, {
+		name:    "controller configuration with negative digest resolution registry connections",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                   defaultSidecarImage,
+			digestResolutionRegistryConnectionsKey: "-1",
+		},
+	}, {
+		name: "controller configuration with digest resolution cache ttl",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			DigestResolutionCacheTTL:          30 * time.Second,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			digestResolutionCacheTTLKey: "30s",
+		},
+	}, {
+		name:    "controller configuration with negative digest resolution cache ttl",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			digestResolutionCacheTTLKey: "-1s",
+		},
+	}, {
+		name: "controller configuration with digest resolution events",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			DigestResolutionEvents:            true,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:      defaultSidecarImage,
+			digestResolutionEventsKey: "true",
+		},
+	}, {
+		name: "controller configuration with a config change resync delay",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			ConfigChangeResyncDelay:           30 * time.Second,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:       defaultSidecarImage,
+			configChangeResyncDelayKey: "30s",
+		},
+	}, {
+		name:    "controller configuration with a negative config change resync delay",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:       defaultSidecarImage,
+			configChangeResyncDelayKey: "-30s",
+		},
+	}, {
+		name:    "controller configuration with a fractional config change resync delay",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:       defaultSidecarImage,
+			configChangeResyncDelayKey: "1500ms",
+		},
+	}, {
+		name: "controller configuration with a progress deadline maximum",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			ProgressDeadlineMax:               time.Hour,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:   defaultSidecarImage,
+			progressDeadlineMaxKey: "1h",
+		},
+	}, {
+		name:    "controller configuration with a negative progress deadline maximum",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:   defaultSidecarImage,
+			progressDeadlineMaxKey: "-1h",
+		},
+	}, {
+		name:    "controller configuration with a fractional progress deadline maximum",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:   defaultSidecarImage,
+			progressDeadlineMaxKey: "1500ms",
+		},
+	}, {
+		name:    "controller configuration with a progress deadline maximum below the progress deadline",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:   defaultSidecarImage,
+			progressDeadlineMaxKey: "5m",
+		},
+	}, {
+		name: "controller configuration with version header",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarVersionHeader:         true,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:         defaultSidecarImage,
+			queueSidecarVersionHeaderKey: "true",
+		},
+	}, {
+		name: "controller configuration with progress deadline advisory",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			ProgressDeadlineAdvisory:          true,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			progressDeadlineAdvisoryKey: "true",
+		},
+	}, {
+		name: "controller configuration prefer lazy-pull images",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			DigestResolutionPreferLazyPull:    true,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			digestResolutionPreferLazyPullKey: "true",
+		},
+	}, {
+		name: "controller configuration with the digest resolution identity header",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			DigestResolutionIdentityHeader:    true,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			digestResolutionIdentityHeaderKey: "true",
+		},
+	}, {
+		name: "controller configuration with registries",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("ko.local", "ko.dev"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			registriesSkippingTagResolvingKey: "ko.local,ko.dev",
+		},
+	}, {
+		name: "controller configuration with custom queue sidecar resource request/limits",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:      sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:             digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:      DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:       DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:            DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:          DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:             DigestResolutionWorkersDefault,
+			QueueSidecarImage:                   defaultSidecarImage,
+			ProgressDeadline:                    ProgressDeadlineDefault,
+			QueueSidecarCPURequest:              quantity("123m"),
+			QueueSidecarMemoryRequest:           quantity("456M"),
+			QueueSidecarEphemeralStorageRequest: quantity("789m"),
+			QueueSidecarCPULimit:                quantity("987M"),
+			QueueSidecarMemoryLimit:             quantity("654m"),
+			QueueSidecarEphemeralStorageLimit:   quantity("321M"),
+			QueueSidecarTokenAudiences:          sets.New(""),
+			DefaultAffinityType:                 defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:     corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:           CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:          HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:     http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode:   http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                   defaultSidecarImage,
+			queueSidecarCPURequestKey:              "123m",
+			queueSidecarMemoryRequestKey:           "456M",
+			queueSidecarEphemeralStorageRequestKey: "789m",
+			queueSidecarCPULimitKey:                "987M",
+			queueSidecarMemoryLimitKey:             "654m",
+			queueSidecarEphemeralStorageLimitKey:   "321M",
+		},
+	}, {
+		name: "controller configuration with strict queue sidecar resource units",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:      sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:             digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:      DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:       DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:            DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:          DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:             DigestResolutionWorkersDefault,
+			QueueSidecarImage:                   defaultSidecarImage,
+			ProgressDeadline:                    ProgressDeadlineDefault,
+			QueueSidecarStrictResourceUnits:     true,
+			QueueSidecarCPURequest:              quantity("123m"),
+			QueueSidecarMemoryRequest:           quantity("456M"),
+			QueueSidecarEphemeralStorageRequest: quantity("789Mi"),
+			QueueSidecarCPULimit:                quantity("2"),
+			QueueSidecarMemoryLimit:             quantity("654M"),
+			QueueSidecarEphemeralStorageLimit:   quantity("1G"),
+			QueueSidecarTokenAudiences:          sets.New(""),
+			DefaultAffinityType:                 defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:     corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:           CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:          HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:     http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode:   http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                   defaultSidecarImage,
+			queueSidecarStrictResourceUnitsKey:     "true",
+			queueSidecarCPURequestKey:              "123m",
+			queueSidecarMemoryRequestKey:           "456M",
+			queueSidecarEphemeralStorageRequestKey: "789Mi",
+			queueSidecarCPULimitKey:                "2",
+			queueSidecarMemoryLimitKey:             "654M",
+			queueSidecarEphemeralStorageLimitKey:   "1G",
+		},
+	}, {
+		name:    "controller configuration with strict queue sidecar resource units and milli memory",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarStrictResourceUnitsKey: "true",
+			queueSidecarMemoryLimitKey:         "654m",
+		},
+	}, {
+		name:    "controller configuration with strict queue sidecar resource units and milli ephemeral storage",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                   defaultSidecarImage,
+			queueSidecarStrictResourceUnitsKey:     "true",
+			queueSidecarEphemeralStorageRequestKey: "789m",
+		},
+	}, {
+		name:    "controller configuration with strict queue sidecar resource units and mega cpu",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarStrictResourceUnitsKey: "true",
+			queueSidecarCPULimitKey:            "987M",
+		},
+	}, {
+		name: "controller configuration with queue sidecar requests within bounds",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            quantity("100m"),
+			QueueSidecarMemoryRequest:         quantity("100Mi"),
+			QueueSidecarCPURequestBound:       quantity("1"),
+			QueueSidecarMemoryRequestBound:    quantity("1Gi"),
+			QueueSidecarResourceBoundScale:    10,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			queueSidecarCPURequestKey:         "100m",
+			queueSidecarMemoryRequestKey:      "100Mi",
+			queueSidecarCPURequestBoundKey:    "1",
+			queueSidecarMemoryRequestBoundKey: "1Gi",
+			queueSidecarResourceBoundScaleKey: "10",
+		},
+	}, {
+		name:    "controller configuration with queue sidecar cpu request exceeding bound",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			queueSidecarCPURequestKey:         "200m",
+			queueSidecarCPURequestBoundKey:    "1",
+			queueSidecarResourceBoundScaleKey: "10",
+		},
+	}, {
+		name:    "controller configuration with queue sidecar memory request exceeding bound",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			queueSidecarMemoryRequestKey:      "2Gi",
+			queueSidecarMemoryRequestBoundKey: "1Gi",
+		},
+	}, {
+		name: "controller configuration with overload details suppressed",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:      sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:             digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:      DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:       DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:            DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:          DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:             DigestResolutionWorkersDefault,
+			QueueSidecarImage:                   defaultSidecarImage,
+			ProgressDeadline:                    ProgressDeadlineDefault,
+			QueueSidecarCPURequest:              &QueueSidecarCPURequestDefault,
+			QueueSidecarSuppressOverloadDetails: true,
+			QueueSidecarTokenAudiences:          sets.New(""),
+			DefaultAffinityType:                 defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:     corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:           CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:          HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:     http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode:   http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                   defaultSidecarImage,
+			queueSidecarSuppressOverloadDetailsKey: "true",
+		},
+	}, {
+		name: "controller configuration with max response headers",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarMaxResponseHeaders:    100,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			queueSidecarMaxResponseHeadersKey: "100",
+		},
+	}, {
+		name: "controller configuration with memory pressure shedding",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:          sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:                 digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:          DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:           DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:                DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:              DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:                 DigestResolutionWorkersDefault,
+			QueueSidecarImage:                       defaultSidecarImage,
+			ProgressDeadline:                        ProgressDeadlineDefault,
+			QueueSidecarCPURequest:                  &QueueSidecarCPURequestDefault,
+			QueueSidecarMemorySheddingHighWaterMark: quantity("700Mi"),
+			QueueSidecarMemorySheddingLowWaterMark:  quantity("600Mi"),
+			QueueSidecarTokenAudiences:              sets.New(""),
+			DefaultAffinityType:                     defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:         corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:               CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:              HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:         http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode:       http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                       defaultSidecarImage,
+			queueSidecarMemorySheddingHighWaterMarkKey: "700Mi",
+			queueSidecarMemorySheddingLowWaterMarkKey:  "600Mi",
+		},
+	}, {
+		name:    "controller configuration with memory shedding low-water mark above high-water mark",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                       defaultSidecarImage,
+			queueSidecarMemorySheddingHighWaterMarkKey: "600Mi",
+			queueSidecarMemorySheddingLowWaterMarkKey:  "700Mi",
+		},
+	}, {
+		name:    "controller configuration with memory shedding low-water mark only",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                      defaultSidecarImage,
+			queueSidecarMemorySheddingLowWaterMarkKey: "600Mi",
+		},
+	}, {
+		name: "controller configuration with the queue proxy user and group",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarRunAsUser:             ptr.Int64(65532),
+			QueueSidecarRunAsGroup:            ptr.Int64(65533),
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:      defaultSidecarImage,
+			queueSidecarRunAsUserKey:  "65532",
+			queueSidecarRunAsGroupKey: "65533",
+		},
+	}, {
+		name: "controller configuration with the queue proxy running as root",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarRunAsUser:             ptr.Int64(0),
+			QueueSidecarRunAsNonRoot:          ptr.Bool(false),
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			queueSidecarRunAsUserKey:    "0",
+			queueSidecarRunAsNonRootKey: "false",
+		},
+	}, {
+		name:    "controller configuration with the queue proxy running as root while required to not",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:     defaultSidecarImage,
+			queueSidecarRunAsUserKey: "0",
+		},
+	}, {
+		name:    "controller configuration with a negative queue proxy user",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:     defaultSidecarImage,
+			queueSidecarRunAsUserKey: "-1",
+		},
+	}, {
+		name:    "controller configuration with a queue proxy user out of range",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:     defaultSidecarImage,
+			queueSidecarRunAsUserKey: "4294967296",
+		},
+	}, {
+		name:    "controller configuration with an unparsable queue proxy group",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:      defaultSidecarImage,
+			queueSidecarRunAsGroupKey: "nogroup",
+		},
+	}, {
+		name:    "controller configuration with a negative queue proxy group",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:      defaultSidecarImage,
+			queueSidecarRunAsGroupKey: "-1",
+		},
+	}, {
+		name:    "controller configuration with an unparsable queue proxy non-root requirement",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			queueSidecarRunAsNonRootKey: "maybe",
+		},
+	}, {
+		name: "controller configuration with counted probe requests",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarCountProbeRequests:    true,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			queueSidecarCountProbeRequestsKey: "true",
+		},
+	}, {
+		name: "controller configuration with response classes reported",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarReportResponseClasses: true,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                 defaultSidecarImage,
+			queueSidecarReportResponseClassesKey: "true",
+		},
+	}, {
+		name: "controller configuration reporting breaker params",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarReportBreakerParams:   true,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarReportBreakerParamsKey: "true",
+		},
+	}, {
+		name: "controller configuration with queue sidecar liveness probe",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarLivenessProbe:         true,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:         defaultSidecarImage,
+			queueSidecarLivenessProbeKey: "true",
+		},
+	}, {
+		name: "controller configuration with queue sidecar upstream protocol detection",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:        sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:               digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:        DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:         DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:              DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:            DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:               DigestResolutionWorkersDefault,
+			QueueSidecarImage:                     defaultSidecarImage,
+			ProgressDeadline:                      ProgressDeadlineDefault,
+			QueueSidecarCPURequest:                &QueueSidecarCPURequestDefault,
+			QueueSidecarUpstreamProtocolDetection: true,
+			QueueSidecarTokenAudiences:            sets.New(""),
+			DefaultAffinityType:                   defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:       corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:             CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:            HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:       http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode:     http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                     defaultSidecarImage,
+			queueSidecarUpstreamProtocolDetectionKey: "true",
+		},
+	}, {
+		name: "controller configuration with queue sidecar resource rationale",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarResourceRationale:     true,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:             defaultSidecarImage,
+			queueSidecarResourceRationaleKey: "true",
+		},
+	}, {
+		name: "controller configuration with queue sidecar limit range check",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarCheckLimitRanges:      true,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:            defaultSidecarImage,
+			queueSidecarCheckLimitRangesKey: "true",
+		},
+	}, {
+		name: "controller configuration with queue sidecar request id header",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarRequestIDHeader:       "X-Request-Id",
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:           defaultSidecarImage,
+			queueSidecarRequestIDHeaderKey: "X-Request-Id",
+		},
+	}, {
+		name:    "controller configuration with invalid queue sidecar request id header",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:           defaultSidecarImage,
+			queueSidecarRequestIDHeaderKey: "X Request Id",
+		},
+	}, {
+		name: "controller configuration with deployment labels",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving: sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay: DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:  DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:       DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:     DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:        DigestResolutionWorkersDefault,
+			QueueSidecarImage:              defaultSidecarImage,
+			ProgressDeadline:               ProgressDeadlineDefault,
+			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:     sets.New(""),
+			DeploymentLabels: map[string]string{
+				"example.com/team":        "{label:team}",
+				"example.com/cost-center": "cc-{namespace}",
+			},
+			DeploymentLabelsOnPodTemplate:     true,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			deploymentLabelsKey: `
+example.com/team: "{label:team}"
+example.com/cost-center: "cc-{namespace}"
+`,
+			deploymentLabelsOnPodTemplateKey: "true",
+		},
+	}, {
+		name:    "controller configuration with invalid deployment label key",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			deploymentLabelsKey:  `"cost center": "{namespace}"`,
+		},
+	}, {
+		name:    "controller configuration with knative deployment label",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			deploymentLabelsKey:  `serving.knative.dev/service: "{namespace}"`,
+		},
+	}, {
+		name:    "controller configuration with unsupported deployment label token",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			deploymentLabelsKey:  `team: "{annotation:team}"`,
+		},
+	}, {
+		name: "controller configuration with pod labels",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			PodLabels:                         map[string]string{"example.com/network-zone": "serverless"},
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			podLabelsKey:         `example.com/network-zone: serverless`,
+		},
+	}, {
+		name:    "controller configuration with invalid pod label key",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			podLabelsKey:         `"network zone": serverless`,
+		},
+	}, {
+		name:    "controller configuration with invalid pod label value",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			podLabelsKey:         `zone: "{namespace}"`,
+		},
+	}, {
+		name:    "controller configuration with knative pod label",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			podLabelsKey:         `serving.knative.dev/revision: foo`,
+		},
+	}, {
+		name: "controller configuration with queue full status code",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusTooManyRequests,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarQueueFullStatusCodeKey: "429",
+		},
+	}, {
+		name: "controller configuration with queue full response",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+			QueueSidecarQueueFullRetryAfter:   5 * time.Second,
+			QueueSidecarQueueFullBody:         "come back later",
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarQueueFullRetryAfterKey: "5s",
+			queueSidecarQueueFullBodyKey:       "come back later",
+		},
+	}, {
+		name: "controller configuration with breaker drain timeout",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+			QueueSidecarBreakerDrainTimeout:   20 * time.Second,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarBreakerDrainTimeoutKey: "20s",
+		},
+	}, {
+		name:    "controller configuration with fractional breaker drain timeout",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarBreakerDrainTimeoutKey: "2500ms",
+		},
+	}, {
+		name:    "controller configuration with negative breaker drain timeout",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarBreakerDrainTimeoutKey: "-1s",
+		},
+	}, {
+		name:    "controller configuration with fractional queue full retry after",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarQueueFullRetryAfterKey: "1500ms",
+		},
+	}, {
+		name:    "controller configuration with negative queue full retry after",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarQueueFullRetryAfterKey: "-1s",
+		},
+	}, {
+		name:    "controller configuration with unsupported queue full status code",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarQueueFullStatusCodeKey: "500",
+		},
+	}, {
+		name: "controller configuration with maintenance response",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusGone,
+			QueueSidecarMaintenanceBody:       "down for maintenance",
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                 defaultSidecarImage,
+			queueSidecarMaintenanceStatusCodeKey: "410",
+			queueSidecarMaintenanceBodyKey:       "down for maintenance",
+		},
+	}, {
+		name:    "controller configuration with maintenance status code not an error",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                 defaultSidecarImage,
+			queueSidecarMaintenanceStatusCodeKey: "200",
+		},
+	}, {
+		name: "controller configuration with sidecar containers",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+			SidecarContainers: map[string]SidecarContainer{
+				"log-shipper": {
+					Selector:  map[string]string{"team": "payments"},
+					Container: corev1.Container{Image: "example.com/log-shipper:1.0"},
+				},
+			},
+		},
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			sidecarContainersKey: `
+log-shipper:
+  selector:
+    team: payments
+  container:
+    image: example.com/log-shipper:1.0
+`,
+		},
+	}, {
+		name:    "controller configuration with invalid sidecar container name",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			sidecarContainersKey: `
+Log_Shipper:
+  container:
+    image: example.com/log-shipper:1.0
+`,
+		},
+	}, {
+		name:    "controller configuration with sidecar container without image",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			sidecarContainersKey: `
+log-shipper:
+  selector:
+    team: payments
+`,
+		},
+	}, {
+		name:    "controller configuration with invalid default runtime class fallback",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:           defaultSidecarImage,
+			defaultRuntimeClassFallbackKey: "Runc_Hardened",
+		},
+	}, {
+		name: "controller configuration with image pull secrets",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ImagePullSecrets:                  []string{"mirror-creds", "registry-creds"},
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			imagePullSecretsKey:  "mirror-creds, registry-creds,,mirror-creds",
+		},
+	}, {
+		name:    "controller configuration with invalid image pull secret",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			imagePullSecretsKey:  "mirror-creds,Registry_Creds",
+		},
+	}, {
+		name: "controller configuration with queue sidecar prewarm",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarPrewarm:               true,
+			QueueSidecarPrewarmPath:           "/warmup",
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:       defaultSidecarImage,
+			queueSidecarPrewarmKey:     "true",
+			queueSidecarPrewarmPathKey: "/warmup",
+		},
+	}, {
+		name:    "controller configuration with relative queue sidecar prewarm path",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:       defaultSidecarImage,
+			queueSidecarPrewarmPathKey: "warmup",
+		},
+	}, {
+		name: "controller configuration with queue sidecar drain readiness path",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarDrainReadinessPath:    "/drain-ready",
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			queueSidecarDrainReadinessPathKey: "/drain-ready",
+		},
+	}, {
+		name:    "controller configuration with relative queue sidecar drain readiness path",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			queueSidecarDrainReadinessPathKey: "drain-ready",
+		},
+	}, {
+		name: "controller configuration with queue sidecar drain path",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarDrainPath:             "/drain",
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:     defaultSidecarImage,
+			queueSidecarDrainPathKey: "/drain",
+		},
+	}, {
+		name:    "controller configuration with relative queue sidecar drain path",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:     defaultSidecarImage,
+			queueSidecarDrainPathKey: "drain",
+		},
+	}, {
+		name:    "controller configuration with reserved queue sidecar drain path",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:     defaultSidecarImage,
+			queueSidecarDrainPathKey: "/wait-for-drain",
+		},
+	}, {
+		name: "controller configuration with automatic queue sidecar gomemlimit",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarGoMemLimitAuto:        true,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:      defaultSidecarImage,
+			queueSidecarGoMemLimitKey: "auto",
+		},
+	}, {
+		name: "controller configuration with explicit queue sidecar gomemlimit",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarMemoryLimit:           quantity("200Mi"),
+			QueueSidecarGoMemLimit:            quantity("180Mi"),
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:       defaultSidecarImage,
+			queueSidecarMemoryLimitKey: "200Mi",
+			queueSidecarGoMemLimitKey:  "180Mi",
+		},
+	}, {
+		name:    "controller configuration with invalid queue sidecar gomemlimit",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:      defaultSidecarImage,
+			queueSidecarGoMemLimitKey: "lots",
+		},
+	}, {
+		name:    "controller configuration with non-positive queue sidecar gomemlimit",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:      defaultSidecarImage,
+			queueSidecarGoMemLimitKey: "0",
+		},
+	}, {
+		name:    "controller configuration with queue sidecar gomemlimit exceeding the memory limit",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:       defaultSidecarImage,
+			queueSidecarMemoryLimitKey: "200Mi",
+			queueSidecarGoMemLimitKey:  "300Mi",
+		},
+	}, {
+		name: "controller configuration with queue sidecar client concurrency limit",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:     sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:            digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:     DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:      DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:           DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:         DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:            DigestResolutionWorkersDefault,
+			QueueSidecarImage:                  defaultSidecarImage,
+			ProgressDeadline:                   ProgressDeadlineDefault,
+			QueueSidecarCPURequest:             &QueueSidecarCPURequestDefault,
+			QueueSidecarClientConcurrencyLimit: 10,
+			QueueSidecarClientKeyHeader:        "X-Api-Key",
+			QueueSidecarTokenAudiences:         sets.New(""),
+			DefaultAffinityType:                defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:    corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:          CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:         HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:    http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode:  http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                  defaultSidecarImage,
+			queueSidecarClientConcurrencyLimitKey: "10",
+			queueSidecarClientKeyHeaderKey:        "X-Api-Key",
+		},
+	}, {
+		name:    "controller configuration with negative queue sidecar client concurrency limit",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                  defaultSidecarImage,
+			queueSidecarClientConcurrencyLimitKey: "-1",
+		},
+	}, {
+		name:    "controller configuration with invalid queue sidecar client key header",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:           defaultSidecarImage,
+			queueSidecarClientKeyHeaderKey: "X Api Key",
+		},
+	}, {
+		name: "controller configuration with max upstream connections",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:     sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:            digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:     DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:      DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:           DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:         DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:            DigestResolutionWorkersDefault,
+			QueueSidecarImage:                  defaultSidecarImage,
+			ProgressDeadline:                   ProgressDeadlineDefault,
+			QueueSidecarCPURequest:             &QueueSidecarCPURequestDefault,
+			QueueSidecarMaxUpstreamConnections: 50,
+			QueueSidecarTokenAudiences:         sets.New(""),
+			DefaultAffinityType:                defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:    corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:          CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:         HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:    http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode:  http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                  defaultSidecarImage,
+			queueSidecarMaxUpstreamConnectionsKey: "50",
+		},
+	}, {
+		name:    "controller configuration with negative max upstream connections",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                  defaultSidecarImage,
+			queueSidecarMaxUpstreamConnectionsKey: "-1",
+		},
+	}, {
+		name: "controller configuration with h2 max concurrent streams",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:     sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:            digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:     DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:      DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:           DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:         DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:            DigestResolutionWorkersDefault,
+			QueueSidecarImage:                  defaultSidecarImage,
+			ProgressDeadline:                   ProgressDeadlineDefault,
+			QueueSidecarCPURequest:             &QueueSidecarCPURequestDefault,
+			QueueSidecarH2MaxConcurrentStreams: 10,
+			QueueSidecarTokenAudiences:         sets.New(""),
+			DefaultAffinityType:                defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:    corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:          CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:         HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:    http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode:  http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                  defaultSidecarImage,
+			queueSidecarH2MaxConcurrentStreamsKey: "10",
+		},
+	}, {
+		name:    "controller configuration with negative h2 max concurrent streams",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                  defaultSidecarImage,
+			queueSidecarH2MaxConcurrentStreamsKey: "-1",
+		},
+	}, {
+		name: "controller configuration with max request body bytes",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarMaxRequestBodyBytes:   1 << 20,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarMaxRequestBodyBytesKey: "1048576",
+		},
+	}, {
+		name:    "controller configuration with negative max request body bytes",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			queueSidecarMaxRequestBodyBytesKey: "-1",
+		},
+	}, {
+		name: "controller configuration with slow request threshold",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarSlowRequestThreshold:  1500 * time.Millisecond,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                defaultSidecarImage,
+			queueSidecarSlowRequestThresholdKey: "1.5s",
+		},
+	}, {
+		name:    "controller configuration with fractional milliseconds slow request threshold",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                defaultSidecarImage,
+			queueSidecarSlowRequestThresholdKey: "1500us",
+		},
+	}, {
+		name:    "controller configuration with negative slow request threshold",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                defaultSidecarImage,
+			queueSidecarSlowRequestThresholdKey: "-1s",
+		},
+	}, {
+		name: "controller configuration with response header timeout",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarResponseHeaderTimeout: 30 * time.Second,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:                 defaultSidecarImage,
+			queueSidecarResponseHeaderTimeoutKey: "30s",
+		},
+	}, {
+		name:    "controller configuration with fractional seconds response header timeout",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                 defaultSidecarImage,
+			queueSidecarResponseHeaderTimeoutKey: "1500ms",
+		},
+	}, {
+		name:    "controller configuration with negative response header timeout",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                 defaultSidecarImage,
+			queueSidecarResponseHeaderTimeoutKey: "-1s",
+		},
+	}, {
+		name:    "controller configuration with negative max response headers",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			queueSidecarMaxResponseHeadersKey: "-1",
+		},
+	}, {
+		name:    "controller configuration with negative resource bound scale",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			queueSidecarResourceBoundScaleKey: "-1",
+		},
+	}, {
+		name:    "controller with no side car image",
+		wantErr: true,
+		data:    map[string]string{},
+	}, {
+		name: "controller configuration with digest resolution retry delays",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    100 * time.Millisecond,
+			DigestResolutionRetryMaxDelay:     time.Minute,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			digestResolutionRetryBaseDelayKey: "100ms",
+			digestResolutionRetryMaxDelayKey:  "1m",
+		},
+	}, {
+		name:    "controller configuration non-positive digest resolution retry base delay",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			digestResolutionRetryBaseDelayKey: "0s",
+		},
+	}, {
+		name:    "controller configuration digest resolution retry max delay shorter than base delay",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			digestResolutionRetryBaseDelayKey: "10s",
+			digestResolutionRetryMaxDelayKey:  "5s",
+		},
+	}, {
+		name: "controller configuration with digest resolution retry rate",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          2.5,
+			DigestResolutionRetryBurst:        5,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:          defaultSidecarImage,
+			digestResolutionRetryQPSKey:   "2.5",
+			digestResolutionRetryBurstKey: "5",
+		},
+	}, {
+		name:    "controller configuration non-positive digest resolution retry qps",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			digestResolutionRetryQPSKey: "0",
+		},
+	}, {
+		name:    "controller configuration non-positive digest resolution retry burst",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:          defaultSidecarImage,
+			digestResolutionRetryBurstKey: "0",
+		},
+	}, {
+		name:    "controller configuration invalid digest resolution timeout",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:       defaultSidecarImage,
+			digestResolutionTimeoutKey: "-1s",
+		},
+	}, {
+		name: "controller configuration with digest resolution workers",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           500,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:       defaultSidecarImage,
+			digestResolutionWorkersKey: "500",
+		},
+	}, {
+		name:    "controller configuration with zero digest resolution workers",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:       defaultSidecarImage,
+			digestResolutionWorkersKey: "0",
+		},
+	}, {
+		name: "controller configuration with digest resolution batch registries",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			DigestResolutionBatchRegistries:   sets.New("registry.example.com", "mirror.example.com"),
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:               defaultSidecarImage,
+			digestResolutionBatchRegistriesKey: "registry.example.com,mirror.example.com",
+		},
+	}, {
+		name: "controller configuration with digest resolution concurrency",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			DigestResolutionConcurrency:       3,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:           defaultSidecarImage,
+			digestResolutionConcurrencyKey: "3",
+		},
+	}, {
+		name:    "controller configuration negative digest resolution concurrency",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:           defaultSidecarImage,
+			digestResolutionConcurrencyKey: "-1",
+		},
+	}, {
+		name: "controller configuration with digest resolution accept media types",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving: sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionAcceptMediaTypes: []string{
+				"application/vnd.oci.image.index.v1+json",
+				"application/vnd.docker.distribution.manifest.v2+json",
+			},
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
 		},
 		data: map[string]string{
-			QueueSidecarImageKey: defaultSidecarImage,
-			ProgressDeadlineKey:  "444s",
+			QueueSidecarImageKey:                defaultSidecarImage,
+			digestResolutionAcceptMediaTypesKey: "application/vnd.oci.image.index.v1+json, application/vnd.docker.distribution.manifest.v2+json,",
 		},
 	}, {
-		name: "controller configuration good digest resolution timeout",
+		name: "controller configuration with digest resolution failures marked unroutable",
 		wantConfig: &Config{
-			RegistriesSkippingTagResolving: sets.New("kind.local", "ko.local", "dev.local"),
-			DigestResolutionTimeout:        60 * time.Second,
-			QueueSidecarImage:              defaultSidecarImage,
-			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
-			QueueSidecarTokenAudiences:     sets.New(""),
-			ProgressDeadline:               ProgressDeadlineDefault,
-			DefaultAffinityType:            defaultAffinityTypeValue,
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			DigestResolutionFailureUnroutable: true,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
 		},
 		data: map[string]string{
-			QueueSidecarImageKey:       defaultSidecarImage,
-			digestResolutionTimeoutKey: "60s",
+			QueueSidecarImageKey:                 defaultSidecarImage,
+			digestResolutionFailureUnroutableKey: "true",
+		}}, {
+		name:    "controller configuration with a digest resolution accept media type which isn't a manifest",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                defaultSidecarImage,
+			digestResolutionAcceptMediaTypesKey: "application/vnd.oci.image.index.v1+json,application/vnd.oci.image.layer.v1.tar+gzip",
 		},
 	}, {
-		name: "controller configuration with registries",
+		name: "controller configuration with exported image labels",
 		wantConfig: &Config{
-			RegistriesSkippingTagResolving: sets.New("ko.local", "ko.dev"),
-			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
-			QueueSidecarImage:              defaultSidecarImage,
-			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
-			QueueSidecarTokenAudiences:     sets.New(""),
-			ProgressDeadline:               ProgressDeadlineDefault,
-			DefaultAffinityType:            defaultAffinityTypeValue,
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			ExportedImageLabels:               sets.New("org.opencontainers.image.revision", "build-id"),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
 		},
 		data: map[string]string{
-			QueueSidecarImageKey:              defaultSidecarImage,
-			registriesSkippingTagResolvingKey: "ko.local,ko.dev",
+			QueueSidecarImageKey:   defaultSidecarImage,
+			exportedImageLabelsKey: "org.opencontainers.image.revision, build-id,",
 		},
 	}, {
-		name: "controller configuration with custom queue sidecar resource request/limits",
+		name: "controller configuration with required image labels",
 		wantConfig: &Config{
-			RegistriesSkippingTagResolving:      sets.New("kind.local", "ko.local", "dev.local"),
-			DigestResolutionTimeout:             digestResolutionTimeoutDefault,
-			QueueSidecarImage:                   defaultSidecarImage,
-			ProgressDeadline:                    ProgressDeadlineDefault,
-			QueueSidecarCPURequest:              quantity("123m"),
-			QueueSidecarMemoryRequest:           quantity("456M"),
-			QueueSidecarEphemeralStorageRequest: quantity("789m"),
-			QueueSidecarCPULimit:                quantity("987M"),
-			QueueSidecarMemoryLimit:             quantity("654m"),
-			QueueSidecarEphemeralStorageLimit:   quantity("321M"),
-			QueueSidecarTokenAudiences:          sets.New(""),
-			DefaultAffinityType:                 defaultAffinityTypeValue,
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			RequiredImageLabels:               map[string]string{"approved": "true", "team": ""},
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
 		},
 		data: map[string]string{
-			QueueSidecarImageKey:                   defaultSidecarImage,
-			queueSidecarCPURequestKey:              "123m",
-			queueSidecarMemoryRequestKey:           "456M",
-			queueSidecarEphemeralStorageRequestKey: "789m",
-			queueSidecarCPULimitKey:                "987M",
-			queueSidecarMemoryLimitKey:             "654m",
-			queueSidecarEphemeralStorageLimitKey:   "321M",
+			QueueSidecarImageKey:   defaultSidecarImage,
+			requiredImageLabelsKey: "approved=true, team=,",
 		},
 	}, {
-		name:    "controller with no side car image",
+		name:    "controller configuration with a required image label without a value",
 		wantErr: true,
-		data:    map[string]string{},
+		data: map[string]string{
+			QueueSidecarImageKey:   defaultSidecarImage,
+			requiredImageLabelsKey: "approved=true,team",
+		},
 	}, {
-		name:    "controller configuration invalid digest resolution timeout",
+		name: "controller configuration with denied image labels",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving: sets.New("kind.local", "ko.local", "dev.local"),
+			DeniedImageLabels: map[string]sets.Set[string]{
+				"base-deprecated": sets.New("true"),
+				"base-digest":     sets.New("sha256:abc", "sha256:def"),
+			},
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			deniedImageLabelsKey: "base-deprecated=true, base-digest=sha256:abc,base-digest=sha256:def,",
+		},
+	}, {
+		name:    "controller configuration with a denied image label without a value",
 		wantErr: true,
 		data: map[string]string{
-			QueueSidecarImageKey:       defaultSidecarImage,
-			digestResolutionTimeoutKey: "-1s",
+			QueueSidecarImageKey: defaultSidecarImage,
+			deniedImageLabelsKey: "base-deprecated",
 		},
 	}, {
 		name:    "controller configuration invalid progress deadline",
@@ -281,11 +2782,17 @@ func TestControllerConfiguration(t *testing.T) {
 			"queueSidecarMemoryLimit":             "8M",
 			"queueSidecarEphemeralStorageRequest": "9M",
 			"queueSidecarEphemeralStorageLimit":   "10M",
+			"digestResolutionWorkers":             "11",
 		},
 		wantConfig: &Config{
 			QueueSidecarImage:                   "1",
 			ProgressDeadline:                    2 * time.Second,
 			DigestResolutionTimeout:             3 * time.Second,
+			DigestResolutionRetryBaseDelay:      DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:       DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:            DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:          DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:             11,
 			RegistriesSkippingTagResolving:      sets.New("4"),
 			QueueSidecarCPURequest:              quantity("5m"),
 			QueueSidecarCPULimit:                quantity("6m"),
@@ -295,6 +2802,11 @@ func TestControllerConfiguration(t *testing.T) {
 			QueueSidecarEphemeralStorageLimit:   quantity("10M"),
 			QueueSidecarTokenAudiences:          sets.New(""),
 			DefaultAffinityType:                 defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:     corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:           CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:          HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:     http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode:   http.StatusServiceUnavailable,
 		},
 	}, {
 		name: "newer key case takes priority",
@@ -311,6 +2823,7 @@ func TestControllerConfiguration(t *testing.T) {
 			"queueSidecarEphemeralStorageRequest": "9M",
 			"queueSidecarEphemeralStorageLimit":   "10M",
 			"queueSidecarTokens":                  "bar",
+			"digestResolutionWorkers":             "11",
 
 			QueueSidecarImageKey:                   "12",
 			ProgressDeadlineKey:                    "13s",
@@ -323,11 +2836,17 @@ func TestControllerConfiguration(t *testing.T) {
 			queueSidecarEphemeralStorageRequestKey: "20M",
 			queueSidecarEphemeralStorageLimitKey:   "21M",
 			queueSidecarTokenAudiencesKey:          "foo",
+			digestResolutionWorkersKey:             "22",
 		},
 		wantConfig: &Config{
 			QueueSidecarImage:                   "12",
 			ProgressDeadline:                    13 * time.Second,
 			DigestResolutionTimeout:             14 * time.Second,
+			DigestResolutionRetryBaseDelay:      DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:       DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:            DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:          DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:             22,
 			RegistriesSkippingTagResolving:      sets.New("15"),
 			QueueSidecarCPURequest:              quantity("16m"),
 			QueueSidecarCPULimit:                quantity("17m"),
@@ -337,89 +2856,556 @@ func TestControllerConfiguration(t *testing.T) {
 			QueueSidecarEphemeralStorageLimit:   quantity("21M"),
 			QueueSidecarTokenAudiences:          sets.New("foo"),
 			DefaultAffinityType:                 defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:     corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:           CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:          HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:     http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode:   http.StatusServiceUnavailable,
+		},
+	}, {
+		name:    "runtime class name defaults to nothing",
+		wantErr: false,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+		},
+		wantConfig: &Config{
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			RuntimeClassNames:                 nil,
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+	}, {
+		name:    "runtime class name with wildcard",
+		wantErr: false,
+		wantConfig: &Config{
+			RuntimeClassNames: map[string]RuntimeClassNameLabelSelector{
+				"gvisor": {},
+			},
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			RuntimeClassNameKey:  "gvisor: {}",
+			QueueSidecarImageKey: defaultSidecarImage,
+		},
+	}, {
+		name:    "default tolerations",
+		wantErr: false,
+		wantConfig: &Config{
+			DefaultTolerations: []corev1.Toleration{{
+				Key:      "nvidia.com/gpu",
+				Operator: corev1.TolerationOpExists,
+				Effect:   corev1.TaintEffectNoSchedule,
+			}, {
+				Key:               "dedicated",
+				Operator:          corev1.TolerationOpEqual,
+				Value:             "serving",
+				Effect:            corev1.TaintEffectNoExecute,
+				TolerationSeconds: ptr.Int64(300),
+			}},
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			defaultTolerationsKey: `---
+- key: nvidia.com/gpu
+  operator: Exists
+  effect: NoSchedule
+- key: dedicated
+  operator: Equal
+  value: serving
+  effect: NoExecute
+  tolerationSeconds: 300
+`,
+			QueueSidecarImageKey: defaultSidecarImage,
+		},
+	}, {
+		name:    "default tolerations with an unparsable format",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:  defaultSidecarImage,
+			defaultTolerationsKey: ` ???; 231424 `,
+		},
+	}, {
+		name:    "default tolerations with a value for operator Exists",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:  defaultSidecarImage,
+			defaultTolerationsKey: `[{key: dedicated, operator: Exists, value: serving}]`,
+		},
+	}, {
+		name:    "default tolerations with operator Equal without a key",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:  defaultSidecarImage,
+			defaultTolerationsKey: `[{operator: Equal, value: serving}]`,
+		},
+	}, {
+		name:    "default tolerations with an unsupported operator",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:  defaultSidecarImage,
+			defaultTolerationsKey: `[{key: dedicated, operator: Gt, value: "1"}]`,
+		},
+	}, {
+		name:    "default tolerations with an unsupported effect",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:  defaultSidecarImage,
+			defaultTolerationsKey: `[{key: dedicated, operator: Exists, effect: NoRun}]`,
+		},
+	}, {
+		name:    "default tolerations with toleration seconds without effect NoExecute",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:  defaultSidecarImage,
+			defaultTolerationsKey: `[{key: dedicated, operator: Exists, effect: NoSchedule, tolerationSeconds: 10}]`,
+		},
+	}, {
+		name:    "default tolerations with an invalid key",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:  defaultSidecarImage,
+			defaultTolerationsKey: `[{key: "-dedicated", operator: Exists}]`,
+		},
+	}, {
+		name:    "default topology spread constraints",
+		wantErr: false,
+		wantConfig: &Config{
+			DefaultTopologySpreadConstraints: []corev1.TopologySpreadConstraint{{
+				MaxSkew:           1,
+				TopologyKey:       corev1.LabelTopologyZone,
+				WhenUnsatisfiable: corev1.ScheduleAnyway,
+			}, {
+				MaxSkew:           2,
+				TopologyKey:       corev1.LabelTopologyZone,
+				WhenUnsatisfiable: corev1.DoNotSchedule,
+				LabelSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "serving"},
+				},
+			}},
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			defaultTopologySpreadConstraintsKey: `---
+- topologyKey: topology.kubernetes.io/zone
+  whenUnsatisfiable: ScheduleAnyway
+- topologyKey: topology.kubernetes.io/zone
+  whenUnsatisfiable: DoNotSchedule
+  maxSkew: 2
+  labelSelector:
+    matchLabels:
+      app: serving
+`,
+			QueueSidecarImageKey: defaultSidecarImage,
+		},
+	}, {
+		name:    "default topology spread constraints with an unparsable format",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                defaultSidecarImage,
+			defaultTopologySpreadConstraintsKey: ` ???; 231424 `,
+		},
+	}, {
+		name:    "default topology spread constraints without a topology key",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                defaultSidecarImage,
+			defaultTopologySpreadConstraintsKey: `[{whenUnsatisfiable: ScheduleAnyway}]`,
+		},
+	}, {
+		name:    "default topology spread constraints with an invalid topology key",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                defaultSidecarImage,
+			defaultTopologySpreadConstraintsKey: `[{topologyKey: "-zone", whenUnsatisfiable: ScheduleAnyway}]`,
+		},
+	}, {
+		name:    "default topology spread constraints without whenUnsatisfiable",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                defaultSidecarImage,
+			defaultTopologySpreadConstraintsKey: `[{topologyKey: topology.kubernetes.io/zone}]`,
+		},
+	}, {
+		name:    "default topology spread constraints with an unsupported whenUnsatisfiable",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                defaultSidecarImage,
+			defaultTopologySpreadConstraintsKey: `[{topologyKey: topology.kubernetes.io/zone, whenUnsatisfiable: Sometimes}]`,
+		},
+	}, {
+		name:    "default topology spread constraints with a negative max skew",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                defaultSidecarImage,
+			defaultTopologySpreadConstraintsKey: `[{topologyKey: topology.kubernetes.io/zone, whenUnsatisfiable: ScheduleAnyway, maxSkew: -1}]`,
+		},
+	}, {
+		name:    "default topology spread constraints with an invalid label selector",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                defaultSidecarImage,
+			defaultTopologySpreadConstraintsKey: `[{topologyKey: topology.kubernetes.io/zone, whenUnsatisfiable: ScheduleAnyway, labelSelector: {matchLabels: {"-app": serving}}}]`,
+		},
+	}, {
+		name:    "default topology spread constraints with duplicates",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:                defaultSidecarImage,
+			defaultTopologySpreadConstraintsKey: `[{topologyKey: topology.kubernetes.io/zone, whenUnsatisfiable: ScheduleAnyway}, {topologyKey: topology.kubernetes.io/zone, whenUnsatisfiable: ScheduleAnyway, maxSkew: 2}]`,
+		},
+	}, {
+		name:    "runtime class name with wildcard and label selectors",
+		wantErr: false,
+		wantConfig: &Config{
+			RuntimeClassNames: map[string]RuntimeClassNameLabelSelector{
+				"gvisor": {},
+				"kata": {
+					Selector: map[string]string{
+						"some": "value-here",
+					},
+				},
+			},
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			RuntimeClassNameKey: `---
+gvisor: {}
+kata:
+  selector:
+    some: value-here
+`,
+			QueueSidecarImageKey: defaultSidecarImage,
+		},
+	}, {
+		name:    "runtime class name with service",
+		wantErr: false,
+		wantConfig: &Config{
+			RuntimeClassNames: map[string]RuntimeClassNameLabelSelector{
+				"gvisor": {},
+				"kata": {
+					Service: "payments",
+				},
+			},
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			RuntimeClassNameKey: `---
+gvisor: {}
+kata:
+  service: payments
+`,
+			QueueSidecarImageKey: defaultSidecarImage,
+		},
+	}, {
+		name:    "runtime class name with bad label selectors",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			RuntimeClassNameKey: `---
+gvisor: {}
+kata:
+  selector:
+    "-a": " a  a "
+`,
+		},
+	}, {
+		name:    "runtime class name with bad service",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			RuntimeClassNameKey: `---
+kata:
+  service: "not a service"
+`,
+		},
+	}, {
+		name:    "runtime class name with an unparsable format",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			RuntimeClassNameKey:  ` ???; 231424 `,
+		},
+	}, {
+		name: "digest resolution timeouts",
+		wantConfig: &Config{
+			DigestResolutionTimeout: digestResolutionTimeoutDefault,
+			DigestResolutionTimeouts: map[string]time.Duration{
+				"registry.internal":  2 * time.Second,
+				"mirror.example.com": time.Minute,
+			},
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			digestResolutionTimeoutsKey: `---
+registry.internal: 2s
+mirror.example.com: 60s
+`,
+		},
+	}, {
+		name:    "digest resolution timeouts with zero timeout",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			digestResolutionTimeoutsKey: "registry.internal: 0s",
+		},
+	}, {
+		name:    "digest resolution timeouts with negative timeout",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			digestResolutionTimeoutsKey: "registry.internal: -1s",
+		},
+	}, {
+		name:    "digest resolution timeouts with an unparsable timeout",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			digestResolutionTimeoutsKey: "registry.internal: soon",
+		},
+	}, {
+		name: "digest resolution tls server names",
+		wantConfig: &Config{
+			DigestResolutionTimeout: digestResolutionTimeoutDefault,
+			DigestResolutionTLSServerNames: map[string]string{
+				"203.0.113.10:5000": "registry.internal.example.com",
+			},
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			digestResolutionTLSServerNamesKey: "203.0.113.10:5000: registry.internal.example.com",
+		},
+	}, {
+		name:    "digest resolution tls server names with an invalid registry",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			digestResolutionTLSServerNamesKey: "203.0.113.10:http: registry.internal.example.com",
 		},
 	}, {
-		name:    "runtime class name defaults to nothing",
-		wantErr: false,
+		name:    "digest resolution tls server names with an invalid server name",
+		wantErr: true,
 		data: map[string]string{
-			QueueSidecarImageKey: defaultSidecarImage,
+			QueueSidecarImageKey:              defaultSidecarImage,
+			digestResolutionTLSServerNamesKey: "203.0.113.10: Not_A_Name",
 		},
-		wantConfig: &Config{
-			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
-			ProgressDeadline:               ProgressDeadlineDefault,
-			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
-			QueueSidecarImage:              defaultSidecarImage,
-			QueueSidecarTokenAudiences:     sets.New(""),
-			RegistriesSkippingTagResolving: sets.New("kind.local", "ko.local", "dev.local"),
-			RuntimeClassNames:              nil,
-			DefaultAffinityType:            defaultAffinityTypeValue,
+	}, {
+		name:    "digest resolution tls server names unparsable",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			digestResolutionTLSServerNamesKey: "- registry.internal.example.com",
 		},
 	}, {
-		name:    "runtime class name with wildcard",
-		wantErr: false,
+		name: "registries resolution rate limits",
 		wantConfig: &Config{
-			RuntimeClassNames: map[string]RuntimeClassNameLabelSelector{
-				"gvisor": {},
+			RegistriesResolutionRateLimits: map[string]RegistryRateLimit{
+				"index.docker.io": {QPS: 0.5, Burst: 10},
 			},
-			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
-			ProgressDeadline:               ProgressDeadlineDefault,
-			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
-			QueueSidecarImage:              defaultSidecarImage,
-			QueueSidecarTokenAudiences:     sets.New(""),
-			RegistriesSkippingTagResolving: sets.New("kind.local", "ko.local", "dev.local"),
-			DefaultAffinityType:            defaultAffinityTypeValue,
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
 		},
 		data: map[string]string{
-			RuntimeClassNameKey:  "gvisor: {}",
 			QueueSidecarImageKey: defaultSidecarImage,
+			registriesResolutionRateLimitsKey: `---
+index.docker.io:
+  qps: 0.5
+  burst: 10
+`,
 		},
 	}, {
-		name:    "runtime class name with wildcard and label selectors",
-		wantErr: false,
-		wantConfig: &Config{
-			RuntimeClassNames: map[string]RuntimeClassNameLabelSelector{
-				"gvisor": {},
-				"kata": {
-					Selector: map[string]string{
-						"some": "value-here",
-					},
-				},
-			},
-			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
-			ProgressDeadline:               ProgressDeadlineDefault,
-			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
-			QueueSidecarImage:              defaultSidecarImage,
-			QueueSidecarTokenAudiences:     sets.New(""),
-			RegistriesSkippingTagResolving: sets.New("kind.local", "ko.local", "dev.local"),
-			DefaultAffinityType:            defaultAffinityTypeValue,
+		name:    "registries resolution rate limits with non-positive qps",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			registriesResolutionRateLimitsKey: "index.docker.io: {qps: 0, burst: 10}",
 		},
+	}, {
+		name:    "registries resolution rate limits with zero burst",
+		wantErr: true,
 		data: map[string]string{
-			RuntimeClassNameKey: `---
-gvisor: {}
-kata:
-  selector:
-    some: value-here
-`,
-			QueueSidecarImageKey: defaultSidecarImage,
+			QueueSidecarImageKey:              defaultSidecarImage,
+			registriesResolutionRateLimitsKey: "index.docker.io: {qps: 1}",
 		},
 	}, {
-		name:    "runtime class name with bad label selectors",
+		name:    "registries resolution rate limits with an unparsable format",
 		wantErr: true,
 		data: map[string]string{
-			QueueSidecarImageKey: defaultSidecarImage,
-			RuntimeClassNameKey: `---
-gvisor: {}
-kata:
-  selector:
-    "-a": " a  a "
-`,
+			QueueSidecarImageKey:              defaultSidecarImage,
+			registriesResolutionRateLimitsKey: ` ???; 231424 `,
 		},
 	}, {
-		name:    "runtime class name with an unparsable format",
+		name: "force activator selector",
+		wantConfig: &Config{
+			ForceActivatorSelector:            labels.SelectorFromSet(labels.Set{"gpu": "true"}),
+			DigestResolutionTimeout:           digestResolutionTimeoutDefault,
+			DigestResolutionRetryBaseDelay:    DigestResolutionRetryBaseDelayDefault,
+			DigestResolutionRetryMaxDelay:     DigestResolutionRetryMaxDelayDefault,
+			DigestResolutionRetryQPS:          DigestResolutionRetryQPSDefault,
+			DigestResolutionRetryBurst:        DigestResolutionRetryBurstDefault,
+			DigestResolutionWorkers:           DigestResolutionWorkersDefault,
+			ProgressDeadline:                  ProgressDeadlineDefault,
+			QueueSidecarCPURequest:            &QueueSidecarCPURequestDefault,
+			QueueSidecarImage:                 defaultSidecarImage,
+			QueueSidecarTokenAudiences:        sets.New(""),
+			RegistriesSkippingTagResolving:    sets.New("kind.local", "ko.local", "dev.local"),
+			DefaultAffinityType:               defaultAffinityTypeValue,
+			TopologySpreadWhenUnsatisfiable:   corev1.ScheduleAnyway,
+			CrossRevisionAntiAffinity:         CrossRevisionAntiAffinityNone,
+			QueueSidecarHTTP10Handling:        HTTP10Compatibility,
+			QueueSidecarQueueFullStatusCode:   http.StatusServiceUnavailable,
+			QueueSidecarMaintenanceStatusCode: http.StatusServiceUnavailable,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:      defaultSidecarImage,
+			forceActivatorSelectorKey: "gpu=true",
+		},
+	}, {
+		name:    "force activator selector with an unparsable format",
 		wantErr: true,
 		data: map[string]string{
-			QueueSidecarImageKey: defaultSidecarImage,
-			RuntimeClassNameKey:  ` ???; 231424 `,
+			QueueSidecarImageKey:      defaultSidecarImage,
+			forceActivatorSelectorKey: "gpu in (",
 		},
 	}, {
 		name:    "invalid runtime class name",
@@ -497,6 +3483,7 @@ func TestPodRuntimeClassName(t *testing.T) {
 		name              string
 		serviceLabels     map[string]string
 		runtimeClassNames map[string]RuntimeClassNameLabelSelector
+		fallback          string
 		want              *string
 	}{{
 		name:              "empty",
@@ -565,6 +3552,62 @@ func TestPodRuntimeClassName(t *testing.T) {
 			},
 		},
 		want: ptr.String("kata"),
+	}, {
+		name: "service name beats wildcard",
+		serviceLabels: map[string]string{
+			"serving.knative.dev/service": "payments",
+		},
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"gvisor":        {},
+			"runc-hardened": {Service: "payments"},
+		},
+		want: ptr.String("runc-hardened"),
+	}, {
+		name: "service name of another service",
+		serviceLabels: map[string]string{
+			"serving.knative.dev/service": "checkout",
+		},
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"gvisor":        {},
+			"runc-hardened": {Service: "payments"},
+		},
+		want: ptr.String("gvisor"),
+	}, {
+		name: "label selector beats service name",
+		serviceLabels: map[string]string{
+			"serving.knative.dev/service": "payments",
+			"very-cool":                   "indeed",
+		},
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"gvisor":        {},
+			"runc-hardened": {Service: "payments"},
+			"kata": {
+				Selector: map[string]string{
+					"very-cool": "indeed",
+				},
+			},
+		},
+		want: ptr.String("kata"),
+	}, {
+		name: "service name narrows a label selector",
+		serviceLabels: map[string]string{
+			"serving.knative.dev/service": "payments",
+			"very-cool":                   "indeed",
+		},
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"kata": {
+				Selector: map[string]string{
+					"very-cool": "indeed",
+				},
+			},
+			"runc-hardened": {
+				Selector: map[string]string{
+					"very-cool": "indeed",
+				},
+				Service: "payments",
+			},
+		},
+		want: ptr.String("runc-hardened"),
 	}, {
 		name: "no default only labels with set labels",
 		serviceLabels: map[string]string{
@@ -591,6 +3634,50 @@ func TestPodRuntimeClassName(t *testing.T) {
 			},
 		},
 		want: nil,
+	}, {
+		name:          "fallback with only labels with set no labels",
+		serviceLabels: map[string]string{},
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"kata": {
+				Selector: map[string]string{
+					"very-cool": "indeed",
+				},
+			},
+		},
+		fallback: "runc-hardened",
+		want:     ptr.String("runc-hardened"),
+	}, {
+		name: "fallback with only labels with set labels",
+		serviceLabels: map[string]string{
+			"very-cool": "indeed",
+		},
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"kata": {
+				Selector: map[string]string{
+					"very-cool": "indeed",
+				},
+			},
+		},
+		fallback: "runc-hardened",
+		want:     ptr.String("kata"),
+	}, {
+		name:          "fallback with explicit default wildcard",
+		serviceLabels: map[string]string{},
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"": {},
+			"kata": {
+				Selector: map[string]string{
+					"very-cool": "indeed",
+				},
+			},
+		},
+		fallback: "runc-hardened",
+		want:     nil,
+	}, {
+		name:          "fallback without selectors",
+		serviceLabels: map[string]string{},
+		fallback:      "runc-hardened",
+		want:          ptr.String("runc-hardened"),
 	}}
 
 	for _, tt := range ts {
@@ -601,6 +3688,7 @@ func TestPodRuntimeClassName(t *testing.T) {
 			}
 			defaults := defaultConfig()
 			defaults.RuntimeClassNames = tt.runtimeClassNames
+			defaults.DefaultRuntimeClassFallback = tt.fallback
 			got, want := defaults.PodRuntimeClassName(tt.serviceLabels), tt.want
 
 			if !equality.Semantic.DeepEqual(got, want) {
@@ -609,3 +3697,270 @@ func TestPodRuntimeClassName(t *testing.T) {
 		})
 	}
 }
+
+func TestAmbiguousRuntimeClassNames(t *testing.T) {
+	ts := []struct {
+		name              string
+		runtimeClassNames map[string]RuntimeClassNameLabelSelector
+		want              [][2]string
+	}{{
+		name: "empty",
+	}, {
+		name: "two wildcards",
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"kata":   {},
+			"gvisor": {},
+		},
+		want: [][2]string{{"gvisor", "kata"}},
+	}, {
+		name: "overlapping selectors with as many labels",
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"kata": {
+				Selector: map[string]string{"isolated": "yes"},
+			},
+			"gvisor": {
+				Selector: map[string]string{"sandboxed": "yes"},
+			},
+		},
+		want: [][2]string{{"gvisor", "kata"}},
+	}, {
+		name: "selectors with more labels win",
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"kata": {
+				Selector: map[string]string{"isolated": "yes"},
+			},
+			"gvisor": {
+				Selector: map[string]string{"isolated": "yes", "sandboxed": "yes"},
+			},
+			"runc": {},
+		},
+	}, {
+		name: "disjoint label values",
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"kata": {
+				Selector: map[string]string{"sandbox": "kata"},
+			},
+			"gvisor": {
+				Selector: map[string]string{"sandbox": "gvisor"},
+			},
+		},
+	}, {
+		name: "different services",
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"kata":   {Service: "payments"},
+			"gvisor": {Service: "checkout"},
+		},
+	}, {
+		name: "same service",
+		runtimeClassNames: map[string]RuntimeClassNameLabelSelector{
+			"kata":   {Service: "payments"},
+			"gvisor": {Service: "payments"},
+			"runc":   {},
+		},
+		want: [][2]string{{"gvisor", "kata"}},
+	}}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{RuntimeClassNames: tt.runtimeClassNames}
+			if diff := cmp.Diff(tt.want, cfg.AmbiguousRuntimeClassNames()); diff != "" {
+				t.Error("AmbiguousRuntimeClassNames() (-want, +got):", diff)
+			}
+		})
+	}
+}
+
+func TestAffinityTypeForNamespace(t *testing.T) {
+	cfg := Config{
+		DefaultAffinityType: PreferSpreadRevisionOverNodes,
+		DefaultAffinityTypeOverrides: map[string]AffinityType{
+			"dev":  None,
+			"prod": SpreadRevisionOverNodes,
+		},
+	}
+	for ns, want := range map[string]AffinityType{
+		"dev":     None,
+		"prod":    SpreadRevisionOverNodes,
+		"staging": PreferSpreadRevisionOverNodes,
+	} {
+		if got := cfg.AffinityTypeForNamespace(ns); got != want {
+			t.Errorf("AffinityTypeForNamespace(%q) = %q, want: %q", ns, got, want)
+		}
+	}
+}
+
+func TestActivatorProxyHeaderFromMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    *ProxyHeader
+		wantErr bool
+	}{{
+		name: "unset",
+	}, {
+		name: "renamed",
+		data: map[string]string{ActivatorProxyHeaderNameKey: "X-Knative-Proxy", ActivatorProxyHeaderValueKey: "kn-activator"},
+		want: &ProxyHeader{Name: "X-Knative-Proxy", Value: "kn-activator"},
+	}, {
+		name: "value only",
+		data: map[string]string{ActivatorProxyHeaderValueKey: "mesh-friendly"},
+		want: &ProxyHeader{Name: DefaultActivatorProxyHeader.Name, Value: "mesh-friendly"},
+	}, {
+		name: "suppressed",
+		data: map[string]string{ActivatorProxyHeaderNameKey: ""},
+		want: &ProxyHeader{},
+	}, {
+		name:    "invalid name",
+		data:    map[string]string{ActivatorProxyHeaderNameKey: "K Proxy"},
+		wantErr: true,
+	}, {
+		name:    "empty value",
+		data:    map[string]string{ActivatorProxyHeaderValueKey: ""},
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ActivatorProxyHeaderFromMap(tc.data)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ActivatorProxyHeaderFromMap() = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !cmp.Equal(got, tc.want) {
+				t.Errorf("ActivatorProxyHeaderFromMap() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewActivatorConfigFromMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    *ActivatorConfig
+		wantErr bool
+	}{{
+		name: "defaults",
+		want: &ActivatorConfig{
+			ProxyHeader:            DefaultActivatorProxyHeader,
+			LoadBalancingPolicy:    LoadBalancingPolicyDefault,
+			CapacityShrinkPolicy:   ShrinkPolicyGraceful,
+			BackendTLSVerification: BackendTLSVerificationStrict,
+		},
+	}, {
+		name: "cold starts",
+		data: map[string]string{
+			ActivatorEndpointsRetryIntervalKey:  "100ms",
+			ActivatorEndpointsMaxWaitKey:        "5s",
+			ActivatorColdStartQueueLengthKey:    "100",
+			ActivatorMaxConcurrentColdStartsKey: "4",
+			ActivatorMaxHeldRequestBytesKey:     "1048576",
+		},
+		want: &ActivatorConfig{
+			ProxyHeader:             DefaultActivatorProxyHeader,
+			LoadBalancingPolicy:     LoadBalancingPolicyDefault,
+			EndpointsRetryInterval:  100 * time.Millisecond,
+			EndpointsMaxWait:        5 * time.Second,
+			ColdStartQueueLength:    100,
+			MaxConcurrentColdStarts: 4,
+			MaxHeldRequestBytes:     1 << 20,
+			CapacityShrinkPolicy:    ShrinkPolicyGraceful,
+			BackendTLSVerification:  BackendTLSVerificationStrict,
+		},
+	}, {
+		name: "load balancing",
+		data: map[string]string{
+			ActivatorLoadBalancingPolicyKey:     string(LoadBalancingPolicyConsistentHash),
+			ActivatorLoadBalancingHashHeaderKey: "X-Session-Id",
+			ActivatorPreferLocalZoneKey:         "true",
+			ActivatorCapacityShrinkPolicyKey:    "lazy",
+		},
+		want: &ActivatorConfig{
+			ProxyHeader:             DefaultActivatorProxyHeader,
+			LoadBalancingPolicy:     LoadBalancingPolicyConsistentHash,
+			LoadBalancingHashHeader: "X-Session-Id",
+			PreferLocalZone:         true,
+			CapacityShrinkPolicy:    ShrinkPolicyLazy,
+			BackendTLSVerification:  BackendTLSVerificationStrict,
+		},
+	}, {
+		name: "permissive backend tls verification",
+		data: map[string]string{
+			ActivatorBackendTLSVerificationKey: "permissive",
+		},
+		want: &ActivatorConfig{
+			ProxyHeader:            DefaultActivatorProxyHeader,
+			LoadBalancingPolicy:    LoadBalancingPolicyDefault,
+			CapacityShrinkPolicy:   ShrinkPolicyGraceful,
+			BackendTLSVerification: BackendTLSVerificationPermissive,
+		},
+	}, {
+		name:    "invalid proxy header",
+		data:    map[string]string{ActivatorProxyHeaderNameKey: "K Proxy"},
+		wantErr: true,
+	}, {
+		name:    "negative endpoints retry interval",
+		data:    map[string]string{ActivatorEndpointsRetryIntervalKey: "-1s"},
+		wantErr: true,
+	}, {
+		name:    "invalid endpoints max wait",
+		data:    map[string]string{ActivatorEndpointsMaxWaitKey: "forever"},
+		wantErr: true,
+	}, {
+		name:    "negative cold start queue length",
+		data:    map[string]string{ActivatorColdStartQueueLengthKey: "-1"},
+		wantErr: true,
+	}, {
+		name:    "negative max concurrent cold starts",
+		data:    map[string]string{ActivatorMaxConcurrentColdStartsKey: "-1"},
+		wantErr: true,
+	}, {
+		name:    "negative max held request bytes",
+		data:    map[string]string{ActivatorMaxHeldRequestBytesKey: "-1"},
+		wantErr: true,
+	}, {
+		name:    "unsupported capacity shrink policy",
+		data:    map[string]string{ActivatorCapacityShrinkPolicyKey: "eager"},
+		wantErr: true,
+	}, {
+		name:    "unsupported backend tls verification",
+		data:    map[string]string{ActivatorBackendTLSVerificationKey: "lenient"},
+		wantErr: true,
+	}, {
+		name:    "unsupported load balancing policy",
+		data:    map[string]string{ActivatorLoadBalancingPolicyKey: "least-loaded"},
+		wantErr: true,
+	}, {
+		name:    "consistent hash without header",
+		data:    map[string]string{ActivatorLoadBalancingPolicyKey: string(LoadBalancingPolicyConsistentHash)},
+		wantErr: true,
+	}, {
+		name: "consistent hash with invalid header",
+		data: map[string]string{
+			ActivatorLoadBalancingPolicyKey:     string(LoadBalancingPolicyConsistentHash),
+			ActivatorLoadBalancingHashHeaderKey: "X Session",
+		},
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NewActivatorConfigFromMap(tc.data)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("NewActivatorConfigFromMap() = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !cmp.Equal(got, tc.want) {
+				t.Error("NewActivatorConfigFromMap (-want, +got):", cmp.Diff(tc.want, got))
+			}
+			if tc.wantErr {
+				// The webhook validates the config-deployment with NewConfigFromMap.
+				data := map[string]string{QueueSidecarImageKey: defaultSidecarImage}
+				for k, v := range tc.data {
+					data[k] = v
+				}
+				if _, err := NewConfigFromMap(data); err == nil {
+					t.Error("NewConfigFromMap() succeeded, wanted an error")
+				}
+			}
+		})
+	}
+}
@@ -25,6 +25,23 @@ import (
 	sets "k8s.io/apimachinery/pkg/util/sets"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActivatorConfig) DeepCopyInto(out *ActivatorConfig) {
+	*out = *in
+	out.ProxyHeader = in.ProxyHeader
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActivatorConfig.
+func (in *ActivatorConfig) DeepCopy() *ActivatorConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ActivatorConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Config) DeepCopyInto(out *Config) {
 	*out = *in
@@ -35,6 +52,21 @@ func (in *Config) DeepCopyInto(out *Config) {
 			(*out)[key] = val
 		}
 	}
+	if in.RegistriesResolutionRateLimits != nil {
+		in, out := &in.RegistriesResolutionRateLimits, &out.RegistriesResolutionRateLimits
+		*out = make(map[string]RegistryRateLimit, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ForceActivatorSelector != nil {
+		out.ForceActivatorSelector = in.ForceActivatorSelector.DeepCopySelector()
+	}
+	if in.ActivatorProxyHeader != nil {
+		in, out := &in.ActivatorProxyHeader, &out.ActivatorProxyHeader
+		*out = new(ProxyHeader)
+		**out = **in
+	}
 	if in.QueueSidecarCPURequest != nil {
 		in, out := &in.QueueSidecarCPURequest, &out.QueueSidecarCPURequest
 		x := (*in).DeepCopy()
@@ -65,6 +97,16 @@ func (in *Config) DeepCopyInto(out *Config) {
 		x := (*in).DeepCopy()
 		*out = &x
 	}
+	if in.QueueSidecarCPURequestBound != nil {
+		in, out := &in.QueueSidecarCPURequestBound, &out.QueueSidecarCPURequestBound
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.QueueSidecarMemoryRequestBound != nil {
+		in, out := &in.QueueSidecarMemoryRequestBound, &out.QueueSidecarMemoryRequestBound
+		x := (*in).DeepCopy()
+		*out = &x
+	}
 	if in.QueueSidecarTokenAudiences != nil {
 		in, out := &in.QueueSidecarTokenAudiences, &out.QueueSidecarTokenAudiences
 		*out = make(sets.Set[string], len(*in))
@@ -92,6 +134,38 @@ func (in *Config) DeepCopy() *Config {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyHeader) DeepCopyInto(out *ProxyHeader) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyHeader.
+func (in *ProxyHeader) DeepCopy() *ProxyHeader {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyHeader)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistryRateLimit) DeepCopyInto(out *RegistryRateLimit) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryRateLimit.
+func (in *RegistryRateLimit) DeepCopy() *RegistryRateLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(RegistryRateLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RuntimeClassNameLabelSelector) DeepCopyInto(out *RuntimeClassNameLabelSelector) {
 	*out = *in
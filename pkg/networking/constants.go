@@ -33,6 +33,18 @@ const (
 	// health check and lifecycle hooks for queue-proxy.
 	QueueAdminPort = 8022
 
+	// QueueDrainPath specifies the path on the admin port of queue-proxy to
+	// wait until the proxy server is shut down. Any subsequent calls to this
+	// endpoint after the server has finished shutting down it will return
+	// immediately. Main usage is to delay the termination of user-container
+	// until all accepted requests have been processed.
+	QueueDrainPath = "/wait-for-drain"
+
+	// QueueSelfHealthPath specifies the path on the admin port of queue-proxy
+	// reporting whether the proxy is still able to handle requests,
+	// independently of the user-container.
+	QueueSelfHealthPath = "/self-health"
+
 	// AutoscalingQueueMetricsPort specifies the port number for metrics emitted
 	// by queue-proxy for autoscaler.
 	AutoscalingQueueMetricsPort = 9090
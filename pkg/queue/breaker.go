@@ -21,6 +21,8 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sync"
+	"time"
 
 	"go.uber.org/atomic"
 )
@@ -28,8 +30,16 @@ import (
 var (
 	// ErrRequestQueueFull indicates the breaker queue depth was exceeded.
 	ErrRequestQueueFull = errors.New("pending request queue full")
+
+	// ErrBreakerDraining indicates the breaker no longer admits requests
+	// because it is draining.
+	ErrBreakerDraining = errors.New("breaker draining")
 )
 
+// drainPollInterval is how often Drain checks whether the requests in flight
+// have completed.
+const drainPollInterval = 10 * time.Millisecond
+
 // MaxBreakerCapacity is the largest valid value for the MaxConcurrency value of BreakerParams.
 // This is limited by the maximum size of a chan struct{} in the current implementation.
 const MaxBreakerCapacity = math.MaxInt32
@@ -39,6 +49,13 @@ type BreakerParams struct {
 	QueueDepth      int
 	MaxConcurrency  int
 	InitialCapacity int
+	// LazyShrink is how the capacity shrinks below the requests in flight. If
+	// unset, the new capacity applies right away: no request is admitted until
+	// enough of the ones in flight complete to get below it. If set, the free
+	// slots are dropped right away and the ones held by the requests in flight
+	// are retired as they complete, until the new capacity is reached.
+	// No request in flight is ever evicted.
+	LazyShrink bool
 }
 
 // Breaker is a component that enforces a concurrency limit on the
@@ -53,6 +70,12 @@ type Breaker struct {
 	// release is the callback function returned to callers by Reserve to
 	// allow the reservation made by Reserve to be released.
 	release func()
+
+	// reportParams, if set, is called with the effective parameters whenever
+	// the concurrency is updated.
+	reportParams func(BreakerParams)
+
+	drainOnce sync.Once
 }
 
 // NewBreaker creates a Breaker with the desired queue depth,
@@ -72,6 +95,7 @@ func NewBreaker(params BreakerParams) *Breaker {
 		totalSlots: int64(params.QueueDepth + params.MaxConcurrency),
 		sem:        newSemaphore(params.MaxConcurrency, params.InitialCapacity),
 	}
+	b.SetLazyShrink(params.LazyShrink)
 
 	// Allocating the closure returned by Reserve here avoids an allocation in Reserve.
 	b.release = func() {
@@ -118,6 +142,9 @@ func (b *Breaker) releasePending() {
 // richer semantics in the caller.
 // The caller on success must execute the callback when done with work.
 func (b *Breaker) Reserve(ctx context.Context) (func(), bool) {
+	if b.Draining() {
+		return nil, false
+	}
 	if !b.tryAcquirePending() {
 		return nil, false
 	}
@@ -135,6 +162,9 @@ func (b *Breaker) Reserve(ctx context.Context) (func(), bool) {
 // already consumed, Maybe returns immediately without calling thunk. If
 // the thunk was executed, Maybe returns nil, else error.
 func (b *Breaker) Maybe(ctx context.Context, thunk func()) error {
+	if b.Draining() {
+		return ErrBreakerDraining
+	}
 	if !b.tryAcquirePending() {
 		return ErrRequestQueueFull
 	}
@@ -151,20 +181,94 @@ func (b *Breaker) Maybe(ctx context.Context, thunk func()) error {
 	// + release calls are equally paired.
 	defer b.sem.release()
 
+	// The capacity may have been freed by a request completing while
+	// draining, which must not start a queued one.
+	if b.Draining() {
+		return ErrBreakerDraining
+	}
+
 	// Do the thing.
 	thunk()
 	// Report success
 	return nil
 }
 
+// Drain stops the breaker from admitting requests, rejects the queued ones
+// with ErrBreakerDraining and waits for the ones already executing to
+// complete. It returns the context's error if it is done before they do.
+func (b *Breaker) Drain(ctx context.Context) error {
+	b.drainOnce.Do(func() { close(b.sem.draining) })
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for b.InFlight() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Draining returns whether Drain has been called.
+func (b *Breaker) Draining() bool {
+	select {
+	case <-b.sem.draining:
+		return true
+	default:
+		return false
+	}
+}
+
 // InFlight returns the number of requests currently in flight in this breaker.
 func (b *Breaker) InFlight() int {
 	return int(b.inFlight.Load())
 }
 
-// UpdateConcurrency updates the maximum number of in-flight requests.
-func (b *Breaker) UpdateConcurrency(size int) {
+// UpdateConcurrency updates the maximum number of in-flight requests, growing
+// or shrinking the capacity in place. Shrinking below the requests in flight
+// doesn't evict them, and follows the LazyShrink setting of the breaker. An error is
+// returned, and the capacity left unchanged, if size is negative or exceeds
+// the max concurrency of the breaker.
+func (b *Breaker) UpdateConcurrency(size int) error {
+	if maxConcurrency := cap(b.sem.queue); size < 0 || size > maxConcurrency {
+		return fmt.Errorf("concurrency must be between 0 and max concurrency %d, was %d", maxConcurrency, size)
+	}
 	b.sem.updateCapacity(size)
+	if b.reportParams != nil {
+		b.reportParams(b.Params())
+	}
+	return nil
+}
+
+// SetLazyShrink sets whether the capacity shrinks lazily below the requests in
+// flight, see BreakerParams.LazyShrink. Unsetting it while shrinking lazily
+// applies the pending capacity right away.
+func (b *Breaker) SetLazyShrink(lazy bool) {
+	if b.sem.lazyShrink.Swap(lazy) && !lazy {
+		b.sem.updateCapacity(int(b.sem.target.Load()))
+	}
+}
+
+// Params returns the effective parameters of the breaker, the current
+// capacity standing in for the initial one.
+func (b *Breaker) Params() BreakerParams {
+	maxConcurrency := cap(b.sem.queue)
+	return BreakerParams{
+		QueueDepth:      int(b.totalSlots) - maxConcurrency,
+		MaxConcurrency:  maxConcurrency,
+		InitialCapacity: b.Capacity(),
+		LazyShrink:      b.sem.lazyShrink.Load(),
+	}
+}
+
+// ReportParams calls report with the effective parameters of the breaker now
+// and whenever its concurrency is updated. It must not be called concurrently
+// with UpdateConcurrency.
+func (b *Breaker) ReportParams(report func(BreakerParams)) {
+	b.reportParams = report
+	report(b.Params())
 }
 
 // Capacity returns the number of allowed in-flight requests on this breaker.
@@ -175,7 +279,7 @@ func (b *Breaker) Capacity() int {
 // newSemaphore creates a semaphore with the desired initial capacity.
 func newSemaphore(maxCapacity, initialCapacity int) *semaphore {
 	queue := make(chan struct{}, maxCapacity)
-	sem := &semaphore{queue: queue}
+	sem := &semaphore{queue: queue, draining: make(chan struct{})}
 	sem.updateCapacity(initialCapacity)
 	return sem
 }
@@ -193,6 +297,15 @@ func newSemaphore(maxCapacity, initialCapacity int) *semaphore {
 type semaphore struct {
 	state atomic.Uint64
 	queue chan struct{}
+
+	// draining is closed to wake up and reject the goroutines waiting for
+	// capacity.
+	draining chan struct{}
+
+	// target is the capacity last set, which the capacity converges to as
+	// the requests in flight release their slots while shrinking lazily.
+	target     atomic.Uint64
+	lazyShrink atomic.Bool
 }
 
 // tryAcquire receives a token from the semaphore if there is one otherwise returns false.
@@ -220,6 +333,8 @@ func (s *semaphore) acquire(ctx context.Context) error {
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
+			case <-s.draining:
+				return ErrBreakerDraining
 			case <-s.queue:
 			}
 			// Force reload state.
@@ -246,6 +361,13 @@ func (s *semaphore) release() {
 		}
 
 		in--
+		// While shrinking lazily, the slot is retired rather than freed.
+		if capacity > s.target.Load() {
+			if s.state.CAS(old, pack(capacity-1, in)) {
+				return
+			}
+			continue
+		}
 		if s.state.CAS(old, pack(capacity, in)) {
 			if in < capacity {
 				select {
@@ -264,20 +386,27 @@ func (s *semaphore) release() {
 }
 
 // updateCapacity updates the capacity of the semaphore to the desired size.
+// While shrinking lazily, the capacity only drops to the requests in flight,
+// for release to retire the slots they hold in excess.
 func (s *semaphore) updateCapacity(size int) {
 	s64 := uint64(size)
+	s.target.Store(s64)
 	for {
 		old := s.state.Load()
 		capacity, in := unpack(old)
 
-		if capacity == s64 {
+		want := s64
+		if s64 < capacity && s.lazyShrink.Load() {
+			want = max(s64, in)
+		}
+		if capacity == want {
 			// Nothing to do, exit early.
 			return
 		}
 
-		if s.state.CAS(old, pack(s64, in)) {
-			if s64 > capacity {
-				for i := uint64(0); i < s64-capacity; i++ {
+		if s.state.CAS(old, pack(want, in)) {
+			if want > capacity {
+				for i := uint64(0); i < want-capacity; i++ {
 					select {
 					case s.queue <- struct{}{}:
 					default:
@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.uber.org/zap"
+
+	pkgmetrics "knative.dev/pkg/metrics"
+	"knative.dev/serving/pkg/metrics"
+)
+
+var (
+	breakerMaxConcurrencyM = stats.Int64(
+		"breaker_max_concurrency",
+		"The maximum number of requests the breaker of the queue-proxy lets in flight",
+		stats.UnitDimensionless)
+	breakerQueueDepthM = stats.Int64(
+		"breaker_queue_depth",
+		"The number of requests the breaker of the queue-proxy queues beyond the ones in flight",
+		stats.UnitDimensionless)
+	breakerCapacityM = stats.Int64(
+		"breaker_capacity",
+		"The number of requests the breaker of the queue-proxy currently lets in flight",
+		stats.UnitDimensionless)
+)
+
+// BreakerParamsReporter logs the effective parameters of a breaker and, if
+// it has a stats context, records them as gauges, so that the concurrency
+// reaching each pod can be audited.
+type BreakerParamsReporter struct {
+	logger   *zap.SugaredLogger
+	statsCtx context.Context
+}
+
+// NewBreakerParamsReporter creates a BreakerParamsReporter recording the
+// parameters as metrics of the given pod of the revision.
+func NewBreakerParamsReporter(logger *zap.SugaredLogger, ns, service, config, rev, pod string) (*BreakerParamsReporter, error) {
+	keys := []tag.Key{metrics.PodKey, metrics.ContainerKey}
+	if err := pkgmetrics.RegisterResourceView(&view.View{
+		Description: "The maximum number of requests the breaker of the queue-proxy lets in flight",
+		Measure:     breakerMaxConcurrencyM,
+		Aggregation: view.LastValue(),
+		TagKeys:     keys,
+	}, &view.View{
+		Description: "The number of requests the breaker of the queue-proxy queues beyond the ones in flight",
+		Measure:     breakerQueueDepthM,
+		Aggregation: view.LastValue(),
+		TagKeys:     keys,
+	}, &view.View{
+		Description: "The number of requests the breaker of the queue-proxy currently lets in flight",
+		Measure:     breakerCapacityM,
+		Aggregation: view.LastValue(),
+		TagKeys:     keys,
+	}); err != nil {
+		return nil, err
+	}
+
+	ctx, err := metrics.PodRevisionContext(pod, "queue-proxy", ns, service, config, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BreakerParamsReporter{
+		logger:   logger,
+		statsCtx: ctx,
+	}, nil
+}
+
+// NewBreakerParamsLogger creates a BreakerParamsReporter which only logs the
+// parameters, for when metrics are unavailable.
+func NewBreakerParamsLogger(logger *zap.SugaredLogger) *BreakerParamsReporter {
+	return &BreakerParamsReporter{logger: logger}
+}
+
+// Report logs and records the given effective breaker parameters. It is
+// meant to be passed to Breaker.ReportParams.
+func (r *BreakerParamsReporter) Report(p BreakerParams) {
+	r.logger.Infow("Effective breaker parameters",
+		zap.Int("maxConcurrency", p.MaxConcurrency),
+		zap.Int("queueDepth", p.QueueDepth),
+		zap.Int("capacity", p.InitialCapacity))
+	if r.statsCtx == nil {
+		return
+	}
+	pkgmetrics.RecordBatch(r.statsCtx,
+		breakerMaxConcurrencyM.M(int64(p.MaxConcurrency)),
+		breakerQueueDepthM.M(int64(p.QueueDepth)),
+		breakerCapacityM.M(int64(p.InitialCapacity)))
+}
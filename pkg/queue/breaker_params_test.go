@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go.opencensus.io/resource"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"knative.dev/pkg/metrics/metricstest"
+	"knative.dev/serving/pkg/metrics"
+)
+
+func TestBreakerParamsReporter(t *testing.T) {
+	t.Cleanup(func() {
+		metricstest.Unregister(breakerMaxConcurrencyM.Name(), breakerQueueDepthM.Name(), breakerCapacityM.Name())
+	})
+
+	var logs bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&logs), zap.InfoLevel)).Sugar()
+	reporter, err := NewBreakerParamsReporter(logger, "ns", "svc", "cfg", "rev", "pod")
+	if err != nil {
+		t.Fatal("NewBreakerParamsReporter() =", err)
+	}
+
+	wantTags := map[string]string{
+		metrics.LabelPodName:       "pod",
+		metrics.LabelContainerName: "queue-proxy",
+	}
+	wantResource := &resource.Resource{
+		Type: "knative_revision",
+		Labels: map[string]string{
+			metrics.LabelNamespaceName:     "ns",
+			metrics.LabelRevisionName:      "rev",
+			metrics.LabelServiceName:       "svc",
+			metrics.LabelConfigurationName: "cfg",
+		},
+	}
+	assertParams := func(maxConcurrency, queueDepth, capacity int64, wantLog string) {
+		t.Helper()
+		metricstest.AssertMetric(t,
+			metricstest.IntMetric("breaker_max_concurrency", maxConcurrency, wantTags).WithResource(wantResource),
+			metricstest.IntMetric("breaker_queue_depth", queueDepth, wantTags).WithResource(wantResource),
+			metricstest.IntMetric("breaker_capacity", capacity, wantTags).WithResource(wantResource))
+		if !strings.Contains(logs.String(), wantLog) {
+			t.Errorf("Logs = %s, want them to contain %s", logs.String(), wantLog)
+		}
+		logs.Reset()
+	}
+
+	breaker := NewBreaker(BreakerParams{QueueDepth: 100, MaxConcurrency: 10, InitialCapacity: 5})
+	breaker.ReportParams(reporter.Report)
+	assertParams(10, 100, 5, `"maxConcurrency":10,"queueDepth":100,"capacity":5`)
+
+	breaker.UpdateConcurrency(8)
+	assertParams(10, 100, 8, `"maxConcurrency":10,"queueDepth":100,"capacity":8`)
+}
+
+func TestBreakerParamsLogger(t *testing.T) {
+	var logs bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&logs), zap.InfoLevel)).Sugar()
+
+	breaker := NewBreaker(BreakerParams{QueueDepth: 10, MaxConcurrency: 1, InitialCapacity: 1})
+	breaker.ReportParams(NewBreakerParamsLogger(logger).Report)
+
+	if want := `"maxConcurrency":1,"queueDepth":10,"capacity":1`; !strings.Contains(logs.String(), want) {
+		t.Errorf("Logs = %s, want them to contain %s", logs.String(), want)
+	}
+}
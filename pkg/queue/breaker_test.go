@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"testing"
 	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 const (
@@ -208,19 +210,250 @@ func TestBreakerCancel(t *testing.T) {
 	reqs.processSuccessfully(t)
 }
 
+func TestBreakerDrain(t *testing.T) {
+	params := BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1}
+	b := NewBreaker(params)
+	reqs := newRequestor(b)
+
+	// One request executes, the other is queued.
+	reqs.request()
+	reqs.request()
+	waitForInFlight(t, b, 2)
+
+	// The drain times out while the executing request is blocked, but the
+	// queued one is rejected.
+	ctx, cancel := context.WithTimeout(context.Background(), semNoChangeTimeout)
+	defer cancel()
+	if err := b.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Drain() = %v, want: %v", err, context.DeadlineExceeded)
+	}
+	reqs.expectFailure(t)
+
+	// New requests aren't admitted anymore.
+	if err := b.Maybe(context.Background(), func() {}); err != ErrBreakerDraining {
+		t.Errorf("Maybe() = %v, want: %v", err, ErrBreakerDraining)
+	}
+	if _, ok := b.Reserve(context.Background()); ok {
+		t.Error("Reserve() = true while draining")
+	}
+
+	reqs.processSuccessfully(t)
+	if err := b.Drain(context.Background()); err != nil {
+		t.Error("Drain() =", err)
+	}
+}
+
 func TestBreakerUpdateConcurrency(t *testing.T) {
 	params := BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 0}
 	b := NewBreaker(params)
-	b.UpdateConcurrency(1)
+	if err := b.UpdateConcurrency(1); err != nil {
+		t.Fatal("UpdateConcurrency(1) =", err)
+	}
 	if got, want := b.Capacity(), 1; got != want {
 		t.Errorf("Capacity() = %d, want: %d", got, want)
 	}
 
-	b.UpdateConcurrency(0)
+	if err := b.UpdateConcurrency(0); err != nil {
+		t.Fatal("UpdateConcurrency(0) =", err)
+	}
 	if got, want := b.Capacity(), 0; got != want {
 		t.Errorf("Capacity() = %d, want: %d", got, want)
 	}
+}
+
+func TestBreakerUpdateConcurrencyOutOfBounds(t *testing.T) {
+	params := BreakerParams{QueueDepth: 1, MaxConcurrency: 2, InitialCapacity: 1}
+	b := NewBreaker(params)
+	for _, size := range []int{3, -1} {
+		if err := b.UpdateConcurrency(size); err == nil {
+			t.Errorf("UpdateConcurrency(%d) succeeded, want an error", size)
+		}
+		if got, want := b.Capacity(), 1; got != want {
+			t.Errorf("Capacity() after UpdateConcurrency(%d) = %d, want: %d", size, got, want)
+		}
+	}
+}
+
+func TestBreakerUpdateConcurrencyGrow(t *testing.T) {
+	params := BreakerParams{QueueDepth: 2, MaxConcurrency: 3, InitialCapacity: 1}
+	b := NewBreaker(params)
+	reqs := newRequestor(b)
+
+	// One request executes, two are queued.
+	reqs.request()
+	reqs.request()
+	reqs.request()
+	waitForInFlight(t, b, 3)
+
+	// Growing lets the queued requests in without waiting for the first one.
+	if err := b.UpdateConcurrency(3); err != nil {
+		t.Fatal("UpdateConcurrency(3) =", err)
+	}
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+}
+
+func TestBreakerUpdateConcurrencyShrinkBelowInFlight(t *testing.T) {
+	params := BreakerParams{QueueDepth: 2, MaxConcurrency: 2, InitialCapacity: 2}
+	b := NewBreaker(params)
+	reqs := newRequestor(b)
+
+	// Two requests execute.
+	reqs.request()
+	reqs.request()
+	waitForInFlight(t, b, 2)
+
+	// Shrinking keeps both executing, but the next one has to wait until
+	// both are done.
+	if err := b.UpdateConcurrency(1); err != nil {
+		t.Fatal("UpdateConcurrency(1) =", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), semNoChangeTimeout)
+	defer cancel()
+	if _, ok := b.Reserve(ctx); ok {
+		t.Error("Reserve() = true with the capacity shrunk below the requests in flight")
+	}
+	reqs.request()
+
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+}
+
+func TestBreakerShrinkGraceful(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 3, InitialCapacity: 3})
+	releases := reserveN(t, b, 3)
+
+	// The capacity shrinks right away, so nothing is admitted until the
+	// requests in flight get below it.
+	if err := b.UpdateConcurrency(1); err != nil {
+		t.Fatal("UpdateConcurrency(1) =", err)
+	}
+	if got, want := b.Capacity(), 1; got != want {
+		t.Errorf("Capacity() = %d, want: %d", got, want)
+	}
+	for _, release := range releases {
+		if _, ok := b.Reserve(context.Background()); ok {
+			t.Fatal("Reserve() = true with the requests in flight at or above the capacity")
+		}
+		release()
+	}
+	release, ok := b.Reserve(context.Background())
+	if !ok {
+		t.Fatal("Reserve() = false once the requests in flight got below the capacity")
+	}
+	release()
+}
+
+func TestBreakerShrinkLazy(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 4, InitialCapacity: 4, LazyShrink: true})
+	releases := reserveN(t, b, 3)
+
+	// The free slot is dropped right away, the ones in flight are kept.
+	if err := b.UpdateConcurrency(1); err != nil {
+		t.Fatal("UpdateConcurrency(1) =", err)
+	}
+	if got, want := b.Capacity(), 3; got != want {
+		t.Errorf("Capacity() = %d, want: %d", got, want)
+	}
+	if _, ok := b.Reserve(context.Background()); ok {
+		t.Error("Reserve() = true with the free slots dropped")
+	}
+
+	// Every request completing retires its slot, down to the new capacity.
+	for i, release := range releases[:2] {
+		release()
+		if got, want := b.Capacity(), 2-i; got != want {
+			t.Errorf("Capacity() after %d releases = %d, want: %d", i+1, got, want)
+		}
+	}
+	releases[2]()
+	release := reserveN(t, b, 1)[0]
+	if _, ok := b.Reserve(context.Background()); ok {
+		t.Error("Reserve() = true beyond the shrunk capacity")
+	}
+
+	// Once at the new capacity, the slots are freed again.
+	release()
+	if got, want := b.Capacity(), 1; got != want {
+		t.Errorf("Capacity() = %d, want: %d", got, want)
+	}
+	reserveN(t, b, 1)[0]()
+}
 
+func TestBreakerShrinkLazyIdle(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 10, InitialCapacity: 10, LazyShrink: true})
+	releases := reserveN(t, b, 1)
+
+	// Shrinking at or above the requests in flight applies the new capacity
+	// right away, as there is no slot in flight to retire.
+	if err := b.UpdateConcurrency(2); err != nil {
+		t.Fatal("UpdateConcurrency(2) =", err)
+	}
+	if got, want := b.Capacity(), 2; got != want {
+		t.Errorf("Capacity() = %d, want: %d", got, want)
+	}
+	releases = append(releases, reserveN(t, b, 1)...)
+	if _, ok := b.Reserve(context.Background()); ok {
+		t.Error("Reserve() = true beyond the shrunk capacity")
+	}
+	for _, release := range releases {
+		release()
+	}
+	if got, want := b.Capacity(), 2; got != want {
+		t.Errorf("Capacity() = %d, want: %d", got, want)
+	}
+}
+
+func TestBreakerShrinkLazySwitchOff(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 4, InitialCapacity: 4, LazyShrink: true})
+	releases := reserveN(t, b, 2)
+	if err := b.UpdateConcurrency(1); err != nil {
+		t.Fatal("UpdateConcurrency(1) =", err)
+	}
+	if !b.Params().LazyShrink {
+		t.Error("Params().LazyShrink = false, want: true")
+	}
+
+	// Switching applies the pending capacity right away.
+	b.SetLazyShrink(false)
+	if got, want := b.Capacity(), 1; got != want {
+		t.Errorf("Capacity() = %d, want: %d", got, want)
+	}
+	if _, ok := b.Reserve(context.Background()); ok {
+		t.Error("Reserve() = true with the requests in flight above the capacity")
+	}
+	for _, release := range releases {
+		release()
+	}
+	if got, want := b.Capacity(), 1; got != want {
+		t.Errorf("Capacity() = %d, want: %d", got, want)
+	}
+}
+
+// reserveN reserves n slots of the breaker, returning their release functions.
+func reserveN(t *testing.T, b *Breaker, n int) []func() {
+	t.Helper()
+	releases := make([]func(), 0, n)
+	for i := 0; i < n; i++ {
+		release, ok := b.Reserve(context.Background())
+		if !ok {
+			t.Fatalf("Reserve() #%d = false, want true", i+1)
+		}
+		releases = append(releases, release)
+	}
+	return releases
+}
+
+// waitForInFlight waits for the breaker to have n requests in flight.
+func waitForInFlight(t *testing.T, b *Breaker, n int) {
+	t.Helper()
+	if err := wait.PollUntilContextTimeout(context.Background(), time.Millisecond, semAcquireTimeout, true, func(context.Context) (bool, error) {
+		return b.InFlight() == n, nil
+	}); err != nil {
+		t.Fatalf("InFlight() = %d, want: %d", b.InFlight(), n)
+	}
 }
 
 // Test empty semaphore, token cannot be acquired
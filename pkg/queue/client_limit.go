@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// clientLimiter caps the number of requests of each client which are in
+// flight at the same time, waiting for the breaker included, so that a single
+// client cannot take up all of a revision's concurrency.
+type clientLimiter struct {
+	limit  int
+	header string
+
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+func newClientLimiter(limit int, header string) *clientLimiter {
+	return &clientLimiter{
+		limit:    limit,
+		header:   header,
+		inFlight: make(map[string]int),
+	}
+}
+
+// clientKey returns the key identifying the client of the request: the value
+// of the configured header if present, the first address of the
+// X-Forwarded-For header otherwise, since the queue proxy mostly receives the
+// requests through the ingress or the activator, and the remote address of
+// the request as a last resort.
+func (l *clientLimiter) clientKey(r *http.Request) string {
+	if l.header != "" {
+		if v := r.Header.Get(l.header); v != "" {
+			return v
+		}
+	}
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		client, _, _ := strings.Cut(xff, ",")
+		if client = strings.TrimSpace(client); client != "" {
+			return client
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// acquire takes a slot for the given client, returning false if the client
+// already has limit requests in flight.
+func (l *clientLimiter) acquire(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[key] >= l.limit {
+		return false
+	}
+	l.inFlight[key]++
+	return true
+}
+
+// release frees a slot of the given client taken by acquire.
+func (l *clientLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[key] <= 1 {
+		delete(l.inFlight, key)
+		return
+	}
+	l.inFlight[key]--
+}
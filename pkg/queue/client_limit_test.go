@@ -0,0 +1,145 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	netstats "knative.dev/networking/pkg/http/stats"
+)
+
+func TestHandlerClientConcurrencyLimit(t *testing.T) {
+	const header = "X-Api-Key"
+
+	// The requests of the greedy client block until released, the others
+	// return right away.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(header) == "greedy" {
+			started <- struct{}{}
+			<-release
+		}
+	})
+	breaker := NewBreaker(BreakerParams{
+		QueueDepth: 10, MaxConcurrency: 3, InitialCapacity: 3,
+	})
+	stats := netstats.NewRequestStats(time.Now())
+	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, handler, WithClientConcurrencyLimit(2, header))
+
+	request := func(client string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil)
+		req.Header.Set(header, client)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	// The greedy client takes up its whole limit.
+	resps := make(chan *httptest.ResponseRecorder)
+	for i := 0; i < 2; i++ {
+		go func() {
+			resps <- request("greedy")
+		}()
+		<-started
+	}
+
+	// Its next request is rejected right away, rather than queued.
+	if got, want := request("greedy").Code, http.StatusTooManyRequests; got != want {
+		t.Errorf("Code = %d, want: %d", got, want)
+	}
+
+	// The other clients are still served.
+	for _, client := range []string{"modest", "another"} {
+		if got, want := request(client).Code, http.StatusOK; got != want {
+			t.Errorf("Code of client %s = %d, want: %d", client, got, want)
+		}
+	}
+
+	// Once its requests are done, the greedy client is served again.
+	close(release)
+	for i := 0; i < 2; i++ {
+		if got, want := (<-resps).Code, http.StatusOK; got != want {
+			t.Errorf("Code = %d, want: %d", got, want)
+		}
+	}
+	go func() { <-started }()
+	if got, want := request("greedy").Code, http.StatusOK; got != want {
+		t.Errorf("Code = %d, want: %d", got, want)
+	}
+}
+
+func TestClientLimiterClientKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		headers map[string]string
+		want    string
+	}{{
+		name: "remote address",
+		want: "192.0.2.1",
+	}, {
+		name:    "forwarded for",
+		headers: map[string]string{"X-Forwarded-For": " 198.51.100.7, 10.0.0.1"},
+		want:    "198.51.100.7",
+	}, {
+		name:   "header",
+		header: "X-Api-Key",
+		headers: map[string]string{
+			"X-Api-Key":       "key",
+			"X-Forwarded-For": "198.51.100.7",
+		},
+		want: "key",
+	}, {
+		name:    "header missing",
+		header:  "X-Api-Key",
+		headers: map[string]string{"X-Forwarded-For": "198.51.100.7"},
+		want:    "198.51.100.7",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			if got := newClientLimiter(1, tc.header).clientKey(req); got != tc.want {
+				t.Errorf("clientKey() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClientLimiterRelease(t *testing.T) {
+	l := newClientLimiter(1, "")
+	if !l.acquire("client") {
+		t.Fatal("acquire() = false, want true")
+	}
+	if l.acquire("client") {
+		t.Error("acquire() = true over the limit, want false")
+	}
+	l.release("client")
+	if got := len(l.inFlight); got != 0 {
+		t.Errorf("len(inFlight) = %d, want the idle client forgotten", got)
+	}
+	if !l.acquire("client") {
+		t.Error("acquire() = false after release, want true")
+	}
+}
@@ -16,17 +16,21 @@ limitations under the License.
 
 package queue
 
+import "knative.dev/serving/pkg/networking"
+
 //nolint:gosec // Volume Mount Points and Filenames
 const (
 	// Name is the name of the component.
 	Name = "queue"
 
 	// RequestQueueDrainPath specifies the path to wait until the proxy
-	// server is shut down. Any subsequent calls to this endpoint after
-	// the server has finished shutting down it will return immediately.
-	// Main usage is to delay the termination of user-container until all
-	// accepted requests have been processed.
-	RequestQueueDrainPath = "/wait-for-drain"
+	// server is shut down, see networking.QueueDrainPath.
+	RequestQueueDrainPath = networking.QueueDrainPath
+
+	// RequestQueueSelfHealthPath specifies the path on the admin port
+	// reporting whether the proxy is still able to handle requests,
+	// see networking.QueueSelfHealthPath.
+	RequestQueueSelfHealthPath = networking.QueueSelfHealthPath
 
 	// CertDirectory is the name of the directory path where certificates are stored.
 	CertDirectory = "/var/lib/knative/certs"
@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"net/http"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	pkghandler "knative.dev/pkg/network/handlers"
+)
+
+// DrainReadiness wraps a Drainer to answer requests of a dedicated path with
+// the readiness of the queue-proxy, which turns not ready as soon as Drain is
+// called. External load balancers probing the path thereby stop sending
+// traffic while the requests in flight still complete.
+type DrainReadiness struct {
+	drainer *pkghandler.Drainer
+	path    string
+	prober  func() bool
+
+	draining atomic.Bool
+}
+
+// NewDrainReadiness creates a DrainReadiness serving the readiness on the
+// given path, as reported by prober until draining. All other requests, or
+// all requests if path is empty, are passed to the drainer.
+func NewDrainReadiness(drainer *pkghandler.Drainer, path string, prober func() bool) *DrainReadiness {
+	return &DrainReadiness{
+		drainer: drainer,
+		path:    path,
+		prober:  prober,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (d *DrainReadiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if d.path == "" || r.URL.Path != d.path {
+		d.drainer.ServeHTTP(w, r)
+		return
+	}
+	// Probes of the path don't count as requests delaying the drain.
+	switch {
+	case d.draining.Load():
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	case d.prober != nil && !d.prober():
+		http.Error(w, "container not ready", http.StatusServiceUnavailable)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// Drain turns the path not ready and drains the drainer, blocking until it
+// is drained.
+func (d *DrainReadiness) Drain() {
+	d.draining.Store(true)
+	d.drainer.Drain()
+}
+
+// DrainHandler returns a handler initiating the drain when requested, e.g.
+// by a mesh sidecar coordinating the shutdown of the pod. It answers with a
+// 202 right away, while the requests in flight complete in the background.
+func (d *DrainReadiness) DrainHandler(logger *zap.SugaredLogger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.Infow("Drain requested", zap.String("path", r.URL.Path))
+		go d.Drain()
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// Reset interrupts Drain and turns the path ready again.
+func (d *DrainReadiness) Reset() {
+	d.draining.Store(false)
+	d.drainer.Reset()
+}
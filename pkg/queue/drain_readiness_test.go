@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	logtesting "knative.dev/pkg/logging/testing"
+	pkghandler "knative.dev/pkg/network/handlers"
+)
+
+func TestDrainReadiness(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	drainer := &pkghandler.Drainer{
+		QuietPeriod: 100 * time.Millisecond,
+		Inner: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+	d := NewDrainReadiness(drainer, "/drain-ready", func() bool { return true })
+
+	readiness := func() int {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/drain-ready", nil))
+		return rec.Code
+	}
+	if got := readiness(); got != http.StatusOK {
+		t.Fatalf("Readiness status = %d, want %d", got, http.StatusOK)
+	}
+
+	inFlight := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		inFlight <- rec.Code
+	}()
+	<-started
+
+	drained := make(chan struct{})
+	go func() {
+		d.Drain()
+		close(drained)
+	}()
+
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return readiness() == http.StatusServiceUnavailable, nil
+	}); err != nil {
+		t.Fatal("Readiness never turned not ready while draining")
+	}
+
+	// The request in flight still completes.
+	close(release)
+	if got := <-inFlight; got != http.StatusOK {
+		t.Errorf("In-flight request status = %d, want %d", got, http.StatusOK)
+	}
+	<-drained
+
+	d.Reset()
+	if got := readiness(); got != http.StatusOK {
+		t.Errorf("Readiness status after Reset = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestDrainReadinessNotReady(t *testing.T) {
+	drainer := &pkghandler.Drainer{Inner: http.NotFoundHandler()}
+	d := NewDrainReadiness(drainer, "/drain-ready", func() bool { return false })
+
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/drain-ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Readiness status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestDrainReadinessWithoutPath(t *testing.T) {
+	drainer := &pkghandler.Drainer{Inner: http.NotFoundHandler()}
+	d := NewDrainReadiness(drainer, "", func() bool { return true })
+
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/drain-ready", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestDrainHandler(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	drainer := &pkghandler.Drainer{
+		QuietPeriod: 100 * time.Millisecond,
+		Inner: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+	d := NewDrainReadiness(drainer, "/drain-ready", func() bool { return true })
+
+	inFlight := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		inFlight <- rec.Code
+	}()
+	<-started
+
+	// The drain is initiated without waiting for the request in flight.
+	rec := httptest.NewRecorder()
+	d.DrainHandler(logtesting.TestLogger(t)).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/drain", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Drain status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/drain-ready", nil))
+		return rec.Code == http.StatusServiceUnavailable, nil
+	}); err != nil {
+		t.Fatal("Readiness never turned not ready after the drain was requested")
+	}
+
+	// The request in flight still completes.
+	close(release)
+	if got := <-inFlight; got != http.StatusOK {
+		t.Errorf("In-flight request status = %d, want %d", got, http.StatusOK)
+	}
+}
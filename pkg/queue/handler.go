@@ -20,32 +20,384 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"go.opencensus.io/trace"
+	"go.uber.org/zap"
 	netheader "knative.dev/networking/pkg/http/header"
 	netstats "knative.dev/networking/pkg/http/stats"
 	"knative.dev/serving/pkg/activator"
+	pkghttp "knative.dev/serving/pkg/http"
 )
 
+// proxyHandlerOptions holds the optional behaviour of ProxyHandler.
+type proxyHandlerOptions struct {
+	// suppressOverloadDetails replaces the breaker error in the body of
+	// overload responses with the generic status text.
+	suppressOverloadDetails bool
+
+	// overloadStatusCode and overloadBody, if set, replace the status code
+	// and the body of overload responses.
+	overloadStatusCode int
+	overloadBody       string
+
+	// maintenance makes all the requests be answered with the maintenance
+	// status code and body rather than forwarded.
+	maintenance           bool
+	maintenanceStatusCode int
+	maintenanceBody       string
+
+	// queueFullStatusCode, queueFullRetryAfter and queueFullBody, if set,
+	// replace the status code, the Retry-After header and the body of the
+	// responses to requests rejected because the queue is full.
+	queueFullStatusCode int
+	queueFullRetryAfter time.Duration
+	queueFullBody       string
+
+	// countProbes records kubelet probes in the request stats. Probes bypass
+	// the breaker either way.
+	countProbes bool
+
+	// memoryPressure sheds new requests while the memory usage is too high.
+	memoryPressure *MemoryPressure
+
+	// clientLimiter, if set, caps the requests in flight per client.
+	clientLimiter *clientLimiter
+
+	// responseClasses, if set, counts the responses by status code class.
+	responseClasses *ResponseClassStats
+
+	// activatorHeaderName and activatorHeaderValue identify the requests
+	// proxied by the activator.
+	activatorHeaderName  string
+	activatorHeaderValue string
+
+	// maxRequestBodyBytes, if positive, limits the size of the request bodies.
+	maxRequestBodyBytes int64
+
+	// slowRequestThreshold, if positive, logs the requests taking longer than
+	// it to slowRequestLogger.
+	slowRequestThreshold time.Duration
+	slowRequestLogger    *zap.SugaredLogger
+
+	// version, if set, is sent in the VersionHeaderName header of the
+	// responses.
+	version string
+}
+
+// ProxyHandlerOption configures optional behaviour of ProxyHandler.
+type ProxyHandlerOption func(*proxyHandlerOptions)
+
+// WithSuppressedOverloadDetails makes ProxyHandler answer requests rejected
+// because the queue is full or the wait timed out with a generic 503 body
+// rather than the underlying error message.
+func WithSuppressedOverloadDetails(suppress bool) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.suppressOverloadDetails = suppress
+	}
+}
+
+// WithOverloadResponse makes ProxyHandler answer requests rejected because
+// the revision is overloaded with the given status code and body instead of
+// a 503 and the underlying error message. A zero status code or an empty body
+// keeps the respective default.
+func WithOverloadResponse(statusCode int, body string) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.overloadStatusCode = statusCode
+		o.overloadBody = body
+	}
+}
+
+// WithQueueFullStatusCode makes ProxyHandler answer requests rejected because
+// the queue is full with the given status code instead of a 503. 429
+// responses carry a Retry-After header. A zero status code keeps the default,
+// and the status code of WithOverloadResponse takes precedence.
+func WithQueueFullStatusCode(statusCode int) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.queueFullStatusCode = statusCode
+	}
+}
+
+// WithQueueFullResponse makes ProxyHandler answer requests rejected because
+// the queue is full with the given Retry-After header, rounded up to whole
+// seconds, and body. A zero retryAfter only sets the default Retry-After of
+// 429 responses and an empty body keeps the default. The body of
+// WithOverloadResponse takes precedence.
+func WithQueueFullResponse(retryAfter time.Duration, body string) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.queueFullRetryAfter = retryAfter
+		o.queueFullBody = body
+	}
+}
+
+// queueFullRetryAfter is the default Retry-After, in seconds, of the 429
+// responses to requests rejected because the queue is full.
+const queueFullRetryAfter = "1"
+
+// writeOverload answers a request rejected because of the given overload
+// error.
+func (o *proxyHandlerOptions) writeOverload(w http.ResponseWriter, err error) {
+	queueFull := errors.Is(err, ErrRequestQueueFull)
+	code := http.StatusServiceUnavailable
+	switch {
+	case o.overloadStatusCode != 0:
+		code = o.overloadStatusCode
+	case o.queueFullStatusCode != 0 && queueFull:
+		code = o.queueFullStatusCode
+		if code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", queueFullRetryAfter)
+		}
+	}
+	if queueFull && o.queueFullRetryAfter > 0 {
+		secs := (o.queueFullRetryAfter + time.Second - 1) / time.Second
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(secs), 10))
+	}
+	msg := err.Error()
+	switch {
+	case o.overloadBody != "":
+		msg = o.overloadBody
+	case o.queueFullBody != "" && queueFull:
+		msg = o.queueFullBody
+	case o.suppressOverloadDetails:
+		msg = http.StatusText(code)
+	}
+	http.Error(w, msg, code)
+}
+
+// WithMaintenanceResponse makes ProxyHandler answer all the requests, but for
+// kubelet probes, with the given status code and body rather than forwarding
+// them, if enabled. A zero status code answers with a 503 and an empty body
+// with the status text.
+func WithMaintenanceResponse(enabled bool, statusCode int, body string) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.maintenance = enabled
+		o.maintenanceStatusCode = statusCode
+		o.maintenanceBody = body
+	}
+}
+
+// writeMaintenance answers a request while in maintenance.
+func (o *proxyHandlerOptions) writeMaintenance(w http.ResponseWriter) {
+	code := http.StatusServiceUnavailable
+	if o.maintenanceStatusCode != 0 {
+		code = o.maintenanceStatusCode
+	}
+	msg := o.maintenanceBody
+	if msg == "" {
+		msg = http.StatusText(code)
+	}
+	http.Error(w, msg, code)
+}
+
+// WithActivatorProxyHeader makes ProxyHandler recognize the requests proxied
+// by the activator by the given header rather than the default
+// netheader.ProxyKey header set to activator.Name. An empty name recognizes
+// none, so that all the requests are recorded as sent directly.
+func WithActivatorProxyHeader(name, value string) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.activatorHeaderName = name
+		o.activatorHeaderValue = value
+	}
+}
+
+// WithCountedProbes makes ProxyHandler record kubelet probes in the request
+// stats consumed by the autoscaler. By default probes are not counted, so that
+// they don't skew the reported concurrency and request rate.
+func WithCountedProbes(count bool) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.countProbes = count
+	}
+}
+
+// WithMemoryPressure makes ProxyHandler reject requests with a 503 while the
+// given MemoryPressure is shedding. A nil MemoryPressure never sheds.
+func WithMemoryPressure(m *MemoryPressure) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.memoryPressure = m
+	}
+}
+
+// WithClientConcurrencyLimit makes ProxyHandler answer a client's requests
+// with a 429 while the client already has limit requests in flight, waiting
+// for the breaker included. Clients are identified by the given header if set
+// and present on the request, and by their IP from the X-Forwarded-For header
+// or the remote address otherwise. A non-positive limit disables the cap.
+func WithClientConcurrencyLimit(limit int, header string) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.clientLimiter = nil
+		if limit > 0 {
+			o.clientLimiter = newClientLimiter(limit, header)
+		}
+	}
+}
+
+// WithResponseClassStats makes ProxyHandler count the responses to the
+// requests recorded in the request stats by the class of their status code.
+// A nil ResponseClassStats counts nothing.
+func WithResponseClassStats(s *ResponseClassStats) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.responseClasses = s
+	}
+}
+
+// WithMaxRequestBodyBytes makes ProxyHandler answer requests whose body is
+// larger than n bytes with a 413. Requests announcing a larger Content-Length
+// are rejected right away, neither counted in the request stats nor waiting
+// for the breaker. The bodies of the others are cut off once they exceed the
+// limit, which the error handler of the proxy reports as a 413 when wrapped
+// with BodyLimitErrorHandler. A non-positive n doesn't limit the bodies.
+func WithMaxRequestBodyBytes(n int64) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.maxRequestBodyBytes = n
+	}
+}
+
+// WithSlowRequestLog makes ProxyHandler log the requests whose total time,
+// waiting for the breaker included, exceeds threshold to the given logger,
+// along with their method, path and status code and the time spent waiting
+// and being served. A non-positive threshold or a nil logger logs nothing.
+func WithSlowRequestLog(threshold time.Duration, logger *zap.SugaredLogger) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.slowRequestThreshold = 0
+		if logger != nil {
+			o.slowRequestThreshold = threshold
+		}
+		o.slowRequestLogger = logger
+	}
+}
+
+// logSlowRequest logs the request if its total time exceeds the threshold.
+func (o *proxyHandlerOptions) logSlowRequest(r *http.Request, status int, wait, total time.Duration) {
+	if total <= o.slowRequestThreshold {
+		return
+	}
+	o.slowRequestLogger.Warnw("Slow request",
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Int("status", status),
+		zap.Duration("wait", wait),
+		zap.Duration("serve", total-wait),
+		zap.Duration("total", total))
+}
+
+// VersionHeaderName is the response header carrying the version of the
+// queue-proxy with WithVersionHeader.
+const VersionHeaderName = "X-Knative-Queue-Version"
+
+// WithVersionHeader makes ProxyHandler send the given version of the
+// queue-proxy in the VersionHeaderName header of the responses, e.g. to tell
+// which build served a request while rolling out a new queue-proxy image. An
+// empty version sends no header.
+func WithVersionHeader(version string) ProxyHandlerOption {
+	return func(o *proxyHandlerOptions) {
+		o.version = version
+	}
+}
+
+// BodyLimitErrorHandler wraps the error handler of a reverse proxy to answer
+// the requests whose body exceeded the limit of WithMaxRequestBodyBytes with
+// a 413, passing all other errors to next.
+func BodyLimitErrorHandler(next func(http.ResponseWriter, *http.Request, error)) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeRequestBodyTooLarge(w)
+			return
+		}
+		next(w, r, err)
+	}
+}
+
+func writeRequestBodyTooLarge(w http.ResponseWriter) {
+	http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+}
+
+// The attributes of the queue_proxy span describing the wait of the request in
+// the breaker.
+const (
+	queueWaitAttribute     = "knative.queue.wait_ms"
+	queueInFlightAttribute = "knative.queue.inflight"
+	queueRejectedAttribute = "knative.queue.rejected"
+)
+
+// recordQueueWait adds how long the request waited in the breaker, the
+// requests in flight and whether the request was rejected to the span.
+func recordQueueWait(span *trace.Span, breaker *Breaker, wait time.Duration, rejected bool) {
+	if !span.IsRecordingEvents() {
+		return
+	}
+	span.AddAttributes(
+		trace.Int64Attribute(queueWaitAttribute, wait.Milliseconds()),
+		trace.Int64Attribute(queueInFlightAttribute, int64(breaker.InFlight())),
+		trace.BoolAttribute(queueRejectedAttribute, rejected))
+}
+
+// probeHandler returns the fast path serving the kubelet probes. It bypasses
+// the breaker and all other admission control, so that the probes are
+// answered even when the breaker is saturated, and counts the probes, if at
+// all, as plain requests, never as proxied ones.
+func (o *proxyHandlerOptions) probeHandler(stats *netstats.RequestStats, next http.Handler) http.HandlerFunc {
+	if !o.countProbes {
+		return next.ServeHTTP
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats.HandleEvent(netstats.ReqEvent{Time: time.Now(), Type: netstats.ReqIn})
+		defer func() {
+			stats.HandleEvent(netstats.ReqEvent{Time: time.Now(), Type: netstats.ReqOut})
+		}()
+		next.ServeHTTP(w, r)
+	}
+}
+
 // ProxyHandler sends requests to the `next` handler at a rate controlled by
 // the passed `breaker`, while recording stats to `stats`.
-func ProxyHandler(breaker *Breaker, stats *netstats.RequestStats, tracingEnabled bool, next http.Handler) http.HandlerFunc {
+func ProxyHandler(breaker *Breaker, stats *netstats.RequestStats, tracingEnabled bool, next http.Handler, opts ...ProxyHandlerOption) http.HandlerFunc {
+	o := proxyHandlerOptions{
+		activatorHeaderName:  netheader.ProxyKey,
+		activatorHeaderValue: activator.Name,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	probe := o.probeHandler(stats, next)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		if netheader.IsKubeletProbe(r) {
-			next.ServeHTTP(w, r)
+			probe(w, r)
 			return
 		}
 
+		if o.version != "" {
+			w.Header().Set(VersionHeaderName, o.version)
+		}
+
+		// Keep the user container out of the traffic during maintenance.
+		if o.maintenance {
+			o.writeMaintenance(w)
+			return
+		}
+
+		if o.maxRequestBodyBytes > 0 && r.Body != nil {
+			if r.ContentLength > o.maxRequestBodyBytes {
+				writeRequestBodyTooLarge(w)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, o.maxRequestBodyBytes)
+		}
+
+		var proxySpan *trace.Span
 		if tracingEnabled {
-			proxyCtx, proxySpan := trace.StartSpan(r.Context(), "queue_proxy")
+			var proxyCtx context.Context
+			proxyCtx, proxySpan = trace.StartSpan(r.Context(), "queue_proxy")
 			r = r.WithContext(proxyCtx)
 			defer proxySpan.End()
 		}
 
 		// Metrics for autoscaling.
 		in, out := netstats.ReqIn, netstats.ReqOut
-		if activator.Name == netheader.GetKnativeProxyValue(r) {
+		if o.activatorHeaderName != "" && r.Header.Get(o.activatorHeaderName) == o.activatorHeaderValue {
 			in, out = netstats.ProxiedIn, netstats.ProxiedOut
 		}
 		stats.HandleEvent(netstats.ReqEvent{Time: time.Now(), Type: in})
@@ -54,6 +406,49 @@ func ProxyHandler(breaker *Breaker, stats *netstats.RequestStats, tracingEnabled
 		}()
 		netheader.RewriteHostOut(r)
 
+		var rr *pkghttp.ResponseRecorder
+		if o.responseClasses != nil || o.slowRequestThreshold > 0 {
+			rr = pkghttp.NewResponseRecorder(w, http.StatusOK)
+			w = rr
+		}
+		if o.responseClasses != nil {
+			defer func() {
+				o.responseClasses.Record(rr.ResponseCode)
+			}()
+		}
+
+		// Shed load before it causes the container to be OOM killed.
+		if o.memoryPressure.Shedding() {
+			o.writeOverload(w, ErrMemoryPressure)
+			return
+		}
+
+		// Don't even queue requests once the breaker is draining.
+		if breaker != nil && breaker.Draining() {
+			o.writeOverload(w, ErrBreakerDraining)
+			return
+		}
+
+		// Keep a single client from monopolizing the breaker.
+		if o.clientLimiter != nil {
+			key := o.clientLimiter.clientKey(r)
+			if !o.clientLimiter.acquire(key) {
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			defer o.clientLimiter.release(key)
+		}
+
+		// The time waiting for the breaker is recorded on the span and, along
+		// with the total time, logged for slow requests.
+		start := time.Now()
+		var wait time.Duration
+		if o.slowRequestThreshold > 0 {
+			defer func() {
+				o.logSlowRequest(r, rr.ResponseCode, wait, time.Since(start))
+			}()
+		}
+
 		// Enforce queuing and concurrency limits.
 		if breaker != nil {
 			var waitSpan *trace.Span
@@ -62,11 +457,16 @@ func ProxyHandler(breaker *Breaker, stats *netstats.RequestStats, tracingEnabled
 			}
 			if err := breaker.Maybe(r.Context(), func() {
 				waitSpan.End()
+				wait = time.Since(start)
+				recordQueueWait(proxySpan, breaker, wait, false /*rejected*/)
 				next.ServeHTTP(w, r)
 			}); err != nil {
 				waitSpan.End()
-				if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrRequestQueueFull) {
-					http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				wait = time.Since(start)
+				recordQueueWait(proxySpan, breaker, wait, true /*rejected*/)
+				if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrRequestQueueFull) ||
+					errors.Is(err, ErrBreakerDraining) {
+					o.writeOverload(w, err)
 				} else {
 					// This line is most likely untestable :-).
 					w.WriteHeader(http.StatusInternalServerError)
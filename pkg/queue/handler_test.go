@@ -17,17 +17,26 @@ limitations under the License.
 package queue
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"go.opencensus.io/trace"
 	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/util/wait"
 	netheader "knative.dev/networking/pkg/http/header"
 	netstats "knative.dev/networking/pkg/http/stats"
 	"knative.dev/serving/pkg/activator"
@@ -81,6 +90,430 @@ func TestHandlerBreakerQueueFull(t *testing.T) {
 	}
 }
 
+func TestHandlerBreakerQueueFullSuppressedDetails(t *testing.T) {
+	resp := make(chan struct{})
+	defer close(resp) // Allow the blocked request to pass.
+	blockHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-resp
+	})
+	breaker := NewBreaker(BreakerParams{
+		QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1,
+	})
+	stats := netstats.NewRequestStats(time.Now())
+	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, blockHandler,
+		WithSuppressedOverloadDetails(true))
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil)
+	resps := make(chan *httptest.ResponseRecorder)
+	for i := 0; i < 3; i++ {
+		go func() {
+			rec := httptest.NewRecorder()
+			h(rec, req)
+			resps <- rec
+		}()
+	}
+
+	failure := <-resps
+	if got, want := failure.Code, http.StatusServiceUnavailable; got != want {
+		t.Errorf("Code = %d, want: %d", got, want)
+	}
+	if got, want := failure.Body.String(), http.StatusText(http.StatusServiceUnavailable)+"\n"; got != want {
+		t.Errorf("Body = %q, want: %q", got, want)
+	}
+}
+
+func TestHandlerBreakerQueueFullOverloadResponse(t *testing.T) {
+	resp := make(chan struct{})
+	defer close(resp) // Allow the blocked request to pass.
+	blockHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-resp
+	})
+	breaker := NewBreaker(BreakerParams{
+		QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1,
+	})
+	stats := netstats.NewRequestStats(time.Now())
+	// The per-revision overload response overrides the global one.
+	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, blockHandler,
+		WithSuppressedOverloadDetails(true),
+		WithOverloadResponse(http.StatusTooManyRequests, "slow down"))
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil)
+	resps := make(chan *httptest.ResponseRecorder)
+	for i := 0; i < 3; i++ {
+		go func() {
+			rec := httptest.NewRecorder()
+			h(rec, req)
+			resps <- rec
+		}()
+	}
+
+	failure := <-resps
+	if got, want := failure.Code, http.StatusTooManyRequests; got != want {
+		t.Errorf("Code = %d, want: %d", got, want)
+	}
+	if got, want := failure.Body.String(), "slow down\n"; got != want {
+		t.Errorf("Body = %q, want: %q", got, want)
+	}
+}
+
+func TestHandlerBreakerQueueFullStatusCode(t *testing.T) {
+	tests := []struct {
+		name           string
+		statusCode     int
+		retryAfter     time.Duration
+		body           string
+		wantCode       int
+		wantRetryAfter string
+		wantBody       string
+	}{{
+		name:     "default",
+		wantCode: http.StatusServiceUnavailable,
+	}, {
+		name:           "too many requests",
+		statusCode:     http.StatusTooManyRequests,
+		wantCode:       http.StatusTooManyRequests,
+		wantRetryAfter: queueFullRetryAfter,
+	}, {
+		name:           "too many requests with retry after and body",
+		statusCode:     http.StatusTooManyRequests,
+		retryAfter:     2500 * time.Millisecond,
+		body:           "come back later",
+		wantCode:       http.StatusTooManyRequests,
+		wantRetryAfter: "3",
+		wantBody:       "come back later\n",
+	}, {
+		name:           "service unavailable with retry after",
+		retryAfter:     10 * time.Second,
+		wantCode:       http.StatusServiceUnavailable,
+		wantRetryAfter: "10",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := make(chan struct{})
+			defer close(resp) // Allow the blocked request to pass.
+			blockHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-resp
+			})
+			breaker := NewBreaker(BreakerParams{
+				QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1,
+			})
+			stats := netstats.NewRequestStats(time.Now())
+			h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, blockHandler,
+				WithSuppressedOverloadDetails(true),
+				WithQueueFullStatusCode(tc.statusCode),
+				WithQueueFullResponse(tc.retryAfter, tc.body))
+
+			req := httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil)
+			resps := make(chan *httptest.ResponseRecorder)
+			for i := 0; i < 3; i++ {
+				go func() {
+					rec := httptest.NewRecorder()
+					h(rec, req)
+					resps <- rec
+				}()
+			}
+
+			failure := <-resps
+			if got := failure.Code; got != tc.wantCode {
+				t.Errorf("Code = %d, want: %d", got, tc.wantCode)
+			}
+			wantBody := tc.wantBody
+			if wantBody == "" {
+				wantBody = http.StatusText(tc.wantCode) + "\n"
+			}
+			if got := failure.Body.String(); got != wantBody {
+				t.Errorf("Body = %q, want: %q", got, wantBody)
+			}
+			if got := failure.Header().Get("Retry-After"); got != tc.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want: %q", got, tc.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestHandlerBreakerDrain(t *testing.T) {
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	blockHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	breaker := NewBreaker(BreakerParams{
+		QueueDepth: 10, MaxConcurrency: 2, InitialCapacity: 2,
+	})
+	stats := netstats.NewRequestStats(time.Now())
+	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, blockHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil)
+	resps := make(chan *httptest.ResponseRecorder)
+	for i := 0; i < 5; i++ {
+		go func() {
+			rec := httptest.NewRecorder()
+			h(rec, req)
+			resps <- rec
+		}()
+	}
+
+	// Two requests start, the other three queue up behind them.
+	<-started
+	<-started
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return breaker.InFlight() == 5, nil
+	}); err != nil {
+		t.Fatalf("InFlight() = %d, want: 5", breaker.InFlight())
+	}
+
+	drained := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		drained <- breaker.Drain(ctx)
+	}()
+
+	// The queued requests are rejected right away.
+	for i := 0; i < 3; i++ {
+		rec := <-resps
+		if got, want := rec.Code, http.StatusServiceUnavailable; got != want {
+			t.Errorf("Code = %d, want: %d", got, want)
+		}
+		if got, want := rec.Body.String(), ErrBreakerDraining.Error(); !strings.Contains(got, want) {
+			t.Errorf("Body = %q wanted to contain %q", got, want)
+		}
+	}
+
+	// New requests are rejected without reaching the breaker.
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	if got, want := rec.Code, http.StatusServiceUnavailable; got != want {
+		t.Errorf("Code after draining = %d, want: %d", got, want)
+	}
+
+	// The started requests complete and the drain returns.
+	close(release)
+	for i := 0; i < 2; i++ {
+		if got, want := (<-resps).Code, http.StatusOK; got != want {
+			t.Errorf("Code = %d, want: %d", got, want)
+		}
+	}
+	if err := <-drained; err != nil {
+		t.Error("Drain() =", err)
+	}
+}
+
+func TestHandlerMaxRequestBodyBytes(t *testing.T) {
+	const limit = 10
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+	proxy := httputil.NewSingleHostReverseProxy(backendURL)
+	proxy.ErrorHandler = BodyLimitErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	tests := []struct {
+		name        string
+		size        int
+		chunked     bool
+		wantCode    int
+		wantCounted bool
+	}{{
+		name:        "at the limit",
+		size:        limit,
+		wantCode:    http.StatusOK,
+		wantCounted: true,
+	}, {
+		name:     "one byte over the limit",
+		size:     limit + 1,
+		wantCode: http.StatusRequestEntityTooLarge,
+	}, {
+		name:        "chunked at the limit",
+		size:        limit,
+		chunked:     true,
+		wantCode:    http.StatusOK,
+		wantCounted: true,
+	}, {
+		name:     "chunked one byte over the limit",
+		size:     limit + 1,
+		chunked:  true,
+		wantCode: http.StatusRequestEntityTooLarge,
+		// The size of the body is only known once it is forwarded.
+		wantCounted: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			breaker := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+			stats := netstats.NewRequestStats(time.Now())
+			h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, proxy, WithMaxRequestBodyBytes(limit))
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.com", strings.NewReader(strings.Repeat("x", tc.size)))
+			req.Header.Set(netheader.ProxyKey, activator.Name)
+			if tc.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			h(rec, req)
+
+			if got := rec.Code; got != tc.wantCode {
+				t.Errorf("Code = %d, want: %d", got, tc.wantCode)
+			}
+			if got := breaker.InFlight(); got != 0 {
+				t.Errorf("InFlight() = %d, want the breaker slot released", got)
+			}
+			if got := stats.Report(time.Now()).ProxiedRequestCount; (got != 0) != tc.wantCounted {
+				t.Errorf("ProxiedRequestCount = %v, want counted: %v", got, tc.wantCounted)
+			}
+		})
+	}
+}
+
+func TestHandlerMaxRequestBodyBytesUnlimited(t *testing.T) {
+	var got int64
+	h := ProxyHandler(nil, netstats.NewRequestStats(time.Now()), false /*tracingEnabled*/, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.Copy(io.Discard, r.Body)
+	}), WithMaxRequestBodyBytes(0))
+
+	const size = 1 << 20
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "http://example.com", strings.NewReader(strings.Repeat("x", size))))
+	if rec.Code != http.StatusOK || got != size {
+		t.Errorf("Code = %d and body read = %d, want: %d and %d", rec.Code, got, http.StatusOK, size)
+	}
+}
+
+func TestHandlerVersionHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+	}{{
+		name: "disabled",
+	}, {
+		name:    "enabled",
+		version: "a1b2c3d",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			baseHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("user container"))
+			})
+			stats := netstats.NewRequestStats(time.Now())
+			h := ProxyHandler(nil, stats, false /*tracingEnabled*/, baseHandler, WithVersionHeader(tc.version))
+
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil))
+			got, ok := rec.Header()[http.CanonicalHeaderKey(VersionHeaderName)]
+			if tc.version == "" {
+				if ok {
+					t.Errorf("%s = %q, want no header", VersionHeaderName, got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0] != tc.version {
+				t.Errorf("%s = %q, want: %q", VersionHeaderName, got, tc.version)
+			}
+		})
+	}
+}
+
+func TestHandlerMaintenance(t *testing.T) {
+	tests := []struct {
+		name        string
+		maintenance bool
+		wantCode    int
+		wantBody    string
+	}{{
+		name:     "not in maintenance",
+		wantCode: http.StatusOK,
+		wantBody: "user container",
+	}, {
+		name:        "in maintenance",
+		maintenance: true,
+		wantCode:    http.StatusGone,
+		wantBody:    "down for maintenance\n",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			forwarded := false
+			baseHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = true
+				w.Write([]byte("user container"))
+			})
+			breaker := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+			stats := netstats.NewRequestStats(time.Now())
+			h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, baseHandler,
+				WithMaintenanceResponse(tc.maintenance, http.StatusGone, "down for maintenance"))
+
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil))
+			if got := rec.Code; got != tc.wantCode {
+				t.Errorf("Code = %d, want: %d", got, tc.wantCode)
+			}
+			if got := rec.Body.String(); got != tc.wantBody {
+				t.Errorf("Body = %q, want: %q", got, tc.wantBody)
+			}
+			if forwarded == tc.maintenance {
+				t.Errorf("Forwarded = %v, want: %v", forwarded, !tc.maintenance)
+			}
+
+			// Kubelet probes still reach the user container.
+			forwarded = false
+			req := httptest.NewRequest(http.MethodGet, "http://localhost:8081/healthz", nil)
+			req.Header.Set("User-Agent", netheader.KubeProbeUAPrefix+"1.29") // Mark it a probe.
+			h(httptest.NewRecorder(), req)
+			if !forwarded {
+				t.Error("The kubelet probe was not forwarded")
+			}
+		})
+	}
+}
+
+func TestHandlerResponseClassStats(t *testing.T) {
+	baseHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, err := strconv.Atoi(r.URL.Query().Get("code"))
+		if err != nil {
+			t.Error("Atoi() =", err)
+		}
+		w.WriteHeader(code)
+	})
+	breaker := NewBreaker(BreakerParams{QueueDepth: 10, MaxConcurrency: 10, InitialCapacity: 10})
+	stats := netstats.NewRequestStats(time.Now())
+	classes := NewResponseClassStats()
+	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, baseHandler, WithResponseClassStats(classes))
+
+	for _, code := range []int{
+		http.StatusOK, http.StatusOK, http.StatusCreated, http.StatusNoContent,
+		http.StatusFound,
+		http.StatusNotFound, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+	} {
+		h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost:8081/?code="+strconv.Itoa(code), nil))
+	}
+
+	// Kubelet probes are not counted.
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8081/?code=200", nil)
+	req.Header.Set("User-Agent", netheader.KubeProbeUAPrefix+"1.29") // Mark it a probe.
+	h(httptest.NewRecorder(), req)
+
+	want := ResponseClassReport{
+		SuccessCount:     4,
+		RedirectCount:    1,
+		ClientErrorCount: 2,
+		ServerErrorCount: 4,
+	}
+	if got := classes.Report(); got != want {
+		t.Errorf("Report() = %+v, want: %+v", got, want)
+	}
+
+	// The counts are reset by reporting them.
+	if got := classes.Report(); got != (ResponseClassReport{}) {
+		t.Errorf("Report() = %+v, want no responses", got)
+	}
+}
+
 func TestHandlerBreakerTimeout(t *testing.T) {
 	// This test sends a request which will take a long time to complete.
 	// Then another one with a very short context timeout.
@@ -120,6 +553,173 @@ func TestHandlerBreakerTimeout(t *testing.T) {
 	}
 }
 
+func TestHandlerSlowRequestLog(t *testing.T) {
+	const threshold = 50 * time.Millisecond
+	var logs bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&logs), zap.InfoLevel)).Sugar()
+
+	release := make(chan struct{})
+	blockHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusAccepted)
+	})
+	breaker := NewBreaker(BreakerParams{
+		QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1,
+	})
+	stats := netstats.NewRequestStats(time.Now())
+	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, blockHandler, WithSlowRequestLog(threshold, logger))
+
+	// A request served below the threshold isn't logged.
+	close(release)
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "http://localhost:8081/fast", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Code = %d, want: %d", rec.Code, http.StatusAccepted)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("Fast request was logged: %s", logs.String())
+	}
+
+	// A request blocked past the threshold is logged.
+	release = make(chan struct{})
+	time.AfterFunc(2*threshold, func() { close(release) })
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "http://localhost:8081/slow", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Code = %d, want: %d", rec.Code, http.StatusAccepted)
+	}
+
+	var entry struct {
+		Msg    string  `json:"msg"`
+		Method string  `json:"method"`
+		Path   string  `json:"path"`
+		Status int     `json:"status"`
+		Wait   float64 `json:"wait"`
+		Serve  float64 `json:"serve"`
+		Total  float64 `json:"total"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to parse the log %q: %v", logs.String(), err)
+	}
+	if entry.Msg != "Slow request" || entry.Method != http.MethodPost || entry.Path != "/slow" || entry.Status != http.StatusAccepted {
+		t.Errorf("Log = %s, want the method, path and status of the slow request", logs.String())
+	}
+	if entry.Serve < threshold.Seconds() || entry.Total < entry.Wait+entry.Serve-1e-6 {
+		t.Errorf("Log = %s, want a serve time over %v adding up to the total", logs.String(), threshold)
+	}
+}
+
+func TestHandlerSlowRequestLogDisabled(t *testing.T) {
+	var logs bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&logs), zap.InfoLevel)).Sugar()
+	h := ProxyHandler(nil, netstats.NewRequestStats(time.Now()), false /*tracingEnabled*/, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}), WithSlowRequestLog(0, logger))
+
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost:8081/", nil))
+	if logs.Len() != 0 {
+		t.Errorf("Request was logged with a zero threshold: %s", logs.String())
+	}
+}
+
+// spanRecorder is a trace.Exporter keeping the exported spans in memory.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *spanRecorder) attributes(name string) []map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var attrs []map[string]interface{}
+	for _, s := range r.spans {
+		if s.Name == name {
+			attrs = append(attrs, s.Attributes)
+		}
+	}
+	return attrs
+}
+
+func TestHandlerQueueWaitSpanAttributes(t *testing.T) {
+	recorder := &spanRecorder{}
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+
+	release := make(chan struct{})
+	blockHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Block") != "" {
+			<-release
+		}
+	})
+	breaker := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+	stats := netstats.NewRequestStats(time.Now())
+	h := ProxyHandler(breaker, stats, true /*tracingEnabled*/, blockHandler)
+
+	serve := func(block bool) {
+		// Sample the spans of the request regardless of the default sampler.
+		ctx, span := trace.StartSpan(context.Background(), "test", trace.WithSampler(trace.AlwaysSample()))
+		defer span.End()
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil).WithContext(ctx)
+		if block {
+			req.Header.Set("X-Block", "true")
+		}
+		h(httptest.NewRecorder(), req)
+	}
+
+	serve(false /*block*/)
+
+	// Saturate the breaker with a request being served and another waiting.
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(true /*block*/)
+		}()
+	}
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return breaker.InFlight() == 2, nil
+	}); err != nil {
+		t.Fatal("The breaker never saturated")
+	}
+	serve(false /*block*/)
+	close(release)
+	wg.Wait()
+
+	attrs := recorder.attributes("queue_proxy")
+	if len(attrs) != 4 {
+		t.Fatalf("Got %d queue_proxy spans, want 4", len(attrs))
+	}
+	for _, a := range attrs {
+		for _, key := range []string{queueWaitAttribute, queueInFlightAttribute, queueRejectedAttribute} {
+			if _, ok := a[key]; !ok {
+				t.Errorf("Span attributes %v lack %q", a, key)
+			}
+		}
+	}
+	if got := attrs[0][queueRejectedAttribute]; got != false {
+		t.Errorf("%s of the served request = %v, want false", queueRejectedAttribute, got)
+	}
+	if got := attrs[0][queueInFlightAttribute]; got != int64(1) {
+		t.Errorf("%s of the served request = %v, want 1", queueInFlightAttribute, got)
+	}
+	// The rejected request ends before the blocked ones.
+	if got := attrs[1][queueRejectedAttribute]; got != true {
+		t.Errorf("%s of the rejected request = %v, want true", queueRejectedAttribute, got)
+	}
+	if got := attrs[1][queueInFlightAttribute]; got != int64(2) {
+		t.Errorf("%s of the rejected request = %v, want 2", queueInFlightAttribute, got)
+	}
+}
+
 func TestHandlerReqEvent(t *testing.T) {
 	params := BreakerParams{QueueDepth: 10, MaxConcurrency: 10, InitialCapacity: 10}
 	breaker := NewBreaker(params)
@@ -172,6 +772,65 @@ func TestHandlerReqEvent(t *testing.T) {
 	}
 }
 
+func TestHandlerActivatorProxyHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []ProxyHandlerOption
+		header      string
+		value       string
+		wantProxied int64
+	}{{
+		name:        "default header",
+		header:      netheader.ProxyKey,
+		value:       activator.Name,
+		wantProxied: 1,
+	}, {
+		name:        "customized header",
+		opts:        []ProxyHandlerOption{WithActivatorProxyHeader("X-Knative-Proxy", "kn-activator")},
+		header:      "X-Knative-Proxy",
+		value:       "kn-activator",
+		wantProxied: 1,
+	}, {
+		name:   "default header with customized config",
+		opts:   []ProxyHandlerOption{WithActivatorProxyHeader("X-Knative-Proxy", "kn-activator")},
+		header: netheader.ProxyKey,
+		value:  activator.Name,
+	}, {
+		name:   "suppressed header",
+		opts:   []ProxyHandlerOption{WithActivatorProxyHeader("", "")},
+		header: netheader.ProxyKey,
+		value:  activator.Name,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The original host is restored whether or not the request
+				// is recognized as proxied by the activator.
+				if got, want := r.Host, wantHost; got != want {
+					t.Errorf("Host header = %q, want: %q", got, want)
+				}
+			})
+			stats := netstats.NewRequestStats(time.Now())
+			h := ProxyHandler(nil /*breaker*/, stats, false /*tracingEnabled*/, next, tc.opts...)
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.com", nil)
+			req.Host = "nimporte.pas"
+			req.Header.Set(netheader.OriginalHostKey, wantHost)
+			req.Header.Set(tc.header, tc.value)
+			h(httptest.NewRecorder(), req)
+
+			report := stats.Report(time.Now())
+			if got := int64(report.ProxiedRequestCount); got != tc.wantProxied {
+				t.Errorf("ProxiedRequestCount = %d, want %d", got, tc.wantProxied)
+			}
+			if got, want := int64(report.RequestCount), int64(1); got != want {
+				t.Errorf("RequestCount = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
 func TestIgnoreProbe(t *testing.T) {
 	// Verifies that probes don't queue.
 	resp := make(chan struct{})
@@ -230,6 +889,80 @@ func TestIgnoreProbe(t *testing.T) {
 	}
 }
 
+func TestProbeStats(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []ProxyHandlerOption
+		wantCount float64
+	}{{
+		name: "probes not counted by default",
+	}, {
+		name:      "probes counted",
+		opts:      []ProxyHandlerOption{WithCountedProbes(true)},
+		wantCount: 1,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := netstats.NewRequestStats(time.Now())
+			breaker := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+			h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), tc.opts...)
+
+			req := httptest.NewRequest(http.MethodGet, "http://prob.in", nil)
+			req.Header.Set("User-Agent", netheader.KubeProbeUAPrefix+"1.29")
+			h(httptest.NewRecorder(), req)
+
+			if got := stats.Report(time.Now()).RequestCount; got != tc.wantCount {
+				t.Errorf("RequestCount = %v, want %v", got, tc.wantCount)
+			}
+		})
+	}
+}
+
+func TestProbeSaturatedBreaker(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !netheader.IsKubeletProbe(r) {
+			<-release
+		}
+	})
+	breaker := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+	stats := netstats.NewRequestStats(time.Now())
+	proxy := ProxyHandler(breaker, stats, false /*tracingEnabled*/, h, WithCountedProbes(true))
+
+	// Fill the breaker, executing and queued, with blocked requests.
+	for i := 0; i < 2; i++ {
+		go proxy(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+	}
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return breaker.InFlight() == 2, nil
+	}); err != nil {
+		t.Fatalf("InFlight() = %d, want: 2", breaker.InFlight())
+	}
+	rec := httptest.NewRecorder()
+	proxy(rec, httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+	if got, want := rec.Code, http.StatusServiceUnavailable; got != want {
+		t.Fatalf("Status of a request to the full breaker = %d, want: %d", got, want)
+	}
+
+	// Probes, even proxied by the activator, are still answered.
+	req := httptest.NewRequest(http.MethodGet, "http://prob.in", nil)
+	req.Header.Set("User-Agent", netheader.KubeProbeUAPrefix+"1.29")
+	req.Header.Set(netheader.ProxyKey, activator.Name)
+	rec = httptest.NewRecorder()
+	proxy(rec, req)
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Errorf("Probe status = %d, want: %d", got, want)
+	}
+	if got, want := breaker.InFlight(), 2; got != want {
+		t.Errorf("InFlight() after the probe = %d, want: %d", got, want)
+	}
+	if got := stats.Report(time.Now()).ProxiedRequestCount; got != 0 {
+		t.Errorf("ProxiedRequestCount = %v, want: 0", got)
+	}
+}
+
 func BenchmarkProxyHandler(b *testing.B) {
 	baseHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 	stats := netstats.NewRequestStats(time.Now())
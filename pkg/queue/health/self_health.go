@@ -0,0 +1,65 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"knative.dev/serving/pkg/queue"
+)
+
+// SelfHealthHandler returns a http.HandlerFunc reporting whether the
+// queue-proxy itself is responsive, independently of the user container.
+// check is expected to go through the request handling path of the
+// queue-proxy and to return once it made it through. The queue-proxy is
+// reported unhealthy if check fails, doesn't return within timeout, or if a
+// previous check is still stuck.
+func SelfHealthHandler(check func(context.Context) error, timeout time.Duration) http.HandlerFunc {
+	var inFlight atomic.Bool
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Don't pile up goroutines behind a check which never returns.
+		if !inFlight.CAS(false, true) {
+			http.Error(w, "previous self-health check is still pending", http.StatusServiceUnavailable)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		done := make(chan error, 1)
+		go func() {
+			defer inFlight.Store(false)
+			done <- check(ctx)
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				http.Error(w, "self-health check failed: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, queue.Name)
+		case <-ctx.Done():
+			http.Error(w, "request handling did not respond within "+timeout.String(), http.StatusServiceUnavailable)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"knative.dev/serving/pkg/queue"
+)
+
+func TestSelfHealthHandler(t *testing.T) {
+	testcases := []struct {
+		name     string
+		check    func(context.Context) error
+		wantCode int
+		wantBody string
+	}{{
+		name:     "responsive",
+		check:    func(context.Context) error { return nil },
+		wantCode: http.StatusOK,
+		wantBody: queue.Name,
+	}, {
+		name:     "failing",
+		check:    func(context.Context) error { return errors.New("connection refused") },
+		wantCode: http.StatusServiceUnavailable,
+		wantBody: "self-health check failed: connection refused\n",
+	}, {
+		name: "stalled",
+		check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		wantCode: http.StatusServiceUnavailable,
+		wantBody: "request handling did not respond within 10ms\n",
+	}}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := SelfHealthHandler(tc.check, 10*time.Millisecond)
+
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+
+			if got, want := rec.Code, tc.wantCode; got != want {
+				t.Errorf("Code = %d, want: %d", got, want)
+			}
+			if got, want := rec.Body.String(), tc.wantBody; got != want {
+				t.Errorf("Body = %q, want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestSelfHealthHandlerStuck(t *testing.T) {
+	// A check ignoring its context keeps the queue-proxy unhealthy until it
+	// returns, without starting new checks in the meantime.
+	unblock := make(chan struct{})
+	calls := atomic.NewInt32(0)
+	h := SelfHealthHandler(func(context.Context) error {
+		calls.Inc()
+		<-unblock
+		return nil
+	}, 10*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+		if got, want := rec.Code, http.StatusServiceUnavailable; got != want {
+			t.Errorf("Code = %d, want: %d", got, want)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("check was called %d times, want 1", got)
+	}
+
+	close(unblock)
+	if err := waitForHealthy(h); err != nil {
+		t.Error(err)
+	}
+}
+
+func waitForHealthy(h http.HandlerFunc) error {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(5 * time.Millisecond) {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+		if rec.Code == http.StatusOK {
+			return nil
+		}
+	}
+	return errors.New("self-health never recovered")
+}
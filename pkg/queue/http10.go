@@ -0,0 +1,51 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"net"
+	"net/http"
+)
+
+// HTTP10Handler handles the requests of HTTP/1.0 clients. If reject is set,
+// they are answered with a 505 HTTP Version Not Supported. Otherwise they are
+// passed to h in a compatibility mode: their connection is closed after the
+// response, since HTTP/1.0 clients don't expect it to be kept alive, and
+// requests without a Host header get the address they were received on, so
+// that the user container sees a Host like for any other request.
+func HTTP10Handler(reject bool, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 1 || r.ProtoMinor != 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if reject {
+			w.Header().Set("Connection", "close")
+			http.Error(w, "HTTP/1.0 is not supported, use HTTP/1.1 or later", http.StatusHTTPVersionNotSupported)
+			return
+		}
+
+		r.Close = true
+		w.Header().Set("Connection", "close")
+		if r.Host == "" {
+			if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+				r.Host = addr.String()
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// sendRaw sends the given raw request to the server and returns the response.
+func sendRaw(t *testing.T, address, request string) (*http.Response, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal("Dial() =", err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatal("Write() =", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal("ReadResponse() =", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal("ReadAll() =", err)
+	}
+	return resp, string(body)
+}
+
+func TestHTTP10Handler(t *testing.T) {
+	hostHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	})
+
+	tests := []struct {
+		name       string
+		reject     bool
+		request    string
+		wantStatus int
+		wantClose  bool
+		wantHost   string // Empty for the address of the server.
+	}{{
+		name:       "compatibility without host",
+		request:    "GET / HTTP/1.0\r\n\r\n",
+		wantStatus: http.StatusOK,
+		wantClose:  true,
+	}, {
+		name:       "compatibility with host",
+		request:    "GET / HTTP/1.0\r\nHost: example.com\r\n\r\n",
+		wantStatus: http.StatusOK,
+		wantClose:  true,
+		wantHost:   "example.com",
+	}, {
+		name:       "compatibility with keep-alive",
+		request:    "GET / HTTP/1.0\r\nHost: example.com\r\nConnection: keep-alive\r\n\r\n",
+		wantStatus: http.StatusOK,
+		wantClose:  true,
+		wantHost:   "example.com",
+	}, {
+		name:       "reject",
+		reject:     true,
+		request:    "GET / HTTP/1.0\r\nHost: example.com\r\n\r\n",
+		wantStatus: http.StatusHTTPVersionNotSupported,
+		wantClose:  true,
+	}, {
+		name:       "reject leaves HTTP/1.1 alone",
+		reject:     true,
+		request:    "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		wantStatus: http.StatusOK,
+		wantHost:   "example.com",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(HTTP10Handler(tc.reject, hostHandler))
+			defer server.Close()
+			address := server.Listener.Addr().String()
+
+			resp, body := sendRaw(t, address, tc.request)
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("StatusCode = %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if resp.Close != tc.wantClose {
+				t.Errorf("Close = %v, want %v", resp.Close, tc.wantClose)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			wantHost := tc.wantHost
+			if wantHost == "" {
+				wantHost = address
+			}
+			if body != wantHost {
+				t.Errorf("Host = %q, want %q", body, wantHost)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrMemoryPressure indicates the request was shed because the memory
+	// usage crossed the high-water mark.
+	ErrMemoryPressure = errors.New("memory pressure too high")
+
+	// cgroupMemoryUsagePaths are the files holding the memory usage of the
+	// container, for cgroup v2 and v1 respectively.
+	cgroupMemoryUsagePaths = []string{
+		"/sys/fs/cgroup/memory.current",
+		"/sys/fs/cgroup/memory/memory.usage_in_bytes",
+	}
+)
+
+// MemoryPressure tracks whether new requests should be shed because the
+// memory usage is too high. Shedding starts once the usage crosses the
+// high-water mark and stops once it drops below the low-water mark again, so
+// that the decision doesn't flap around a single threshold.
+type MemoryPressure struct {
+	highWaterMark int64
+	lowWaterMark  int64
+	usage         func() (int64, error)
+
+	shedding atomic.Bool
+}
+
+// NewMemoryPressure creates a MemoryPressure reading the memory usage in bytes
+// from usage. A lowWaterMark which is not positive or above the highWaterMark
+// is replaced by the highWaterMark.
+func NewMemoryPressure(highWaterMark, lowWaterMark int64, usage func() (int64, error)) *MemoryPressure {
+	if lowWaterMark <= 0 || lowWaterMark > highWaterMark {
+		lowWaterMark = highWaterMark
+	}
+	return &MemoryPressure{
+		highWaterMark: highWaterMark,
+		lowWaterMark:  lowWaterMark,
+		usage:         usage,
+	}
+}
+
+// Shedding returns whether new requests should be rejected. It is safe to
+// call on a nil MemoryPressure, which never sheds.
+func (m *MemoryPressure) Shedding() bool {
+	return m != nil && m.shedding.Load()
+}
+
+// Update reads the current memory usage and updates the shedding state.
+func (m *MemoryPressure) Update() error {
+	usage, err := m.usage()
+	if err != nil {
+		return err
+	}
+	switch {
+	case usage >= m.highWaterMark:
+		m.shedding.Store(true)
+	case usage < m.lowWaterMark:
+		m.shedding.Store(false)
+	}
+	return nil
+}
+
+// Run updates the shedding state every period until the stop channel is
+// closed.
+func (m *MemoryPressure) Run(stop <-chan struct{}, period time.Duration, logger *zap.SugaredLogger) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			wasShedding := m.Shedding()
+			if err := m.Update(); err != nil {
+				logger.Errorw("Failed to read the memory usage", zap.Error(err))
+				continue
+			}
+			if shedding := m.Shedding(); shedding != wasShedding {
+				logger.Infof("Memory pressure shedding changed to %v", shedding)
+			}
+		}
+	}
+}
+
+// CgroupMemoryUsage returns the memory usage in bytes of the container, as
+// reported by its cgroup.
+func CgroupMemoryUsage() (int64, error) {
+	var err error
+	for _, path := range cgroupMemoryUsagePaths {
+		var b []byte
+		if b, err = os.ReadFile(path); err == nil {
+			return strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		}
+	}
+	return 0, err
+}
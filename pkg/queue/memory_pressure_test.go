@@ -0,0 +1,111 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	netstats "knative.dev/networking/pkg/http/stats"
+)
+
+func TestMemoryPressure(t *testing.T) {
+	var usage int64
+	m := NewMemoryPressure(100, 80, func() (int64, error) { return usage, nil })
+
+	for _, step := range []struct {
+		usage        int64
+		wantShedding bool
+	}{
+		{usage: 50},
+		{usage: 99},
+		{usage: 100, wantShedding: true},
+		{usage: 90, wantShedding: true}, // Between the marks the state is kept.
+		{usage: 80, wantShedding: true},
+		{usage: 79},
+		{usage: 90},
+		{usage: 150, wantShedding: true},
+	} {
+		usage = step.usage
+		if err := m.Update(); err != nil {
+			t.Fatal("Update() =", err)
+		}
+		if got := m.Shedding(); got != step.wantShedding {
+			t.Errorf("Shedding() at usage %d = %v, want %v", step.usage, got, step.wantShedding)
+		}
+	}
+}
+
+func TestMemoryPressureUsageError(t *testing.T) {
+	usageErr := errors.New("no cgroup")
+	var err error
+	m := NewMemoryPressure(100, 0, func() (int64, error) { return 200, err })
+
+	if err := m.Update(); err != nil {
+		t.Fatal("Update() =", err)
+	}
+
+	// A failing read keeps the last known state.
+	err = usageErr
+	if got := m.Update(); !errors.Is(got, usageErr) {
+		t.Errorf("Update() = %v, want %v", got, usageErr)
+	}
+	if !m.Shedding() {
+		t.Error("Shedding() = false, want true")
+	}
+}
+
+func TestMemoryPressureNil(t *testing.T) {
+	var m *MemoryPressure
+	if m.Shedding() {
+		t.Error("Shedding() = true, want false")
+	}
+}
+
+func TestHandlerMemoryPressure(t *testing.T) {
+	var usage int64
+	m := NewMemoryPressure(100, 80, func() (int64, error) { return usage, nil })
+
+	breaker := NewBreaker(BreakerParams{QueueDepth: 10, MaxConcurrency: 10, InitialCapacity: 10})
+	stats := netstats.NewRequestStats(time.Now())
+	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		WithMemoryPressure(m))
+
+	for _, step := range []struct {
+		usage    int64
+		wantCode int
+	}{
+		{usage: 50, wantCode: http.StatusOK},
+		{usage: 120, wantCode: http.StatusServiceUnavailable},
+		{usage: 90, wantCode: http.StatusServiceUnavailable},
+		{usage: 70, wantCode: http.StatusOK},
+	} {
+		usage = step.usage
+		if err := m.Update(); err != nil {
+			t.Fatal("Update() =", err)
+		}
+
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil))
+		if got := rec.Code; got != step.wantCode {
+			t.Errorf("Code at usage %d = %d, want: %d", step.usage, got, step.wantCode)
+		}
+	}
+}
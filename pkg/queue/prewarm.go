@@ -0,0 +1,103 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// Prewarmer warms up the user container once it becomes ready, so that the
+// first request doesn't pay for the connection setup.
+type Prewarmer struct {
+	address   string
+	path      string
+	transport http.RoundTripper
+	timeout   time.Duration
+	logger    *zap.SugaredLogger
+
+	ready atomic.Bool
+}
+
+// NewPrewarmer creates a Prewarmer of the user container at the given address.
+// If path is empty, a connection is opened to the user container. Otherwise a
+// GET request of the path is sent through the given transport, which keeps
+// the connection for the first request proxied with it.
+func NewPrewarmer(address, path string, transport http.RoundTripper, timeout time.Duration, logger *zap.SugaredLogger) *Prewarmer {
+	return &Prewarmer{
+		address:   address,
+		path:      path,
+		transport: transport,
+		timeout:   timeout,
+		logger:    logger,
+	}
+}
+
+// Wrap returns a readiness probe which prewarms the user container every time
+// the given probe transitions to ready.
+func (p *Prewarmer) Wrap(probe func() bool) func() bool {
+	return func() bool {
+		ready := probe()
+		if wasReady := p.ready.Swap(ready); ready && !wasReady {
+			go func() {
+				if err := p.Prewarm(context.Background()); err != nil {
+					p.logger.Warnw("Failed to prewarm the user container", zap.Error(err))
+				}
+			}()
+		}
+		return ready
+	}
+}
+
+// Prewarm opens a connection to the user container, or sends the warmup
+// request if a path is configured.
+func (p *Prewarmer) Prewarm(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	if p.path == "" {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", p.address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+p.address+p.path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	// Drain the body, so that the connection can be reused.
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("warmup request of %s answered with status %d", p.path, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	pkgnet "knative.dev/pkg/network"
+)
+
+// newConnServer starts a server which reports its new connections and the
+// paths of its requests.
+func newConnServer(t *testing.T) (string, chan struct{}, chan string) {
+	conns, paths := make(chan struct{}, 10), make(chan string, 10)
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+	}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns <- struct{}{}
+		}
+	}
+	s.Start()
+	t.Cleanup(s.Close)
+	return s.Listener.Addr().String(), conns, paths
+}
+
+func TestPrewarmerOnReadinessTransition(t *testing.T) {
+	address, conns, paths := newConnServer(t)
+	p := NewPrewarmer(address, "", pkgnet.NewProxyAutoTransport(1, 1), time.Second, zap.NewNop().Sugar())
+
+	ready := false
+	probe := p.Wrap(func() bool { return ready })
+
+	// No connection is opened while the user container isn't ready.
+	probe()
+	select {
+	case <-conns:
+		t.Fatal("Connection opened before the user container got ready")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ready = true
+	if !probe() {
+		t.Fatal("probe() = false, want true")
+	}
+	select {
+	case <-conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("No connection opened upon the readiness transition")
+	}
+
+	// Staying ready doesn't open further connections.
+	probe()
+	select {
+	case <-conns:
+		t.Fatal("Connection opened without a readiness transition")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if len(paths) != 0 {
+		t.Errorf("Got %d requests, want none", len(paths))
+	}
+
+	// Becoming ready again prewarms again.
+	ready = false
+	probe()
+	ready = true
+	probe()
+	select {
+	case <-conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("No connection opened upon the second readiness transition")
+	}
+}
+
+func TestPrewarmerWarmupRequest(t *testing.T) {
+	address, conns, paths := newConnServer(t)
+	transport := pkgnet.NewProxyAutoTransport(1, 1)
+	p := NewPrewarmer(address, "/warmup", transport, time.Second, zap.NewNop().Sugar())
+
+	if err := p.Prewarm(context.Background()); err != nil {
+		t.Fatal("Prewarm() =", err)
+	}
+	if got := <-paths; got != "/warmup" {
+		t.Errorf("Warmup request path = %q, want %q", got, "/warmup")
+	}
+	<-conns
+
+	// The first request reuses the connection of the warmup request.
+	req, err := http.NewRequest(http.MethodGet, "http://"+address+"/", nil)
+	if err != nil {
+		t.Fatal("NewRequest() =", err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal("RoundTrip() =", err)
+	}
+	resp.Body.Close()
+	if len(conns) != 0 {
+		t.Error("The first request opened a new connection")
+	}
+}
+
+func TestPrewarmerNotListening(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Listen() =", err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	p := NewPrewarmer(address, "", pkgnet.NewProxyAutoTransport(1, 1), time.Second, zap.NewNop().Sugar())
+	if err := p.Prewarm(context.Background()); err == nil {
+		t.Error("Prewarm() = nil, want an error")
+	}
+}
@@ -63,6 +63,12 @@ func NewProtobufStatsReporter(pod string, reportingPeriod time.Duration) *Protob
 
 // Report captures request metrics.
 func (r *ProtobufStatsReporter) Report(stats netstats.RequestStatsReport) {
+	r.ReportWithResponseClasses(stats, ResponseClassReport{})
+}
+
+// ReportWithResponseClasses captures request metrics along with the
+// breakdown of the responses by status code class.
+func (r *ProtobufStatsReporter) ReportWithResponseClasses(stats netstats.RequestStatsReport, classes ResponseClassReport) {
 	r.stat.Store(metrics.Stat{
 		PodName:       r.podName,
 		ProcessUptime: time.Since(r.startTime).Seconds(),
@@ -72,6 +78,12 @@ func (r *ProtobufStatsReporter) Report(stats netstats.RequestStatsReport) {
 		ProxiedRequestCount:              stats.ProxiedRequestCount / r.reportingPeriodSeconds,
 		AverageConcurrentRequests:        stats.AverageConcurrency,
 		AverageProxiedConcurrentRequests: stats.AverageProxiedConcurrency,
+
+		// The response counts are a rate over time, like RequestCount.
+		SuccessCount:     classes.SuccessCount / r.reportingPeriodSeconds,
+		RedirectCount:    classes.RedirectCount / r.reportingPeriodSeconds,
+		ClientErrorCount: classes.ClientErrorCount / r.reportingPeriodSeconds,
+		ServerErrorCount: classes.ServerErrorCount / r.reportingPeriodSeconds,
 	})
 }
 
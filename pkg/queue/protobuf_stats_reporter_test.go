@@ -120,6 +120,32 @@ func TestProtobufStatsReporterReport(t *testing.T) {
 	}
 }
 
+func TestProtobufStatsReporterReportWithResponseClasses(t *testing.T) {
+	reporter := NewProtobufStatsReporter(pod, 2*time.Second)
+	reporter.ReportWithResponseClasses(netstats.RequestStatsReport{
+		AverageConcurrency: 3,
+		RequestCount:       12,
+	}, ResponseClassReport{
+		SuccessCount:     6,
+		RedirectCount:    2,
+		ClientErrorCount: 3,
+		ServerErrorCount: 1,
+	})
+
+	want := metrics.Stat{
+		PodName:                   pod,
+		AverageConcurrentRequests: 3,
+		RequestCount:              6,
+		SuccessCount:              3,
+		RedirectCount:             1,
+		ClientErrorCount:          1.5,
+		ServerErrorCount:          0.5,
+	}
+	if got := scrapeProtobufStat(t, reporter); !cmp.Equal(want, got, ignoreStatFields) {
+		t.Errorf("Scraped stat mismatch; diff(-want,+got):\n%s", cmp.Diff(want, got, ignoreStatFields))
+	}
+}
+
 func TestInitialProtobufStateValid(t *testing.T) {
 	r := NewProtobufStatsReporter(pod, 1*time.Second)
 	emptyStat := metrics.Stat{
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"knative.dev/serving/pkg/queue/health"
+)
+
+// DependencyCheck checks that a dependency of the user container, e.g. a
+// database or a downstream service, is reachable.
+type DependencyCheck struct {
+	target  string
+	timeout time.Duration
+	check   func(time.Duration) error
+	out     io.Writer // To make tests not log errors in good cases.
+}
+
+// NewDependencyCheck returns a DependencyCheck of the given target, which is
+// either an http(s):// URL, checked to answer a GET with a 2xx or 3xx status
+// code, or a tcp://host:port target, checked to accept connections.
+func NewDependencyCheck(target string, timeout time.Duration) (*DependencyCheck, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dependency health check %q: %w", target, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("dependency health check %q has no host", target)
+	}
+
+	d := &DependencyCheck{
+		target:  target,
+		timeout: timeout,
+		out:     os.Stderr,
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("dependency health check %q has no port", target)
+		}
+		config := health.TCPProbeConfigOptions{Address: u.Host}
+		d.check = func(to time.Duration) error {
+			config.SocketTimeout = to
+			return health.TCPProbe(config)
+		}
+	case "http", "https":
+		scheme, port := corev1.URISchemeHTTP, "80"
+		if u.Scheme == "https" {
+			scheme, port = corev1.URISchemeHTTPS, "443"
+		}
+		if p := u.Port(); p != "" {
+			port = p
+		}
+		config := health.HTTPProbeConfigOptions{
+			HTTPGetAction: &corev1.HTTPGetAction{
+				Host:   u.Hostname(),
+				Port:   intstr.Parse(port),
+				Path:   u.RequestURI(),
+				Scheme: scheme,
+			},
+			MaxProtoMajor: 1,
+		}
+		d.check = func(to time.Duration) error {
+			config.Timeout = to
+			return health.HTTPProbe(config)
+		}
+	default:
+		return nil, fmt.Errorf("dependency health check %q has unsupported scheme %q", target, u.Scheme)
+	}
+	return d, nil
+}
+
+// Check checks the dependency once, returning an error if it isn't reachable.
+func (d *DependencyCheck) Check() error {
+	if err := d.check(d.timeout); err != nil {
+		return fmt.Errorf("dependency %s is not reachable: %w", d.target, err)
+	}
+	return nil
+}
+
+// Wrap returns a readiness probe which succeeds only if both the given probe
+// of the user container and the dependency check succeed. The dependency is
+// only checked once the user container is ready.
+func (d *DependencyCheck) Wrap(probe func() bool) func() bool {
+	return func() bool {
+		if !probe() {
+			return false
+		}
+		if err := d.Check(); err != nil {
+			fmt.Fprintln(d.out, err.Error())
+			return false
+		}
+		return true
+	}
+}
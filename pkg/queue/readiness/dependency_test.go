@@ -0,0 +1,139 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newDependencyServer(t *testing.T, status int) string {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s.Listener.Addr().String()
+}
+
+func closedAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Listen() =", err)
+	}
+	address := l.Addr().String()
+	l.Close()
+	return address
+}
+
+func TestDependencyCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Listen() =", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	tests := []struct {
+		name      string
+		target    string
+		wantReady bool
+	}{{
+		name:      "http dependency healthy",
+		target:    "http://" + newDependencyServer(t, http.StatusOK) + "/healthz",
+		wantReady: true,
+	}, {
+		name:   "http dependency unhealthy",
+		target: "http://" + newDependencyServer(t, http.StatusServiceUnavailable) + "/healthz",
+	}, {
+		name:   "http dependency down",
+		target: "http://" + closedAddress(t) + "/healthz",
+	}, {
+		name:      "tcp dependency listening",
+		target:    "tcp://" + listener.Addr().String(),
+		wantReady: true,
+	}, {
+		name:   "tcp dependency down",
+		target: "tcp://" + closedAddress(t),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := NewDependencyCheck(tc.target, time.Second)
+			if err != nil {
+				t.Fatal("NewDependencyCheck() =", err)
+			}
+			d.out = io.Discard
+
+			if err := d.Check(); (err == nil) != tc.wantReady {
+				t.Errorf("Check() = %v, want ready: %v", err, tc.wantReady)
+			}
+
+			// The queue-proxy is not ready while the dependency is down, even
+			// though the user container is up.
+			probe := d.Wrap(func() bool { return true })
+			if got := probe(); got != tc.wantReady {
+				t.Errorf("probe() = %v, want %v", got, tc.wantReady)
+			}
+		})
+	}
+}
+
+func TestDependencyCheckUserContainerNotReady(t *testing.T) {
+	d, err := NewDependencyCheck("http://"+newDependencyServer(t, http.StatusOK)+"/healthz", time.Second)
+	if err != nil {
+		t.Fatal("NewDependencyCheck() =", err)
+	}
+
+	if d.Wrap(func() bool { return false })() {
+		t.Error("Reported ready while the user container isn't")
+	}
+}
+
+func TestDependencyCheckLogsFailure(t *testing.T) {
+	d, err := NewDependencyCheck("tcp://"+closedAddress(t), time.Second)
+	if err != nil {
+		t.Fatal("NewDependencyCheck() =", err)
+	}
+	var buf strings.Builder
+	d.out = &buf
+
+	d.Wrap(func() bool { return true })()
+	if !strings.Contains(buf.String(), "is not reachable") {
+		t.Errorf("Log = %q, want the dependency failure", buf.String())
+	}
+}
+
+func TestNewDependencyCheckInvalid(t *testing.T) {
+	for _, target := range []string{
+		"/healthz",
+		"tcp://127.0.0.1",
+		"udp://127.0.0.1:53",
+		"http://%zz",
+	} {
+		if _, err := NewDependencyCheck(target, time.Second); err == nil {
+			t.Errorf("NewDependencyCheck(%q) = nil, want an error", target)
+		}
+	}
+}
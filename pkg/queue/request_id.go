@@ -0,0 +1,43 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHandler makes sure every request carries a request ID in the given
+// header, for correlating the logs of a request across components. An ID the
+// request already carries, e.g. set by the activator or the client, is
+// propagated as is; otherwise a random one is generated. The ID is set on both
+// the request passed to h and the response. No-op if header is empty.
+func RequestIDHandler(header string, h http.Handler) http.Handler {
+	if header == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(header)
+		if id == "" {
+			id = uuid.NewString()
+			r.Header.Set(header, id)
+		}
+		w.Header().Set(header, id)
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const testRequestIDHeader = "X-Request-Id"
+
+func TestRequestIDHandlerGeneratesWhenAbsent(t *testing.T) {
+	var upstream string
+	h := RequestIDHandler(testRequestIDHeader, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Header.Get(testRequestIDHeader)
+	}))
+
+	ids := make(map[string]bool, 2)
+	for i := 0; i < 2; i++ {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+
+		if _, err := uuid.Parse(upstream); err != nil {
+			t.Errorf("Upstream request ID = %q, want a UUID: %v", upstream, err)
+		}
+		if got := resp.Header().Get(testRequestIDHeader); got != upstream {
+			t.Errorf("Response request ID = %q, want %q", got, upstream)
+		}
+		ids[upstream] = true
+	}
+	if len(ids) != 2 {
+		t.Error("Generated the same request ID for different requests")
+	}
+}
+
+func TestRequestIDHandlerPropagatesWhenPresent(t *testing.T) {
+	const id = "the-request-id"
+
+	var upstream []string
+	h := RequestIDHandler(testRequestIDHeader, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Header.Values(testRequestIDHeader)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	req.Header.Set(testRequestIDHeader, id)
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+
+	if len(upstream) != 1 || upstream[0] != id {
+		t.Errorf("Upstream request IDs = %q, want [%q]", upstream, id)
+	}
+	if got := resp.Header().Values(testRequestIDHeader); len(got) != 1 || got[0] != id {
+		t.Errorf("Response request IDs = %q, want [%q]", got, id)
+	}
+}
+
+func TestRequestIDHandlerDisabled(t *testing.T) {
+	h := RequestIDHandler("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(testRequestIDHeader); got != "" {
+			t.Errorf("Upstream request ID = %q, want none", got)
+		}
+	}))
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+	if got := resp.Header().Get(testRequestIDHeader); got != "" {
+		t.Errorf("Response request ID = %q, want none", got)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"go.uber.org/atomic"
+)
+
+// ResponseClassStats counts the responses to the proxied requests by the
+// class of their status code.
+type ResponseClassStats struct {
+	success     atomic.Int64
+	redirect    atomic.Int64
+	clientError atomic.Int64
+	serverError atomic.Int64
+}
+
+// ResponseClassReport holds the number of responses of each status code
+// class over a reporting period.
+type ResponseClassReport struct {
+	SuccessCount     float64
+	RedirectCount    float64
+	ClientErrorCount float64
+	ServerErrorCount float64
+}
+
+// NewResponseClassStats creates an empty ResponseClassStats.
+func NewResponseClassStats() *ResponseClassStats {
+	return &ResponseClassStats{}
+}
+
+// Record counts a response with the given status code. Informational status
+// codes are not counted. It is safe to call on a nil ResponseClassStats,
+// which counts nothing.
+func (s *ResponseClassStats) Record(statusCode int) {
+	if s == nil {
+		return
+	}
+	switch statusCode / 100 {
+	case 2:
+		s.success.Inc()
+	case 3:
+		s.redirect.Inc()
+	case 4:
+		s.clientError.Inc()
+	case 5:
+		s.serverError.Inc()
+	}
+}
+
+// Report returns the responses counted since the last Report and resets the
+// counts. A nil ResponseClassStats reports no responses.
+func (s *ResponseClassStats) Report() ResponseClassReport {
+	if s == nil {
+		return ResponseClassReport{}
+	}
+	return ResponseClassReport{
+		SuccessCount:     float64(s.success.Swap(0)),
+		RedirectCount:    float64(s.redirect.Swap(0)),
+		ClientErrorCount: float64(s.clientError.Swap(0)),
+		ServerErrorCount: float64(s.serverError.Swap(0)),
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// LimitResponseHeaders returns a function suitable for the ModifyResponse hook
+// of a httputil.ReverseProxy, which truncates the response headers to at most
+// maxHeaders header fields. Each value of a multi-valued header counts as a
+// separate field. Headers are kept in lexical order of their names, so the
+// truncation is deterministic, and a Warning header is added when any field
+// was dropped. A non-positive maxHeaders disables the limit.
+func LimitResponseHeaders(maxHeaders int) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		if maxHeaders <= 0 {
+			return nil
+		}
+
+		total := 0
+		for _, v := range resp.Header {
+			total += len(v)
+		}
+		if total <= maxHeaders {
+			return nil
+		}
+
+		keys := make([]string, 0, len(resp.Header))
+		for k := range resp.Header {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		remaining := maxHeaders
+		for _, k := range keys {
+			v := resp.Header[k]
+			switch {
+			case remaining == 0:
+				delete(resp.Header, k)
+			case len(v) > remaining:
+				resp.Header[k] = v[:remaining]
+				remaining = 0
+			default:
+				remaining -= len(v)
+			}
+		}
+		resp.Header.Add("Warning", fmt.Sprintf(`199 queue-proxy "response headers truncated to %d of %d"`, maxHeaders, total))
+		return nil
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLimitResponseHeaders(t *testing.T) {
+	const backendHeaders = 100
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < backendHeaders; i++ {
+			w.Header().Set(fmt.Sprintf("X-Header-%03d", i), "value")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal("url.Parse() =", err)
+	}
+
+	tests := []struct {
+		name          string
+		maxHeaders    int
+		wantTruncated bool
+	}{{
+		name:       "unlimited",
+		maxHeaders: 0,
+	}, {
+		name:       "below limit",
+		maxHeaders: 1000,
+	}, {
+		name:          "truncated",
+		maxHeaders:    10,
+		wantTruncated: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := httputil.NewSingleHostReverseProxy(u)
+			proxy.ModifyResponse = LimitResponseHeaders(test.maxHeaders)
+
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+
+			got := 0
+			for k := range rec.Header() {
+				if strings.HasPrefix(k, "X-Header-") {
+					got++
+				}
+			}
+			warning := rec.Header().Get("Warning")
+
+			if !test.wantTruncated {
+				if got != backendHeaders {
+					t.Errorf("Got %d backend headers, want %d", got, backendHeaders)
+				}
+				if warning != "" {
+					t.Errorf("Warning = %q, want none", warning)
+				}
+				return
+			}
+
+			// The backend headers compete with the ones added by the server
+			// (e.g. Content-Length, Date), so at most maxHeaders are kept.
+			total := 0
+			for k, v := range rec.Header() {
+				if k != "Warning" {
+					total += len(v)
+				}
+			}
+			if total != test.maxHeaders {
+				t.Errorf("Got %d headers, want %d", total, test.maxHeaders)
+			}
+			if got == 0 || got > test.maxHeaders {
+				t.Errorf("Got %d backend headers, want between 1 and %d", got, test.maxHeaders)
+			}
+			if !strings.Contains(warning, "response headers truncated") {
+				t.Errorf("Warning = %q, want truncation warning", warning)
+			}
+		})
+	}
+}
@@ -26,6 +26,8 @@ import (
 	netheader "knative.dev/networking/pkg/http/header"
 	netproxy "knative.dev/networking/pkg/http/proxy"
 	netstats "knative.dev/networking/pkg/http/stats"
+	"knative.dev/pkg/changeset"
+	pkgnet "knative.dev/pkg/network"
 	pkghandler "knative.dev/pkg/network/handlers"
 	"knative.dev/pkg/tracing"
 	tracingconfig "knative.dev/pkg/tracing/config"
@@ -40,19 +42,28 @@ func mainHandler(
 	ctx context.Context,
 	env config,
 	transport http.RoundTripper,
+	breaker *queue.Breaker,
 	prober func() bool,
 	stats *netstats.RequestStats,
+	responseClasses *queue.ResponseClassStats,
 	logger *zap.SugaredLogger,
-) (http.Handler, *pkghandler.Drainer) {
+) (http.Handler, *queue.DrainReadiness) {
 	target := net.JoinHostPort("127.0.0.1", env.UserPort)
 
 	httpProxy := pkghttp.NewHeaderPruningReverseProxy(target, pkghttp.NoHostOverride, activator.RevisionHeaders, false /* use HTTP */)
 	httpProxy.Transport = transport
-	httpProxy.ErrorHandler = pkghandler.Error(logger)
+	httpProxy.ErrorHandler = queue.ResponseHeaderTimeoutErrorHandler(queue.BodyLimitErrorHandler(pkghandler.Error(logger)))
 	httpProxy.BufferPool = netproxy.NewBufferPool()
 	httpProxy.FlushInterval = netproxy.FlushInterval
+	if env.MaxResponseHeaders > 0 {
+		httpProxy.ModifyResponse = queue.LimitResponseHeaders(env.MaxResponseHeaders)
+	}
 
-	breaker := buildBreaker(logger, env)
+	memoryPressure := buildMemoryPressure(ctx, logger, env)
+	var version string
+	if env.VersionHeader {
+		version = changeset.Get()
+	}
 	tracingEnabled := env.TracingConfigBackend != tracingconfig.None
 	timeout := time.Duration(env.RevisionTimeoutSeconds) * time.Second
 	var responseStartTimeout = 0 * time.Second
@@ -68,10 +79,24 @@ func mainHandler(
 	var composedHandler http.Handler = httpProxy
 
 	metricsSupported := supportsMetrics(ctx, logger, env)
+	reportBreakerParams(logger, breaker, metricsSupported, env)
 	if metricsSupported {
 		composedHandler = requestAppMetricsHandler(logger, composedHandler, breaker, env)
 	}
-	composedHandler = queue.ProxyHandler(breaker, stats, tracingEnabled, composedHandler)
+	composedHandler = queue.ProxyHandler(breaker, stats, tracingEnabled, composedHandler,
+		queue.WithSuppressedOverloadDetails(env.SuppressOverloadDetails),
+		queue.WithOverloadResponse(env.OverloadStatusCode, env.OverloadBody),
+		queue.WithQueueFullStatusCode(env.QueueFullStatusCode),
+		queue.WithQueueFullResponse(time.Duration(env.QueueFullRetryAfterSeconds)*time.Second, env.QueueFullBody),
+		queue.WithMaintenanceResponse(env.Maintenance, env.MaintenanceStatusCode, env.MaintenanceBody),
+		queue.WithActivatorProxyHeader(env.ActivatorProxyHeaderName, env.ActivatorProxyHeaderValue),
+		queue.WithCountedProbes(env.CountProbeRequests),
+		queue.WithResponseClassStats(responseClasses),
+		queue.WithMemoryPressure(memoryPressure),
+		queue.WithClientConcurrencyLimit(env.ClientConcurrencyLimit, env.ClientKeyHeader),
+		queue.WithMaxRequestBodyBytes(env.MaxRequestBodyBytes),
+		queue.WithSlowRequestLog(time.Duration(env.SlowRequestThresholdMs)*time.Millisecond, logger),
+		queue.WithVersionHeader(version))
 	composedHandler = queue.ForwardedShimHandler(composedHandler)
 	composedHandler = handler.NewTimeoutHandler(composedHandler, "request timeout", func(r *http.Request) (time.Duration, time.Duration, time.Duration) {
 		return timeout, responseStartTimeout, idleTimeout
@@ -84,6 +109,8 @@ func mainHandler(
 		composedHandler = tracing.HTTPSpanMiddleware(composedHandler)
 	}
 
+	composedHandler = queue.RequestIDHandler(env.RequestIDHeader, composedHandler)
+	composedHandler = queue.HTTP10Handler(env.RejectHTTP10, composedHandler)
 	composedHandler = withFullDuplex(composedHandler, env.EnableHTTPFullDuplex, logger)
 
 	drainer := &pkghandler.Drainer{
@@ -93,18 +120,20 @@ func mainHandler(
 		Inner:                 composedHandler,
 		HealthCheck:           health.ProbeHandler(prober, tracingEnabled),
 	}
-	composedHandler = drainer
+	drainReadiness := queue.NewDrainReadiness(drainer, env.DrainReadinessPath, prober)
+	composedHandler = drainReadiness
 
 	if env.ServingEnableRequestLog {
 		// We want to capture the probes/healthchecks in the request logs.
 		// Hence we need to have RequestLogHandler be the first one.
 		composedHandler = requestLogHandler(logger, composedHandler, env)
 	}
-	return composedHandler, drainer
+	return composedHandler, drainReadiness
 }
 
-func adminHandler(ctx context.Context, logger *zap.SugaredLogger, drainer *pkghandler.Drainer) http.Handler {
+func adminHandler(ctx context.Context, logger *zap.SugaredLogger, drainer *queue.DrainReadiness, drainPath string, selfHealthCheck func(context.Context) error) http.Handler {
 	mux := http.NewServeMux()
+	mux.Handle(queue.RequestQueueSelfHealthPath, health.SelfHealthHandler(selfHealthCheck, selfHealthTimeout))
 	mux.HandleFunc(queue.RequestQueueDrainPath, func(w http.ResponseWriter, r *http.Request) {
 		logger.Info("Attached drain handler from user-container", r)
 
@@ -123,10 +152,35 @@ func adminHandler(ctx context.Context, logger *zap.SugaredLogger, drainer *pkgha
 		drainer.Drain()
 		w.WriteHeader(http.StatusOK)
 	})
+	if drainPath != "" {
+		mux.Handle(drainPath, drainer.DrainHandler(logger))
+	}
 
 	return mux
 }
 
+// selfHealthCheck returns a check sending a network probe over a new
+// connection to the main server listening on port. The probe is answered by
+// the handler chain of the queue-proxy without reaching the user-container, so
+// any response, even a 503 while draining, shows the server is responsive.
+func selfHealthCheck(port string) func(context.Context) error {
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	target := "http://" + net.JoinHostPort("127.0.0.1", port)
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(pkgnet.ProbeHeaderName, pkgnet.ProbeHeaderValue)
+		req.Header.Set(pkgnet.HashHeaderName, queue.Name)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+}
+
 func withFullDuplex(h http.Handler, enableFullDuplex bool, logger *zap.SugaredLogger) http.Handler {
 	if !enableFullDuplex {
 		return h
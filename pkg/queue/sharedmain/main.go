@@ -21,6 +21,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
@@ -61,6 +62,28 @@ const (
 	// from its configuration and propagate that to all loadbalancers and nodes.
 	drainSleepDuration = 30 * time.Second
 
+	// memoryPressurePeriod is how often the memory usage is checked when
+	// memory pressure shedding is enabled.
+	memoryPressurePeriod = time.Second
+
+	// selfHealthTimeout is how long the main server is given to answer the
+	// self-health checks of the queue-proxy.
+	selfHealthTimeout = time.Second
+
+	// upstreamProtocolProbePeriod is how often the protocol of the user
+	// container is probed until it is detected, and upstreamProtocolProbeTimeout
+	// how long each probe waits for an answer.
+	upstreamProtocolProbePeriod  = 100 * time.Millisecond
+	upstreamProtocolProbeTimeout = time.Second
+
+	// prewarmTimeout is how long prewarming the user container may take once
+	// it became ready.
+	prewarmTimeout = 5 * time.Second
+
+	// dependencyHealthCheckTimeout is how long the dependency health check
+	// waits for the dependency as part of each readiness probe.
+	dependencyHealthCheckTimeout = time.Second
+
 	// certPath is the path for the server certificate mounted by queue-proxy.
 	certPath = queue.CertDirectory + "/" + certificates.CertName
 
@@ -87,9 +110,70 @@ type config struct {
 	ServingReadinessProbe               string `split_words:"true"` // optional
 	EnableProfiling                     bool   `split_words:"true"` // optional
 	// See https://github.com/knative/serving/issues/12387
-	EnableHTTPFullDuplex       bool `split_words:"true"`                      // optional
-	EnableHTTP2AutoDetection   bool `envconfig:"ENABLE_HTTP2_AUTO_DETECTION"` // optional
-	EnableMultiContainerProbes bool `split_words:"true"`
+	EnableHTTPFullDuplex         bool  `split_words:"true"`                      // optional
+	EnableHTTP2AutoDetection     bool  `envconfig:"ENABLE_HTTP2_AUTO_DETECTION"` // optional
+	EnableMultiContainerProbes   bool  `split_words:"true"`
+	SuppressOverloadDetails      bool  `split_words:"true"` // optional
+	QueueFullStatusCode          int   `split_words:"true"` // optional
+	MaxResponseHeaders           int   `split_words:"true"` // optional
+	MaxUpstreamConnections       int   `split_words:"true"` // optional
+	H2MaxConcurrentStreams       int   `split_words:"true"` // optional
+	MaxRequestBodyBytes          int64 `split_words:"true"` // optional
+	SlowRequestThresholdMs       int   `split_words:"true"` // optional
+	ResponseHeaderTimeoutSeconds int   `split_words:"true"` // optional
+	VersionHeader                bool  `split_words:"true"` // optional
+	CountProbeRequests           bool  `split_words:"true"` // optional
+	ReportResponseClasses        bool  `split_words:"true"` // optional
+	ReportBreakerParams          bool  `split_words:"true"` // optional
+	UpstreamProtocolDetection    bool  `split_words:"true"` // optional
+
+	// Queue full response, see queue.WithQueueFullResponse
+	QueueFullRetryAfterSeconds int    `split_words:"true"` // optional
+	QueueFullBody              string `split_words:"true"` // optional
+
+	// How long to wait on shutdown for the requests executing in the breaker,
+	// see queue.Breaker.Drain
+	BreakerDrainTimeoutSeconds int `split_words:"true"` // optional
+
+	// Per-revision overload response, see queue.WithOverloadResponse
+	OverloadStatusCode int    `split_words:"true"` // optional
+	OverloadBody       string `split_words:"true"` // optional
+
+	// Per-revision maintenance response, see queue.WithMaintenanceResponse
+	Maintenance           bool   `split_words:"true"` // optional
+	MaintenanceStatusCode int    `split_words:"true"` // optional
+	MaintenanceBody       string `split_words:"true"` // optional
+
+	// The header identifying the requests proxied by the activator
+	ActivatorProxyHeaderName  string `split_words:"true" default:"K-Proxy-Request"` // optional
+	ActivatorProxyHeaderValue string `split_words:"true" default:"activator"`       // optional
+
+	// The header carrying the request ID, see queue.RequestIDHandler
+	RequestIDHeader string `split_words:"true"` // optional
+
+	// Per-client concurrency limit, see queue.WithClientConcurrencyLimit
+	ClientConcurrencyLimit int    `split_words:"true"` // optional
+	ClientKeyHeader        string `split_words:"true"` // optional
+
+	// Whether HTTP/1.0 requests are rejected, see queue.HTTP10Handler
+	RejectHTTP10 bool `envconfig:"REJECT_HTTP10"` // optional
+
+	// Prewarming of the user container once it becomes ready, see queue.NewPrewarmer
+	Prewarm     bool   `split_words:"true"` // optional
+	PrewarmPath string `split_words:"true"` // optional
+
+	// The path answering not ready once draining, see queue.NewDrainReadiness
+	DrainReadinessPath string `split_words:"true"` // optional
+
+	// The admin path initiating the drain, see queue.DrainReadiness.DrainHandler
+	DrainPath string `split_words:"true"` // optional
+
+	// A dependency checked as part of the readiness, see readiness.NewDependencyCheck
+	DependencyHealthCheck string `split_words:"true"` // optional
+
+	// Memory pressure shedding configuration, in bytes
+	MemorySheddingHighWaterMark int64 `split_words:"true"` // optional
+	MemorySheddingLowWaterMark  int64 `split_words:"true"` // optional
 
 	// Logging configuration
 	ServingLoggingConfig         string `split_words:"true" required:"true"`
@@ -191,7 +275,13 @@ func Main(opts ...Option) error {
 		zap.String(logkey.Pod, env.ServingPod))
 
 	d.Logger = logger
-	d.Transport = buildTransport(env)
+
+	var upstream *queue.UpstreamProtocol
+	if env.UpstreamProtocolDetection {
+		upstream = queue.NewUpstreamProtocol(net.JoinHostPort("127.0.0.1", env.UserPort), upstreamProtocolProbeTimeout)
+		go upstream.Run(d.Ctx, upstreamProtocolProbePeriod, logger)
+	}
+	d.Transport = buildTransport(env, upstream)
 
 	if env.TracingConfigBackend != tracingconfig.None {
 		oct := tracing.NewOpenCensusTracer(tracing.WithExporterFull(env.ServingPod, env.ServingPodIP, logger))
@@ -218,10 +308,14 @@ func Main(opts ...Option) error {
 	defer reportTicker.Stop()
 
 	stats := netstats.NewRequestStats(time.Now())
+	var responseClasses *queue.ResponseClassStats
+	if env.ReportResponseClasses {
+		responseClasses = queue.NewResponseClassStats()
+	}
 	go func() {
 		for now := range reportTicker.C {
 			stat := stats.Report(now)
-			protoStatReporter.Report(stat)
+			protoStatReporter.ReportWithResponseClasses(stat, responseClasses.Report())
 		}
 	}()
 
@@ -230,12 +324,24 @@ func Main(opts ...Option) error {
 	if env.ServingReadinessProbe != "" {
 		probe = buildProbe(logger, env.ServingReadinessProbe, env.EnableHTTP2AutoDetection, env.EnableMultiContainerProbes).ProbeContainer
 	}
+	if env.DependencyHealthCheck != "" {
+		dependency, err := readiness.NewDependencyCheck(env.DependencyHealthCheck, dependencyHealthCheckTimeout)
+		if err != nil {
+			logger.Fatalw("Invalid dependency health check", zap.Error(err))
+		}
+		probe = dependency.Wrap(probe)
+	}
+	if env.Prewarm {
+		prewarmer := queue.NewPrewarmer(net.JoinHostPort("127.0.0.1", env.UserPort), env.PrewarmPath, d.Transport, prewarmTimeout, logger)
+		probe = prewarmer.Wrap(probe)
+	}
 
 	// Enable TLS when certificate is mounted.
 	tlsEnabled := exists(logger, certPath) && exists(logger, keyPath)
 
-	mainHandler, drainer := mainHandler(d.Ctx, env, d.Transport, probe, stats, logger)
-	adminHandler := adminHandler(d.Ctx, logger, drainer)
+	breaker := buildBreaker(logger, env)
+	mainHandler, drainer := mainHandler(d.Ctx, env, d.Transport, breaker, probe, stats, responseClasses, logger)
+	adminHandler := adminHandler(d.Ctx, logger, drainer, env.DrainPath, selfHealthCheck(env.QueueServingPort))
 
 	// Enable TLS server when activator server certs are mounted.
 	// At this moment activator with TLS does not disable HTTP.
@@ -305,6 +411,7 @@ func Main(opts ...Option) error {
 		logger.Info("Received TERM signal, attempting to gracefully shutdown servers.")
 		logger.Infof("Sleeping %v to allow K8s propagation of non-ready state", drainSleepDuration)
 		drainer.Drain()
+		drainBreaker(logger, breaker, env)
 
 		for name, srv := range httpServers {
 			logger.Info("Shutting down server: ", name)
@@ -324,6 +431,22 @@ func Main(opts ...Option) error {
 	return nil
 }
 
+// drainBreaker rejects the requests queued in the breaker and waits up to the
+// configured timeout for the executing ones to complete.
+func drainBreaker(logger *zap.SugaredLogger, breaker *queue.Breaker, env config) {
+	if breaker == nil || env.BreakerDrainTimeoutSeconds <= 0 {
+		return
+	}
+	timeout := time.Duration(env.BreakerDrainTimeoutSeconds) * time.Second
+	logger.Infof("Draining the breaker for up to %v", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := breaker.Drain(ctx); err != nil {
+		logger.Warnw("Requests still in flight after draining the breaker",
+			zap.Int("inFlight", breaker.InFlight()), zap.Error(err))
+	}
+}
+
 func exists(logger *zap.SugaredLogger, filename string) bool {
 	_, err := os.Stat(filename)
 	if err != nil && !os.IsNotExist(err) {
@@ -343,13 +466,21 @@ func buildProbe(logger *zap.SugaredLogger, encodedProbe string, autodetectHTTP2
 	return readiness.NewProbe(coreProbes)
 }
 
-func buildTransport(env config) http.RoundTripper {
+func buildTransport(env config, upstream *queue.UpstreamProtocol) http.RoundTripper {
 	maxIdleConns := 1000 // TODO: somewhat arbitrary value for CC=0, needs experimental validation.
 	if env.ContainerConcurrency > 0 {
 		maxIdleConns = env.ContainerConcurrency
 	}
 	// set max-idle and max-idle-per-host to same value since we're always proxying to the same host.
 	transport := pkgnet.NewProxyAutoTransport(maxIdleConns /* max-idle */, maxIdleConns /* max-idle-per-host */)
+	transport = queue.LimitH2CStreams(transport, env.H2MaxConcurrentStreams)
+	if upstream != nil {
+		// Use the detected protocol of the user container rather than the
+		// protocol of the incoming request.
+		transport = upstream.Transport(transport)
+	}
+	transport = queue.TimeoutResponseHeaders(transport, time.Duration(env.ResponseHeaderTimeoutSeconds)*time.Second)
+	transport = queue.LimitUpstreamConnections(transport, env.MaxUpstreamConnections)
 
 	if env.TracingConfigBackend == tracingconfig.None {
 		return transport
@@ -378,6 +509,36 @@ func buildBreaker(logger *zap.SugaredLogger, env config) *queue.Breaker {
 	return queue.NewBreaker(params)
 }
 
+func buildMemoryPressure(ctx context.Context, logger *zap.SugaredLogger, env config) *queue.MemoryPressure {
+	if env.MemorySheddingHighWaterMark <= 0 {
+		return nil
+	}
+
+	m := queue.NewMemoryPressure(env.MemorySheddingHighWaterMark, env.MemorySheddingLowWaterMark, queue.CgroupMemoryUsage)
+	logger.Infof("Queue container sheds requests once its memory usage reaches %d bytes", env.MemorySheddingHighWaterMark)
+	go m.Run(ctx.Done(), memoryPressurePeriod, logger)
+	return m
+}
+
+// reportBreakerParams makes the breaker report its effective parameters, as
+// metrics too if they are supported.
+func reportBreakerParams(logger *zap.SugaredLogger, breaker *queue.Breaker, metricsSupported bool, env config) {
+	if breaker == nil || !env.ReportBreakerParams {
+		return
+	}
+	reporter := queue.NewBreakerParamsLogger(logger)
+	if metricsSupported {
+		r, err := queue.NewBreakerParamsReporter(logger, env.ServingNamespace,
+			env.ServingService, env.ServingConfiguration, env.ServingRevision, env.ServingPod)
+		if err != nil {
+			logger.Errorw("Error setting up breaker params reporter. Breaker metrics will be unavailable.", zap.Error(err))
+		} else {
+			reporter = r
+		}
+	}
+	breaker.ReportParams(reporter.Report)
+}
+
 func supportsMetrics(ctx context.Context, logger *zap.SugaredLogger, env config) bool {
 	// Setup request metrics reporting for end-user metrics.
 	if env.ServingRequestMetricsBackend == "" {
@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	pkgnet "knative.dev/pkg/network"
+)
+
+// LimitUpstreamConnections wraps the given RoundTripper so that at most
+// maxConns requests use a connection to the upstream at the same time. A
+// connection slot is held from the start of the round trip until the response
+// body is closed or fully read. This bounds the simultaneous connections to
+// the user container independently of the breaker, which might admit more
+// requests than the container can accept connections for. A non-positive
+// maxConns returns the RoundTripper unchanged.
+func LimitUpstreamConnections(rt http.RoundTripper, maxConns int) http.RoundTripper {
+	if maxConns <= 0 {
+		return rt
+	}
+	return &connLimitingTransport{
+		base:  rt,
+		slots: make(chan struct{}, maxConns),
+	}
+}
+
+type connLimitingTransport struct {
+	base  http.RoundTripper
+	slots chan struct{}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *connLimitingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	select {
+	case t.slots <- struct{}{}:
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() { <-t.slots })
+	}
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	body := &releasingBody{ReadCloser: resp.Body, release: release}
+	if rw, ok := resp.Body.(io.ReadWriteCloser); ok {
+		// Keep upgraded connections (e.g. websockets) writable for the proxy.
+		resp.Body = &releasingReadWriteBody{releasingBody: body, w: rw}
+	} else {
+		resp.Body = body
+	}
+	return resp, nil
+}
+
+// releasingBody releases the connection slot once the body is exhausted or closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+type releasingReadWriteBody struct {
+	*releasingBody
+	w io.Writer
+}
+
+func (b *releasingReadWriteBody) Write(p []byte) (int, error) {
+	return b.w.Write(p)
+}
+
+// LimitH2CStreams wraps the given RoundTripper, which is expected to select
+// h2c or HTTP/1.1 by the request's ProtoMajor like
+// pkgnet.NewProxyAutoTransport does, so that at most maxStreams HTTP/2
+// requests are in flight at the same time. As the queue proxy always talks to
+// the same upstream, which the h2c transport multiplexes over a single
+// connection, this is the maximum number of concurrent streams on that
+// connection. A stream is held until the response body is closed or fully
+// read, and HTTP/1.1 requests aren't limited. A non-positive maxStreams
+// returns the RoundTripper unchanged.
+func LimitH2CStreams(rt http.RoundTripper, maxStreams int) http.RoundTripper {
+	if maxStreams <= 0 {
+		return rt
+	}
+	streams := LimitUpstreamConnections(rt, maxStreams)
+	return pkgnet.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if r.ProtoMajor == 2 {
+			return streams.RoundTrip(r)
+		}
+		return rt.RoundTrip(r)
+	})
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	pkgnet "knative.dev/pkg/network"
+)
+
+func TestLimitUpstreamConnections(t *testing.T) {
+	const (
+		maxConns = 3
+		requests = 20
+	)
+
+	var inFlight, maxInFlight atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Inc()
+		defer inFlight.Dec()
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = requests
+	client := &http.Client{Transport: LimitUpstreamConnections(transport, maxConns)}
+
+	var wg sync.WaitGroup
+	wg.Add(requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(backend.URL)
+			if err != nil {
+				t.Error("Get() =", err)
+				return
+			}
+			defer resp.Body.Close()
+			if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "ok" {
+				t.Errorf("Body = %q, %v, want %q", body, err, "ok")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := maxInFlight.Load(); got > maxConns {
+		t.Errorf("Upstream saw %d concurrent connections, want at most %d", got, maxConns)
+	}
+}
+
+func TestLimitUpstreamConnectionsContextDone(t *testing.T) {
+	blocked, release := make(chan struct{}), make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			close(blocked)
+			<-release
+		}
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	rt := LimitUpstreamConnections(http.DefaultTransport, 1)
+
+	// Occupy the only connection slot.
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, backend.URL+"/block", nil)
+		if resp, err := rt.RoundTrip(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-blocked
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, backend.URL, nil)
+	if _, err := rt.RoundTrip(req); err == nil {
+		t.Error("RoundTrip() succeeded, want the wait for a connection slot to time out")
+	}
+}
+
+func TestLimitUpstreamConnectionsUnlimited(t *testing.T) {
+	if got, want := LimitUpstreamConnections(http.DefaultTransport, 0), http.DefaultTransport; got != want {
+		t.Errorf("LimitUpstreamConnections() = %v, want the base transport", got)
+	}
+}
+
+func TestLimitH2CStreams(t *testing.T) {
+	const (
+		maxStreams = 3
+		requests   = 20
+	)
+
+	var inFlight, maxInFlight atomic.Int32
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("Upstream received HTTP/%d, want HTTP/2", r.ProtoMajor)
+		}
+		n := inFlight.Inc()
+		defer inFlight.Dec()
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	rt := LimitH2CStreams(pkgnet.NewProxyAutoTransport(requests, requests), maxStreams)
+
+	var wg sync.WaitGroup
+	wg.Add(requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, backend.URL, nil)
+			req.ProtoMajor, req.ProtoMinor = 2, 0
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Error("RoundTrip() =", err)
+				return
+			}
+			defer resp.Body.Close()
+			if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "ok" {
+				t.Errorf("Body = %q, %v, want %q", body, err, "ok")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := maxInFlight.Load(); got > maxStreams {
+		t.Errorf("Upstream saw %d concurrent streams, want at most %d", got, maxStreams)
+	}
+}
+
+func TestLimitH2CStreamsUnlimited(t *testing.T) {
+	if got, want := LimitH2CStreams(http.DefaultTransport, 0), http.DefaultTransport; got != want {
+		t.Errorf("LimitH2CStreams() = %v, want the base transport", got)
+	}
+}
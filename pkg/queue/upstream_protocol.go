@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	pkgnet "knative.dev/pkg/network"
+)
+
+// UpstreamProtocol detects whether the user container speaks h2c or
+// HTTP/1.1, so that requests can be proxied to it with the protocol it
+// supports rather than the one they came in with.
+type UpstreamProtocol struct {
+	url     string
+	timeout time.Duration
+	h2c     http.RoundTripper
+	h1      http.RoundTripper
+
+	// protoMajor is the detected major protocol version, zero until the
+	// detection succeeded.
+	protoMajor atomic.Int32
+}
+
+// NewUpstreamProtocol creates an UpstreamProtocol probing the user container
+// at the given address, waiting at most timeout for each probe.
+func NewUpstreamProtocol(address string, timeout time.Duration) *UpstreamProtocol {
+	var d net.Dialer
+	return &UpstreamProtocol{
+		url:     "http://" + address,
+		timeout: timeout,
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+		h1: &http.Transport{DisableKeepAlives: true, DialContext: d.DialContext},
+	}
+}
+
+// ProtoMajor returns the detected major protocol version of the user
+// container, or zero if it is not known yet.
+func (u *UpstreamProtocol) ProtoMajor() int {
+	return int(u.protoMajor.Load())
+}
+
+// Detect probes the user container with h2c prior knowledge first, and with
+// HTTP/1.1 if that fails. Any response counts as support of the protocol.
+// The detected version is returned and remembered. An error is returned if
+// the container answered neither, e.g. because it isn't listening yet.
+func (u *UpstreamProtocol) Detect(ctx context.Context) (int, error) {
+	h2cErr := u.probe(ctx, u.h2c)
+	if h2cErr == nil {
+		u.protoMajor.Store(2)
+		return 2, nil
+	}
+	if err := u.probe(ctx, u.h1); err != nil {
+		return 0, fmt.Errorf("upstream answered neither h2c (%v) nor HTTP/1.1: %w", h2cErr, err)
+	}
+	u.protoMajor.Store(1)
+	return 1, nil
+}
+
+func (u *UpstreamProtocol) probe(ctx context.Context, rt http.RoundTripper) error {
+	ctx, cancel := context.WithTimeout(ctx, u.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodOptions, u.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// Run retries the detection every period until it succeeds or the context is
+// done.
+func (u *UpstreamProtocol) Run(ctx context.Context, period time.Duration, logger *zap.SugaredLogger) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		protoMajor, err := u.Detect(ctx)
+		if err == nil {
+			logger.Infof("Detected upstream protocol HTTP/%d", protoMajor)
+			return
+		}
+		logger.Debugw("Failed to detect the upstream protocol", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Transport wraps the given RoundTripper, which is expected to select h2c or
+// HTTP/1.1 by the request's ProtoMajor like pkgnet.NewProxyAutoTransport does,
+// so that requests are sent with the detected protocol. Until the protocol is
+// detected, and for upgrade requests like websockets, HTTP/1.1 is used.
+func (u *UpstreamProtocol) Transport(rt http.RoundTripper) http.RoundTripper {
+	return pkgnet.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		protoMajor := u.ProtoMajor()
+		if protoMajor != 2 || r.Header.Get("Upgrade") != "" {
+			protoMajor = 1
+		}
+
+		// Restore the request & response HTTP version before returning.
+		version := r.ProtoMajor
+		r.ProtoMajor = protoMajor
+		resp, err := rt.RoundTrip(r)
+		r.ProtoMajor = version
+		if resp != nil {
+			resp.ProtoMajor = version
+		}
+		return resp, err
+	})
+}
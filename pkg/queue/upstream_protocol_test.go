@@ -0,0 +1,141 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	pkgnet "knative.dev/pkg/network"
+)
+
+// protoHandler answers with the protocol of the request.
+var protoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Proto", r.Proto)
+})
+
+// newH2COnlyServer starts a server which only speaks h2c with prior knowledge.
+func newH2COnlyServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Listen() =", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go (&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{Handler: protoHandler})
+		}
+	}()
+	return l.Addr().String()
+}
+
+func newH1OnlyServer(t *testing.T) string {
+	s := httptest.NewServer(protoHandler)
+	t.Cleanup(s.Close)
+	return s.Listener.Addr().String()
+}
+
+func TestUpstreamProtocolDetect(t *testing.T) {
+	tests := []struct {
+		name      string
+		upstream  func(*testing.T) string
+		wantProto int
+	}{{
+		name:      "h2c only",
+		upstream:  newH2COnlyServer,
+		wantProto: 2,
+	}, {
+		name:      "h1 only",
+		upstream:  newH1OnlyServer,
+		wantProto: 1,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			u := NewUpstreamProtocol(tc.upstream(t), time.Second)
+			got, err := u.Detect(context.Background())
+			if err != nil {
+				t.Fatal("Detect() =", err)
+			}
+			if got != tc.wantProto {
+				t.Errorf("Detect() = %d, want %d", got, tc.wantProto)
+			}
+			if got := u.ProtoMajor(); got != tc.wantProto {
+				t.Errorf("ProtoMajor() = %d, want %d", got, tc.wantProto)
+			}
+
+			// Incoming HTTP/1.1 requests are proxied with the detected protocol.
+			client := &http.Client{Transport: u.Transport(pkgnet.NewProxyAutoTransport(1, 1))}
+			resp, err := client.Get(u.url)
+			if err != nil {
+				t.Fatal("Get() =", err)
+			}
+			resp.Body.Close()
+			if got, want := resp.Header.Get("X-Proto"), map[int]string{1: "HTTP/1.1", 2: "HTTP/2.0"}[tc.wantProto]; got != want {
+				t.Errorf("Upstream protocol = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestUpstreamProtocolNotListening(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Listen() =", err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	u := NewUpstreamProtocol(address, time.Second)
+	if got, err := u.Detect(context.Background()); err == nil {
+		t.Fatalf("Detect() = %d, want an error", got)
+	}
+	if got := u.ProtoMajor(); got != 0 {
+		t.Errorf("ProtoMajor() = %d, want 0", got)
+	}
+}
+
+func TestUpstreamProtocolFallback(t *testing.T) {
+	// Until the protocol is detected, HTTP/1.1 is used even for HTTP/2
+	// requests.
+	u := NewUpstreamProtocol(newH1OnlyServer(t), time.Second)
+	client := &http.Client{Transport: u.Transport(pkgnet.NewProxyAutoTransport(1, 1))}
+
+	req, err := http.NewRequest(http.MethodGet, u.url, nil)
+	if err != nil {
+		t.Fatal("NewRequest() =", err)
+	}
+	req.ProtoMajor = 2
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal("Do() =", err)
+	}
+	resp.Body.Close()
+	if got, want := resp.Header.Get("X-Proto"), "HTTP/1.1"; got != want {
+		t.Errorf("Upstream protocol = %q, want %q", got, want)
+	}
+}
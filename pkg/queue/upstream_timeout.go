@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	pkgnet "knative.dev/pkg/network"
+)
+
+// ErrResponseHeaderTimeout is the error of the round trips to the upstream
+// which didn't receive the response headers within the timeout of
+// TimeoutResponseHeaders.
+var ErrResponseHeaderTimeout = errors.New("timeout awaiting response headers from the user container")
+
+// TimeoutResponseHeaders wraps the given RoundTripper so that the round trips
+// not receiving the response headers from the upstream within timeout are
+// cancelled and fail with ErrResponseHeaderTimeout. Unlike
+// http.Transport.ResponseHeaderTimeout, this also applies to the h2c
+// transport. The response body isn't subject to the timeout. A non-positive
+// timeout returns the RoundTripper unchanged.
+func TimeoutResponseHeaders(rt http.RoundTripper, timeout time.Duration) http.RoundTripper {
+	if timeout <= 0 {
+		return rt
+	}
+	return pkgnet.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		ctx, cancel := context.WithCancel(r.Context())
+		timer := time.AfterFunc(timeout, cancel)
+
+		resp, err := rt.RoundTrip(r.WithContext(ctx))
+		if !timer.Stop() {
+			if err == nil {
+				resp.Body.Close()
+			}
+			cancel()
+			return nil, ErrResponseHeaderTimeout
+		}
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		// The context of the round trip must outlive it until the body is
+		// done with.
+		body := &releasingBody{ReadCloser: resp.Body, release: cancel}
+		if rw, ok := resp.Body.(io.ReadWriteCloser); ok {
+			resp.Body = &releasingReadWriteBody{releasingBody: body, w: rw}
+		} else {
+			resp.Body = body
+		}
+		return resp, nil
+	})
+}
+
+// ResponseHeaderTimeoutErrorHandler wraps the error handler of a reverse
+// proxy to answer the requests which failed with ErrResponseHeaderTimeout
+// with a 504, passing all other errors to next.
+func ResponseHeaderTimeoutErrorHandler(next func(http.ResponseWriter, *http.Request, error)) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(err, ErrResponseHeaderTimeout) {
+			http.Error(w, ErrResponseHeaderTimeout.Error(), http.StatusGatewayTimeout)
+			return
+		}
+		next(w, r, err)
+	}
+}
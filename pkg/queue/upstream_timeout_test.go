@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+
+	netstats "knative.dev/networking/pkg/http/stats"
+)
+
+func TestTimeoutResponseHeaders(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow-headers":
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		case "/slow-body":
+			// The headers are sent in time, only the body takes longer.
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(2 * timeout)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	target, _ := url.Parse(backend.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = TimeoutResponseHeaders(http.DefaultTransport, timeout)
+	proxy.ErrorHandler = ResponseHeaderTimeoutErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		t.Error("Unexpected proxy error:", err)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	breaker := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+	h := ProxyHandler(breaker, netstats.NewRequestStats(time.Now()), false /*tracingEnabled*/, proxy)
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "http://example.com/slow-headers", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Code = %d, want: %d", rec.Code, http.StatusGatewayTimeout)
+	}
+	// The breaker slot is released.
+	if got := breaker.InFlight(); got != 0 {
+		t.Errorf("InFlight() = %d, want 0", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "http://example.com/slow-body", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("Code = %d and body = %q, want: %d and %q", rec.Code, rec.Body.String(), http.StatusOK, "ok")
+	}
+}
+
+func TestTimeoutResponseHeadersDisabled(t *testing.T) {
+	if got, want := TimeoutResponseHeaders(http.DefaultTransport, 0), http.DefaultTransport; got != want {
+		t.Errorf("TimeoutResponseHeaders() = %v, want the base transport", got)
+	}
+}
@@ -197,6 +197,7 @@ func (c *Reconciler) ObserveDeletion(ctx context.Context, key types.NamespacedNa
 
 func (c *Reconciler) reconcileDecider(ctx context.Context, pa *autoscalingv1alpha1.PodAutoscaler) (*scaling.Decider, error) {
 	desiredDecider := resources.MakeDecider(pa, config.FromContext(ctx).Autoscaler)
+	desiredDecider.Spec.TargetBurstCapacity = resolveTBC(ctx, pa)
 	decider, err := c.deciders.Get(ctx, desiredDecider.Namespace, desiredDecider.Name)
 	if errors.IsNotFound(err) {
 		decider, err = c.deciders.Create(ctx, desiredDecider)
@@ -327,6 +328,9 @@ func resolveScrapeTarget(ctx context.Context, pa *autoscalingv1alpha1.PodAutosca
 }
 
 func resolveTBC(ctx context.Context, pa *autoscalingv1alpha1.PodAutoscaler) float64 {
+	if config.FromContext(ctx).Deployment.ForcesActivator(pa.Labels) {
+		return -1
+	}
 	if v, ok := pa.TargetBC(); ok {
 		return v
 	}
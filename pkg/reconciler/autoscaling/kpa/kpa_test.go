@@ -51,6 +51,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -1915,6 +1916,55 @@ func TestResolveScrapeTarget(t *testing.T) {
 	}
 }
 
+func TestResolveTBCForcedActivator(t *testing.T) {
+	selector, err := labels.Parse("gpu=true")
+	if err != nil {
+		t.Fatal("labels.Parse() =", err)
+	}
+	tc := &testConfigStore{config: defaultConfig()}
+	tc.config.Deployment.ForceActivatorSelector = selector
+	ctx := tc.ToContext(context.Background())
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		tbc    string
+		want   float64
+	}{{
+		name:   "matching revision",
+		labels: map[string]string{"gpu": "true"},
+		want:   -1,
+	}, {
+		name:   "matching revision overrides annotation",
+		labels: map[string]string{"gpu": "true"},
+		tbc:    "10",
+		want:   -1,
+	}, {
+		name:   "non-matching revision",
+		labels: map[string]string{"gpu": "false"},
+		want:   tc.config.Autoscaler.TargetBurstCapacity,
+	}, {
+		name: "non-matching revision with annotation",
+		tbc:  "10",
+		want: 10,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pa := kpa(testNamespace, testRevision)
+			for k, v := range test.labels {
+				pa.Labels[k] = v
+			}
+			if test.tbc != "" {
+				pa.Annotations[autoscaling.TargetBurstCapacityKey] = test.tbc
+			}
+			if got := resolveTBC(ctx, pa); got != test.want {
+				t.Errorf("resolveTBC() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
 func withInitialScale(initScale int) PodAutoscalerOption {
 	return func(pa *autoscalingv1alpha1.PodAutoscaler) {
 		pa.Annotations = kmeta.UnionMaps(
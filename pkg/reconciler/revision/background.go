@@ -18,23 +18,46 @@ package revision
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn/k8schain"
+	"github.com/google/go-containerregistry/pkg/name"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 )
 
 // imageResolver is an interface used mostly to mock digestResolver for tests.
 type imageResolver interface {
 	Resolve(ctx context.Context, image string, opt k8schain.Options, registriesToSkip sets.Set[string]) (string, error)
+	Labels(ctx context.Context, image string, opt k8schain.Options) (map[string]string, error)
+	CheckLayers(ctx context.Context, image string, opt k8schain.Options) error
 }
 
+// batchImageResolver is implemented by the imageResolvers able to resolve
+// several images of a registry with a single request.
+type batchImageResolver interface {
+	ResolveBatch(ctx context.Context, registry string, images []string, opt k8schain.Options) (map[string]string, error)
+}
+
+// batchWindow is how long the images of a batch-capable registry wait for
+// others to be resolved along with them.
+const batchWindow = 50 * time.Millisecond
+
+// notFoundTTL is how long an image reported missing by its registry is
+// remembered, so that resolving it again fails fast rather than hitting the
+// registry, while it is still re-checked in case the image gets pushed.
+const notFoundTTL = 30 * time.Second
+
 // backgroundResolver performs background downloads of image digests.
 type backgroundResolver struct {
 	logger *zap.SugaredLogger
@@ -44,31 +67,175 @@ type backgroundResolver struct {
 
 	queue workqueue.RateLimitingInterface
 
+	// namespaceConcurrency, if set and positive, is the maximum number of
+	// images of the revisions of a single namespace resolved in parallel, so
+	// that a rollout storm in one namespace cannot take up all the workers.
+	namespaceConcurrency *atomic.Int32
+
+	// registryTimeouts, if set, maps registry host prefixes to the timeout
+	// of the resolutions of their images, in place of the timeout given to
+	// Resolve. The longest matching prefix wins.
+	registryTimeouts *atomic.Pointer[map[string]time.Duration]
+
+	// batchRegistries, if set, holds the registries whose images are resolved
+	// in batches, if the resolver is a batchImageResolver. The images of the
+	// same registry and credentials processed within batchWindow of each
+	// other are resolved with a single request.
+	batchRegistries *atomic.Pointer[sets.Set[string]]
+	batchWindow     time.Duration
+	batchMu         sync.Mutex
+	batches         map[batchKey]*resolveBatch
+
 	mu      sync.RWMutex
 	results map[types.NamespacedName]*resolveResult
+
+	// inFlight holds the queued or processing work items of each namespace,
+	// waiting the ones held back until a slot of their namespace frees up.
+	inFlight map[string]sets.Set[workItem]
+	waiting  map[string][]workItem
+
+	// notFound holds the errors of the images reported missing by their
+	// registry, until they expire after notFoundTTL.
+	clock       clock.PassiveClock
+	notFoundTTL time.Duration
+	notFound    map[imageKey]notFoundEntry
+
+	// digestCacheTTL, if set and positive, is how long the digest resolved for
+	// an image and credentials is reused by the revisions sharing them. The
+	// resolutions of the same image and credentials in flight at the same time
+	// are then coalesced into one.
+	digestCacheTTL *atomic.Duration
+	cacheMu        sync.Mutex
+	digests        map[imageKey]digestEntry
+	digestCalls    map[imageKey]*digestCall
+}
+
+// imageKey identifies an image resolved with the given credentials, as a
+// private image may only be missing to, or point at another digest for, the
+// ones lacking access to it.
+type imageKey struct {
+	namespace          string
+	serviceAccountName string
+	imagePullSecrets   string
+	image              string
+}
+
+type notFoundEntry struct {
+	err     error
+	expires time.Time
+}
+
+type digestEntry struct {
+	digest  string
+	expires time.Time
+}
+
+// digestCall is a resolution in flight. Its digest and err are set once done
+// is closed.
+type digestCall struct {
+	done chan struct{}
+
+	digest string
+	err    error
+}
+
+// batchKey identifies the images of a registry resolved with the given
+// credentials, which can be resolved in a single batch.
+type batchKey struct {
+	namespace          string
+	serviceAccountName string
+	imagePullSecrets   string
+	registry           string
+}
+
+// resolveBatch collects the images resolved with a single request. Its
+// digests and err are set once done is closed.
+type resolveBatch struct {
+	images sets.Set[string]
+	done   chan struct{}
+
+	digests map[string]string
+	err     error
+}
+
+func newImageKey(opt k8schain.Options, image string) imageKey {
+	// Several images may refer to the same tag, e.g. "ubuntu" and "ubuntu:latest".
+	if ref, err := name.ParseReference(image, name.WeakValidation); err == nil {
+		image = ref.Name()
+	}
+	return imageKey{
+		namespace:          opt.Namespace,
+		serviceAccountName: opt.ServiceAccountName,
+		imagePullSecrets:   strings.Join(opt.ImagePullSecrets, ","),
+		image:              image,
+	}
 }
 
 // resolveResult is the overall result for a particular revision. We create a
 // workItem for each container we need to resolve for the overall result.
 type resolveResult struct {
 	// these fields are immutable after creation, so can be accessed without a lock.
-	opt                k8schain.Options
-	registriesToSkip   sets.Set[string]
+	resolveOptions
 	completionCallback func()
 	workItems          []workItem
 
 	// these fields can be written concurrently, so should only be accessed while
 	// holding the backgroundResolver mutex.
 
+	// pending holds the work items which are not queued yet because the
+	// revision's resolution concurrency limit was reached.
+	pending []workItem
+
 	// imagesResolved is a map of container image to resolved image with digest.
 	imagesResolved map[string]string
 
+	// imageLabels is a map of container image to its labels which are exported.
+	imageLabels map[string]map[string]string
+
 	// imagesToBeResolved keeps unique image names so we can quickly compare with the current number of resolved ones
 	imagesToBeResolved sets.Set[string]
 
+	// queued holds when the resolution of each image was first dispatched,
+	// to measure its latency waiting in the queue included.
+	queued map[string]time.Time
+
 	err error
 }
 
+// resolveOptions are the settings of the resolution of the images of a
+// revision.
+type resolveOptions struct {
+	// opt are the credentials the images are resolved with.
+	opt k8schain.Options
+
+	// registriesToSkip are the registries whose images are not resolved.
+	registriesToSkip sets.Set[string]
+
+	// labelsToExport are the labels of the resolved images which are returned.
+	labelsToExport sets.Set[string]
+
+	// requiredLabels are the labels each image must carry, with their values.
+	// An image lacking one fails the resolution with a *missingImageLabelError.
+	requiredLabels map[string]string
+
+	// deniedLabels are the label values no image may carry. An image carrying
+	// one fails the resolution with a *deniedImageLabelError.
+	deniedLabels map[string]sets.Set[string]
+
+	// verifyLayers checks the existence of the layers of the resolved images
+	// as well. A missing one fails the resolution with a
+	// *missingImageLayerError.
+	verifyLayers bool
+
+	// timeout is the timeout of the resolution of each image.
+	timeout time.Duration
+
+	// maxConcurrency is the maximum number of the images of the revision
+	// resolved in parallel. A non-positive value resolves all of them in
+	// parallel.
+	maxConcurrency int
+}
+
 // workItem is a single task submitted to the queue, to resolve a single image
 // for a resolveResult.
 type workItem struct {
@@ -78,6 +245,41 @@ type workItem struct {
 	image string
 }
 
+// missingImageLabelError is returned when an image lacks one of the labels
+// required by the configuration, or carries a different value for it.
+type missingImageLabelError struct {
+	image string
+	label string
+	want  string
+}
+
+func (e *missingImageLabelError) Error() string {
+	return fmt.Sprintf("Image %q does not carry the required label %s=%q", e.image, e.label, e.want)
+}
+
+// deniedImageLabelError is returned when an image carries one of the label
+// values denied by the configuration.
+type deniedImageLabelError struct {
+	image string
+	label string
+	value string
+}
+
+func (e *deniedImageLabelError) Error() string {
+	return fmt.Sprintf("Image %q carries the denied label %s=%q", e.image, e.label, e.value)
+}
+
+// missingImageLayerError is returned when the manifest of an image references
+// a layer which does not exist in its registry.
+type missingImageLayerError struct {
+	image string
+	layer string
+}
+
+func (e *missingImageLayerError) Error() string {
+	return fmt.Sprintf("Image %q references the layer %s which is missing from the registry", e.image, e.layer)
+}
+
 func newBackgroundResolver(logger *zap.SugaredLogger, resolver imageResolver, queue workqueue.RateLimitingInterface, enqueue func(types.NamespacedName)) *backgroundResolver {
 	r := &backgroundResolver{
 		logger: logger,
@@ -87,6 +289,19 @@ func newBackgroundResolver(logger *zap.SugaredLogger, resolver imageResolver, qu
 
 		results: make(map[types.NamespacedName]*resolveResult),
 		queue:   queue,
+
+		inFlight: make(map[string]sets.Set[workItem]),
+		waiting:  make(map[string][]workItem),
+
+		batchWindow: batchWindow,
+		batches:     make(map[batchKey]*resolveBatch),
+
+		clock:       clock.RealClock{},
+		notFoundTTL: notFoundTTL,
+		notFound:    make(map[imageKey]notFoundEntry),
+
+		digests:     make(map[imageKey]digestEntry),
+		digestCalls: make(map[imageKey]*digestCall),
 	}
 
 	return r
@@ -140,10 +355,14 @@ func (r *backgroundResolver) Start(stop <-chan struct{}, maxInFlight int) (done
 // the resolver already has the digest in cache it is returned immediately, if
 // it does not and no resolution is already in flight a resolution is triggered
 // in the background.
-// If this method returns `nil, nil` this implies a resolve was triggered or is
+// If this method returns `nil, nil, nil` this implies a resolve was triggered or is
 // already in progress, so the reconciler should exit and wait for the revision
 // to be re-enqueued when the result is ready.
-func (r *backgroundResolver) Resolve(logger *zap.SugaredLogger, rev *v1.Revision, opt k8schain.Options, registriesToSkip sets.Set[string], timeout time.Duration) (initContainerStatuses []v1.ContainerStatus, statuses []v1.ContainerStatus, error error) {
+// The labels of the resolved images which are in opts.labelsToExport are
+// returned keyed by container name. A *missingImageLabelError is kept until the
+// revision is cleared or the required labels change, and likewise for a
+// *deniedImageLabelError and the denied labels.
+func (r *backgroundResolver) Resolve(logger *zap.SugaredLogger, rev *v1.Revision, opts resolveOptions) (initContainerStatuses []v1.ContainerStatus, statuses []v1.ContainerStatus, imageLabels map[string]map[string]string, error error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -153,21 +372,31 @@ func (r *backgroundResolver) Resolve(logger *zap.SugaredLogger, rev *v1.Revision
 	}
 
 	result, inFlight := r.results[name]
+	if inFlight && result.ready() && (!maps.Equal(result.requiredLabels, opts.requiredLabels) ||
+		!maps.EqualFunc(result.deniedLabels, opts.deniedLabels, sets.Set[string].Equal)) {
+		// The images need to be checked against the new required or denied labels.
+		delete(r.results, name)
+		inFlight = false
+	}
 	if !inFlight {
+		if err := r.cachedNotFound(rev, opts.opt); err != nil {
+			logger.Debugf("Resolve returned the cached not found error: %v", err)
+			return nil, nil, nil, err
+		}
 		logger.Debugf("Adding Resolve request to queue (depth: %d)", r.queue.Len())
-		r.addWorkItems(rev, name, opt, registriesToSkip, timeout)
-		return nil, nil, nil
+		r.addWorkItems(rev, name, opts)
+		return nil, nil, nil, nil
 	}
 
 	if !result.ready() {
-		logger.Debug("Resolve request in flight, returning nil, nil")
-		return nil, nil, nil
+		logger.Debug("Resolve request in flight, returning nil, nil, nil")
+		return nil, nil, nil, nil
 	}
 
 	ret := r.results[name]
 	if ret.err != nil {
 		logger.Debugf("Resolve returned the resolved error: %v", ret.err)
-		return nil, nil, ret.err
+		return nil, nil, nil, ret.err
 	}
 
 	initContainerStatuses = make([]v1.ContainerStatus, len(rev.Spec.InitContainers))
@@ -188,19 +417,62 @@ func (r *backgroundResolver) Resolve(logger *zap.SugaredLogger, rev *v1.Revision
 		}
 	}
 
+	for _, container := range append(rev.Spec.InitContainers, rev.Spec.Containers...) {
+		if labels := ret.imageLabels[container.Image]; len(labels) > 0 {
+			if imageLabels == nil {
+				imageLabels = make(map[string]map[string]string)
+			}
+			imageLabels[container.Name] = labels
+		}
+	}
+
 	logger.Debugf("Resolve returned %d resolved images for revision", len(statuses)+len(initContainerStatuses))
-	return initContainerStatuses, statuses, nil
+	return initContainerStatuses, statuses, imageLabels, nil
+}
+
+// cachedNotFound returns the error of the first image of the revision which
+// was recently reported missing by its registry, if any.
+// This is expected to be called with the mutex locked.
+func (r *backgroundResolver) cachedNotFound(rev *v1.Revision, opt k8schain.Options) error {
+	now := r.clock.Now()
+	for _, container := range append(rev.Spec.InitContainers, rev.Spec.Containers...) {
+		key := newImageKey(opt, container.Image)
+		entry, ok := r.notFound[key]
+		if !ok {
+			continue
+		}
+		if !now.Before(entry.expires) {
+			delete(r.notFound, key)
+			continue
+		}
+		return fmt.Errorf("%s: %w", v1.RevisionContainerMissingMessage(container.Image, "failed to resolve image to digest"), entry.err)
+	}
+	return nil
+}
+
+// rememberNotFound remembers that the image was reported missing by its
+// registry with the given error, dropping the expired entries.
+// This is expected to be called with the mutex locked.
+func (r *backgroundResolver) rememberNotFound(opt k8schain.Options, image string, err error) {
+	now := r.clock.Now()
+	for key, entry := range r.notFound {
+		if !now.Before(entry.expires) {
+			delete(r.notFound, key)
+		}
+	}
+	r.notFound[newImageKey(opt, image)] = notFoundEntry{err: err, expires: now.Add(r.notFoundTTL)}
 }
 
 // addWorkItems adds a digest resolve item to the queue for each container in the revision.
 // This is expected to be called with the mutex locked.
-func (r *backgroundResolver) addWorkItems(rev *v1.Revision, name types.NamespacedName, opt k8schain.Options, registriesToSkip sets.Set[string], timeout time.Duration) {
+func (r *backgroundResolver) addWorkItems(rev *v1.Revision, name types.NamespacedName, opts resolveOptions) {
 	totalNumOfContainers := len(rev.Spec.Containers) + len(rev.Spec.InitContainers)
 	r.results[name] = &resolveResult{
-		opt:                opt,
-		registriesToSkip:   registriesToSkip,
+		resolveOptions:     opts,
 		imagesResolved:     make(map[string]string),
+		imageLabels:        make(map[string]map[string]string),
 		imagesToBeResolved: sets.Set[string]{},
+		queued:             make(map[string]time.Time),
 		workItems:          make([]workItem, 0, totalNumOfContainers),
 		completionCallback: func() {
 			r.enqueue(name)
@@ -213,38 +485,154 @@ func (r *backgroundResolver) addWorkItems(rev *v1.Revision, name types.Namespace
 		}
 		item := workItem{
 			revision: name,
-			timeout:  timeout,
+			timeout:  opts.timeout,
 			image:    container.Image,
 		}
 		r.results[name].workItems = append(r.results[name].workItems, item)
 		r.results[name].imagesToBeResolved.Insert(container.Image)
-		r.queue.AddRateLimited(item)
+		if opts.maxConcurrency > 0 && len(r.results[name].workItems) > opts.maxConcurrency {
+			r.results[name].pending = append(r.results[name].pending, item)
+			continue
+		}
+		r.dispatch(item)
+	}
+}
+
+// dispatch queues the work item, unless its namespace already has
+// namespaceConcurrency items in flight, in which case it waits for one of them
+// to complete.
+// This is expected to be called with the mutex locked.
+func (r *backgroundResolver) dispatch(item workItem) {
+	if result := r.results[item.revision]; result != nil {
+		if _, ok := result.queued[item.image]; !ok {
+			result.queued[item.image] = r.clock.Now()
+		}
+	}
+	ns := item.revision.Namespace
+	if limit := r.namespaceLimit(); limit > 0 && r.inFlight[ns].Len() >= limit && !r.inFlight[ns].Has(item) {
+		r.waiting[ns] = append(r.waiting[ns], item)
+		return
+	}
+	if r.inFlight[ns] == nil {
+		r.inFlight[ns] = sets.New[workItem]()
+	}
+	r.inFlight[ns].Insert(item)
+	r.queue.AddRateLimited(item)
+}
+
+// release hands the namespace slot of the completed work item to the items of
+// the namespace waiting for one.
+// This is expected to be called with the mutex locked.
+func (r *backgroundResolver) release(item workItem) {
+	ns := item.revision.Namespace
+	r.inFlight[ns].Delete(item)
+	limit := r.namespaceLimit()
+	for len(r.waiting[ns]) > 0 && (limit <= 0 || r.inFlight[ns].Len() < limit) {
+		next := r.waiting[ns][0]
+		r.waiting[ns] = r.waiting[ns][1:]
+		r.dispatch(next)
+	}
+	if len(r.waiting[ns]) == 0 {
+		delete(r.waiting, ns)
+	}
+	if r.inFlight[ns].Len() == 0 {
+		delete(r.inFlight, ns)
 	}
 }
 
+func (r *backgroundResolver) namespaceLimit() int {
+	if r.namespaceConcurrency == nil {
+		return 0
+	}
+	return int(r.namespaceConcurrency.Load())
+}
+
 // processWorkItem runs a single image digest resolution and stores the result
 // in the resolveResult. If this completes the work for the revision, the
 // completionCallback is called.
 func (r *backgroundResolver) processWorkItem(item workItem) {
 	defer r.queue.Done(item)
+	defer func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.release(item)
+	}()
 	r.logger.Debugf("Processing image %q from revision %q (depth: %d)", item.image, item.revision, r.queue.Len())
 
 	// We need to acquire the result under lock since it's theoretically possible
 	// for a Clear to race with this and try to delete the result from the map.
 	r.mu.RLock()
 	result := r.results[item.revision]
+	var queued time.Time
+	if result != nil {
+		queued = result.queued[item.image]
+	}
 	r.mu.RUnlock()
 
 	if result == nil {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), item.timeout)
+	timeout := r.timeout(item)
+	ctx, cancel := context.WithTimeout(withResolvingRevision(context.Background(), item.revision), timeout)
 	defer cancel()
 
 	r.logger.Debugf("Resolving image %q from revision %q to digest", item.image, item.revision)
-	resolvedDigest, resolveErr := r.resolver.Resolve(ctx, item.image, result.opt, result.registriesToSkip)
+	resolvedDigest, resolveErr := r.resolveCached(ctx, item, result, timeout)
 	r.logger.Debugf("Resolved image %q from revision %q to digest %q, %v", item.image, item.revision, resolvedDigest, resolveErr)
+	if resolveErr == nil && resolvedDigest != "" {
+		recordImageResolution(isDigest(item.image))
+	}
+	recordResolution(imageRegistry(item.image), resolveErr, r.clock.Since(queued))
+	notFound := isImageNotFound(resolveErr)
+
+	var (
+		labels   map[string]string
+		labelErr error
+		layerErr error
+	)
+	if resolveErr == nil && resolvedDigest != "" && result.verifyLayers {
+		if err := r.resolver.CheckLayers(ctx, resolvedDigest, result.opt); errors.As(err, new(*missingImageLayerError)) {
+			layerErr = err
+		} else if err != nil {
+			resolveErr = fmt.Errorf("failed to check the image layers: %w", err)
+		}
+	}
+	checkLabels := len(result.requiredLabels) > 0 || len(result.deniedLabels) > 0
+	if resolveErr == nil && resolvedDigest != "" && (result.labelsToExport.Len() > 0 || checkLabels) {
+		// Failing to fetch the labels does not fail the revision, they are
+		// just not exported, unless some labels are required or denied.
+		allLabels, err := r.resolver.Labels(ctx, resolvedDigest, result.opt)
+		if err != nil {
+			r.logger.Warnw("Failed to fetch the image labels", zap.String("image", resolvedDigest), zap.Error(err))
+			if checkLabels {
+				resolveErr = fmt.Errorf("failed to fetch the image labels: %w", err)
+			}
+		}
+		for label, value := range allLabels {
+			if result.labelsToExport.Has(label) {
+				if labels == nil {
+					labels = make(map[string]string, result.labelsToExport.Len())
+				}
+				labels[label] = value
+			}
+		}
+		if err == nil {
+			for _, label := range sets.List(sets.KeySet(result.requiredLabels)) {
+				want := result.requiredLabels[label]
+				if got, ok := allLabels[label]; !ok || got != want {
+					labelErr = &missingImageLabelError{image: item.image, label: label, want: want}
+					break
+				}
+			}
+			for _, label := range sets.List(sets.KeySet(result.deniedLabels)) {
+				if got, ok := allLabels[label]; labelErr == nil && ok && result.deniedLabels[label].Has(got) {
+					labelErr = &deniedImageLabelError{image: item.image, label: label, value: got}
+					break
+				}
+			}
+		}
+	}
 
 	// lock after the resolve because we don't want to block parallel resolves,
 	// just storing the result.
@@ -256,6 +644,10 @@ func (r *backgroundResolver) processWorkItem(item workItem) {
 		r.queue.Forget(item)
 	}
 
+	if notFound {
+		r.rememberNotFound(result.opt, item.image, resolveErr)
+	}
+
 	// If we're already ready we don't want to callback twice.
 	// This can happen if an image resolve completes but we've already reported
 	// an error from another image in the result.
@@ -269,11 +661,215 @@ func (r *backgroundResolver) processWorkItem(item workItem) {
 		return
 	}
 
+	if layerErr != nil {
+		result.err = layerErr
+		result.completionCallback()
+		return
+	}
+
+	if labelErr != nil {
+		result.err = labelErr
+		result.completionCallback()
+		return
+	}
+
 	result.imagesResolved[item.image] = resolvedDigest
+	if labels != nil {
+		result.imageLabels[item.image] = labels
+	}
 
 	if result.ready() {
 		result.completionCallback()
+		return
 	}
+
+	// Hand the slot freed up by this item to the next pending one.
+	if len(result.pending) > 0 {
+		next := result.pending[0]
+		result.pending = result.pending[1:]
+		r.dispatch(next)
+	}
+}
+
+// timeout returns the timeout of the resolution of the work item's image,
+// which is the one of the longest registryTimeouts prefix matching the
+// image's registry, if any.
+func (r *backgroundResolver) timeout(item workItem) time.Duration {
+	if r.registryTimeouts == nil {
+		return item.timeout
+	}
+	timeouts := r.registryTimeouts.Load()
+	if timeouts == nil || len(*timeouts) == 0 {
+		return item.timeout
+	}
+	ref, err := name.ParseReference(item.image, name.WeakValidation)
+	if err != nil {
+		return item.timeout
+	}
+	registry := ref.Context().RegistryStr()
+
+	timeout, longest := item.timeout, -1
+	for prefix, t := range *timeouts {
+		if strings.HasPrefix(registry, prefix) && len(prefix) > longest {
+			timeout, longest = t, len(prefix)
+		}
+	}
+	return timeout
+}
+
+// resolveCached resolves the image of the work item like resolve, reusing the
+// digest resolved for the same image and credentials within digestCacheTTL,
+// or waiting for the resolution of them in flight, if any, rather than hitting
+// the registry again.
+func (r *backgroundResolver) resolveCached(ctx context.Context, item workItem, result *resolveResult, timeout time.Duration) (string, error) {
+	ttl := r.cacheTTL()
+	if ttl <= 0 || isDigest(item.image) {
+		return r.resolve(ctx, item, result, timeout)
+	}
+	key := newImageKey(result.opt, item.image)
+
+	r.cacheMu.Lock()
+	if entry, ok := r.digests[key]; ok && r.clock.Now().Before(entry.expires) {
+		r.cacheMu.Unlock()
+		return entry.digest, nil
+	}
+	if call, ok := r.digestCalls[key]; ok {
+		r.cacheMu.Unlock()
+		select {
+		case <-call.done:
+			return call.digest, call.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	call := &digestCall{done: make(chan struct{})}
+	r.digestCalls[key] = call
+	r.cacheMu.Unlock()
+
+	call.digest, call.err = r.resolve(ctx, item, result, timeout)
+
+	r.cacheMu.Lock()
+	delete(r.digestCalls, key)
+	now := r.clock.Now()
+	for k, entry := range r.digests {
+		if !now.Before(entry.expires) {
+			delete(r.digests, k)
+		}
+	}
+	// Skipped registries resolve to an empty digest, which isn't worth caching.
+	if call.err == nil && call.digest != "" {
+		r.digests[key] = digestEntry{digest: call.digest, expires: now.Add(ttl)}
+	}
+	r.cacheMu.Unlock()
+	close(call.done)
+
+	return call.digest, call.err
+}
+
+func (r *backgroundResolver) cacheTTL() time.Duration {
+	if r.digestCacheTTL == nil {
+		return 0
+	}
+	return r.digestCacheTTL.Load()
+}
+
+// resolve resolves the image of the work item to a digest, in a batch with
+// other images of its registry if the registry is batch-capable, falling back
+// to resolving it individually if the batch fails.
+func (r *backgroundResolver) resolve(ctx context.Context, item workItem, result *resolveResult, timeout time.Duration) (string, error) {
+	if isDigest(item.image) {
+		// The image is pinned to a digest already, there is nothing to resolve.
+		return item.image, nil
+	}
+	if registry, ok := r.batchRegistry(item.image, result.registriesToSkip); ok {
+		digest, err := r.resolveInBatch(item, registry, result.opt, timeout)
+		if err == nil {
+			return digest, nil
+		}
+		r.logger.Warnw("Failed to resolve the image in a batch, resolving it individually",
+			zap.String("image", item.image), zap.Error(err))
+	}
+	return r.resolver.Resolve(ctx, item.image, result.opt, result.registriesToSkip)
+}
+
+// imageRegistry returns the registry of the image, or an empty string if the
+// image cannot be parsed.
+func imageRegistry(image string) string {
+	ref, err := name.ParseReference(image, name.WeakValidation)
+	if err != nil {
+		return ""
+	}
+	return ref.Context().RegistryStr()
+}
+
+// batchRegistry returns the registry of the image if its tag is to be
+// resolved in a batch.
+func (r *backgroundResolver) batchRegistry(image string, registriesToSkip sets.Set[string]) (string, bool) {
+	if _, ok := r.resolver.(batchImageResolver); !ok || r.batchRegistries == nil {
+		return "", false
+	}
+	registries := r.batchRegistries.Load()
+	if registries == nil || registries.Len() == 0 {
+		return "", false
+	}
+	if isDigest(image) {
+		return "", false
+	}
+	tag, err := name.NewTag(image, name.WeakValidation)
+	if err != nil {
+		return "", false
+	}
+	registry := tag.Registry.RegistryStr()
+	return registry, registries.Has(registry) && !registriesToSkip.Has(registry)
+}
+
+// resolveInBatch adds the image of the work item to the pending batch of its
+// registry and credentials, starting one if there is none, and waits for the
+// batch to be resolved after batchWindow.
+func (r *backgroundResolver) resolveInBatch(item workItem, registry string, opt k8schain.Options, timeout time.Duration) (string, error) {
+	key := batchKey{
+		namespace:          opt.Namespace,
+		serviceAccountName: opt.ServiceAccountName,
+		imagePullSecrets:   strings.Join(opt.ImagePullSecrets, ","),
+		registry:           registry,
+	}
+
+	r.batchMu.Lock()
+	batch, ok := r.batches[key]
+	if !ok {
+		batch = &resolveBatch{images: sets.New[string](), done: make(chan struct{})}
+		r.batches[key] = batch
+		time.AfterFunc(r.batchWindow, func() {
+			r.flushBatch(key, batch, opt, timeout)
+		})
+	}
+	batch.images.Insert(item.image)
+	r.batchMu.Unlock()
+
+	<-batch.done
+	if batch.err != nil {
+		return "", batch.err
+	}
+	digest, ok := batch.digests[item.image]
+	if !ok {
+		return "", fmt.Errorf("image %q is missing from the batch response", item.image)
+	}
+	return digest, nil
+}
+
+// flushBatch resolves the images of the batch with a single request.
+func (r *backgroundResolver) flushBatch(key batchKey, batch *resolveBatch, opt k8schain.Options, timeout time.Duration) {
+	r.batchMu.Lock()
+	delete(r.batches, key)
+	images := sets.List(batch.images)
+	r.batchMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	r.logger.Debugf("Resolving %d images of registry %q in a batch", len(images), key.registry)
+	batch.digests, batch.err = r.resolver.(batchImageResolver).ResolveBatch(ctx, key.registry, images, opt)
+	close(batch.done)
 }
 
 // Clear removes any cached results for the revision. This should be called
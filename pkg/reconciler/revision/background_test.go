@@ -21,19 +21,29 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"net/http"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"go.opencensus.io/metric/metricdata"
+	"go.uber.org/atomic"
 	logtesting "knative.dev/pkg/logging/testing"
+	"knative.dev/pkg/metrics/metricstest"
 	"knative.dev/pkg/ptr"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-containerregistry/pkg/authn/k8schain"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/workqueue"
+	clocktest "k8s.io/utils/clock/testing"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 )
 
@@ -161,7 +171,7 @@ func TestResolveInBackground(t *testing.T) {
 			for i := 0; i < 2; i++ {
 				t.Run(fmt.Sprint("iteration", i), func(t *testing.T) {
 					logger := logtesting.TestLogger(t)
-					initContainerStatuses, statuses, err := subject.Resolve(logger, fakeRevision, k8schain.Options{ServiceAccountName: "san"}, sets.New("skip"), timeout)
+					initContainerStatuses, statuses, _, err := subject.Resolve(logger, fakeRevision, resolveOptions{opt: k8schain.Options{ServiceAccountName: "san"}, registriesToSkip: sets.New("skip"), timeout: timeout})
 					if err != nil || statuses != nil || initContainerStatuses != nil {
 						// Initial result should be nil, nil, nil since we have nothing in cache.
 						t.Errorf("Resolve() = %v, %v %v, wanted nil, nil, nil", statuses, initContainerStatuses, err)
@@ -176,7 +186,7 @@ func TestResolveInBackground(t *testing.T) {
 						t.Fatalf("Resolver did not report ready")
 					}
 
-					initContainerStatuses, statuses, err = subject.Resolve(logger, fakeRevision, k8schain.Options{}, nil, timeout)
+					initContainerStatuses, statuses, _, err = subject.Resolve(logger, fakeRevision, resolveOptions{timeout: timeout})
 					if got, want := err, tt.wantError; !errors.Is(got, want) {
 						t.Errorf("Resolve() = _, %q, wanted %q", got, want)
 					}
@@ -198,6 +208,968 @@ func TestResolveInBackground(t *testing.T) {
 	}
 }
 
+func TestResolveInBackgroundBoundedConcurrency(t *testing.T) {
+	const (
+		containers     = 6
+		maxConcurrency = 2
+	)
+	logger := logtesting.TestLogger(t)
+
+	var inFlight, maxInFlight atomic.Int32
+	var resolver resolveFunc = func(_ context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+		n := inFlight.Inc()
+		defer inFlight.Dec()
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return img + "-digest", nil
+	}
+
+	enqueue := make(chan struct{})
+	subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(types.NamespacedName) {
+		enqueue <- struct{}{}
+	})
+
+	stop := make(chan struct{})
+	done := subject.Start(stop, 10)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	revision := rev("rev", "img0", "img1")
+	revision.Spec.Containers = nil
+	for i := 0; i < containers; i++ {
+		revision.Spec.Containers = append(revision.Spec.Containers, corev1.Container{
+			Name:  fmt.Sprint("container", i),
+			Image: fmt.Sprint("img", i),
+		})
+	}
+
+	if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: time.Second, maxConcurrency: maxConcurrency}); err != nil || statuses != nil {
+		t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+	}
+
+	select {
+	case <-enqueue:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the resolution to complete")
+	}
+
+	_, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: time.Second, maxConcurrency: maxConcurrency})
+	if err != nil {
+		t.Fatal("Resolve() =", err)
+	}
+	if got, want := len(statuses), containers; got != want {
+		t.Fatalf("len(statuses) = %d, want %d", got, want)
+	}
+	for i, status := range statuses {
+		if got, want := status.ImageDigest, fmt.Sprint("img", i, "-digest"); got != want {
+			t.Errorf("statuses[%d].ImageDigest = %q, want %q", i, got, want)
+		}
+	}
+	if got := maxInFlight.Load(); got > maxConcurrency {
+		t.Errorf("Resolved %d images in parallel, want at most %d", got, maxConcurrency)
+	}
+}
+
+func TestResolveInBackgroundNamespaceConcurrency(t *testing.T) {
+	const (
+		workers              = 4
+		namespaceConcurrency = 2
+		floodRevisions       = 10
+	)
+	logger := logtesting.TestLogger(t)
+
+	// The images of the flooding namespace are resolved once released.
+	release := make(chan struct{})
+	var floodInFlight, maxFloodInFlight atomic.Int32
+	var resolver resolveFunc = func(ctx context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+		if strings.HasPrefix(img, "flood") {
+			n := floodInFlight.Inc()
+			defer floodInFlight.Dec()
+			for {
+				m := maxFloodInFlight.Load()
+				if n <= m || maxFloodInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+		return img + "-digest", nil
+	}
+
+	enqueued := make(chan types.NamespacedName, floodRevisions+1)
+	subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(name types.NamespacedName) {
+		enqueued <- name
+	})
+	subject.namespaceConcurrency = atomic.NewInt32(namespaceConcurrency)
+
+	stop := make(chan struct{})
+	done := subject.Start(stop, workers)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	var flood []*v1.Revision
+	for i := 0; i < floodRevisions; i++ {
+		revision := rev(fmt.Sprint("rev", i), fmt.Sprint("flood", i), fmt.Sprint("flood-sidecar", i))
+		revision.Namespace = "flood"
+		revision.Spec.InitContainers = nil
+		flood = append(flood, revision)
+		if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: 10 * time.Second}); err != nil || statuses != nil {
+			t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+		}
+	}
+
+	// The revision of another namespace is resolved while the flooding
+	// namespace's resolutions are still blocked.
+	other := rev("rev", "first-image", "second-image")
+	other.Namespace = "other"
+	if _, statuses, _, err := subject.Resolve(logger, other, resolveOptions{timeout: 10 * time.Second}); err != nil || statuses != nil {
+		t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+	}
+	select {
+	case name := <-enqueued:
+		if name.Namespace != "other" {
+			t.Fatalf("Enqueued %v, wanted the revision of the other namespace first", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the resolution of the other namespace")
+	}
+	if _, statuses, _, err := subject.Resolve(logger, other, resolveOptions{timeout: 10 * time.Second}); err != nil || len(statuses) != 2 {
+		t.Fatalf("Resolve() = %v, %v, wanted the images to be resolved", statuses, err)
+	}
+
+	// The flooding namespace's resolutions complete once released.
+	close(release)
+	for range flood {
+		select {
+		case <-enqueued:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the resolutions of the flooding namespace")
+		}
+	}
+	for _, revision := range flood {
+		if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: 10 * time.Second}); err != nil || len(statuses) != 2 {
+			t.Errorf("Resolve(%s) = %v, %v, wanted the images to be resolved", revision.Name, statuses, err)
+		}
+	}
+	if got := maxFloodInFlight.Load(); got > namespaceConcurrency {
+		t.Errorf("Resolved %d images of a namespace in parallel, want at most %d", got, namespaceConcurrency)
+	}
+}
+
+func TestResolveInBackgroundExportsLabels(t *testing.T) {
+	logger := logtesting.TestLogger(t)
+
+	resolver := &labeledResolver{
+		resolveFunc: func(_ context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+			return img + "-digest", nil
+		},
+		labels: map[string]map[string]string{
+			"first-image-digest": {
+				"org.opencontainers.image.revision": "abc123",
+				"maintainer":                        "someone",
+			},
+			"second-image-digest": {
+				"maintainer": "someone else",
+			},
+		},
+	}
+
+	enqueue := make(chan struct{})
+	subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(types.NamespacedName) {
+		enqueue <- struct{}{}
+	})
+
+	stop := make(chan struct{})
+	done := subject.Start(stop, 10)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	revision := rev("rev", "first-image", "second-image")
+	labelsToExport := sets.New("org.opencontainers.image.revision", "build-id")
+	if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{labelsToExport: labelsToExport, timeout: time.Second}); err != nil || statuses != nil {
+		t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+	}
+
+	select {
+	case <-enqueue:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the resolution to complete")
+	}
+
+	_, _, imageLabels, err := subject.Resolve(logger, revision, resolveOptions{labelsToExport: labelsToExport, timeout: time.Second})
+	if err != nil {
+		t.Fatal("Resolve() =", err)
+	}
+	want := map[string]map[string]string{
+		"first": {"org.opencontainers.image.revision": "abc123"},
+	}
+	if !reflect.DeepEqual(imageLabels, want) {
+		t.Errorf("Resolve() image labels = %v, wanted %v", imageLabels, want)
+	}
+}
+
+func TestResolveInBackgroundRequiredLabels(t *testing.T) {
+	requiredLabels := map[string]string{"approved": "true"}
+
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{{
+		name:   "image with the required label",
+		labels: map[string]string{"approved": "true", "maintainer": "someone"},
+	}, {
+		name:    "image without the required label",
+		labels:  map[string]string{"maintainer": "someone"},
+		wantErr: true,
+	}, {
+		name:    "image with another value of the required label",
+		labels:  map[string]string{"approved": "false"},
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := logtesting.TestLogger(t)
+			resolver := &labeledResolver{
+				resolveFunc: func(_ context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+					return img + "-digest", nil
+				},
+				labels: map[string]map[string]string{
+					"first-image-digest":  {"approved": "true"},
+					"second-image-digest": tc.labels,
+					"init-digest":         {"approved": "true"},
+				},
+			}
+
+			enqueue := make(chan struct{})
+			subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(types.NamespacedName) {
+				enqueue <- struct{}{}
+			})
+
+			stop := make(chan struct{})
+			done := subject.Start(stop, 10)
+			defer func() {
+				close(stop)
+				<-done
+			}()
+
+			revision := rev("rev", "first-image", "second-image")
+			if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{requiredLabels: requiredLabels, timeout: time.Second}); err != nil || statuses != nil {
+				t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+			}
+
+			select {
+			case <-enqueue:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for the resolution to complete")
+			}
+
+			_, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{requiredLabels: requiredLabels, timeout: time.Second})
+			var labelErr *missingImageLabelError
+			if got := errors.As(err, &labelErr); got != tc.wantErr {
+				t.Fatalf("Resolve() = %v, wanted a missing label error: %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && (len(statuses) != 2 || statuses[1].ImageDigest != "second-image-digest") {
+				t.Errorf("Resolve() = %v, wanted the image to be resolved", statuses)
+			}
+
+			if tc.wantErr {
+				// Dropping the requirement triggers a new resolution.
+				if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: time.Second}); err != nil || statuses != nil {
+					t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+				}
+				select {
+				case <-enqueue:
+				case <-time.After(5 * time.Second):
+					t.Fatal("Timed out waiting for the resolution to complete")
+				}
+				if _, _, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: time.Second}); err != nil {
+					t.Error("Resolve() =", err)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveInBackgroundDeniedLabels(t *testing.T) {
+	deniedLabels := map[string]sets.Set[string]{"base-deprecated": sets.New("true")}
+
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{{
+		name:   "image without the denied label",
+		labels: map[string]string{"maintainer": "someone"},
+	}, {
+		name:   "image with another value of the denied label",
+		labels: map[string]string{"base-deprecated": "false"},
+	}, {
+		name:    "image with the denied label",
+		labels:  map[string]string{"base-deprecated": "true", "maintainer": "someone"},
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := logtesting.TestLogger(t)
+			resolver := &labeledResolver{
+				resolveFunc: func(_ context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+					return img + "-digest", nil
+				},
+				labels: map[string]map[string]string{
+					"first-image-digest":  {},
+					"second-image-digest": tc.labels,
+					"init-digest":         {},
+				},
+			}
+
+			enqueue := make(chan struct{})
+			subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(types.NamespacedName) {
+				enqueue <- struct{}{}
+			})
+
+			stop := make(chan struct{})
+			done := subject.Start(stop, 10)
+			defer func() {
+				close(stop)
+				<-done
+			}()
+
+			revision := rev("rev", "first-image", "second-image")
+			if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{deniedLabels: deniedLabels, timeout: time.Second}); err != nil || statuses != nil {
+				t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+			}
+
+			select {
+			case <-enqueue:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for the resolution to complete")
+			}
+
+			_, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{deniedLabels: deniedLabels, timeout: time.Second})
+			var labelErr *deniedImageLabelError
+			if got := errors.As(err, &labelErr); got != tc.wantErr {
+				t.Fatalf("Resolve() = %v, wanted a denied label error: %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && (len(statuses) != 2 || statuses[1].ImageDigest != "second-image-digest") {
+				t.Errorf("Resolve() = %v, wanted the image to be resolved", statuses)
+			}
+
+			if tc.wantErr {
+				// Allowing the label value again triggers a new resolution.
+				allowed := map[string]sets.Set[string]{"base-deprecated": sets.New("unknown")}
+				if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{deniedLabels: allowed, timeout: time.Second}); err != nil || statuses != nil {
+					t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+				}
+				select {
+				case <-enqueue:
+				case <-time.After(5 * time.Second):
+					t.Fatal("Timed out waiting for the resolution to complete")
+				}
+				if _, _, _, err := subject.Resolve(logger, revision, resolveOptions{deniedLabels: allowed, timeout: time.Second}); err != nil {
+					t.Error("Resolve() =", err)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveInBackgroundVerifyLayers(t *testing.T) {
+	for _, verifyLayers := range []bool{false, true} {
+		t.Run(fmt.Sprint("verifyLayers=", verifyLayers), func(t *testing.T) {
+			logger := logtesting.TestLogger(t)
+			resolver := &layerCheckingResolver{
+				resolveFunc: func(_ context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+					return img + "-digest", nil
+				},
+				missing: sets.New("second-image-digest"),
+			}
+
+			enqueue := make(chan struct{})
+			subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(types.NamespacedName) {
+				enqueue <- struct{}{}
+			})
+
+			stop := make(chan struct{})
+			done := subject.Start(stop, 10)
+			defer func() {
+				close(stop)
+				<-done
+			}()
+
+			revision := rev("rev", "first-image", "second-image")
+			if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{verifyLayers: verifyLayers, timeout: time.Second}); err != nil || statuses != nil {
+				t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+			}
+
+			select {
+			case <-enqueue:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for the resolution to complete")
+			}
+
+			// The layers are only checked when asked to.
+			_, _, _, err := subject.Resolve(logger, revision, resolveOptions{verifyLayers: verifyLayers, timeout: time.Second})
+			var layerErr *missingImageLayerError
+			if got := errors.As(err, &layerErr); got != verifyLayers {
+				t.Errorf("Resolve() = %v, wanted a missing layer error: %v", err, verifyLayers)
+			}
+		})
+	}
+}
+
+func TestResolveInBackgroundNotFoundCache(t *testing.T) {
+	logger := logtesting.TestLogger(t)
+	resolves := atomic.NewInt32(0)
+	var resolver resolveFunc = func(_ context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+		resolves.Inc()
+		if img == "typo-image" {
+			return "", &transport.Error{StatusCode: http.StatusNotFound}
+		}
+		return img + "-digest", nil
+	}
+
+	enqueue := make(chan struct{})
+	subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(types.NamespacedName) {
+		enqueue <- struct{}{}
+	})
+	clock := clocktest.NewFakePassiveClock(time.Now())
+	subject.clock = clock
+
+	stop := make(chan struct{})
+	done := subject.Start(stop, 10)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	revision := rev("rev", "first-image", "typo-image")
+	name := types.NamespacedName{Namespace: revision.Namespace, Name: revision.Name}
+	resolve := func() error {
+		t.Helper()
+		if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: time.Second}); err != nil || statuses != nil {
+			return err
+		}
+		select {
+		case <-enqueue:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the resolution to complete")
+		}
+		_, _, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: time.Second})
+		subject.Clear(name)
+		return err
+	}
+
+	if err := resolve(); !isImageNotFound(err) {
+		t.Fatalf("Resolve() = %v, wanted a not found error", err)
+	}
+	// The init, first and typo images are resolved.
+	if got, want := resolves.Load(), int32(3); got != want {
+		t.Fatalf("Resolves = %d, want: %d", got, want)
+	}
+
+	// Within the TTL, the revision fails right away without hitting the registry.
+	clock.SetTime(clock.Now().Add(notFoundTTL - time.Second))
+	if _, _, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: time.Second}); !isImageNotFound(err) {
+		t.Errorf("Resolve() = %v, wanted the cached not found error", err)
+	}
+	if got, want := resolves.Load(), int32(3); got != want {
+		t.Errorf("Resolves = %d, want: %d", got, want)
+	}
+
+	// Other credentials may have access to the image.
+	if _, _, _, err := subject.Resolve(logger, revision, resolveOptions{opt: k8schain.Options{ServiceAccountName: "san"}, timeout: time.Second}); err != nil {
+		t.Errorf("Resolve() = %v, wanted the resolution to be triggered", err)
+	}
+	<-enqueue
+	subject.Clear(name)
+
+	// After the TTL, the image is checked again.
+	clock.SetTime(clock.Now().Add(time.Second))
+	resolves.Store(0)
+	if err := resolve(); !isImageNotFound(err) {
+		t.Errorf("Resolve() = %v, wanted a not found error", err)
+	}
+	if got, want := resolves.Load(), int32(3); got != want {
+		t.Errorf("Resolves = %d, want: %d", got, want)
+	}
+}
+
+func TestResolveInBackgroundDigestCacheCoalesces(t *testing.T) {
+	logger := logtesting.TestLogger(t)
+	resolves := atomic.NewInt32(0)
+	release := make(chan struct{})
+	var resolver resolveFunc = func(_ context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+		resolves.Inc()
+		<-release
+		return img + "-digest", nil
+	}
+
+	const revisions = 5
+	enqueue := make(chan struct{}, revisions)
+	subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(types.NamespacedName) {
+		enqueue <- struct{}{}
+	})
+	subject.digestCacheTTL = atomic.NewDuration(time.Minute)
+
+	stop := make(chan struct{})
+	done := subject.Start(stop, 3*revisions)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	for i := 0; i < revisions; i++ {
+		revision := rev(fmt.Sprint("rev-", i), "first-image", "second-image")
+		if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: 5 * time.Second}); err != nil || statuses != nil {
+			t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+		}
+	}
+
+	// The init, first and second images are resolved once for all revisions.
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return resolves.Load() == 3, nil
+	}); err != nil {
+		t.Fatalf("Resolves = %d, want: 3", resolves.Load())
+	}
+	close(release)
+
+	for i := 0; i < revisions; i++ {
+		select {
+		case <-enqueue:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the resolutions to complete")
+		}
+	}
+	if got, want := resolves.Load(), int32(3); got != want {
+		t.Errorf("Resolves = %d, want: %d", got, want)
+	}
+
+	_, statuses, _, err := subject.Resolve(logger, rev("rev-0", "first-image", "second-image"), resolveOptions{timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal("Resolve() =", err)
+	}
+	want := []v1.ContainerStatus{{
+		Name:        "first",
+		ImageDigest: "first-image-digest",
+	}, {
+		Name:        "second",
+		ImageDigest: "second-image-digest",
+	}}
+	if diff := cmp.Diff(want, statuses); diff != "" {
+		t.Error("Statuses differ (-want +got):", diff)
+	}
+}
+
+func TestResolveInBackgroundDigestCacheTTL(t *testing.T) {
+	logger := logtesting.TestLogger(t)
+	resolves := atomic.NewInt32(0)
+	var resolver resolveFunc = func(_ context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+		resolves.Inc()
+		return img + "-digest", nil
+	}
+
+	enqueue := make(chan struct{})
+	subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(types.NamespacedName) {
+		enqueue <- struct{}{}
+	})
+	clock := clocktest.NewFakePassiveClock(time.Now())
+	subject.clock = clock
+	ttl := atomic.NewDuration(0)
+	subject.digestCacheTTL = ttl
+
+	stop := make(chan struct{})
+	done := subject.Start(stop, 10)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	resolve := func(name string, opt k8schain.Options) int32 {
+		t.Helper()
+		resolves.Store(0)
+		revision := rev(name, "first-image", "second-image")
+		if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{opt: opt, timeout: time.Second}); err != nil || statuses != nil {
+			t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+		}
+		select {
+		case <-enqueue:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the resolution to complete")
+		}
+		if _, _, _, err := subject.Resolve(logger, revision, resolveOptions{opt: opt, timeout: time.Second}); err != nil {
+			t.Fatal("Resolve() =", err)
+		}
+		return resolves.Load()
+	}
+
+	// Without a TTL, every revision resolves its images.
+	if got, want := resolve("rev-1", k8schain.Options{}), int32(3); got != want {
+		t.Errorf("Resolves = %d, want: %d", got, want)
+	}
+	if got, want := resolve("rev-2", k8schain.Options{}), int32(3); got != want {
+		t.Errorf("Resolves = %d, want: %d", got, want)
+	}
+
+	ttl.Store(time.Minute)
+	if got, want := resolve("rev-3", k8schain.Options{}), int32(3); got != want {
+		t.Errorf("Resolves = %d, want: %d", got, want)
+	}
+
+	// Within the TTL, the digests are reused by the other revisions.
+	clock.SetTime(clock.Now().Add(time.Minute - time.Second))
+	if got, want := resolve("rev-4", k8schain.Options{}), int32(0); got != want {
+		t.Errorf("Resolves = %d, want: %d", got, want)
+	}
+
+	// Other credentials may see other digests.
+	if got, want := resolve("rev-5", k8schain.Options{ServiceAccountName: "san"}), int32(3); got != want {
+		t.Errorf("Resolves = %d, want: %d", got, want)
+	}
+
+	// After the TTL, the images are resolved again.
+	clock.SetTime(clock.Now().Add(time.Second))
+	if got, want := resolve("rev-6", k8schain.Options{}), int32(3); got != want {
+		t.Errorf("Resolves = %d, want: %d", got, want)
+	}
+}
+
+func TestResolveInBackgroundPinnedDigest(t *testing.T) {
+	metricstest.Unregister(imageResolutionCountM.Name(), resolutionCountM.Name(), resolutionLatencyM.Name())
+	register()
+
+	const pinned = "first-image@sha256:e7def0d56013d50204d73bb588d99e0baa7d69ea1bc1157549b898eb67287612"
+	logger := logtesting.TestLogger(t)
+	var resolver resolveFunc = func(_ context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+		if img == pinned {
+			t.Error("Unexpected resolution of the pinned image")
+		}
+		return img + "-digest", nil
+	}
+
+	enqueue := make(chan struct{})
+	subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(types.NamespacedName) {
+		enqueue <- struct{}{}
+	})
+
+	stop := make(chan struct{})
+	done := subject.Start(stop, 10)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	revision := rev("rev", pinned, "second-image")
+	if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: time.Second}); err != nil || statuses != nil {
+		t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+	}
+
+	select {
+	case <-enqueue:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the resolution to complete")
+	}
+
+	_, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: time.Second})
+	if err != nil {
+		t.Fatal("Resolve() =", err)
+	}
+	// The pinned image is used as is.
+	want := []v1.ContainerStatus{{
+		Name:        "first",
+		ImageDigest: pinned,
+	}, {
+		Name:        "second",
+		ImageDigest: "second-image-digest",
+	}}
+	if diff := cmp.Diff(want, statuses); diff != "" {
+		t.Error("Statuses differ (-want +got):", diff)
+	}
+
+	metricstest.AssertMetric(t, metricstest.Metric{
+		Name: imageResolutionCountM.Name(),
+		Values: []metricstest.Value{{
+			Int64: ptr.Int64(1),
+			Tags:  map[string]string{imageReferenceKey.Name(): imageReferencePinned},
+		}, {
+			// The second and init images.
+			Int64: ptr.Int64(2),
+			Tags:  map[string]string{imageReferenceKey.Name(): imageReferenceResolved},
+		}},
+	})
+}
+
+func TestResolveInBackgroundMetrics(t *testing.T) {
+	metricstest.Unregister(imageResolutionCountM.Name(), resolutionCountM.Name(), resolutionLatencyM.Name())
+	register()
+
+	logger := logtesting.TestLogger(t)
+	var resolver resolveFunc = func(_ context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+		if img == "quay.io/typo-image" {
+			return "", &transport.Error{StatusCode: http.StatusNotFound}
+		}
+		return img + "-digest", nil
+	}
+
+	enqueue := make(chan struct{})
+	subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(types.NamespacedName) {
+		enqueue <- struct{}{}
+	})
+	clock := clocktest.NewFakePassiveClock(time.Now())
+	subject.clock = clock
+
+	revision := rev("rev", "gcr.io/first-image", "quay.io/typo-image")
+	if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: time.Second}); err != nil || statuses != nil {
+		t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+	}
+
+	// The time waiting in the queue counts towards the latency.
+	clock.SetTime(clock.Now().Add(2 * time.Second))
+	stop := make(chan struct{})
+	done := subject.Start(stop, 10)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	select {
+	case <-enqueue:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the resolution to complete")
+	}
+	if _, _, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: time.Second}); !isImageNotFound(err) {
+		t.Fatalf("Resolve() = %v, wanted a not found error", err)
+	}
+	// The remaining images are still resolved after the revision failed.
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		subject.mu.RLock()
+		defer subject.mu.RUnlock()
+		return len(subject.inFlight) == 0, nil
+	}); err != nil {
+		t.Fatal("Timed out waiting for the queue to drain")
+	}
+
+	tags := func(registry, outcome string) map[string]string {
+		return map[string]string{registryKey.Name(): registry, outcomeKey.Name(): outcome}
+	}
+	latency := func(registry, outcome string) metricstest.Value {
+		return metricstest.Value{
+			Distribution:                &metricdata.Distribution{Count: 1},
+			Tags:                        tags(registry, outcome),
+			VerifyDistributionCountOnly: true,
+		}
+	}
+	metricstest.AssertMetric(t, metricstest.Metric{
+		Name: resolutionCountM.Name(),
+		Values: []metricstest.Value{{
+			Int64: ptr.Int64(1),
+			Tags:  tags("gcr.io", resolutionOutcomeSuccess),
+		}, {
+			Int64: ptr.Int64(1),
+			Tags:  tags("index.docker.io", resolutionOutcomeSuccess),
+		}, {
+			Int64: ptr.Int64(1),
+			Tags:  tags("quay.io", resolutionOutcomeFailure),
+		}},
+	}, metricstest.Metric{
+		Name: resolutionLatencyM.Name(),
+		Values: []metricstest.Value{
+			latency("gcr.io", resolutionOutcomeSuccess),
+			latency("index.docker.io", resolutionOutcomeSuccess),
+			latency("quay.io", resolutionOutcomeFailure),
+		},
+	})
+	for _, v := range metricstest.GetOneMetric(resolutionLatencyM.Name()).Values {
+		if got, want := v.Distribution.Sum, 2000.; got != want {
+			t.Errorf("Latency of %v = %vms, want: %vms", v.Tags, got, want)
+		}
+	}
+}
+
+func TestResolveInBackgroundRegistryTimeouts(t *testing.T) {
+	logger := logtesting.TestLogger(t)
+
+	const (
+		fallback  = 10 * time.Second
+		tolerance = time.Second
+	)
+	var (
+		mu       sync.Mutex
+		timeouts = make(map[string]time.Duration)
+	)
+	var resolver resolveFunc = func(ctx context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Errorf("No deadline for image %q", img)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		timeouts[img] = time.Until(deadline)
+		return img + "-digest", nil
+	}
+
+	enqueue := make(chan struct{})
+	subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(types.NamespacedName) {
+		enqueue <- struct{}{}
+	})
+	subject.registryTimeouts = atomic.NewPointer(&map[string]time.Duration{
+		"registry":          30 * time.Second,
+		"registry.internal": 2 * time.Second,
+	})
+
+	stop := make(chan struct{})
+	done := subject.Start(stop, 10)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	revision := rev("rev", "registry.internal:5000/first", "registry.mirror/second")
+	if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: fallback}); err != nil || statuses != nil {
+		t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+	}
+	select {
+	case <-enqueue:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the resolution to complete")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for img, want := range map[string]time.Duration{
+		"registry.internal:5000/first": 2 * time.Second,
+		"registry.mirror/second":       30 * time.Second,
+		"init":                         fallback,
+	} {
+		if got := timeouts[img]; got > want || got < want-tolerance {
+			t.Errorf("Timeout of image %q = %v, want %v", img, got, want)
+		}
+	}
+}
+
+func TestResolveInBackgroundBatch(t *testing.T) {
+	const batchRegistry = "batch.example.com"
+
+	tests := []struct {
+		name            string
+		batchErr        error
+		batchRegistries sets.Set[string]
+		wantBatches     [][]string
+		wantIndividual  sets.Set[string]
+	}{{
+		name:            "batch-capable registry",
+		batchRegistries: sets.New(batchRegistry),
+		wantBatches:     [][]string{{batchRegistry + "/first", batchRegistry + "/second"}},
+		wantIndividual:  sets.New("init"),
+	}, {
+		name:           "no batch-capable registry",
+		wantIndividual: sets.New("init", batchRegistry+"/first", batchRegistry+"/second"),
+	}, {
+		name:            "batch failure",
+		batchErr:        errDigest,
+		batchRegistries: sets.New(batchRegistry),
+		wantBatches:     [][]string{{batchRegistry + "/first", batchRegistry + "/second"}},
+		wantIndividual:  sets.New("init", batchRegistry+"/first", batchRegistry+"/second"),
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logtesting.TestLogger(t)
+
+			var (
+				mu         sync.Mutex
+				batches    [][]string
+				individual = sets.New[string]()
+			)
+			resolver := &batchResolver{
+				resolveFunc: func(_ context.Context, img string, _ k8schain.Options, _ sets.Set[string]) (string, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					individual.Insert(img)
+					return img + "-digest", nil
+				},
+				resolveBatch: func(_ context.Context, registry string, images []string, _ k8schain.Options) (map[string]string, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					if registry != batchRegistry {
+						t.Errorf("ResolveBatch() registry = %q, want %q", registry, batchRegistry)
+					}
+					batches = append(batches, images)
+					if tt.batchErr != nil {
+						return nil, tt.batchErr
+					}
+					digests := make(map[string]string, len(images))
+					for _, img := range images {
+						digests[img] = img + "-digest"
+					}
+					return digests, nil
+				},
+			}
+
+			enqueue := make(chan struct{})
+			subject := newBackgroundResolver(logger, resolver, workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(types.NamespacedName) {
+				enqueue <- struct{}{}
+			})
+			subject.batchRegistries = atomic.NewPointer(&tt.batchRegistries)
+			// Leave the workers enough time to join the batch.
+			subject.batchWindow = 200 * time.Millisecond
+
+			stop := make(chan struct{})
+			done := subject.Start(stop, 10)
+			defer func() {
+				close(stop)
+				<-done
+			}()
+
+			revision := rev("rev", batchRegistry+"/first", batchRegistry+"/second")
+			if _, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: 5 * time.Second}); err != nil || statuses != nil {
+				t.Fatalf("Resolve() = %v, %v, wanted nil, nil", statuses, err)
+			}
+			select {
+			case <-enqueue:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for the resolution to complete")
+			}
+
+			_, statuses, _, err := subject.Resolve(logger, revision, resolveOptions{timeout: 5 * time.Second})
+			if err != nil {
+				t.Fatal("Resolve() =", err)
+			}
+			for i, status := range statuses {
+				if got, want := status.ImageDigest, revision.Spec.Containers[i].Image+"-digest"; got != want {
+					t.Errorf("statuses[%d].ImageDigest = %q, want %q", i, got, want)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !cmp.Equal(batches, tt.wantBatches) {
+				t.Error("Batches (-want, +got):", cmp.Diff(tt.wantBatches, batches))
+			}
+			if !individual.Equal(tt.wantIndividual) {
+				t.Errorf("Individually resolved images = %v, want %v", sets.List(individual), sets.List(tt.wantIndividual))
+			}
+		})
+	}
+}
+
 func TestRateLimitPerItem(t *testing.T) {
 	logger := logtesting.TestLogger(t)
 
@@ -229,14 +1201,14 @@ func TestRateLimitPerItem(t *testing.T) {
 	for i := 0; i < 3; i++ {
 		subject.Clear(types.NamespacedName{Name: revision.Name, Namespace: revision.Namespace})
 		start := time.Now()
-		initResolution, resolution, err := subject.Resolve(logger, revision, k8schain.Options{ServiceAccountName: "san"}, sets.New("skip"), 0)
+		initResolution, resolution, _, err := subject.Resolve(logger, revision, resolveOptions{opt: k8schain.Options{ServiceAccountName: "san"}, registriesToSkip: sets.New("skip")})
 		if err != nil || resolution != nil || initResolution != nil {
 			t.Fatalf("Expected Resolve to be nil, nil, nil but got %v, %v, %v", resolution, initResolution, err)
 		}
 
 		<-enqueue
 
-		_, _, err = subject.Resolve(logger, revision, k8schain.Options{ServiceAccountName: "san"}, sets.New("skip"), 0)
+		_, _, _, err = subject.Resolve(logger, revision, resolveOptions{opt: k8schain.Options{ServiceAccountName: "san"}, registriesToSkip: sets.New("skip")})
 		if err == nil {
 			t.Fatalf("Expected Resolve to fail")
 		}
@@ -251,7 +1223,7 @@ func TestRateLimitPerItem(t *testing.T) {
 
 	t.Run("Does not affect other revisions", func(t *testing.T) {
 		start := time.Now()
-		_, resolution, err := subject.Resolve(logger, rev("another-revision", "img1", "img2"), k8schain.Options{ServiceAccountName: "san"}, sets.New("skip"), 0)
+		_, resolution, _, err := subject.Resolve(logger, rev("another-revision", "img1", "img2"), resolveOptions{opt: k8schain.Options{ServiceAccountName: "san"}, registriesToSkip: sets.New("skip")})
 		if err != nil || resolution != nil {
 			t.Fatalf("Expected Resolve to be nil, nil but got %v, %v", resolution, err)
 		}
@@ -266,7 +1238,7 @@ func TestRateLimitPerItem(t *testing.T) {
 		subject.Forget(types.NamespacedName{Name: revision.Name, Namespace: revision.Namespace})
 
 		start := time.Now()
-		_, resolution, err := subject.Resolve(logger, revision, k8schain.Options{ServiceAccountName: "san"}, sets.New("skip"), 0)
+		_, resolution, _, err := subject.Resolve(logger, revision, resolveOptions{opt: k8schain.Options{ServiceAccountName: "san"}, registriesToSkip: sets.New("skip")})
 		if err != nil || resolution != nil {
 			t.Fatalf("Expected Resolve to be nil, nil but got %v, %v", resolution, err)
 		}
@@ -285,6 +1257,50 @@ func (r resolveFunc) Resolve(c context.Context, s string, o k8schain.Options, t
 	return r(c, s, o, t)
 }
 
+func (r resolveFunc) Labels(context.Context, string, k8schain.Options) (map[string]string, error) {
+	return nil, nil
+}
+
+func (r resolveFunc) CheckLayers(context.Context, string, k8schain.Options) error {
+	return nil
+}
+
+// labeledResolver resolves images with its resolveFunc and returns the labels
+// of the resolved images from its labels map.
+type labeledResolver struct {
+	resolveFunc
+	labels map[string]map[string]string
+}
+
+func (r *labeledResolver) Labels(_ context.Context, image string, _ k8schain.Options) (map[string]string, error) {
+	return r.labels[image], nil
+}
+
+// layerCheckingResolver resolves images with its resolveFunc and reports a
+// missing layer for the resolved images in its missing set.
+type layerCheckingResolver struct {
+	resolveFunc
+	missing sets.Set[string]
+}
+
+func (r *layerCheckingResolver) CheckLayers(_ context.Context, image string, _ k8schain.Options) error {
+	if r.missing.Has(image) {
+		return &missingImageLayerError{image: image, layer: "sha256:deadbeef"}
+	}
+	return nil
+}
+
+// batchResolver resolves images with its resolveFunc, or in batches with its
+// resolveBatch func.
+type batchResolver struct {
+	resolveFunc
+	resolveBatch func(context.Context, string, []string, k8schain.Options) (map[string]string, error)
+}
+
+func (r *batchResolver) ResolveBatch(ctx context.Context, registry string, images []string, opt k8schain.Options) (map[string]string, error) {
+	return r.resolveBatch(ctx, registry, images, opt)
+}
+
 func rev(name, firstImage, secondImage string) *v1.Revision {
 	return &v1.Revision{
 		ObjectMeta: metav1.ObjectMeta{
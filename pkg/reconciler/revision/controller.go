@@ -20,10 +20,11 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
 	"time"
 
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
-	"golang.org/x/time/rate"
 	cachingclient "knative.dev/caching/pkg/client/injection/client"
 	imageinformer "knative.dev/caching/pkg/client/injection/informers/caching/v1alpha1/image"
 	"knative.dev/networking/pkg/apis/networking/v1alpha1"
@@ -32,11 +33,17 @@ import (
 	"knative.dev/pkg/changeset"
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
 	deploymentinformer "knative.dev/pkg/client/injection/kube/informers/apps/v1/deployment"
+	limitrangeinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/limitrange"
+	namespaceinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/namespace"
+	serviceaccountinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/serviceaccount"
 	servingclient "knative.dev/serving/pkg/client/injection/client"
 	painformer "knative.dev/serving/pkg/client/injection/informers/autoscaling/v1alpha1/podautoscaler"
 	revisioninformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/revision"
 	revisionreconciler "knative.dev/serving/pkg/client/injection/reconciler/serving/v1/revision"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	netcfg "knative.dev/networking/pkg/config"
@@ -44,24 +51,54 @@ import (
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/metrics"
+	"knative.dev/pkg/system"
 	apisconfig "knative.dev/serving/pkg/apis/config"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	"knative.dev/serving/pkg/deployment"
 	"knative.dev/serving/pkg/reconciler/revision/config"
 )
 
-// digestResolutionWorkers is the number of image digest resolutions that can
-// take place in parallel. MaxIdleConns and MaxIdleConnsPerHost for the digest
-// resolution's Transport will also be set to this value.
-const digestResolutionWorkers = 100
-
 // NewController initializes the controller and is called by the generated code
 // Registers eventhandlers to enqueue events
 func NewController(
 	ctx context.Context,
 	cmw configmap.Watcher,
 ) *controller.Impl {
-	return newControllerWithOptions(ctx, cmw)
+	return newControllerWithOptions(ctx, cmw, digestResolutionWorkersFromConfig(ctx))
+}
+
+// digestResolutionWorkersFromConfig reads the number of digest resolution
+// workers from the deployment config map, as the workers are started once
+// along with the controller.
+func digestResolutionWorkersFromConfig(ctx context.Context) int {
+	logger := logging.FromContext(ctx)
+	cm, err := kubeclient.Get(ctx).CoreV1().ConfigMaps(system.Namespace()).Get(ctx, deployment.ConfigName, metav1.GetOptions{})
+	if err != nil {
+		logger.Warnw("Failed to get the deployment config map, using the default digest resolution workers", zap.Error(err))
+		return deployment.DigestResolutionWorkersDefault
+	}
+	cfg, err := deployment.NewConfigFromConfigMap(cm)
+	if err != nil {
+		logger.Warnw("Failed to parse the deployment config map, using the default digest resolution workers", zap.Error(err))
+		return deployment.DigestResolutionWorkersDefault
+	}
+	return cfg.DigestResolutionWorkers
+}
+
+// resolverIdentity returns the identity of this controller replica in the
+// requests sent to the registries, the name of its pod if known.
+func resolverIdentity() string {
+	if pod := os.Getenv("POD_NAME"); pod != "" {
+		return pod
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// leaderChecker tells whether this replica leads the bucket of a key, as
+// implemented by the generated reconciler.
+type leaderChecker interface {
+	IsLeaderFor(types.NamespacedName) bool
 }
 
 type reconcilerOption func(*Reconciler)
@@ -69,6 +106,7 @@ type reconcilerOption func(*Reconciler)
 func newControllerWithOptions(
 	ctx context.Context,
 	cmw configmap.Watcher,
+	digestResolutionWorkers int,
 	opts ...reconcilerOption,
 ) *controller.Impl {
 	logger := logging.FromContext(ctx)
@@ -77,6 +115,31 @@ func newControllerWithOptions(
 	imageInformer := imageinformer.Get(ctx)
 	paInformer := painformer.Get(ctx)
 	certificateInformer := certificateinformer.Get(ctx)
+	limitRangeInformer := limitrangeinformer.Get(ctx)
+	serviceAccountInformer := serviceaccountinformer.Get(ctx)
+	namespaceInformer := namespaceinformer.Get(ctx)
+
+	registryLimiter := newRegistryRateLimiter()
+	baseTransport := http.DefaultTransport.(*http.Transport)
+	if rt, err := newResolverTransport(k8sCertPath, digestResolutionWorkers, digestResolutionWorkers); err != nil {
+		logging.FromContext(ctx).Errorw("Failed to create resolver transport", zap.Error(err))
+	} else {
+		baseTransport = rt
+	}
+	connectionsTransport := &registryConnectionsTransport{base: baseTransport}
+	acceptTransport := &manifestAcceptTransport{inner: connectionsTransport}
+	identityTransport := &identityTransport{inner: acceptTransport, identity: resolverIdentity()}
+	digestResolver := &digestResolver{
+		client:      kubeclient.Get(ctx),
+		transport:   identityTransport,
+		userAgent:   fmt.Sprintf("knative/%s (serving)", changeset.Get()),
+		rateLimiter: registryLimiter,
+	}
+	namespaceConcurrency := atomic.NewInt32(0)
+	batchRegistries := atomic.NewPointer[sets.Set[string]](nil)
+	registryTimeouts := atomic.NewPointer[map[string]time.Duration](nil)
+	digestCacheTTL := atomic.NewDuration(0)
+	digestResolveLimiter := newDigestResolveRateLimiter()
 
 	c := &Reconciler{
 		kubeclient:       kubeclient.Get(ctx),
@@ -88,6 +151,10 @@ func newControllerWithOptions(
 		imageLister:         imageInformer.Lister(),
 		deploymentLister:    deploymentInformer.Lister(),
 		certificateLister:   certificateInformer.Lister(),
+
+		limitRangeLister:     limitRangeInformer.Lister(),
+		serviceAccountLister: serviceAccountInformer.Lister(),
+		namespaceLister:      namespaceInformer.Lister(),
 	}
 
 	impl := revisionreconciler.NewImpl(ctx, c, func(impl *controller.Impl) controller.Options {
@@ -98,11 +165,32 @@ func newControllerWithOptions(
 			&apisconfig.Defaults{},
 		}
 
-		resync := configmap.TypeFilter(configsToResync...)(func(string, interface{}) {
-			// Triggers syncs on all revisions when configuration
-			// changes
+		// Triggers syncs on all revisions when configuration changes,
+		// coalescing the changes within the configured delay.
+		resyncs := newResyncThrottler(func() {
 			impl.GlobalResync(revisionInformer.Informer())
 		})
+		resync := configmap.TypeFilter(configsToResync...)(func(_ string, value interface{}) {
+			if cfg, ok := value.(*deployment.Config); ok {
+				resyncs.SetDelay(cfg.ConfigChangeResyncDelay)
+				for _, classes := range cfg.AmbiguousRuntimeClassNames() {
+					logger.Warnf("The %s selectors of the runtime classes %q and %q are equally specific and may match the same revision, in which case %q is picked by name",
+						deployment.RuntimeClassNameKey, classes[0], classes[1], classes[0])
+				}
+				registryLimiter.Update(cfg.RegistriesResolutionRateLimits)
+				acceptTransport.Update(cfg.DigestResolutionAcceptMediaTypes)
+				connectionsTransport.Update(cfg.DigestResolutionRegistryConnections)
+				connectionsTransport.UpdateServerNames(cfg.DigestResolutionTLSServerNames)
+				digestResolver.preferLazyPull.Store(cfg.DigestResolutionPreferLazyPull)
+				identityTransport.enabled.Store(cfg.DigestResolutionIdentityHeader)
+				namespaceConcurrency.Store(int32(cfg.DigestResolutionNamespaceConcurrency))
+				batchRegistries.Store(&cfg.DigestResolutionBatchRegistries)
+				registryTimeouts.Store(&cfg.DigestResolutionTimeouts)
+				digestCacheTTL.Store(cfg.DigestResolutionCacheTTL)
+				digestResolveLimiter.Update(cfg)
+			}
+			resyncs.Trigger()
+		})
 
 		configStore := config.NewStore(logger.Named("config-store"), resync)
 		configStore.WatchConfigs(cmw)
@@ -111,22 +199,17 @@ func newControllerWithOptions(
 
 	c.tracker = impl.Tracker
 
-	transport := http.DefaultTransport
-	if rt, err := newResolverTransport(k8sCertPath, digestResolutionWorkers, digestResolutionWorkers); err != nil {
-		logging.FromContext(ctx).Errorw("Failed to create resolver transport", zap.Error(err))
-	} else {
-		transport = rt
-	}
+	digestResolveQueue := workqueue.NewNamedRateLimitingQueue(digestResolveLimiter, "digests")
 
-	userAgent := fmt.Sprintf("knative/%s (serving)", changeset.Get())
-
-	digestResolveQueue := workqueue.NewNamedRateLimitingQueue(workqueue.NewMaxOfRateLimiter(
-		newItemExponentialFailureRateLimiter(1*time.Second, 1000*time.Second),
-		// 10 qps, 100 bucket size.  This is only for retry speed and its only the overall factor (not per item)
-		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
-	), "digests")
-
-	resolver := newBackgroundResolver(logger, &digestResolver{client: kubeclient.Get(ctx), transport: transport, userAgent: userAgent}, digestResolveQueue, impl.EnqueueKey)
+	identityTransport.isLeader = func(rev types.NamespacedName) bool {
+		lc, ok := impl.Reconciler.(leaderChecker)
+		return ok && lc.IsLeaderFor(rev)
+	}
+	resolver := newBackgroundResolver(logger, digestResolver, digestResolveQueue, impl.EnqueueKey)
+	resolver.namespaceConcurrency = namespaceConcurrency
+	resolver.batchRegistries = batchRegistries
+	resolver.registryTimeouts = registryTimeouts
+	resolver.digestCacheTTL = digestCacheTTL
 	resolver.Start(ctx.Done(), digestResolutionWorkers)
 	c.resolver = resolver
 
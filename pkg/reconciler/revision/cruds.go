@@ -22,7 +22,9 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 
 	caching "knative.dev/caching/pkg/apis/caching/v1alpha1"
 	"knative.dev/pkg/kmeta"
@@ -37,7 +39,7 @@ import (
 func (c *Reconciler) createDeployment(ctx context.Context, rev *v1.Revision) (*appsv1.Deployment, error) {
 	cfgs := config.FromContext(ctx)
 
-	deployment, err := resources.MakeDeployment(rev, cfgs)
+	deployment, err := c.makeDeployment(ctx, rev, cfgs)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to make deployment: %w", err)
@@ -46,11 +48,57 @@ func (c *Reconciler) createDeployment(ctx context.Context, rev *v1.Revision) (*a
 	return c.kubeclient.AppsV1().Deployments(deployment.Namespace).Create(ctx, deployment, metav1.CreateOptions{})
 }
 
+// makeDeployment makes the Deployment of the revision. When image pull secrets
+// are configured centrally, the pods no longer get the image pull secrets of
+// their service account from its admission, so they are merged in here.
+func (c *Reconciler) makeDeployment(ctx context.Context, rev *v1.Revision, cfgs *config.Config) (*appsv1.Deployment, error) {
+	var nsLabels map[string]string
+	if len(cfgs.Deployment.DeploymentLabels) > 0 {
+		ns, err := c.namespaceLister.Get(rev.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get namespace %q: %w", rev.Namespace, err)
+		}
+		nsLabels = ns.Labels
+	}
+	deployment, err := resources.MakeDeployment(rev, nsLabels, cfgs)
+	if err != nil {
+		return nil, err
+	}
+	if cfgs.Deployment.QueueSidecarCheckLimitRanges {
+		lrs, err := c.limitRangeLister.LimitRanges(rev.Namespace).List(labels.Everything())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list limit ranges: %w", err)
+		}
+		if err := resources.CheckQueueLimitRanges(&deployment.Spec.Template.Spec, lrs); err != nil {
+			return nil, err
+		}
+	}
+	if len(cfgs.Deployment.ImagePullSecrets) == 0 || len(rev.Spec.ImagePullSecrets) > 0 {
+		return deployment, nil
+	}
+
+	saName := rev.Spec.ServiceAccountName
+	if saName == "" {
+		saName = "default"
+	}
+	sa, err := c.serviceAccountLister.ServiceAccounts(rev.Namespace).Get(saName)
+	if apierrs.IsNotFound(err) {
+		return deployment, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get service account %q: %w", saName, err)
+	}
+	podSpec := &deployment.Spec.Template.Spec
+	for _, secret := range sa.ImagePullSecrets {
+		podSpec.ImagePullSecrets = resources.AppendImagePullSecrets(podSpec.ImagePullSecrets, secret.Name)
+	}
+	return deployment, nil
+}
+
 func (c *Reconciler) checkAndUpdateDeployment(ctx context.Context, rev *v1.Revision, have *appsv1.Deployment) (*appsv1.Deployment, error) {
 	logger := logging.FromContext(ctx)
 	cfgs := config.FromContext(ctx)
 
-	deployment, err := resources.MakeDeployment(rev, cfgs)
+	deployment, err := c.makeDeployment(ctx, rev, cfgs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update deployment: %w", err)
 	}
@@ -94,6 +142,15 @@ func (c *Reconciler) checkAndUpdateDeployment(ctx context.Context, rev *v1.Revis
 	return d, nil
 }
 
+// adoptDeployment makes the revision the controller of the given deployment,
+// which must not have one yet. Its spec is reconciled afterwards like that of
+// any other deployment of a revision.
+func (c *Reconciler) adoptDeployment(ctx context.Context, rev *v1.Revision, have *appsv1.Deployment) (*appsv1.Deployment, error) {
+	desired := have.DeepCopy()
+	desired.OwnerReferences = append(desired.OwnerReferences, *kmeta.NewControllerRef(rev))
+	return c.kubeclient.AppsV1().Deployments(desired.Namespace).Update(ctx, desired, metav1.UpdateOptions{})
+}
+
 func (c *Reconciler) createImageCache(ctx context.Context, rev *v1.Revision, containerName, imageDigest string) (*caching.Image, error) {
 	image := resources.MakeImageCache(rev, containerName, imageDigest)
 	return c.cachingclient.CachingV1alpha1().Images(image.Namespace).Create(ctx, image, metav1.CreateOptions{})
@@ -0,0 +1,114 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/authn/k8schain"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/clock"
+)
+
+// keychainCacheTTL is how long the keychain built from the pull secrets of a
+// service account is reused before the secrets are read again, so that
+// rotated secrets are eventually picked up.
+const keychainCacheTTL = time.Minute
+
+// imagePullSecretsError is returned when the image pull secrets of a revision,
+// or its service account, cannot be read to authenticate with the registry.
+type imagePullSecretsError struct {
+	namespace      string
+	serviceAccount string
+	err            error
+}
+
+func (e *imagePullSecretsError) Error() string {
+	return fmt.Sprintf("failed to read the image pull secrets of service account %q in namespace %q: %v",
+		e.serviceAccount, e.namespace, e.err)
+}
+
+func (e *imagePullSecretsError) Unwrap() error {
+	return e.err
+}
+
+type keychainEntry struct {
+	keychain authn.Keychain
+	expires  time.Time
+}
+
+// keychainCache caches the keychains built from the image pull secrets of the
+// service accounts, so that resolving the images of a revision doesn't read
+// the same secrets from the API server over and over. Its zero value is ready
+// to use.
+type keychainCache struct {
+	clock clock.PassiveClock
+
+	mu      sync.Mutex
+	entries map[string]keychainEntry
+}
+
+// Get returns the keychain for the given options, building it from the
+// secrets read with client if it isn't cached or has expired. Failures to
+// read the secrets are returned as an *imagePullSecretsError and not cached.
+func (c *keychainCache) Get(ctx context.Context, client kubernetes.Interface, opt k8schain.Options) (authn.Keychain, error) {
+	key := opt.Namespace + "/" + opt.ServiceAccountName + "/" + strings.Join(opt.ImagePullSecrets, ",")
+	now := c.now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.keychain, nil
+	}
+
+	kc, err := k8schain.New(ctx, client, opt)
+	if err != nil {
+		sa := opt.ServiceAccountName
+		if sa == "" {
+			sa = "default"
+		}
+		return nil, &imagePullSecretsError{namespace: opt.Namespace, serviceAccount: sa, err: err}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]keychainEntry)
+	}
+	// Drop the expired entries while we're at it, so the namespaces and
+	// service accounts that are gone don't pile up.
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = keychainEntry{keychain: kc, expires: now.Add(keychainCacheTTL)}
+	return kc, nil
+}
+
+func (c *keychainCache) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn/k8schain"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	clocktest "k8s.io/utils/clock/testing"
+)
+
+func TestKeychainCache(t *testing.T) {
+	const ns, sa = "user-project", "user-robot"
+	client := fakeclient.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: sa, Namespace: ns},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "secret"}},
+	}, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: ns},
+		Type:       corev1.SecretTypeDockercfg,
+		Data:       map[string][]byte{corev1.DockerConfigKey: []byte("{}")},
+	})
+	clock := clocktest.NewFakePassiveClock(time.Now())
+	cache := &keychainCache{clock: clock}
+	opt := k8schain.Options{Namespace: ns, ServiceAccountName: sa}
+
+	reads := func() int {
+		n := 0
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "get" {
+				n++
+			}
+		}
+		return n
+	}
+
+	if _, err := cache.Get(context.Background(), client, opt); err != nil {
+		t.Fatal("Get() =", err)
+	}
+	want := reads()
+	if want == 0 {
+		t.Fatal("Get() read neither the service account nor its secrets")
+	}
+
+	// The cached keychain is reused.
+	if _, err := cache.Get(context.Background(), client, opt); err != nil {
+		t.Fatal("Get() =", err)
+	}
+	if got := reads(); got != want {
+		t.Errorf("Reads after a cached Get() = %d, want %d", got, want)
+	}
+
+	// Other pull secrets make another keychain.
+	other := opt
+	other.ImagePullSecrets = []string{"secret"}
+	if _, err := cache.Get(context.Background(), client, other); err != nil {
+		t.Fatal("Get() =", err)
+	}
+	if got := reads(); got == want {
+		t.Error("Get() with other pull secrets used the cached keychain")
+	}
+	want = reads()
+
+	// The secrets are read again once the keychain expires.
+	clock.SetTime(clock.Now().Add(keychainCacheTTL))
+	if _, err := cache.Get(context.Background(), client, opt); err != nil {
+		t.Fatal("Get() =", err)
+	}
+	if got := reads(); got == want {
+		t.Error("Get() used the expired keychain")
+	}
+}
+
+func TestKeychainCacheError(t *testing.T) {
+	client := fakeclient.NewSimpleClientset()
+	client.PrependReactor("get", "serviceaccounts", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+
+	var cache keychainCache
+	_, err := cache.Get(context.Background(), client, k8schain.Options{Namespace: "user-project"})
+	var secretsErr *imagePullSecretsError
+	if !errors.As(err, &secretsErr) {
+		t.Fatalf("Get() = %v, want an imagePullSecretsError", err)
+	}
+	if got, want := secretsErr.serviceAccount, "default"; got != want {
+		t.Errorf("serviceAccount = %q, want %q", got, want)
+	}
+	if len(cache.entries) != 0 {
+		t.Error("The failure was cached")
+	}
+}
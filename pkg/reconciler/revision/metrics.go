@@ -0,0 +1,122 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"time"
+
+	pkgmetrics "knative.dev/pkg/metrics"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+const (
+	// imageReferencePinned tags the images referenced by digest already.
+	imageReferencePinned = "pinned"
+	// imageReferenceResolved tags the images resolved from a tag to a digest.
+	imageReferenceResolved = "resolved"
+
+	// resolutionOutcomeSuccess and resolutionOutcomeFailure tag the outcome
+	// of a digest resolution.
+	resolutionOutcomeSuccess = "success"
+	resolutionOutcomeFailure = "failure"
+)
+
+var (
+	imageResolutionCountM = stats.Int64(
+		"image_digest_resolution_count",
+		"Number of container images of revisions resolved to a digest",
+		stats.UnitDimensionless)
+
+	resolutionCountM = stats.Int64(
+		"image_digest_resolution_outcome_count",
+		"Number of digest resolutions of container images, by outcome",
+		stats.UnitDimensionless)
+	resolutionLatencyM = stats.Float64(
+		"image_digest_resolution_latencies",
+		"The time to resolve a container image to a digest, waiting in the queue included, in milliseconds",
+		stats.UnitMilliseconds)
+
+	imageReferenceKey = tag.MustNewKey("image_reference")
+	registryKey       = tag.MustNewKey("registry")
+	outcomeKey        = tag.MustNewKey("outcome")
+
+	// NOTE: 0 should not be used as boundary. See
+	// https://github.com/census-ecosystem/opencensus-go-exporter-stackdriver/issues/98
+	resolutionLatencyDistribution = view.Distribution(5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 20000, 30000, 60000, 120000)
+)
+
+func init() {
+	register()
+}
+
+func register() {
+	if err := pkgmetrics.RegisterResourceView(
+		&view.View{
+			Description: "Number of container images of revisions resolved to a digest, by whether they were pinned to one already",
+			Measure:     imageResolutionCountM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{imageReferenceKey},
+		},
+		&view.View{
+			Description: "Number of digest resolutions of container images, by registry and outcome",
+			Measure:     resolutionCountM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{registryKey, outcomeKey},
+		},
+		&view.View{
+			Description: "The time to resolve a container image to a digest, waiting in the queue included, in milliseconds",
+			Measure:     resolutionLatencyM,
+			Aggregation: resolutionLatencyDistribution,
+			TagKeys:     []tag.Key{registryKey, outcomeKey},
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// recordImageResolution records the resolution of an image to a digest,
+// tagged with whether the image was pinned to the digest already.
+func recordImageResolution(pinned bool) {
+	reference := imageReferenceResolved
+	if pinned {
+		reference = imageReferencePinned
+	}
+	ctx, err := tag.New(context.Background(), tag.Upsert(imageReferenceKey, reference))
+	if err != nil {
+		return
+	}
+	pkgmetrics.Record(ctx, imageResolutionCountM.M(1))
+}
+
+// recordResolution records the outcome and latency of the resolution of an
+// image of the given registry to a digest.
+func recordResolution(registry string, err error, latency time.Duration) {
+	outcome := resolutionOutcomeSuccess
+	if err != nil {
+		outcome = resolutionOutcomeFailure
+	}
+	ctx, err := tag.New(context.Background(), tag.Upsert(registryKey, registry), tag.Upsert(outcomeKey, outcome))
+	if err != nil {
+		return
+	}
+	pkgmetrics.Record(ctx, resolutionCountM.M(1))
+	pkgmetrics.Record(ctx, resolutionLatencyM.M(float64(latency.Milliseconds())))
+}
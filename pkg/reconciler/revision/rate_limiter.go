@@ -17,11 +17,14 @@ limitations under the License.
 package revision
 
 import (
+	"context"
 	"math"
 	"sync"
 	"time"
 
+	"golang.org/x/time/rate"
 	"k8s.io/client-go/util/workqueue"
+	"knative.dev/serving/pkg/deployment"
 )
 
 // itemExponentialFailureRateLimiter does a simple baseDelay*2^<num-failures> limit
@@ -41,7 +44,7 @@ type itemExponentialFailureRateLimiter struct {
 
 var _ workqueue.RateLimiter = &itemExponentialFailureRateLimiter{}
 
-func newItemExponentialFailureRateLimiter(baseDelay time.Duration, maxDelay time.Duration) workqueue.RateLimiter {
+func newItemExponentialFailureRateLimiter(baseDelay time.Duration, maxDelay time.Duration) *itemExponentialFailureRateLimiter {
 	return &itemExponentialFailureRateLimiter{
 		failures:  map[interface{}]int{},
 		baseDelay: baseDelay,
@@ -49,6 +52,16 @@ func newItemExponentialFailureRateLimiter(baseDelay time.Duration, maxDelay time
 	}
 }
 
+// SetDelays updates the base and max delays, applying to the next retries of
+// the items which are already failing as well.
+func (r *itemExponentialFailureRateLimiter) SetDelays(baseDelay time.Duration, maxDelay time.Duration) {
+	r.failuresLock.Lock()
+	defer r.failuresLock.Unlock()
+
+	r.baseDelay = baseDelay
+	r.maxDelay = maxDelay
+}
+
 func (r *itemExponentialFailureRateLimiter) When(item interface{}) time.Duration {
 	r.failuresLock.Lock()
 	defer r.failuresLock.Unlock()
@@ -89,3 +102,88 @@ func (r *itemExponentialFailureRateLimiter) Forget(item interface{}) {
 	defer r.failuresLock.Unlock()
 	delete(r.failures, item)
 }
+
+// digestResolveRateLimiter is the rate limiter of the digest resolve queue,
+// the max of the per-item exponential backoff and of a token bucket pacing all
+// the retries together.
+type digestResolveRateLimiter struct {
+	workqueue.RateLimiter
+
+	retry   *itemExponentialFailureRateLimiter
+	overall *rate.Limiter
+}
+
+// newDigestResolveRateLimiter creates a digestResolveRateLimiter set up with
+// the defaults of the deployment config.
+func newDigestResolveRateLimiter() *digestResolveRateLimiter {
+	r := &digestResolveRateLimiter{
+		retry: newItemExponentialFailureRateLimiter(deployment.DigestResolutionRetryBaseDelayDefault,
+			deployment.DigestResolutionRetryMaxDelayDefault),
+		overall: rate.NewLimiter(rate.Limit(deployment.DigestResolutionRetryQPSDefault),
+			deployment.DigestResolutionRetryBurstDefault),
+	}
+	r.RateLimiter = workqueue.NewMaxOfRateLimiter(r.retry, &workqueue.BucketRateLimiter{Limiter: r.overall})
+	return r
+}
+
+// Update applies the retry settings of the given deployment config.
+func (r *digestResolveRateLimiter) Update(cfg *deployment.Config) {
+	r.retry.SetDelays(cfg.DigestResolutionRetryBaseDelay, cfg.DigestResolutionRetryMaxDelay)
+	r.overall.SetLimit(rate.Limit(cfg.DigestResolutionRetryQPS))
+	r.overall.SetBurst(cfg.DigestResolutionRetryBurst)
+}
+
+// registryRateLimiter paces the digest resolution requests sent to each
+// registry using a token bucket per registry host. It is distinct from the
+// workqueue rate limiters above, which only control retries. Registries without
+// a configured limit are not rate limited. A nil registryRateLimiter never
+// blocks.
+type registryRateLimiter struct {
+	mu       sync.RWMutex
+	limiters map[string]*rate.Limiter
+}
+
+func newRegistryRateLimiter() *registryRateLimiter {
+	return &registryRateLimiter{
+		limiters: map[string]*rate.Limiter{},
+	}
+}
+
+// Update replaces the configured per registry limits. The token buckets of
+// registries which remain limited are adjusted in place so their current
+// state is preserved.
+func (r *registryRateLimiter) Update(limits map[string]deployment.RegistryRateLimit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for registry := range r.limiters {
+		if _, ok := limits[registry]; !ok {
+			delete(r.limiters, registry)
+		}
+	}
+	for registry, limit := range limits {
+		if l, ok := r.limiters[registry]; ok {
+			l.SetLimit(rate.Limit(limit.QPS))
+			l.SetBurst(limit.Burst)
+			continue
+		}
+		r.limiters[registry] = rate.NewLimiter(rate.Limit(limit.QPS), limit.Burst)
+	}
+}
+
+// Wait blocks until a resolution request may be sent to the given registry or
+// the context is done.
+func (r *registryRateLimiter) Wait(ctx context.Context, registry string) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	l := r.limiters[registry]
+	r.mu.RUnlock()
+
+	if l == nil {
+		return nil
+	}
+	return l.Wait(ctx)
+}
@@ -19,6 +19,9 @@ package revision
 import (
 	"testing"
 	"time"
+
+	"golang.org/x/time/rate"
+	"knative.dev/serving/pkg/deployment"
 )
 
 // Copyright 2016 The Kubernetes Authors.
@@ -66,6 +69,35 @@ func TestItemExponentialFailureRateLimiter(t *testing.T) {
 
 }
 
+func TestDigestResolveRateLimiterUpdate(t *testing.T) {
+	limiter := newDigestResolveRateLimiter()
+	if got, want := limiter.overall.Limit(), rate.Limit(deployment.DigestResolutionRetryQPSDefault); got != want {
+		t.Errorf("Limit() = %v, want: %v", got, want)
+	}
+	if got, want := limiter.overall.Burst(), deployment.DigestResolutionRetryBurstDefault; got != want {
+		t.Errorf("Burst() = %v, want: %v", got, want)
+	}
+
+	limiter.Update(&deployment.Config{
+		DigestResolutionRetryBaseDelay: 10 * time.Millisecond,
+		DigestResolutionRetryMaxDelay:  30 * time.Second,
+		DigestResolutionRetryQPS:       2.5,
+		DigestResolutionRetryBurst:     5,
+	})
+	if got, want := limiter.retry.baseDelay, 10*time.Millisecond; got != want {
+		t.Errorf("baseDelay = %v, want: %v", got, want)
+	}
+	if got, want := limiter.retry.maxDelay, 30*time.Second; got != want {
+		t.Errorf("maxDelay = %v, want: %v", got, want)
+	}
+	if got, want := limiter.overall.Limit(), rate.Limit(2.5); got != want {
+		t.Errorf("Limit() = %v, want: %v", got, want)
+	}
+	if got, want := limiter.overall.Burst(), 5; got != want {
+		t.Errorf("Burst() = %v, want: %v", got, want)
+	}
+}
+
 func TestItemExponentialFailureRateLimiterOverFlow(t *testing.T) {
 	limiter := newItemExponentialFailureRateLimiter(1*time.Millisecond, 1000*time.Second)
 	for i := 0; i < 5; i++ {
@@ -98,3 +130,23 @@ func TestItemExponentialFailureRateLimiterOverFlow(t *testing.T) {
 	}
 
 }
+
+func TestItemExponentialFailureRateLimiterSetDelays(t *testing.T) {
+	limiter := newItemExponentialFailureRateLimiter(1*time.Millisecond, 1*time.Second)
+	limiter.When("one")
+	limiter.When("one")
+
+	// The configured delays apply to the next retries of failing items too.
+	limiter.SetDelays(10*time.Millisecond, 30*time.Millisecond)
+	if e, a := 20*time.Millisecond, limiter.When("one"); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if e, a := 30*time.Millisecond, limiter.When("one"); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+
+	limiter.When("two")
+	if e, a := 10*time.Millisecond, limiter.When("two"); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
@@ -18,6 +18,7 @@ package revision
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"go.uber.org/zap"
@@ -32,6 +33,7 @@ import (
 
 	networkingApi "knative.dev/networking/pkg/apis/networking"
 	"knative.dev/networking/pkg/certificates"
+	"knative.dev/pkg/controller"
 	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/kmp"
 	"knative.dev/pkg/logging"
@@ -54,6 +56,10 @@ func (c *Reconciler) reconcileDeployment(ctx context.Context, rev *v1.Revision)
 		rev.Status.MarkResourcesAvailableUnknown(v1.ReasonDeploying, "")
 		rev.Status.MarkContainerHealthyUnknown(v1.ReasonDeploying, "")
 		if _, err = c.createDeployment(ctx, rev); err != nil {
+			if err := markPortCollision(rev, err); err != nil {
+				return err
+			}
+			markLimitRangeViolation(rev, err)
 			return fmt.Errorf("failed to create deployment %q: %w", deploymentName, err)
 		}
 		logger.Infof("Created deployment %q", deploymentName)
@@ -61,14 +67,24 @@ func (c *Reconciler) reconcileDeployment(ctx context.Context, rev *v1.Revision)
 	} else if err != nil {
 		return fmt.Errorf("failed to get deployment %q: %w", deploymentName, err)
 	} else if !metav1.IsControlledBy(deployment, rev) {
-		// Surface an error in the revision's status, and return an error.
-		rev.Status.MarkResourcesAvailableFalse(v1.ReasonNotOwned, v1.ResourceNotOwnedMessage("Deployment", deploymentName))
-		return fmt.Errorf("revision: %q does not own Deployment: %q", rev.Name, deploymentName)
+		if !config.FromContext(ctx).Deployment.AdoptExistingDeployments || metav1.GetControllerOf(deployment) != nil {
+			// Surface an error in the revision's status, and return an error.
+			rev.Status.MarkResourcesAvailableFalse(v1.ReasonNotOwned, v1.ResourceNotOwnedMessage("Deployment", deploymentName))
+			return fmt.Errorf("revision: %q does not own Deployment: %q", rev.Name, deploymentName)
+		}
+		if deployment, err = c.adoptDeployment(ctx, rev, deployment); err != nil {
+			return fmt.Errorf("failed to adopt deployment %q: %w", deploymentName, err)
+		}
+		logger.Infof("Adopted deployment %q", deploymentName)
 	}
 
 	// The deployment exists, but make sure that it has the shape that we expect.
 	deployment, err = c.checkAndUpdateDeployment(ctx, rev, deployment)
 	if err != nil {
+		if err := markPortCollision(rev, err); err != nil {
+			return err
+		}
+		markLimitRangeViolation(rev, err)
 		return fmt.Errorf("failed to update deployment %q: %w", deploymentName, err)
 	}
 
@@ -120,6 +136,29 @@ func (c *Reconciler) reconcileDeployment(ctx context.Context, rev *v1.Revision)
 	return nil
 }
 
+// markPortCollision surfaces a port collision between the containers of the
+// revision's pods in its status, and returns a permanent error since retrying
+// can't succeed until the revision or the configuration changes. It returns
+// nil for any other error.
+func markPortCollision(rev *v1.Revision, err error) error {
+	var pce *resources.PortCollisionError
+	if !errors.As(err, &pce) {
+		return nil
+	}
+	rev.Status.MarkResourcesAvailableFalse(v1.ReasonPortCollision, pce.Error())
+	return controller.NewPermanentError(err)
+}
+
+// markLimitRangeViolation surfaces the queue-proxy resources violating a
+// LimitRange of the namespace in the revision's status. The error is retried,
+// since the LimitRange may be changed at any time.
+func markLimitRangeViolation(rev *v1.Revision, err error) {
+	var lrve *resources.LimitRangeViolationError
+	if errors.As(err, &lrve) {
+		rev.Status.MarkResourcesAvailableFalse(v1.ReasonLimitRangeViolation, lrve.Error())
+	}
+}
+
 func (c *Reconciler) reconcileImageCache(ctx context.Context, rev *v1.Revision) error {
 	logger := logging.FromContext(ctx)
 
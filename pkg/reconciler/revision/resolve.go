@@ -17,25 +17,41 @@ limitations under the License.
 package revision
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"net"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/google/go-containerregistry/pkg/authn/k8schain"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"go.uber.org/atomic"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
 )
 
 type digestResolver struct {
-	client    kubernetes.Interface
-	transport http.RoundTripper
-	userAgent string
+	client      kubernetes.Interface
+	transport   http.RoundTripper
+	userAgent   string
+	rateLimiter *registryRateLimiter
+	keychains   keychainCache
+
+	// preferLazyPull resolves tags pointing at an index holding both lazy-pull
+	// and regular variants of an image to the lazy-pull one.
+	preferLazyPull atomic.Bool
 }
 
 const (
@@ -44,6 +60,17 @@ const (
 	k8sCertPath = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
 
 	tlsMinVersionEnvKey = "TAG_TO_DIGEST_TLS_MIN_VERSION"
+
+	// estargzTOCDigestAnnotation is the layer annotation marking eStargz layers.
+	estargzTOCDigestAnnotation = "containerd.io/snapshot/stargz/toc.digest"
+
+	// sociIndexDigestAnnotation is the annotation of the image manifests in an
+	// index pointing at their SOCI index.
+	sociIndexDigestAnnotation = "com.amazon.soci.index-digest"
+
+	// batchManifestsPath is the endpoint of the registries resolving several
+	// tags to digests with a single request, see ResolveBatch.
+	batchManifestsPath = "/v2/_batch/manifests"
 )
 
 // newResolverTransport returns an http.Transport that appends the certs bundle
@@ -73,6 +100,174 @@ func newResolverTransport(path string, maxIdleConns, maxIdleConnsPerHost int) (*
 	return transport, nil
 }
 
+// resolverIdentityHeader is the header identifying the controller replica
+// sending the requests to the registries, followed by whether it leads the
+// revision it resolves the image for when known, e.g.
+// "controller-5d9f7c8b4-x2x7q; leader=true".
+const resolverIdentityHeader = "K-Resolver-Identity"
+
+// resolvingRevisionKey is the context key of the revision an image is
+// resolved for.
+type resolvingRevisionKey struct{}
+
+// withResolvingRevision attaches the revision an image is resolved for to the
+// context.
+func withResolvingRevision(ctx context.Context, rev types.NamespacedName) context.Context {
+	return context.WithValue(ctx, resolvingRevisionKey{}, rev)
+}
+
+// resolvingRevisionFrom returns the revision an image is resolved for, if
+// known.
+func resolvingRevisionFrom(ctx context.Context) (types.NamespacedName, bool) {
+	rev, ok := ctx.Value(resolvingRevisionKey{}).(types.NamespacedName)
+	return rev, ok
+}
+
+// identityTransport tags the requests sent to the registries with the
+// resolverIdentityHeader while enabled, so that the registries can attribute
+// the traffic to the controller replicas and the resolutions made by the
+// replicas not leading the revision stand out.
+type identityTransport struct {
+	inner    http.RoundTripper
+	identity string
+	// isLeader tells whether this replica leads the given revision. It is set
+	// once before the first request.
+	isLeader func(types.NamespacedName) bool
+
+	enabled atomic.Bool
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *identityTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.enabled.Load() {
+		value := t.identity
+		if rev, ok := resolvingRevisionFrom(req.Context()); ok && t.isLeader != nil {
+			value += fmt.Sprintf("; leader=%t", t.isLeader(rev))
+		}
+		req = req.Clone(req.Context())
+		req.Header.Set(resolverIdentityHeader, value)
+	}
+	return t.inner.RoundTrip(req)
+}
+
+// manifestAcceptTransport overrides the Accept header of the manifest HEAD
+// requests resolving tags to digests with the configured media types. The
+// requests fetching the image labels are left alone, since they must accept
+// whatever the resolved digest points at.
+type manifestAcceptTransport struct {
+	inner http.RoundTripper
+
+	mu     sync.RWMutex
+	accept string
+}
+
+// Update replaces the accepted media types, in order of preference. If there
+// are none, the Accept header chosen by go-containerregistry is kept.
+func (t *manifestAcceptTransport) Update(mediaTypes []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.accept = strings.Join(mediaTypes, ",")
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *manifestAcceptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	accept := t.accept
+	t.mu.RUnlock()
+
+	if accept != "" && req.Method == http.MethodHead && strings.Contains(req.URL.Path, "/manifests/") {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept", accept)
+	}
+	return t.inner.RoundTrip(req)
+}
+
+// registryConnectionsTransport caps the connections to each registry host,
+// so that a slow registry cannot take up all the connections of the pool
+// shared by the registries and delay the resolutions from the others. It also
+// overrides the server name verified in the TLS handshake with specific
+// registry hosts, e.g. registries reachable by IP address with a certificate
+// for a hostname.
+type registryConnectionsTransport struct {
+	base *http.Transport
+
+	mu          sync.RWMutex
+	limit       int
+	limited     *http.Transport
+	serverNames map[string]string
+	hosts       map[string]*http.Transport
+}
+
+// Update sets the maximum number of connections per registry host. If it is
+// zero, the connections are not limited.
+func (t *registryConnectionsTransport) Update(limit int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if limit == t.limit {
+		return
+	}
+	old := t.limited
+	t.limit, t.limited = limit, nil
+	if limit > 0 {
+		t.limited = t.base.Clone()
+		t.limited.MaxConnsPerHost = limit
+	}
+	if old != nil {
+		// The requests in flight complete on their connections regardless.
+		old.CloseIdleConnections()
+	}
+	t.updateHosts()
+}
+
+// UpdateServerNames sets the server names, keyed by registry host, to send
+// and verify in the TLS handshake in place of the host.
+func (t *registryConnectionsTransport) UpdateServerNames(serverNames map[string]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if maps.Equal(serverNames, t.serverNames) {
+		return
+	}
+	t.serverNames = serverNames
+	t.updateHosts()
+}
+
+// updateHosts recreates the transports of the hosts with a server name
+// override, applying the connection limit. t.mu must be held.
+func (t *registryConnectionsTransport) updateHosts() {
+	for _, rt := range t.hosts {
+		rt.CloseIdleConnections()
+	}
+	t.hosts = nil
+	if len(t.serverNames) == 0 {
+		return
+	}
+	t.hosts = make(map[string]*http.Transport, len(t.serverNames))
+	for host, serverName := range t.serverNames {
+		rt := t.base.Clone()
+		rt.MaxConnsPerHost = t.limit
+		if rt.TLSClientConfig == nil {
+			rt.TLSClientConfig = &tls.Config{}
+		}
+		rt.TLSClientConfig.ServerName = serverName
+		t.hosts[host] = rt
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *registryConnectionsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	rt, ok := t.hosts[req.URL.Host]
+	if !ok {
+		rt = t.limited
+	}
+	t.mu.RUnlock()
+
+	if rt == nil {
+		return t.base.RoundTrip(req)
+	}
+	return rt.RoundTrip(req)
+}
+
 func tlsMinVersionFromEnv(defaultTLSMinVersion uint16) uint16 {
 	switch tlsMinVersion := os.Getenv(tlsMinVersionEnvKey); tlsMinVersion {
 	case "1.2":
@@ -92,14 +287,14 @@ func (r *digestResolver) Resolve(
 	image string,
 	opt k8schain.Options,
 	registriesToSkip sets.Set[string]) (string, error) {
-	kc, err := k8schain.New(ctx, r.client, opt)
-	if err != nil {
-		return "", fmt.Errorf("failed to initialize authentication: %w", err)
+	if isDigest(image) {
+		// Already a digest, there is no need to fetch the credentials.
+		return image, nil
 	}
 
-	if _, err := name.NewDigest(image, name.WeakValidation); err == nil {
-		// Already a digest
-		return image, nil
+	kc, err := r.keychains.Get(ctx, r.client, opt)
+	if err != nil {
+		return "", err
 	}
 
 	tag, err := name.NewTag(image, name.WeakValidation)
@@ -111,9 +306,334 @@ func (r *digestResolver) Resolve(
 		return "", nil
 	}
 
-	desc, err := remote.Head(tag, remote.WithContext(ctx), remote.WithTransport(r.transport), remote.WithAuthFromKeychain(kc), remote.WithUserAgent(r.userAgent))
+	if err := r.rateLimiter.Wait(ctx, tag.Registry.RegistryStr()); err != nil {
+		return "", fmt.Errorf("failed to wait for the rate limit of registry %q: %w", tag.Registry.RegistryStr(), err)
+	}
+
+	opts := []remote.Option{remote.WithContext(ctx), remote.WithTransport(r.transport), remote.WithAuthFromKeychain(kc), remote.WithUserAgent(r.userAgent)}
+	desc, err := remote.Head(tag, opts...)
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%s@%s", tag.Repository.String(), desc.Digest), nil
+	digest := desc.Digest
+	if r.preferLazyPull.Load() && desc.MediaType.IsIndex() {
+		lazy, err := r.lazyPullVariant(ctx, tag.Context().Digest(desc.Digest.String()), opts...)
+		if err != nil {
+			return "", fmt.Errorf("failed to look for a lazy-pull variant of image %q: %w", image, err)
+		}
+		if lazy != nil {
+			digest = *lazy
+		}
+	}
+	return fmt.Sprintf("%s@%s", tag.Repository.String(), digest), nil
+}
+
+// batchManifestsRequest is the body of a request to batchManifestsPath.
+type batchManifestsRequest struct {
+	References []string `json:"references"`
+}
+
+// batchManifestsResponse is the body of a response of batchManifestsPath.
+type batchManifestsResponse struct {
+	Manifests []struct {
+		Reference string `json:"reference"`
+		Digest    string `json:"digest"`
+	} `json:"manifests"`
+}
+
+// ResolveBatch resolves the image references, which use tags of the given
+// registry, to digests with a single request to the batch manifest endpoint
+// of the registry. It POSTs the references, e.g.
+// {"references": ["registry/repo:tag"]}, to batchManifestsPath and expects
+// their digests in return, e.g.
+// {"manifests": [{"reference": "registry/repo:tag", "digest": "sha256:..."}]}.
+// The images missing from the response are left out of the returned map.
+func (r *digestResolver) ResolveBatch(
+	ctx context.Context,
+	registry string,
+	images []string,
+	opt k8schain.Options) (map[string]string, error) {
+	kc, err := r.keychains.Get(ctx, r.client, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := name.NewRegistry(registry, name.WeakValidation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse registry name %q: %w", registry, err)
+	}
+	// Several images may refer to the same tag, e.g. "ubuntu" and "ubuntu:latest".
+	tags := make(map[string]name.Tag, len(images))
+	imagesOfTag := make(map[string][]string, len(images))
+	req := batchManifestsRequest{References: make([]string, 0, len(images))}
+	scopes := make([]string, 0, len(images))
+	for _, image := range images {
+		tag, err := name.NewTag(image, name.WeakValidation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse image name %q into a tag: %w", image, err)
+		}
+		if tag.Registry.RegistryStr() != registry {
+			return nil, fmt.Errorf("image %q is not of registry %q", image, registry)
+		}
+		ref := tag.Name()
+		if _, ok := tags[ref]; !ok {
+			tags[ref] = tag
+			req.References = append(req.References, ref)
+			scopes = append(scopes, tag.Scope(transport.PullScope))
+		}
+		imagesOfTag[ref] = append(imagesOfTag[ref], image)
+	}
+
+	auth, err := kc.Resolve(reg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve the credentials of registry %q: %w", registry, err)
+	}
+	if err := r.rateLimiter.Wait(ctx, registry); err != nil {
+		return nil, fmt.Errorf("failed to wait for the rate limit of registry %q: %w", registry, err)
+	}
+	rt, err := transport.NewWithContext(ctx, reg, auth, r.transport, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s://%s%s", reg.Scheme(), reg.RegistryStr(), batchManifestsPath), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if r.userAgent != "" {
+		httpReq.Header.Set("User-Agent", r.userAgent)
+	}
+	resp, err := rt.RoundTrip(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := transport.CheckError(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	var batch batchManifestsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return nil, fmt.Errorf("failed to decode the batch manifests response: %w", err)
+	}
+	digests := make(map[string]string, len(images))
+	for _, m := range batch.Manifests {
+		tag, ok := tags[m.Reference]
+		if !ok {
+			continue
+		}
+		digest, err := v1.NewHash(m.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest %q of image %q: %w", m.Digest, m.Reference, err)
+		}
+		for _, image := range imagesOfTag[m.Reference] {
+			digests[image] = fmt.Sprintf("%s@%s", tag.Repository.String(), digest)
+		}
+	}
+	return digests, nil
+}
+
+// lazyPullVariant returns the digest of the lazy-pull variant of the image in
+// the given index, if the index holds both lazy-pull and regular variants of
+// an image for a single platform, or nil otherwise. Indexes spanning several
+// platforms are left alone, since picking a single variant would break the
+// other platforms.
+func (r *digestResolver) lazyPullVariant(ctx context.Context, ref name.Digest, opts ...remote.Option) (*v1.Hash, error) {
+	if err := r.rateLimiter.Wait(ctx, ref.Registry.RegistryStr()); err != nil {
+		return nil, fmt.Errorf("failed to wait for the rate limit of registry %q: %w", ref.Registry.RegistryStr(), err)
+	}
+	idx, err := remote.Index(ref, opts...)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		platform     *v1.Platform
+		lazy         *v1.Hash
+		foundRegular bool
+	)
+	for _, desc := range manifest.Manifests {
+		// Skip nested indexes and the attestations attached by buildkit.
+		if !desc.MediaType.IsImage() || (desc.Platform != nil && desc.Platform.OS == "unknown") {
+			continue
+		}
+		if platform == nil {
+			platform = desc.Platform
+		} else if desc.Platform != nil && !desc.Platform.Equals(*platform) {
+			return nil, nil
+		}
+
+		isLazy, err := isLazyPullImage(idx, desc)
+		if err != nil {
+			return nil, err
+		}
+		if !isLazy {
+			foundRegular = true
+		} else if lazy == nil {
+			lazy = &desc.Digest
+		}
+	}
+	if !foundRegular {
+		return nil, nil
+	}
+	return lazy, nil
+}
+
+// isLazyPullImage returns whether the image of the descriptor in the index is
+// in a lazy-pull format, i.e. has a SOCI index or eStargz layers.
+func isLazyPullImage(idx v1.ImageIndex, desc v1.Descriptor) (bool, error) {
+	if _, ok := desc.Annotations[sociIndexDigestAnnotation]; ok {
+		return true, nil
+	}
+	img, err := idx.Image(desc.Digest)
+	if err != nil {
+		return false, err
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch the manifest %s: %w", desc.Digest, err)
+	}
+	for _, layer := range manifest.Layers {
+		if _, ok := layer.Annotations[estargzTOCDigestAnnotation]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Labels returns the labels of the config of the given image, which is
+// expected to be a digest reference as returned by Resolve.
+func (r *digestResolver) Labels(ctx context.Context, image string, opt k8schain.Options) (map[string]string, error) {
+	kc, err := r.keychains.Get(ctx, r.client, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := name.NewDigest(image, name.WeakValidation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image name %q into a digest: %w", image, err)
+	}
+
+	if err := r.rateLimiter.Wait(ctx, digest.Registry.RegistryStr()); err != nil {
+		return nil, fmt.Errorf("failed to wait for the rate limit of registry %q: %w", digest.Registry.RegistryStr(), err)
+	}
+
+	img, err := remote.Image(digest, remote.WithContext(ctx), remote.WithTransport(r.transport), remote.WithAuthFromKeychain(kc), remote.WithUserAgent(r.userAgent))
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the config of image %q: %w", image, err)
+	}
+	return cfg.Config.Labels, nil
+}
+
+// CheckLayers checks that every layer of the given image, which is expected to
+// be a digest reference as returned by Resolve, exists in its registry. If one
+// is missing, a *missingImageLayerError is returned.
+func (r *digestResolver) CheckLayers(ctx context.Context, image string, opt k8schain.Options) error {
+	kc, err := r.keychains.Get(ctx, r.client, opt)
+	if err != nil {
+		return err
+	}
+
+	digest, err := name.NewDigest(image, name.WeakValidation)
+	if err != nil {
+		return fmt.Errorf("failed to parse image name %q into a digest: %w", image, err)
+	}
+
+	if err := r.rateLimiter.Wait(ctx, digest.Registry.RegistryStr()); err != nil {
+		return fmt.Errorf("failed to wait for the rate limit of registry %q: %w", digest.Registry.RegistryStr(), err)
+	}
+
+	opts := []remote.Option{remote.WithContext(ctx), remote.WithTransport(r.transport), remote.WithAuthFromKeychain(kc), remote.WithUserAgent(r.userAgent)}
+	img, err := remote.Image(digest, opts...)
+	if err != nil {
+		return err
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return fmt.Errorf("failed to fetch the manifest of image %q: %w", image, err)
+	}
+	for _, desc := range manifest.Layers {
+		// Foreign layers are not pulled from the registry.
+		if !desc.MediaType.IsDistributable() {
+			continue
+		}
+		layer, err := remote.Layer(digest.Context().Digest(desc.Digest.String()), opts...)
+		if err != nil {
+			return err
+		}
+		// Size issues a HEAD request for the blob.
+		if _, err := layer.Size(); err != nil {
+			var terr *transport.Error
+			if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+				return &missingImageLayerError{image: image, layer: desc.Digest.String()}
+			}
+			return fmt.Errorf("failed to check layer %s of image %q: %w", desc.Digest, image, err)
+		}
+	}
+	return nil
+}
+
+// isImageNotFound reports whether the error is the registry reporting that the
+// image, or its repository, does not exist.
+func isImageNotFound(err error) bool {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	if terr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	for _, diag := range terr.Errors {
+		if diag.Code == transport.ManifestUnknownErrorCode || diag.Code == transport.NameUnknownErrorCode {
+			return true
+		}
+	}
+	return false
+}
+
+// isImageUnauthorized reports whether the error means that the registry denied
+// access to the image.
+func isImageUnauthorized(err error) bool {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	if terr.StatusCode == http.StatusUnauthorized || terr.StatusCode == http.StatusForbidden {
+		return true
+	}
+	for _, diag := range terr.Errors {
+		if diag.Code == transport.UnauthorizedErrorCode || diag.Code == transport.DeniedErrorCode {
+			return true
+		}
+	}
+	return false
+}
+
+// isResolutionTimeout reports whether the error means that the resolution of
+// the image timed out.
+func isResolutionTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// isDigest reports whether the image reference is pinned to a digest.
+func isDigest(image string) bool {
+	_, err := name.NewDigest(image, name.WeakValidation)
+	return err == nil
 }
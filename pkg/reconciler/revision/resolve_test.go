@@ -19,18 +19,26 @@ package revision
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -38,11 +46,20 @@ import (
 	"github.com/google/go-containerregistry/pkg/authn/k8schain"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"go.uber.org/atomic"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	fakeclient "k8s.io/client-go/kubernetes/fake"
+	pkgnet "knative.dev/pkg/network"
+	"knative.dev/serving/pkg/deployment"
 )
 
 var emptyRegistrySet = sets.New[string]()
@@ -231,7 +248,11 @@ func TestResolveWithDigest(t *testing.T) {
 		},
 	})
 	originalDigest := "ubuntu@sha256:e7def0d56013d50204d73bb588d99e0baa7d69ea1bc1157549b898eb67287612"
-	dr := &digestResolver{client: client, transport: http.DefaultTransport}
+	transport := pkgnet.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		t.Error("Unexpected request to the registry:", r.URL)
+		return nil, errors.New("unexpected request")
+	})
+	dr := &digestResolver{client: client, transport: transport}
 	opt := k8schain.Options{
 		Namespace:          ns,
 		ServiceAccountName: svcacct,
@@ -244,6 +265,10 @@ func TestResolveWithDigest(t *testing.T) {
 	if diff := cmp.Diff(originalDigest, resolvedDigest); diff != "" {
 		t.Errorf("Digest should not change (-want +got):\n%s", diff)
 	}
+	// Neither the credentials nor the registry are needed to resolve a digest.
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("Unexpected API server actions: %v", actions)
+	}
 }
 
 func TestResolveWithBadTag(t *testing.T) {
@@ -309,6 +334,243 @@ func TestResolveWithPingFailure(t *testing.T) {
 	}
 }
 
+func TestResolveRegistryRateLimited(t *testing.T) {
+	const (
+		ns           = "user-project"
+		svcacct      = "user-robot"
+		expectedRepo = "booger/nose"
+		qps          = 20
+		resolutions  = 5
+	)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// Fail with a status that is not retried by the client.
+		http.Error(w, "Nope", http.StatusForbidden)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal("url.Parse() =", err)
+	}
+
+	tag, err := name.NewTag(fmt.Sprintf("%s/%s:latest", u.Host, expectedRepo), name.WeakValidation)
+	if err != nil {
+		t.Fatal("NewTag() =", err)
+	}
+
+	client := fakeclient.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      svcacct,
+			Namespace: ns,
+		},
+	})
+
+	limiter := newRegistryRateLimiter()
+	limiter.Update(map[string]deployment.RegistryRateLimit{
+		tag.RegistryStr(): {QPS: qps, Burst: 1},
+	})
+	dr := &digestResolver{client: client, transport: http.DefaultTransport, rateLimiter: limiter}
+	opt := k8schain.Options{
+		Namespace:          ns,
+		ServiceAccountName: svcacct,
+	}
+
+	start := time.Now()
+	for i := 0; i < resolutions; i++ {
+		if resolvedDigest, err := dr.Resolve(context.Background(), tag.String(), opt, emptyRegistrySet); err == nil {
+			t.Fatalf("Resolve() = %v, want error", resolvedDigest)
+		}
+	}
+
+	// The first resolution uses the burst, every following one has to wait
+	// for a new token.
+	if got, want := time.Since(start), (resolutions-1)*time.Second/qps; got < want {
+		t.Errorf("Resolutions took %v, want at least %v", got, want)
+	}
+	if got := requests.Load(); got != resolutions {
+		t.Errorf("Registry received %d requests, want %d", got, resolutions)
+	}
+}
+
+func TestResolveAcceptMediaTypes(t *testing.T) {
+	const expectedRepo = "booger/nose"
+
+	ociDigest, _, err := v1.SHA256(strings.NewReader("oci image index"))
+	if err != nil {
+		t.Fatal("SHA256() =", err)
+	}
+	dockerDigest, _, err := v1.SHA256(strings.NewReader("docker manifest list"))
+	if err != nil {
+		t.Fatal("SHA256() =", err)
+	}
+
+	tests := []struct {
+		name       string
+		mediaTypes []string
+		wantAccept string
+		wantDigest v1.Hash
+	}{{
+		name:       "prefer docker manifest list",
+		mediaTypes: []string{string(types.DockerManifestList), string(types.OCIImageIndex)},
+		wantAccept: string(types.DockerManifestList) + "," + string(types.OCIImageIndex),
+		wantDigest: dockerDigest,
+	}, {
+		name:       "prefer oci image index",
+		mediaTypes: []string{string(types.OCIImageIndex), string(types.DockerManifestList)},
+		wantAccept: string(types.OCIImageIndex) + "," + string(types.DockerManifestList),
+		wantDigest: ociDigest,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The registry serves the manifest type preferred by the client.
+			var gotAccept atomic.String
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v2/":
+					w.WriteHeader(http.StatusOK)
+				case fmt.Sprintf("/v2/%s/manifests/latest", expectedRepo):
+					accept := r.Header.Get("Accept")
+					gotAccept.Store(accept)
+					mediaType, digest := types.DockerManifestList, dockerDigest
+					if strings.HasPrefix(accept, string(types.OCIImageIndex)) {
+						mediaType, digest = types.OCIImageIndex, ociDigest
+					}
+					w.Header().Set("Content-Type", string(mediaType))
+					w.Header().Set("Content-Length", "42")
+					w.Header().Set("Docker-Content-Digest", digest.String())
+				default:
+					t.Error("Unexpected path:", r.URL.Path)
+				}
+			}))
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatal("url.Parse() =", err)
+			}
+
+			transport := &manifestAcceptTransport{inner: http.DefaultTransport}
+			transport.Update(test.mediaTypes)
+			dr := &digestResolver{client: fakeclient.NewSimpleClientset(), transport: transport}
+
+			image := fmt.Sprintf("%s/%s:latest", u.Host, expectedRepo)
+			resolvedDigest, err := dr.Resolve(context.Background(), image, k8schain.Options{}, emptyRegistrySet)
+			if err != nil {
+				t.Fatal("Resolve() =", err)
+			}
+
+			if got, want := gotAccept.Load(), test.wantAccept; got != want {
+				t.Errorf("Accept = %q, want: %q", got, want)
+			}
+			if got, want := resolvedDigest, fmt.Sprintf("%s/%s@%s", u.Host, expectedRepo, test.wantDigest); got != want {
+				t.Errorf("Resolve() = %q, want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestResolveIdentityHeader(t *testing.T) {
+	const (
+		expectedRepo = "booger/nose"
+		podName      = "controller-5d9f7c8b4-x2x7q"
+	)
+	leading := k8stypes.NamespacedName{Namespace: "default", Name: "leading"}
+	following := k8stypes.NamespacedName{Namespace: "default", Name: "following"}
+
+	digest, _, err := v1.SHA256(strings.NewReader("image"))
+	if err != nil {
+		t.Fatal("SHA256() =", err)
+	}
+
+	tests := []struct {
+		name     string
+		disabled bool
+		revision *k8stypes.NamespacedName
+		want     string
+	}{{
+		name:     "disabled",
+		disabled: true,
+		revision: &leading,
+	}, {
+		name:     "leader",
+		revision: &leading,
+		want:     podName + "; leader=true",
+	}, {
+		name:     "not leader",
+		revision: &following,
+		want:     podName + "; leader=false",
+	}, {
+		name: "unknown revision",
+		want: podName,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotIdentity atomic.String
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v2/":
+					w.WriteHeader(http.StatusOK)
+				case fmt.Sprintf("/v2/%s/manifests/latest", expectedRepo):
+					gotIdentity.Store(r.Header.Get(resolverIdentityHeader))
+					w.Header().Set("Content-Type", string(types.DockerManifestSchema2))
+					w.Header().Set("Content-Length", "42")
+					w.Header().Set("Docker-Content-Digest", digest.String())
+				default:
+					t.Error("Unexpected path:", r.URL.Path)
+				}
+			}))
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatal("url.Parse() =", err)
+			}
+
+			transport := &identityTransport{
+				inner:    http.DefaultTransport,
+				identity: podName,
+				isLeader: func(rev k8stypes.NamespacedName) bool { return rev == leading },
+			}
+			transport.enabled.Store(!test.disabled)
+			dr := &digestResolver{client: fakeclient.NewSimpleClientset(), transport: transport}
+
+			ctx := context.Background()
+			if test.revision != nil {
+				ctx = withResolvingRevision(ctx, *test.revision)
+			}
+			image := fmt.Sprintf("%s/%s:latest", u.Host, expectedRepo)
+			if _, err := dr.Resolve(ctx, image, k8schain.Options{}, emptyRegistrySet); err != nil {
+				t.Fatal("Resolve() =", err)
+			}
+
+			if got := gotIdentity.Load(); got != test.want {
+				t.Errorf("%s = %q, want: %q", resolverIdentityHeader, got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveRegistryRateLimitCanceled(t *testing.T) {
+	limiter := newRegistryRateLimiter()
+	limiter.Update(map[string]deployment.RegistryRateLimit{
+		"index.docker.io": {QPS: 0.001, Burst: 1},
+	})
+
+	dr := &digestResolver{client: fakeclient.NewSimpleClientset(), transport: http.DefaultTransport, rateLimiter: limiter}
+	// Use up the burst so that the resolution below has to wait.
+	if err := limiter.Wait(context.Background(), "index.docker.io"); err != nil {
+		t.Fatal("Wait() =", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := dr.Resolve(ctx, "ubuntu:latest", k8schain.Options{}, emptyRegistrySet); err == nil {
+		t.Fatal("Resolve() succeeded, want rate limit error")
+	}
+}
+
 func TestResolveWithManifestFailure(t *testing.T) {
 	const (
 		ns           = "user-project"
@@ -449,6 +711,609 @@ func TestResolveSkippingRegistry(t *testing.T) {
 	}
 }
 
+func TestResolveBatch(t *testing.T) {
+	const (
+		ns      = "user-project"
+		svcacct = "user-robot"
+		digest  = "sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef"
+	)
+
+	var gotRefs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case batchManifestsPath:
+			if r.Method != http.MethodPost {
+				t.Error("Unexpected method:", r.Method)
+			}
+			var req batchManifestsRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error("Failed to decode the request:", err)
+			}
+			gotRefs = req.References
+			// The digest of the ear is unknown.
+			fmt.Fprintf(w, `{"manifests": [{"reference": %q, "digest": %q}]}`, req.References[0], digest)
+		default:
+			t.Error("Unexpected path:", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal("url.Parse() =", err)
+	}
+
+	client := fakeclient.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      svcacct,
+			Namespace: ns,
+		},
+	})
+	dr := &digestResolver{client: client, transport: http.DefaultTransport}
+	opt := k8schain.Options{
+		Namespace:          ns,
+		ServiceAccountName: svcacct,
+	}
+
+	nose, noseLatest, ear := u.Host+"/booger/nose", u.Host+"/booger/nose:latest", u.Host+"/booger/ear:v1"
+	digests, err := dr.ResolveBatch(context.Background(), u.Host, []string{nose, noseLatest, ear}, opt)
+	if err != nil {
+		t.Fatal("ResolveBatch() =", err)
+	}
+	if want := []string{noseLatest, ear}; !cmp.Equal(gotRefs, want) {
+		t.Error("References (-want, +got):", cmp.Diff(want, gotRefs))
+	}
+	want := map[string]string{
+		nose:       u.Host + "/booger/nose@" + digest,
+		noseLatest: u.Host + "/booger/nose@" + digest,
+	}
+	if !cmp.Equal(digests, want) {
+		t.Error("ResolveBatch() (-want, +got):", cmp.Diff(want, digests))
+	}
+
+	if _, err := dr.ResolveBatch(context.Background(), "other.example.com", []string{nose}, opt); err == nil {
+		t.Error("ResolveBatch() = nil, wanted an error for an image of another registry")
+	}
+}
+
+func TestResolveBatchUnsupported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal("url.Parse() =", err)
+	}
+
+	client := fakeclient.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "default",
+			Namespace: "foo",
+		},
+	})
+	dr := &digestResolver{client: client, transport: http.DefaultTransport}
+	opt := k8schain.Options{
+		Namespace:          "foo",
+		ServiceAccountName: "default",
+	}
+	if digests, err := dr.ResolveBatch(context.Background(), u.Host, []string{u.Host + "/booger/nose"}, opt); err == nil {
+		t.Fatalf("ResolveBatch() = %v, wanted an error", digests)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	const (
+		ns           = "user-project"
+		svcacct      = "user-robot"
+		expectedRepo = "booger/nose"
+	)
+
+	base, err := random.Image(3, 1024)
+	if err != nil {
+		t.Fatal("random.Image() =", err)
+	}
+	wantLabels := map[string]string{
+		"org.opencontainers.image.revision": "abc123",
+		"maintainer":                        "someone",
+	}
+	img, err := mutate.Config(base, v1.Config{Labels: wantLabels})
+	if err != nil {
+		t.Fatal("mutate.Config() =", err)
+	}
+	manifest, err := img.RawManifest()
+	if err != nil {
+		t.Fatal("RawManifest() =", err)
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		t.Fatal("MediaType() =", err)
+	}
+	config, err := img.RawConfigFile()
+	if err != nil {
+		t.Fatal("RawConfigFile() =", err)
+	}
+	configName, err := img.ConfigName()
+	if err != nil {
+		t.Fatal("ConfigName() =", err)
+	}
+	digest := mustDigest(t, img)
+
+	// Stand up a fake registry serving the image's manifest and config.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case fmt.Sprintf("/v2/%s/manifests/%s", expectedRepo, digest):
+			w.Header().Set("Content-Type", string(mt))
+			w.Write(manifest)
+		case fmt.Sprintf("/v2/%s/blobs/%s", expectedRepo, configName):
+			w.Write(config)
+		default:
+			t.Error("Unexpected path:", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal("url.Parse() =", err)
+	}
+
+	client := fakeclient.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      svcacct,
+			Namespace: ns,
+		},
+	})
+	dr := &digestResolver{client: client, transport: http.DefaultTransport}
+	opt := k8schain.Options{
+		Namespace:          ns,
+		ServiceAccountName: svcacct,
+	}
+
+	labels, err := dr.Labels(context.Background(), fmt.Sprintf("%s/%s@%s", u.Host, expectedRepo, digest), opt)
+	if err != nil {
+		t.Fatal("Labels() =", err)
+	}
+	if !cmp.Equal(labels, wantLabels) {
+		t.Error("Labels() (-want, +got):", cmp.Diff(wantLabels, labels))
+	}
+}
+
+func TestLabelsWithTag(t *testing.T) {
+	client := fakeclient.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "default",
+			Namespace: "foo",
+		},
+	})
+	dr := &digestResolver{client: client, transport: http.DefaultTransport}
+	opt := k8schain.Options{
+		Namespace:          "foo",
+		ServiceAccountName: "default",
+	}
+	if labels, err := dr.Labels(context.Background(), "ubuntu:latest", opt); err == nil {
+		t.Fatalf("Labels() = %v, want error", labels)
+	}
+}
+
+func TestCheckLayers(t *testing.T) {
+	const expectedRepo = "booger/nose"
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal("random.Image() =", err)
+	}
+	manifest, err := img.RawManifest()
+	if err != nil {
+		t.Fatal("RawManifest() =", err)
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		t.Fatal("MediaType() =", err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal("Layers() =", err)
+	}
+	missingLayer, err := layers[1].Digest()
+	if err != nil {
+		t.Fatal("Digest() =", err)
+	}
+	digest := mustDigest(t, img)
+
+	tests := []struct {
+		name    string
+		missing bool
+	}{{
+		name: "all layers exist",
+	}, {
+		name:    "manifest references a missing layer",
+		missing: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Stand up a fake registry serving the image's manifest and layers.
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/v2/":
+					w.WriteHeader(http.StatusOK)
+				case r.URL.Path == fmt.Sprintf("/v2/%s/manifests/%s", expectedRepo, digest):
+					w.Header().Set("Content-Type", string(mt))
+					w.Write(manifest)
+				case r.URL.Path == fmt.Sprintf("/v2/%s/blobs/%s", expectedRepo, missingLayer) && tc.missing:
+					http.NotFound(w, r)
+				case strings.HasPrefix(r.URL.Path, fmt.Sprintf("/v2/%s/blobs/", expectedRepo)):
+					if r.Method != http.MethodHead {
+						t.Errorf("Method = %v, want %v", r.Method, http.MethodHead)
+					}
+					w.Header().Set("Content-Length", "1024")
+				default:
+					t.Error("Unexpected path:", r.URL.Path)
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatal("url.Parse() =", err)
+			}
+
+			dr := &digestResolver{client: fakeclient.NewSimpleClientset(), transport: http.DefaultTransport}
+			err = dr.CheckLayers(context.Background(), fmt.Sprintf("%s/%s@%s", u.Host, expectedRepo, digest), k8schain.Options{})
+			var layerErr *missingImageLayerError
+			if got := errors.As(err, &layerErr); got != tc.missing {
+				t.Fatalf("CheckLayers() = %v, wanted a missing layer error: %v", err, tc.missing)
+			}
+			if tc.missing && layerErr.layer != missingLayer.String() {
+				t.Errorf("Missing layer = %s, want %s", layerErr.layer, missingLayer)
+			}
+		})
+	}
+}
+
+// fakeIndexRegistry stands up a fake registry serving the given index under
+// the latest tag, along with its images and their layers.
+func fakeIndexRegistry(t *testing.T, repo string, idx v1.ImageIndex) *httptest.Server {
+	t.Helper()
+	manifests := map[string]v1.Descriptor{}
+	raw := map[string][]byte{}
+	add := func(key string, desc v1.Descriptor, m []byte) {
+		manifests[key], raw[key] = desc, m
+	}
+
+	idxManifest, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal("IndexManifest() =", err)
+	}
+	rawIdx, err := idx.RawManifest()
+	if err != nil {
+		t.Fatal("RawManifest() =", err)
+	}
+	idxDesc := v1.Descriptor{MediaType: types.OCIImageIndex, Digest: mustIndexDigest(t, idx), Size: int64(len(rawIdx))}
+	add("latest", idxDesc, rawIdx)
+	add(idxDesc.Digest.String(), idxDesc, rawIdx)
+	for _, desc := range idxManifest.Manifests {
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			t.Fatal("Image() =", err)
+		}
+		m, err := img.RawManifest()
+		if err != nil {
+			t.Fatal("RawManifest() =", err)
+		}
+		add(desc.Digest.String(), desc, m)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := fmt.Sprintf("/v2/%s/manifests/", repo)
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case strings.HasPrefix(r.URL.Path, prefix):
+			key := strings.TrimPrefix(r.URL.Path, prefix)
+			m, ok := raw[key]
+			if !ok {
+				t.Error("Unexpected manifest:", key)
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", string(manifests[key].MediaType))
+			w.Header().Set("Docker-Content-Digest", manifests[key].Digest.String())
+			w.Header().Set("Content-Length", fmt.Sprint(len(m)))
+			if r.Method != http.MethodHead {
+				w.Write(m)
+			}
+		case strings.HasPrefix(r.URL.Path, fmt.Sprintf("/v2/%s/blobs/", repo)):
+			w.Header().Set("Content-Length", "1024")
+		default:
+			t.Error("Unexpected path:", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func mustIndexDigest(t *testing.T, idx v1.ImageIndex) v1.Hash {
+	h, err := idx.Digest()
+	if err != nil {
+		t.Fatal("Digest() =", err)
+	}
+	return h
+}
+
+// estargzImage returns an image with a layer annotated like eStargz layers.
+func estargzImage(t *testing.T) v1.Image {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal("random.Image() =", err)
+	}
+	layer, err := random.Layer(1024, types.OCILayer)
+	if err != nil {
+		t.Fatal("random.Layer() =", err)
+	}
+	img, err := mutate.Append(base, mutate.Addendum{
+		Layer: layer,
+		Annotations: map[string]string{
+			estargzTOCDigestAnnotation: "sha256:2c4ab8be0a2f1bde4bf4e8b8fc0a2e8aa4d3b7ecb4e1e7fd5dc9d2e6e0f3c0a1",
+		},
+	})
+	if err != nil {
+		t.Fatal("mutate.Append() =", err)
+	}
+	return img
+}
+
+func TestResolvePreferLazyPull(t *testing.T) {
+	const expectedRepo = "booger/nose"
+
+	amd64 := &v1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := &v1.Platform{OS: "linux", Architecture: "arm64"}
+	regular, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal("random.Image() =", err)
+	}
+	estargz := estargzImage(t)
+
+	addenda := func(adds ...mutate.IndexAddendum) v1.ImageIndex {
+		return mutate.AppendManifests(empty.Index, adds...)
+	}
+	image := func(img v1.Image, platform *v1.Platform, annotations map[string]string) mutate.IndexAddendum {
+		return mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				Platform:    platform,
+				Annotations: annotations,
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		idx     v1.ImageIndex
+		want    v1.Hash // Zero for the digest of the index.
+	}{{
+		name: "disabled",
+		idx:  addenda(image(regular, amd64, nil), image(estargz, amd64, nil)),
+	}, {
+		name:    "eStargz variant",
+		enabled: true,
+		idx:     addenda(image(regular, amd64, nil), image(estargz, amd64, nil)),
+		want:    mustDigest(t, estargz),
+	}, {
+		name:    "SOCI variant",
+		enabled: true,
+		idx: addenda(image(regular, amd64, nil), image(estargz, amd64, map[string]string{
+			sociIndexDigestAnnotation: "sha256:0f3c0a12c4ab8be0a2f1bde4bf4e8b8fc0a2e8aa4d3b7ecb4e1e7fd5dc9d2e6e",
+		})),
+		want: mustDigest(t, estargz),
+	}, {
+		name:    "only lazy-pull variant",
+		enabled: true,
+		idx:     addenda(image(estargz, amd64, nil)),
+	}, {
+		name:    "only regular variant",
+		enabled: true,
+		idx:     addenda(image(regular, amd64, nil)),
+	}, {
+		name:    "multiple platforms",
+		enabled: true,
+		idx:     addenda(image(regular, amd64, nil), image(estargz, arm64, nil)),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := fakeIndexRegistry(t, expectedRepo, tc.idx)
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatal("url.Parse() =", err)
+			}
+
+			dr := &digestResolver{client: fakeclient.NewSimpleClientset(), transport: http.DefaultTransport}
+			dr.preferLazyPull.Store(tc.enabled)
+			resolved, err := dr.Resolve(context.Background(), fmt.Sprintf("%s/%s:latest", u.Host, expectedRepo), k8schain.Options{}, emptyRegistrySet)
+			if err != nil {
+				t.Fatal("Resolve() =", err)
+			}
+
+			want := tc.want
+			if want == (v1.Hash{}) {
+				want = mustIndexDigest(t, tc.idx)
+			}
+			if got, want := resolved, fmt.Sprintf("%s/%s@%s", u.Host, expectedRepo, want); got != want {
+				t.Errorf("Resolve() = %s, want %s", got, want)
+			}
+
+			// The layers of the resolved image, eStargz ones included, are found.
+			if tc.want != (v1.Hash{}) {
+				if err := dr.CheckLayers(context.Background(), resolved, k8schain.Options{}); err != nil {
+					t.Error("CheckLayers() =", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistryConnectionsTransport(t *testing.T) {
+	const limit = 2
+
+	var (
+		mu                sync.Mutex
+		active, maxActive int
+	)
+	activeRequests := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return active
+	}
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		maxActive = max(maxActive, active)
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+
+	transport := &registryConnectionsTransport{base: http.DefaultTransport.(*http.Transport).Clone()}
+	transport.Update(limit)
+	client := &http.Client{Transport: transport}
+
+	get := func(url string) error {
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	// Flood the slow registry.
+	errs := make(chan error, 2*limit)
+	for i := 0; i < 2*limit; i++ {
+		go func() { errs <- get(slow.URL) }()
+	}
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return activeRequests() == limit, nil
+	}); err != nil {
+		t.Fatalf("Got %d requests to the slow registry in flight, want %d", activeRequests(), limit)
+	}
+
+	// The other registry is not held up by the slow one.
+	if err := get(fast.URL); err != nil {
+		t.Error("Request to the fast registry =", err)
+	}
+
+	close(release)
+	for i := 0; i < 2*limit; i++ {
+		if err := <-errs; err != nil {
+			t.Error("Request to the slow registry =", err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := maxActive; got != limit {
+		t.Errorf("Connections to the slow registry = %d, want %d", got, limit)
+	}
+}
+
+func TestRegistryConnectionsTransportServerNames(t *testing.T) {
+	const serverName = "registry.example.com"
+
+	// The registry is reached by IP address, but has a cert for a hostname.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("GenerateKey() =", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: serverName},
+		DNSNames:              []string{serverName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("CreateCertificate() =", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("ParseCertificate() =", err)
+	}
+
+	var gotServerName string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotServerName = r.TLS.ServerName
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	server.StartTLS()
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal("url.Parse() =", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = &tls.Config{RootCAs: pool}
+	transport := &registryConnectionsTransport{base: base}
+	client := &http.Client{Transport: transport}
+
+	get := func() error {
+		resp, err := client.Get(server.URL + "/v2/")
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	// Without the override, the cert fails the SAN verification.
+	var verr *tls.CertificateVerificationError
+	if err := get(); !errors.As(err, &verr) {
+		t.Fatalf("Get() = %v, want a certificate verification error", err)
+	}
+
+	// With it, the cert is verified against the server name, sent as SNI.
+	transport.UpdateServerNames(map[string]string{u.Host: serverName})
+	if err := get(); err != nil {
+		t.Fatal("Get() with the server name override =", err)
+	}
+	if gotServerName != serverName {
+		t.Errorf("SNI = %q, want %q", gotServerName, serverName)
+	}
+
+	// The override keeps applying under a connection limit.
+	transport.Update(1)
+	if err := get(); err != nil {
+		t.Error("Get() with the server name override and a connection limit =", err)
+	}
+
+	// The override is only used for its host.
+	transport.UpdateServerNames(map[string]string{"203.0.113.10": serverName})
+	if err := get(); !errors.As(err, &verr) {
+		t.Errorf("Get() = %v, want a certificate verification error", err)
+	}
+}
+
 func TestNewResolverTransport(t *testing.T) {
 	cases := []struct {
 		name               string
@@ -578,6 +1443,106 @@ func containsSubject(t *testing.T, subjects [][]byte, contents []byte) bool {
 	return false
 }
 
+func TestIsImageNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{{
+		name: "not found status",
+		err:  fmt.Errorf("wrapped: %w", &transport.Error{StatusCode: http.StatusNotFound}),
+		want: true,
+	}, {
+		name: "manifest unknown",
+		err: &transport.Error{
+			StatusCode: http.StatusBadRequest,
+			Errors:     []transport.Diagnostic{{Code: transport.ManifestUnknownErrorCode}},
+		},
+		want: true,
+	}, {
+		name: "unauthorized",
+		err:  &transport.Error{StatusCode: http.StatusUnauthorized},
+	}, {
+		name: "other error",
+		err:  errors.New("connection refused"),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isImageNotFound(tc.err); got != tc.want {
+				t.Errorf("isImageNotFound() = %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsImageUnauthorized(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{{
+		name: "unauthorized status",
+		err:  fmt.Errorf("wrapped: %w", &transport.Error{StatusCode: http.StatusUnauthorized}),
+		want: true,
+	}, {
+		name: "forbidden status",
+		err:  &transport.Error{StatusCode: http.StatusForbidden},
+		want: true,
+	}, {
+		name: "denied",
+		err: &transport.Error{
+			StatusCode: http.StatusBadRequest,
+			Errors:     []transport.Diagnostic{{Code: transport.DeniedErrorCode}},
+		},
+		want: true,
+	}, {
+		name: "not found",
+		err:  &transport.Error{StatusCode: http.StatusNotFound},
+	}, {
+		name: "other error",
+		err:  errors.New("connection refused"),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isImageUnauthorized(tc.err); got != tc.want {
+				t.Errorf("isImageUnauthorized() = %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsResolutionTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{{
+		name: "deadline exceeded",
+		err:  fmt.Errorf("wrapped: %w", context.DeadlineExceeded),
+		want: true,
+	}, {
+		name: "network timeout",
+		err:  &url.Error{Op: "Get", URL: "https://gcr.io/v2/", Err: &net.DNSError{IsTimeout: true}},
+		want: true,
+	}, {
+		name: "unauthorized",
+		err:  &transport.Error{StatusCode: http.StatusUnauthorized},
+	}, {
+		name: "other error",
+		err:  errors.New("connection refused"),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isResolutionTimeout(tc.err); got != tc.want {
+				t.Errorf("isResolutionTimeout() = %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
 // Cert stolen from crypto/x509/example_test.go
 const certPEM = `
 -----BEGIN CERTIFICATE-----
@@ -18,11 +18,13 @@ package resources
 
 import (
 	"fmt"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"knative.dev/pkg/kmap"
 	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/ptr"
 	"knative.dev/serving/pkg/apis/autoscaling"
@@ -35,8 +37,10 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	apiconfig "knative.dev/serving/pkg/apis/config"
 	deploymentconfig "knative.dev/serving/pkg/deployment"
@@ -167,6 +171,41 @@ func makePreferSpreadRevisionOverNodes(revisionLabelValue string) *corev1.PodAnt
 	}
 }
 
+func makeSpreadRevisionOverNodes(revisionLabelValue string, whenUnsatisfiable corev1.UnsatisfiableConstraintAction) []corev1.TopologySpreadConstraint {
+	return []corev1.TopologySpreadConstraint{{
+		MaxSkew:           1,
+		TopologyKey:       corev1.LabelHostname,
+		WhenUnsatisfiable: whenUnsatisfiable,
+		LabelSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				serving.RevisionLabelKey: revisionLabelValue,
+			},
+		},
+	}}
+}
+
+func makeCrossRevisionAntiAffinity(antiAffinity *corev1.PodAntiAffinity, t deploymentconfig.CrossRevisionAntiAffinityType) *corev1.PodAntiAffinity {
+	term := corev1.PodAffinityTerm{
+		TopologyKey: corev1.LabelHostname,
+		LabelSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      serving.RevisionLabelKey,
+				Operator: metav1.LabelSelectorOpExists,
+			}},
+		},
+	}
+	if antiAffinity == nil {
+		antiAffinity = &corev1.PodAntiAffinity{}
+	}
+	if t == deploymentconfig.CrossRevisionAntiAffinityRequired {
+		antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, term)
+	} else {
+		antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+			corev1.WeightedPodAffinityTerm{Weight: 100, PodAffinityTerm: term})
+	}
+	return antiAffinity
+}
+
 func makePodSpec(rev *v1.Revision, cfg *config.Config) (*corev1.PodSpec, error) {
 	queueContainer, err := makeQueueContainer(rev, cfg)
 	tokenVolume := varTokenVolume.DeepCopy()
@@ -209,10 +248,19 @@ func makePodSpec(rev *v1.Revision, cfg *config.Config) (*corev1.PodSpec, error)
 
 	podSpec := BuildPodSpec(rev, append(BuildUserContainers(rev), *queueContainer), cfg)
 	podSpec.Volumes = append(podSpec.Volumes, extraVolumes...)
+	podSpec.ImagePullSecrets = AppendImagePullSecrets(podSpec.ImagePullSecrets, cfg.Deployment.ImagePullSecrets...)
+	podSpec.Containers = appendSidecarContainers(podSpec, cfg.Deployment.SidecarContainersFor(rev.Labels))
+	podSpec.Tolerations = appendTolerations(podSpec.Tolerations, cfg.Deployment.DefaultTolerations)
 
 	if val := cfg.Deployment.PodRuntimeClassName(rev.ObjectMeta.Labels); podSpec.RuntimeClassName == nil {
 		podSpec.RuntimeClassName = val
 	}
+	if cfg.Deployment.ShareProcessNamespace && podSpec.ShareProcessNamespace == nil {
+		podSpec.ShareProcessNamespace = ptr.Bool(true)
+	}
+	if podSpec.PriorityClassName == "" {
+		podSpec.PriorityClassName = cfg.Deployment.DefaultPriorityClassName
+	}
 	if cfg.Observability.EnableVarLogCollection {
 		podSpec.Volumes = append(podSpec.Volumes, varLogVolume)
 
@@ -230,13 +278,140 @@ func makePodSpec(rev *v1.Revision, cfg *config.Config) (*corev1.PodSpec, error)
 		}
 	}
 
-	if cfg.Deployment.DefaultAffinityType == deploymentconfig.PreferSpreadRevisionOverNodes && rev.Spec.Affinity == nil {
+	affinityType := cfg.Deployment.AffinityTypeForNamespace(rev.Namespace)
+	if affinityType == deploymentconfig.PreferSpreadRevisionOverNodes && rev.Spec.Affinity == nil {
 		podSpec.Affinity = &corev1.Affinity{PodAntiAffinity: makePreferSpreadRevisionOverNodes(rev.Name)}
 	}
+	if affinityType == deploymentconfig.SpreadRevisionOverNodes && len(rev.Spec.TopologySpreadConstraints) == 0 {
+		podSpec.TopologySpreadConstraints = makeSpreadRevisionOverNodes(rev.Name, cfg.Deployment.TopologySpreadWhenUnsatisfiable)
+	}
+	if len(rev.Spec.TopologySpreadConstraints) == 0 {
+		podSpec.TopologySpreadConstraints = appendTopologySpreadConstraints(podSpec.TopologySpreadConstraints, cfg.Deployment.DefaultTopologySpreadConstraints, rev.Name)
+	}
+	// Unlike the default affinity, this protects the nodes, so it is added to
+	// the affinity set by the user as well.
+	if t := cfg.Deployment.CrossRevisionAntiAffinity; t == deploymentconfig.CrossRevisionAntiAffinityPreferred || t == deploymentconfig.CrossRevisionAntiAffinityRequired {
+		if podSpec.Affinity == nil {
+			podSpec.Affinity = &corev1.Affinity{}
+		}
+		podSpec.Affinity.PodAntiAffinity = makeCrossRevisionAntiAffinity(podSpec.Affinity.PodAntiAffinity, t)
+	}
+
+	if err := checkPortCollisions(podSpec); err != nil {
+		return nil, err
+	}
 
 	return podSpec, nil
 }
 
+// PortCollisionError is returned when two containers of the pod, e.g. the
+// user container and the queue-proxy, expose the same port, in which case the
+// pod wouldn't start.
+type PortCollisionError struct {
+	Port       int32
+	Protocol   corev1.Protocol
+	Containers [2]string
+}
+
+func (e *PortCollisionError) Error() string {
+	return fmt.Sprintf("port %d/%s is exposed by both container %q and container %q",
+		e.Port, e.Protocol, e.Containers[0], e.Containers[1])
+}
+
+// checkPortCollisions returns a PortCollisionError if two containers running
+// alongside each other, including sidecar init containers, expose the same
+// port.
+func checkPortCollisions(podSpec *corev1.PodSpec) error {
+	type portKey struct {
+		port     int32
+		protocol corev1.Protocol
+	}
+	owners := make(map[portKey]string)
+
+	check := func(container *corev1.Container) error {
+		for _, p := range container.Ports {
+			key := portKey{port: p.ContainerPort, protocol: p.Protocol}
+			if key.protocol == "" {
+				key.protocol = corev1.ProtocolTCP
+			}
+			if owner, ok := owners[key]; ok && owner != container.Name {
+				return &PortCollisionError{
+					Port:       key.port,
+					Protocol:   key.protocol,
+					Containers: [2]string{owner, container.Name},
+				}
+			}
+			owners[key] = container.Name
+		}
+		return nil
+	}
+
+	for i := range podSpec.InitContainers {
+		// Regular init containers have exited before the other containers start.
+		if c := &podSpec.InitContainers[i]; c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			if err := check(c); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range podSpec.Containers {
+		if err := check(&podSpec.Containers[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendSidecarContainers returns the containers of the pod spec with the
+// given sidecars appended, leaving out the ones whose name is already taken by
+// a container of the pod, like the user or the queue-proxy containers.
+func appendSidecarContainers(podSpec *corev1.PodSpec, sidecars []corev1.Container) []corev1.Container {
+	containers := podSpec.Containers
+	if len(sidecars) == 0 {
+		return containers
+	}
+	names := sets.New[string]()
+	for _, c := range append(podSpec.InitContainers, containers...) {
+		names.Insert(c.Name)
+	}
+	for _, sidecar := range sidecars {
+		if !names.Has(sidecar.Name) {
+			containers = append(containers, sidecar)
+		}
+	}
+	return containers
+}
+
+// AppendImagePullSecrets appends the named secrets to the given image pull
+// secrets, leaving out the ones already present.
+func AppendImagePullSecrets(secrets []corev1.LocalObjectReference, names ...string) []corev1.LocalObjectReference {
+	seen := make(sets.Set[string], len(secrets))
+	for _, s := range secrets {
+		seen.Insert(s.Name)
+	}
+	for _, name := range names {
+		if !seen.Has(name) {
+			seen.Insert(name)
+			secrets = append(secrets, corev1.LocalObjectReference{Name: name})
+		}
+	}
+	return secrets
+}
+
+// appendTolerations appends the given tolerations to the tolerations of the
+// pod, leaving out the ones already present.
+func appendTolerations(tolerations, extra []corev1.Toleration) []corev1.Toleration {
+	for i := range extra {
+		t := &extra[i]
+		if !slices.ContainsFunc(tolerations, func(u corev1.Toleration) bool {
+			return u.MatchToleration(t) && equality.Semantic.DeepEqual(u.TolerationSeconds, t.TolerationSeconds)
+		}) {
+			tolerations = append(tolerations, *t)
+		}
+	}
+	return tolerations
+}
+
 // BuildUserContainers makes an array of containers from the Revision template.
 func BuildUserContainers(rev *v1.Revision) []corev1.Container {
 	containers := make([]corev1.Container, 0, len(rev.Spec.PodSpec.Containers))
@@ -350,8 +525,38 @@ func buildUserPortEnv(userPort string) corev1.EnvVar {
 	}
 }
 
-// MakeDeployment constructs a K8s Deployment resource from a revision.
-func MakeDeployment(rev *v1.Revision, cfg *config.Config) (*appsv1.Deployment, error) {
+// ProgressDeadline returns the progress deadline of the deployment of the
+// revision, as overridden by its annotation if any and valid.
+func ProgressDeadline(rev *v1.Revision, cfg *config.Config) time.Duration {
+	if pd, found, err := AnnotatedProgressDeadline(rev, cfg); found && err == nil {
+		return pd
+	}
+	return cfg.Deployment.ProgressDeadline
+}
+
+// AnnotatedProgressDeadline returns the progress deadline of the annotation of
+// the revision, and whether it has one. It fails if the annotation isn't a
+// positive whole number of seconds, which the webhook doesn't guarantee for
+// the revisions created before it did, or exceeds the ProgressDeadlineMax of
+// the config.
+func AnnotatedProgressDeadline(rev *v1.Revision, cfg *config.Config) (time.Duration, bool, error) {
+	k, ann, found := serving.ProgressDeadlineAnnotation.Get(rev.Annotations)
+	if !found {
+		return 0, false, nil
+	}
+	pd, err := time.ParseDuration(ann)
+	if err != nil || pd <= 0 || pd.Truncate(time.Second) != pd {
+		return 0, true, fmt.Errorf("the %s annotation %q is not a positive whole number of seconds", k, ann)
+	}
+	if max := cfg.Deployment.ProgressDeadlineMax; max > 0 && pd > max {
+		return 0, true, fmt.Errorf("the %s annotation %v exceeds the maximum of %v", k, pd, max)
+	}
+	return pd, true, nil
+}
+
+// MakeDeployment constructs a K8s Deployment resource from a revision. The
+// labels of its namespace are used to compute the configured deployment labels.
+func MakeDeployment(rev *v1.Revision, nsLabels map[string]string, cfg *config.Config) (*appsv1.Deployment, error) {
 	podSpec, err := makePodSpec(rev, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create PodSpec: %w", err)
@@ -365,16 +570,31 @@ func MakeDeployment(rev *v1.Revision, cfg *config.Config) (*appsv1.Deployment, e
 		replicaCount = int32(rc)
 	}
 
-	progressDeadline := int32(cfg.Deployment.ProgressDeadline.Seconds())
-	_, pdAnn, pdFound := serving.ProgressDeadlineAnnotation.Get(rev.Annotations)
-	if pdFound {
-		// Ignore errors and no error checking because already validated in webhook.
-		pd, _ := time.ParseDuration(pdAnn)
-		progressDeadline = int32(pd.Seconds())
-	}
+	progressDeadline := int32(ProgressDeadline(rev, cfg).Seconds())
 
 	labels := makeLabels(rev)
+	deploymentLabels, podLabels := labels, labels
+	extra, err := cfg.Deployment.DeploymentLabelsFor(rev.Namespace, nsLabels)
+	if err != nil {
+		return nil, err
+	}
+	if len(extra) > 0 {
+		// The labels managed by Knative take precedence.
+		deploymentLabels = kmap.Union(extra, labels)
+		if cfg.Deployment.DeploymentLabelsOnPodTemplate {
+			podLabels = deploymentLabels
+		}
+	}
+	if len(cfg.Deployment.PodLabels) > 0 {
+		podLabels = kmap.Union(cfg.Deployment.PodLabels, podLabels)
+	}
 	anns := makeAnnotations(rev)
+	podAnns := anns
+	if cfg.Deployment.QueueSidecarResourceRationale {
+		if rationale := queueResourceRationale(rev.GetAnnotations(), rev.Spec.GetContainer()); rationale != "" {
+			podAnns = kmap.Union(anns, map[string]string{serving.QueueSidecarResourceRationaleAnnotationKey: rationale})
+		}
+	}
 
 	// Slowly but steadily roll the deployment out, to have the least possible impact.
 	maxUnavailable := intstr.FromInt(0)
@@ -382,7 +602,7 @@ func MakeDeployment(rev *v1.Revision, cfg *config.Config) (*appsv1.Deployment, e
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            names.Deployment(rev),
 			Namespace:       rev.Namespace,
-			Labels:          labels,
+			Labels:          deploymentLabels,
 			Annotations:     anns,
 			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(rev)},
 		},
@@ -390,6 +610,9 @@ func MakeDeployment(rev *v1.Revision, cfg *config.Config) (*appsv1.Deployment, e
 			Replicas:                ptr.Int32(replicaCount),
 			Selector:                makeSelector(rev),
 			ProgressDeadlineSeconds: ptr.Int32(progressDeadline),
+			RevisionHistoryLimit:    ptr.Int32(cfg.Deployment.RevisionHistoryLimit),
+			MinReadySeconds:         cfg.Deployment.MinReadySeconds,
+			Paused:                  rev.IsDeploymentPaused(),
 			Strategy: appsv1.DeploymentStrategy{
 				Type: appsv1.RollingUpdateDeploymentStrategyType,
 				RollingUpdate: &appsv1.RollingUpdateDeployment{
@@ -398,11 +621,36 @@ func MakeDeployment(rev *v1.Revision, cfg *config.Config) (*appsv1.Deployment, e
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels:      labels,
-					Annotations: anns,
+					Labels:      podLabels,
+					Annotations: podAnns,
 				},
 				Spec: *podSpec,
 			},
 		},
 	}, nil
 }
+
+// appendTopologySpreadConstraints appends the given constraints to the
+// topology spread constraints of the pod, leaving out the ones on a topology
+// key and whenUnsatisfiable it already has a constraint on. The constraints
+// without a label selector are given one selecting the pods of the revision.
+func appendTopologySpreadConstraints(constraints, extra []corev1.TopologySpreadConstraint, revisionLabelValue string) []corev1.TopologySpreadConstraint {
+	for i := range extra {
+		c := &extra[i]
+		if slices.ContainsFunc(constraints, func(u corev1.TopologySpreadConstraint) bool {
+			return u.TopologyKey == c.TopologyKey && u.WhenUnsatisfiable == c.WhenUnsatisfiable
+		}) {
+			continue
+		}
+		constraint := *c.DeepCopy()
+		if constraint.LabelSelector == nil {
+			constraint.LabelSelector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					serving.RevisionLabelKey: revisionLabelValue,
+				},
+			}
+		}
+		constraints = append(constraints, constraint)
+	}
+	return constraints
+}
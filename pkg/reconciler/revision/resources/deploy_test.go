@@ -17,11 +17,14 @@ limitations under the License.
 package resources
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -41,6 +44,7 @@ import (
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	"knative.dev/serving/pkg/autoscaler/config/autoscalerconfig"
 	"knative.dev/serving/pkg/deployment"
+	"knative.dev/serving/pkg/networking"
 	"knative.dev/serving/pkg/queue"
 
 	_ "knative.dev/pkg/metrics/testing"
@@ -197,6 +201,101 @@ var (
 		}, {
 			Name:  "ENABLE_MULTI_CONTAINER_PROBES",
 			Value: "false",
+		}, {
+			Name:  "SUPPRESS_OVERLOAD_DETAILS",
+			Value: "false",
+		}, {
+			Name:  "QUEUE_FULL_STATUS_CODE",
+			Value: "0",
+		}, {
+			Name:  "QUEUE_FULL_RETRY_AFTER_SECONDS",
+			Value: "0",
+		}, {
+			Name:  "QUEUE_FULL_BODY",
+			Value: "",
+		}, {
+			Name:  "BREAKER_DRAIN_TIMEOUT_SECONDS",
+			Value: "0",
+		}, {
+			Name:  "MAX_RESPONSE_HEADERS",
+			Value: "0",
+		}, {
+			Name:  "MAX_UPSTREAM_CONNECTIONS",
+			Value: "0",
+		}, {
+			Name:  "H2_MAX_CONCURRENT_STREAMS",
+			Value: "0",
+		}, {
+			Name:  "MAX_REQUEST_BODY_BYTES",
+			Value: "0",
+		}, {
+			Name:  "SLOW_REQUEST_THRESHOLD_MS",
+			Value: "0",
+		}, {
+			Name:  "RESPONSE_HEADER_TIMEOUT_SECONDS",
+			Value: "0",
+		}, {
+			Name:  "VERSION_HEADER",
+			Value: "false",
+		}, {
+			Name:  "COUNT_PROBE_REQUESTS",
+			Value: "false",
+		}, {
+			Name:  "REPORT_RESPONSE_CLASSES",
+			Value: "false",
+		}, {
+			Name:  "REPORT_BREAKER_PARAMS",
+			Value: "false",
+		}, {
+			Name:  "MEMORY_SHEDDING_HIGH_WATER_MARK",
+			Value: "0",
+		}, {
+			Name:  "MEMORY_SHEDDING_LOW_WATER_MARK",
+			Value: "0",
+		}, {
+			Name:  "UPSTREAM_PROTOCOL_DETECTION",
+			Value: "false",
+		}, {
+			Name:  "OVERLOAD_STATUS_CODE",
+			Value: "0",
+		}, {
+			Name:  "OVERLOAD_BODY",
+			Value: "",
+		}, {
+			Name:  "MAINTENANCE",
+			Value: "false",
+		}, {
+			Name:  "MAINTENANCE_STATUS_CODE",
+			Value: "0",
+		}, {
+			Name: "MAINTENANCE_BODY",
+		}, {
+			Name:  "ACTIVATOR_PROXY_HEADER_NAME",
+			Value: "K-Proxy-Request",
+		}, {
+			Name:  "ACTIVATOR_PROXY_HEADER_VALUE",
+			Value: "activator",
+		}, {
+			Name: "DEPENDENCY_HEALTH_CHECK",
+		}, {
+			Name: "REQUEST_ID_HEADER",
+		}, {
+			Name:  "CLIENT_CONCURRENCY_LIMIT",
+			Value: "0",
+		}, {
+			Name: "CLIENT_KEY_HEADER",
+		}, {
+			Name:  "REJECT_HTTP10",
+			Value: "false",
+		}, {
+			Name:  "PREWARM",
+			Value: "false",
+		}, {
+			Name: "PREWARM_PATH",
+		}, {
+			Name: "DRAIN_READINESS_PATH",
+		}, {
+			Name: "DRAIN_PATH",
 		}},
 	}
 
@@ -219,6 +318,29 @@ var (
 		}},
 	}
 
+	defaultTopologySpreadConstraints = func(whenUnsatisfiable corev1.UnsatisfiableConstraintAction) []corev1.TopologySpreadConstraint {
+		return []corev1.TopologySpreadConstraint{{
+			MaxSkew:           1,
+			TopologyKey:       "kubernetes.io/hostname",
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"serving.knative.dev/revision": "bar",
+				},
+			},
+		}}
+	}
+
+	crossRevisionPodAffinityTerm = corev1.PodAffinityTerm{
+		TopologyKey: "kubernetes.io/hostname",
+		LabelSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      "serving.knative.dev/revision",
+				Operator: metav1.LabelSelectorOpExists,
+			}},
+		},
+	}
+
 	userDefinedPodAntiAffinityRules = &corev1.PodAntiAffinity{
 		RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
 			TopologyKey: "kubernetes.io/hostname",
@@ -258,6 +380,8 @@ var (
 				},
 			},
 			ProgressDeadlineSeconds: ptr.Int32(0),
+			RevisionHistoryLimit:    ptr.Int32(0),
+			MinReadySeconds:         0,
 			Strategy: appsv1.DeploymentStrategy{
 				Type: appsv1.RollingUpdateDeploymentStrategyType,
 				RollingUpdate: &appsv1.RollingUpdateDeployment{
@@ -1375,6 +1499,60 @@ func TestMakePodSpec(t *testing.T) {
 			},
 			withAppendedTokenVolumes([]appendTokenVolume{{filename: "boo-srv", audience: "boo-srv", expires: 3600}}),
 		),
+	}, {
+		name: "qpoption tokens with the default empty audience",
+		dc: deployment.Config{
+			QueueSidecarTokenAudiences: sets.New(""),
+		},
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+				Ports:          buildContainerPorts(v1.DefaultUserPort),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+		),
+		// No token with an empty audience is projected, so neither is the volume.
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(func(container *corev1.Container) {
+					container.Image = "busybox@sha256:deadbeef"
+				}),
+				queueContainer(),
+			}),
+	}, {
+		name: "qpoption tokens skip the empty audience",
+		dc: deployment.Config{
+			QueueSidecarTokenAudiences: sets.New("", "boo-srv"),
+		},
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+				Ports:          buildContainerPorts(v1.DefaultUserPort),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+		),
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(func(container *corev1.Container) {
+					container.Image = "busybox@sha256:deadbeef"
+				}),
+				queueContainer(func(container *corev1.Container) {
+					container.VolumeMounts = []corev1.VolumeMount{{
+						Name:      varTokenVolume.Name,
+						MountPath: "/var/run/secrets/tokens",
+					}}
+				}),
+			},
+			withAppendedTokenVolumes([]appendTokenVolume{{filename: "boo-srv", audience: "boo-srv", expires: 3600}}),
+		),
 	}, {
 		name: "qpoption rootca",
 		dc: deployment.Config{
@@ -1498,7 +1676,7 @@ func TestMakePodSpec(t *testing.T) {
 			},
 		),
 	}, {
-		name: "with affinity rules set by both the user and the operator",
+		name: "with default affinity type deactivated for the namespace",
 		rev: revision("bar", "foo",
 			withContainers([]corev1.Container{{
 				Name:           servingContainerName,
@@ -1508,16 +1686,13 @@ func TestMakePodSpec(t *testing.T) {
 			WithContainerStatuses([]v1.ContainerStatus{{
 				ImageDigest: "busybox@sha256:deadbeef",
 			}}),
-			func(r *v1.Revision) {
-				r.Spec.Affinity = &corev1.Affinity{
-					PodAntiAffinity: userDefinedPodAntiAffinityRules,
-				}
-			}),
+		),
 		fc: apicfg.Features{
-			PodSpecAffinity: apicfg.Enabled,
+			PodSpecAffinity: apicfg.Disabled,
 		},
 		dc: deployment.Config{
-			DefaultAffinityType: deployment.PreferSpreadRevisionOverNodes,
+			DefaultAffinityType:          deployment.PreferSpreadRevisionOverNodes,
+			DefaultAffinityTypeOverrides: map[string]deployment.AffinityType{"foo": deployment.None},
 		},
 		want: podSpec(
 			[]corev1.Container{
@@ -1526,111 +1701,423 @@ func TestMakePodSpec(t *testing.T) {
 				}),
 				queueContainer(),
 			},
-			func(p *corev1.PodSpec) {
-				p.Affinity = &corev1.Affinity{
-					PodAntiAffinity: userDefinedPodAntiAffinityRules,
-				}
-			},
 		),
 	}, {
-		name: "with runtime-class-name set",
-		dc: deployment.Config{
-			RuntimeClassNames: map[string]deployment.RuntimeClassNameLabelSelector{
-				"gvisor": {},
-			},
-		},
+		name: "with default affinity type deactivated for another namespace",
 		rev: revision("bar", "foo",
 			withContainers([]corev1.Container{{
 				Name:           servingContainerName,
 				Image:          "busybox",
-				Ports:          buildContainerPorts(v1.DefaultUserPort),
-				ReadinessProbe: withHTTPReadinessProbe(v1.DefaultUserPort),
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
 			}}),
 		),
-		want: podSpec([]corev1.Container{
-			servingContainer(func(container *corev1.Container) {
-				container.Image = "busybox"
-			}),
-			queueContainer(
-				withEnvVar("SERVING_READINESS_PROBE", `{"httpGet":{"path":"/","port":8080,"host":"127.0.0.1","scheme":"HTTP"}}`),
-			),
-		}, withRuntimeClass("gvisor")),
-	}, {
-		name: "with runtime-class-name set requiring selector and no label set in revision",
+		fc: apicfg.Features{
+			PodSpecAffinity: apicfg.Disabled,
+		},
 		dc: deployment.Config{
-			RuntimeClassNames: map[string]deployment.RuntimeClassNameLabelSelector{
-				"gvisor": {
-					Selector: map[string]string{
-						"this-one": "specifically",
-					},
-				},
-			},
+			DefaultAffinityType:          deployment.PreferSpreadRevisionOverNodes,
+			DefaultAffinityTypeOverrides: map[string]deployment.AffinityType{"dev": deployment.None},
 		},
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(func(container *corev1.Container) {
+					container.Image = "busybox@sha256:deadbeef"
+				}),
+				queueContainer(),
+			},
+			func(p *corev1.PodSpec) {
+				p.Affinity = &corev1.Affinity{
+					PodAntiAffinity: defaultPodAntiAffinityRules,
+				}
+			},
+		),
+	}, {
+		name: "with topology spread over nodes set to ScheduleAnyway",
 		rev: revision("bar", "foo",
 			withContainers([]corev1.Container{{
 				Name:           servingContainerName,
 				Image:          "busybox",
-				Ports:          buildContainerPorts(v1.DefaultUserPort),
-				ReadinessProbe: withHTTPReadinessProbe(v1.DefaultUserPort),
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
 			}}),
 		),
-		want: podSpec([]corev1.Container{
-			servingContainer(func(container *corev1.Container) {
-				container.Image = "busybox"
-			}),
-			queueContainer(
-				withEnvVar("SERVING_READINESS_PROBE", `{"httpGet":{"path":"/","port":8080,"host":"127.0.0.1","scheme":"HTTP"}}`),
-			),
-		}),
-	}, {
-		name: "with runtime-class-name set requiring selector and label set in revision",
 		dc: deployment.Config{
-			RuntimeClassNames: map[string]deployment.RuntimeClassNameLabelSelector{
-				"gvisor": {
-					Selector: map[string]string{
-						"this-one": "specifically",
-					},
-				},
-			},
+			DefaultAffinityType:             deployment.SpreadRevisionOverNodes,
+			TopologySpreadWhenUnsatisfiable: corev1.ScheduleAnyway,
 		},
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(func(container *corev1.Container) {
+					container.Image = "busybox@sha256:deadbeef"
+				}),
+				queueContainer(),
+			},
+			func(p *corev1.PodSpec) {
+				p.TopologySpreadConstraints = defaultTopologySpreadConstraints(corev1.ScheduleAnyway)
+			},
+		),
+	}, {
+		name: "with topology spread over nodes set to DoNotSchedule",
 		rev: revision("bar", "foo",
-			WithRevisionLabel("this-one", "specifically"),
 			withContainers([]corev1.Container{{
 				Name:           servingContainerName,
 				Image:          "busybox",
-				Ports:          buildContainerPorts(v1.DefaultUserPort),
-				ReadinessProbe: withHTTPReadinessProbe(v1.DefaultUserPort),
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
 			}}),
 		),
-		want: podSpec([]corev1.Container{
-			servingContainer(func(container *corev1.Container) {
-				container.Image = "busybox"
-			}),
-			queueContainer(
-				withEnvVar("SERVING_READINESS_PROBE", `{"httpGet":{"path":"/","port":8080,"host":"127.0.0.1","scheme":"HTTP"}}`),
-			),
-		}, withRuntimeClass("gvisor")),
-	}, {
-		name: "with multiple runtime-class-name set and label selector for one",
 		dc: deployment.Config{
-			RuntimeClassNames: map[string]deployment.RuntimeClassNameLabelSelector{
-				"gvisor": {},
-				"kata": {
-					Selector: map[string]string{
-						"specific": "this-one",
-					},
-				},
-			},
+			DefaultAffinityType:             deployment.SpreadRevisionOverNodes,
+			TopologySpreadWhenUnsatisfiable: corev1.DoNotSchedule,
 		},
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(func(container *corev1.Container) {
+					container.Image = "busybox@sha256:deadbeef"
+				}),
+				queueContainer(),
+			},
+			func(p *corev1.PodSpec) {
+				p.TopologySpreadConstraints = defaultTopologySpreadConstraints(corev1.DoNotSchedule)
+			},
+		),
+	}, {
+		name: "with topology spread constraints set by both the user and the operator",
 		rev: revision("bar", "foo",
-			WithRevisionLabel("specific", "this-one"),
 			withContainers([]corev1.Container{{
 				Name:           servingContainerName,
 				Image:          "busybox",
-				Ports:          buildContainerPorts(v1.DefaultUserPort),
-				ReadinessProbe: withHTTPReadinessProbe(v1.DefaultUserPort),
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
 			}}),
-		),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+			func(r *v1.Revision) {
+				r.Spec.TopologySpreadConstraints = defaultTopologySpreadConstraints(corev1.DoNotSchedule)
+				r.Spec.TopologySpreadConstraints[0].MaxSkew = 2
+			}),
+		dc: deployment.Config{
+			DefaultAffinityType:             deployment.SpreadRevisionOverNodes,
+			TopologySpreadWhenUnsatisfiable: corev1.ScheduleAnyway,
+		},
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(func(container *corev1.Container) {
+					container.Image = "busybox@sha256:deadbeef"
+				}),
+				queueContainer(),
+			},
+			func(p *corev1.PodSpec) {
+				p.TopologySpreadConstraints = defaultTopologySpreadConstraints(corev1.DoNotSchedule)
+				p.TopologySpreadConstraints[0].MaxSkew = 2
+			},
+		),
+	}, {
+		name: "with affinity rules set by both the user and the operator",
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+			func(r *v1.Revision) {
+				r.Spec.Affinity = &corev1.Affinity{
+					PodAntiAffinity: userDefinedPodAntiAffinityRules,
+				}
+			}),
+		fc: apicfg.Features{
+			PodSpecAffinity: apicfg.Enabled,
+		},
+		dc: deployment.Config{
+			DefaultAffinityType: deployment.PreferSpreadRevisionOverNodes,
+		},
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(func(container *corev1.Container) {
+					container.Image = "busybox@sha256:deadbeef"
+				}),
+				queueContainer(),
+			},
+			func(p *corev1.PodSpec) {
+				p.Affinity = &corev1.Affinity{
+					PodAntiAffinity: userDefinedPodAntiAffinityRules,
+				}
+			},
+		),
+	}, {
+		name: "with preferred cross-revision anti-affinity",
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+		),
+		dc: deployment.Config{
+			DefaultAffinityType:       deployment.PreferSpreadRevisionOverNodes,
+			CrossRevisionAntiAffinity: deployment.CrossRevisionAntiAffinityPreferred,
+		},
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(func(container *corev1.Container) {
+					container.Image = "busybox@sha256:deadbeef"
+				}),
+				queueContainer(),
+			},
+			func(p *corev1.PodSpec) {
+				antiAffinity := defaultPodAntiAffinityRules.DeepCopy()
+				antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+					corev1.WeightedPodAffinityTerm{Weight: 100, PodAffinityTerm: crossRevisionPodAffinityTerm})
+				p.Affinity = &corev1.Affinity{PodAntiAffinity: antiAffinity}
+			},
+		),
+	}, {
+		name: "with required cross-revision anti-affinity and affinity rules set by the user",
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+			func(r *v1.Revision) {
+				r.Spec.Affinity = &corev1.Affinity{
+					PodAntiAffinity: userDefinedPodAntiAffinityRules,
+				}
+			}),
+		fc: apicfg.Features{
+			PodSpecAffinity: apicfg.Enabled,
+		},
+		dc: deployment.Config{
+			DefaultAffinityType:       deployment.PreferSpreadRevisionOverNodes,
+			CrossRevisionAntiAffinity: deployment.CrossRevisionAntiAffinityRequired,
+		},
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(func(container *corev1.Container) {
+					container.Image = "busybox@sha256:deadbeef"
+				}),
+				queueContainer(),
+			},
+			func(p *corev1.PodSpec) {
+				antiAffinity := userDefinedPodAntiAffinityRules.DeepCopy()
+				antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+					crossRevisionPodAffinityTerm)
+				p.Affinity = &corev1.Affinity{PodAntiAffinity: antiAffinity}
+			},
+		),
+	}, {
+		name: "with share-process-namespace set",
+		dc: deployment.Config{
+			ShareProcessNamespace: true,
+		},
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				Ports:          buildContainerPorts(v1.DefaultUserPort),
+				ReadinessProbe: withHTTPReadinessProbe(v1.DefaultUserPort),
+			}}),
+		),
+		want: podSpec([]corev1.Container{
+			servingContainer(func(container *corev1.Container) {
+				container.Image = "busybox"
+			}),
+			queueContainer(
+				withEnvVar("SERVING_READINESS_PROBE", `{"httpGet":{"path":"/","port":8080,"host":"127.0.0.1","scheme":"HTTP"}}`),
+			),
+		}, func(p *corev1.PodSpec) {
+			p.ShareProcessNamespace = ptr.Bool(true)
+		}),
+	}, {
+		name: "with share-process-namespace set and disabled by the revision",
+		dc: deployment.Config{
+			ShareProcessNamespace: true,
+		},
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				Ports:          buildContainerPorts(v1.DefaultUserPort),
+				ReadinessProbe: withHTTPReadinessProbe(v1.DefaultUserPort),
+			}}),
+			func(revision *v1.Revision) {
+				revision.Spec.ShareProcessNamespace = ptr.Bool(false)
+			},
+		),
+		want: podSpec([]corev1.Container{
+			servingContainer(func(container *corev1.Container) {
+				container.Image = "busybox"
+			}),
+			queueContainer(
+				withEnvVar("SERVING_READINESS_PROBE", `{"httpGet":{"path":"/","port":8080,"host":"127.0.0.1","scheme":"HTTP"}}`),
+			),
+		}, func(p *corev1.PodSpec) {
+			p.ShareProcessNamespace = ptr.Bool(false)
+		}),
+	}, {
+		name: "with default-priority-class-name set",
+		dc: deployment.Config{
+			DefaultPriorityClassName: "serving-high-priority",
+		},
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				Ports:          buildContainerPorts(v1.DefaultUserPort),
+				ReadinessProbe: withHTTPReadinessProbe(v1.DefaultUserPort),
+			}}),
+		),
+		want: podSpec([]corev1.Container{
+			servingContainer(func(container *corev1.Container) {
+				container.Image = "busybox"
+			}),
+			queueContainer(
+				withEnvVar("SERVING_READINESS_PROBE", `{"httpGet":{"path":"/","port":8080,"host":"127.0.0.1","scheme":"HTTP"}}`),
+			),
+		}, func(p *corev1.PodSpec) {
+			p.PriorityClassName = "serving-high-priority"
+		}),
+	}, {
+		name: "with default-priority-class-name set and overridden by the revision",
+		dc: deployment.Config{
+			DefaultPriorityClassName: "serving-high-priority",
+		},
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				Ports:          buildContainerPorts(v1.DefaultUserPort),
+				ReadinessProbe: withHTTPReadinessProbe(v1.DefaultUserPort),
+			}}),
+			func(revision *v1.Revision) {
+				revision.Spec.PriorityClassName = "batch"
+			},
+		),
+		want: podSpec([]corev1.Container{
+			servingContainer(func(container *corev1.Container) {
+				container.Image = "busybox"
+			}),
+			queueContainer(
+				withEnvVar("SERVING_READINESS_PROBE", `{"httpGet":{"path":"/","port":8080,"host":"127.0.0.1","scheme":"HTTP"}}`),
+			),
+		}, func(p *corev1.PodSpec) {
+			p.PriorityClassName = "batch"
+		}),
+	}, {
+		name: "with runtime-class-name set",
+		dc: deployment.Config{
+			RuntimeClassNames: map[string]deployment.RuntimeClassNameLabelSelector{
+				"gvisor": {},
+			},
+		},
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				Ports:          buildContainerPorts(v1.DefaultUserPort),
+				ReadinessProbe: withHTTPReadinessProbe(v1.DefaultUserPort),
+			}}),
+		),
+		want: podSpec([]corev1.Container{
+			servingContainer(func(container *corev1.Container) {
+				container.Image = "busybox"
+			}),
+			queueContainer(
+				withEnvVar("SERVING_READINESS_PROBE", `{"httpGet":{"path":"/","port":8080,"host":"127.0.0.1","scheme":"HTTP"}}`),
+			),
+		}, withRuntimeClass("gvisor")),
+	}, {
+		name: "with runtime-class-name set requiring selector and no label set in revision",
+		dc: deployment.Config{
+			RuntimeClassNames: map[string]deployment.RuntimeClassNameLabelSelector{
+				"gvisor": {
+					Selector: map[string]string{
+						"this-one": "specifically",
+					},
+				},
+			},
+		},
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				Ports:          buildContainerPorts(v1.DefaultUserPort),
+				ReadinessProbe: withHTTPReadinessProbe(v1.DefaultUserPort),
+			}}),
+		),
+		want: podSpec([]corev1.Container{
+			servingContainer(func(container *corev1.Container) {
+				container.Image = "busybox"
+			}),
+			queueContainer(
+				withEnvVar("SERVING_READINESS_PROBE", `{"httpGet":{"path":"/","port":8080,"host":"127.0.0.1","scheme":"HTTP"}}`),
+			),
+		}),
+	}, {
+		name: "with runtime-class-name set requiring selector and label set in revision",
+		dc: deployment.Config{
+			RuntimeClassNames: map[string]deployment.RuntimeClassNameLabelSelector{
+				"gvisor": {
+					Selector: map[string]string{
+						"this-one": "specifically",
+					},
+				},
+			},
+		},
+		rev: revision("bar", "foo",
+			WithRevisionLabel("this-one", "specifically"),
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				Ports:          buildContainerPorts(v1.DefaultUserPort),
+				ReadinessProbe: withHTTPReadinessProbe(v1.DefaultUserPort),
+			}}),
+		),
+		want: podSpec([]corev1.Container{
+			servingContainer(func(container *corev1.Container) {
+				container.Image = "busybox"
+			}),
+			queueContainer(
+				withEnvVar("SERVING_READINESS_PROBE", `{"httpGet":{"path":"/","port":8080,"host":"127.0.0.1","scheme":"HTTP"}}`),
+			),
+		}, withRuntimeClass("gvisor")),
+	}, {
+		name: "with multiple runtime-class-name set and label selector for one",
+		dc: deployment.Config{
+			RuntimeClassNames: map[string]deployment.RuntimeClassNameLabelSelector{
+				"gvisor": {},
+				"kata": {
+					Selector: map[string]string{
+						"specific": "this-one",
+					},
+				},
+			},
+		},
+		rev: revision("bar", "foo",
+			WithRevisionLabel("specific", "this-one"),
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				Ports:          buildContainerPorts(v1.DefaultUserPort),
+				ReadinessProbe: withHTTPReadinessProbe(v1.DefaultUserPort),
+			}}),
+		),
 		want: podSpec([]corev1.Container{
 			servingContainer(func(container *corev1.Container) {
 				container.Image = "busybox"
@@ -1695,21 +2182,82 @@ func TestMakeDeployment(t *testing.T) {
 			}})),
 		want: appsv1deployment(),
 	}, {
-		name: "with owner",
+		name: "with owner",
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "ubuntu",
+				ReadinessProbe: withTCPReadinessProbe(12345),
+			}}),
+			withoutLabels,
+			withOwnerReference("parent-config"),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}})),
+		want: appsv1deployment(),
+	}, {
+		name: "with sidecar annotation override",
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "ubuntu",
+				ReadinessProbe: withTCPReadinessProbe(12345),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+			withoutLabels, func(revision *v1.Revision) {
+				revision.Annotations = map[string]string{
+					sidecarIstioInjectAnnotation: "false",
+				}
+			}),
+		want: appsv1deployment(func(deploy *appsv1.Deployment) {
+			deploy.Annotations = kmeta.UnionMaps(deploy.Annotations,
+				map[string]string{sidecarIstioInjectAnnotation: "false"})
+			deploy.Spec.Template.Annotations = kmeta.UnionMaps(deploy.Spec.Template.Annotations,
+				map[string]string{sidecarIstioInjectAnnotation: "false"})
+		}),
+	}, {
+		name: "with deployment paused annotation",
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "ubuntu",
+				ReadinessProbe: withTCPReadinessProbe(12345),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+			withoutLabels, func(revision *v1.Revision) {
+				revision.Annotations = map[string]string{
+					serving.DeploymentPausedAnnotationKey: "true",
+				}
+			}),
+		want: appsv1deployment(func(deploy *appsv1.Deployment) {
+			deploy.Spec.Paused = true
+		}),
+	}, {
+		name: "with progress-deadline override",
+		dc: deployment.Config{
+			ProgressDeadline: 42 * time.Second,
+		},
 		rev: revision("bar", "foo",
 			withContainers([]corev1.Container{{
 				Name:           servingContainerName,
 				Image:          "ubuntu",
 				ReadinessProbe: withTCPReadinessProbe(12345),
 			}}),
-			withoutLabels,
-			withOwnerReference("parent-config"),
 			WithContainerStatuses([]v1.ContainerStatus{{
 				ImageDigest: "busybox@sha256:deadbeef",
-			}})),
-		want: appsv1deployment(),
+			}}), withoutLabels),
+		want: appsv1deployment(func(deploy *appsv1.Deployment) {
+			deploy.Spec.ProgressDeadlineSeconds = ptr.Int32(42)
+		}),
 	}, {
-		name: "with sidecar annotation override",
+		name: "with revision-history-limit override",
+		dc: deployment.Config{
+			RevisionHistoryLimit: 3,
+		},
 		rev: revision("bar", "foo",
 			withContainers([]corev1.Container{{
 				Name:           servingContainerName,
@@ -1718,22 +2266,14 @@ func TestMakeDeployment(t *testing.T) {
 			}}),
 			WithContainerStatuses([]v1.ContainerStatus{{
 				ImageDigest: "busybox@sha256:deadbeef",
-			}}),
-			withoutLabels, func(revision *v1.Revision) {
-				revision.Annotations = map[string]string{
-					sidecarIstioInjectAnnotation: "false",
-				}
-			}),
+			}}), withoutLabels),
 		want: appsv1deployment(func(deploy *appsv1.Deployment) {
-			deploy.Annotations = kmeta.UnionMaps(deploy.Annotations,
-				map[string]string{sidecarIstioInjectAnnotation: "false"})
-			deploy.Spec.Template.Annotations = kmeta.UnionMaps(deploy.Spec.Template.Annotations,
-				map[string]string{sidecarIstioInjectAnnotation: "false"})
+			deploy.Spec.RevisionHistoryLimit = ptr.Int32(3)
 		}),
 	}, {
-		name: "with progress-deadline override",
+		name: "with min-ready-seconds override",
 		dc: deployment.Config{
-			ProgressDeadline: 42 * time.Second,
+			MinReadySeconds: 10,
 		},
 		rev: revision("bar", "foo",
 			withContainers([]corev1.Container{{
@@ -1745,7 +2285,7 @@ func TestMakeDeployment(t *testing.T) {
 				ImageDigest: "busybox@sha256:deadbeef",
 			}}), withoutLabels),
 		want: appsv1deployment(func(deploy *appsv1.Deployment) {
-			deploy.Spec.ProgressDeadlineSeconds = ptr.Int32(42)
+			deploy.Spec.MinReadySeconds = 10
 		}),
 	}, {
 		name: "with progress-deadline annotation",
@@ -1784,6 +2324,47 @@ func TestMakeDeployment(t *testing.T) {
 			deploy.Annotations = map[string]string{serving.ProgressDeadlineAnnotationKey: "42s"}
 			deploy.Spec.Template.Annotations = map[string]string{serving.ProgressDeadlineAnnotationKey: "42s"}
 		}),
+	}, {
+		name: "with ProgressDeadline annotation over the maximum",
+		dc: deployment.Config{
+			ProgressDeadline:    503 * time.Second,
+			ProgressDeadlineMax: 900 * time.Second,
+		},
+		rev: revision("bar", "foo",
+			WithRevisionAnn("serving.knative.dev/progress-deadline", "1200s"),
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "ubuntu",
+				ReadinessProbe: withTCPReadinessProbe(12345),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}), withoutLabels),
+		want: appsv1deployment(func(deploy *appsv1.Deployment) {
+			deploy.Spec.ProgressDeadlineSeconds = ptr.Int32(503)
+			deploy.Annotations = map[string]string{serving.ProgressDeadlineAnnotationKey: "1200s"}
+			deploy.Spec.Template.Annotations = map[string]string{serving.ProgressDeadlineAnnotationKey: "1200s"}
+		}),
+	}, {
+		name: "with invalid ProgressDeadline annotation",
+		dc: deployment.Config{
+			ProgressDeadline: 503 * time.Second,
+		},
+		rev: revision("bar", "foo",
+			WithRevisionAnn("serving.knative.dev/progress-deadline", "1.5s"),
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "ubuntu",
+				ReadinessProbe: withTCPReadinessProbe(12345),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}), withoutLabels),
+		want: appsv1deployment(func(deploy *appsv1.Deployment) {
+			deploy.Spec.ProgressDeadlineSeconds = ptr.Int32(503)
+			deploy.Annotations = map[string]string{serving.ProgressDeadlineAnnotationKey: "1.5s"}
+			deploy.Spec.Template.Annotations = map[string]string{serving.ProgressDeadlineAnnotationKey: "1.5s"}
+		}),
 	}, {
 		name: "cluster initial scale",
 		acMutator: func(ac *autoscalerconfig.Config) {
@@ -1821,6 +2402,61 @@ func TestMakeDeployment(t *testing.T) {
 			deploy.Spec.Template.Annotations = map[string]string{autoscaling.InitialScaleAnnotationKey: "20"}
 			deploy.Annotations = map[string]string{autoscaling.InitialScaleAnnotationKey: "20"}
 		}),
+	}, {
+		name: "with queue resource rationale",
+		dc: deployment.Config{
+			QueueSidecarResourceRationale: true,
+		},
+		rev: revision("bar", "foo",
+			withoutLabels,
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "ubuntu",
+				ReadinessProbe: withTCPReadinessProbe(12345),
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU: resource.MustParse("100m"),
+					},
+					Limits: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("8"),
+						corev1.ResourceMemory: resource.MustParse("3000Mi"),
+					},
+				},
+			}}),
+			func(revision *v1.Revision) {
+				revision.Annotations = map[string]string{
+					serving.QueueSidecarResourcePercentageAnnotationKey:  "10",
+					serving.QueueSidecarMemoryResourceLimitAnnotationKey: "400Mi",
+				}
+			},
+		),
+		want: appsv1deployment(func(deploy *appsv1.Deployment) {
+			deploy.Annotations = map[string]string{
+				serving.QueueSidecarResourcePercentageAnnotationKey:  "10",
+				serving.QueueSidecarMemoryResourceLimitAnnotationKey: "400Mi",
+			}
+			deploy.Spec.Template.Annotations = map[string]string{
+				serving.QueueSidecarResourcePercentageAnnotationKey:  "10",
+				serving.QueueSidecarMemoryResourceLimitAnnotationKey: "400Mi",
+				serving.QueueSidecarResourceRationaleAnnotationKey: "cpu-request: 10% of user 100m = 10m, floored to 25m; " +
+					"cpu-limit: 10% of user 8 = 800m, capped to 500m; " +
+					"memory-limit: 10% of user 3000Mi = 300Mi, overridden to 400Mi by " + serving.QueueSidecarMemoryResourceLimitAnnotationKey,
+			}
+		}),
+	}, {
+		name: "with queue resource rationale but no computed resources",
+		dc: deployment.Config{
+			QueueSidecarResourceRationale: true,
+		},
+		rev: revision("bar", "foo",
+			withoutLabels,
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "ubuntu",
+				ReadinessProbe: withTCPReadinessProbe(12345),
+			}}),
+		),
+		want: appsv1deployment(),
 	}}
 
 	for _, test := range tests {
@@ -1844,7 +2480,7 @@ func TestMakeDeployment(t *testing.T) {
 				test.want.Spec.Template.Spec = *podSpec
 			}
 			// Copy to override
-			got, err := MakeDeployment(test.rev, cfg)
+			got, err := MakeDeployment(test.rev, nil, cfg)
 			if err != nil {
 				t.Fatal("Got unexpected error:", err)
 			}
@@ -1854,3 +2490,483 @@ func TestMakeDeployment(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeDeploymentPortCollision(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	tests := []struct {
+		name           string
+		initContainers []corev1.Container
+		userPort       int32
+		want           *PortCollisionError
+	}{{
+		name:     "no collision",
+		userPort: 8888,
+		initContainers: []corev1.Container{{
+			Name:          "sidecar",
+			Image:         "ubuntu",
+			RestartPolicy: &always,
+			Ports:         []corev1.ContainerPort{{ContainerPort: 9999}},
+		}},
+	}, {
+		name:     "user container collides with queue-proxy",
+		userPort: networking.BackendHTTPSPort,
+		want: &PortCollisionError{
+			Port:       networking.BackendHTTPSPort,
+			Protocol:   corev1.ProtocolTCP,
+			Containers: [2]string{servingContainerName, QueueContainerName},
+		},
+	}, {
+		name:     "sidecar collides with user container",
+		userPort: 8888,
+		initContainers: []corev1.Container{{
+			Name:          "sidecar",
+			Image:         "ubuntu",
+			RestartPolicy: &always,
+			Ports:         []corev1.ContainerPort{{ContainerPort: 8888}},
+		}},
+		want: &PortCollisionError{
+			Port:       8888,
+			Protocol:   corev1.ProtocolTCP,
+			Containers: [2]string{"sidecar", servingContainerName},
+		},
+	}, {
+		name:     "regular init container doesn't collide",
+		userPort: 8888,
+		initContainers: []corev1.Container{{
+			Name:  "init",
+			Image: "ubuntu",
+			Ports: []corev1.ContainerPort{{ContainerPort: 8888}},
+		}},
+	}, {
+		name:     "different protocols don't collide",
+		userPort: 8888,
+		initContainers: []corev1.Container{{
+			Name:          "sidecar",
+			Image:         "ubuntu",
+			RestartPolicy: &always,
+			Ports:         []corev1.ContainerPort{{ContainerPort: 8888, Protocol: corev1.ProtocolUDP}},
+		}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rev := revision("bar", "foo",
+				withoutLabels,
+				withContainers([]corev1.Container{{
+					Name:           servingContainerName,
+					Image:          "busybox",
+					Ports:          []corev1.ContainerPort{{ContainerPort: test.userPort}},
+					ReadinessProbe: withTCPReadinessProbe(int(test.userPort)),
+				}}),
+				func(r *v1.Revision) {
+					r.Spec.InitContainers = test.initContainers
+				})
+
+			_, err := MakeDeployment(rev, nil, revConfig())
+			if test.want == nil {
+				if err != nil {
+					t.Fatal("MakeDeployment() =", err)
+				}
+				return
+			}
+			var got *PortCollisionError
+			if !errors.As(err, &got) {
+				t.Fatalf("MakeDeployment() = %v, want a PortCollisionError", err)
+			}
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("PortCollisionError (-want, +got) =\n%s", cmp.Diff(test.want, got))
+			}
+		})
+	}
+}
+
+func TestMakeDeploymentLabels(t *testing.T) {
+	tests := []struct {
+		name          string
+		dc            deployment.Config
+		labels        map[string]string
+		nsLabels      map[string]string
+		wantLabels    map[string]string
+		wantPodLabels map[string]string
+		wantErr       string
+	}{{
+		name: "substitution",
+		dc: deployment.Config{
+			DeploymentLabels: map[string]string{
+				"example.com/team": "{label:team}",
+				"cost-center":      "cc-{namespace}",
+				"owner":            "{label:owner}",
+			},
+		},
+		// The tokens are resolved against the labels of the namespace.
+		labels:   map[string]string{"team": "revision"},
+		nsLabels: map[string]string{"team": "payments"},
+		wantLabels: map[string]string{
+			"example.com/team": "payments",
+			"cost-center":      "cc-foo",
+			"owner":            "",
+		},
+	}, {
+		name: "on pod template",
+		dc: deployment.Config{
+			DeploymentLabels:              map[string]string{"cost-center": "cc-{namespace}"},
+			DeploymentLabelsOnPodTemplate: true,
+		},
+		wantLabels:    map[string]string{"cost-center": "cc-foo"},
+		wantPodLabels: map[string]string{"cost-center": "cc-foo"},
+	}, {
+		name: "knative-managed labels are protected",
+		dc: deployment.Config{
+			DeploymentLabels: map[string]string{
+				AppLabelKey: "{namespace}",
+				"team":      "{namespace}",
+			},
+			DeploymentLabelsOnPodTemplate: true,
+		},
+		labels: map[string]string{"team": "payments"},
+	}, {
+		name: "invalid value",
+		dc: deployment.Config{
+			DeploymentLabels: map[string]string{
+				"cost-center": "cc-{namespace}",
+				"team":        "{label:team}",
+			},
+		},
+		nsLabels: map[string]string{"team": "payments team"},
+		wantErr:  `deployment-labels "team" is not a valid label value in namespace "foo", was "payments team"`,
+	}, {
+		name: "value too long after the substitution",
+		dc: deployment.Config{
+			DeploymentLabels: map[string]string{"owner": "{label:team}-{label:cost-center}"},
+		},
+		nsLabels: map[string]string{
+			"team":        strings.Repeat("t", 40),
+			"cost-center": strings.Repeat("c", 40),
+		},
+		wantErr: `deployment-labels "owner" is not a valid label value in namespace "foo"`,
+	}, {
+		name: "pod labels",
+		dc: deployment.Config{
+			PodLabels: map[string]string{"example.com/network-zone": "serverless"},
+		},
+		wantPodLabels: map[string]string{"example.com/network-zone": "serverless"},
+	}, {
+		name: "pod labels don't override the managed labels",
+		dc: deployment.Config{
+			PodLabels: map[string]string{
+				AppLabelKey:              "policy",
+				serving.RevisionLabelKey: "policy",
+				"team":                   "policy",
+				"zone":                   "serverless",
+			},
+		},
+		labels:        map[string]string{"team": "payments"},
+		wantPodLabels: map[string]string{"zone": "serverless"},
+	}, {
+		name: "pod labels along deployment labels",
+		dc: deployment.Config{
+			DeploymentLabels:              map[string]string{"cost-center": "cc-{namespace}"},
+			DeploymentLabelsOnPodTemplate: true,
+			PodLabels:                     map[string]string{"cost-center": "policy", "zone": "serverless"},
+		},
+		wantLabels:    map[string]string{"cost-center": "cc-foo"},
+		wantPodLabels: map[string]string{"cost-center": "cc-foo", "zone": "serverless"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rev := revision("bar", "foo",
+				withContainers([]corev1.Container{{
+					Name:           servingContainerName,
+					Image:          "busybox",
+					ReadinessProbe: withTCPReadinessProbe(12345),
+				}}),
+				func(r *v1.Revision) {
+					r.Labels = test.labels
+				})
+			cfg := revConfig()
+			cfg.Deployment = &test.dc
+
+			got, err := MakeDeployment(rev, test.nsLabels, cfg)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("MakeDeployment() = %v, want an error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("MakeDeployment() =", err)
+			}
+			labels := makeLabels(rev)
+			if want := kmeta.UnionMaps(labels, test.wantLabels); !cmp.Equal(got.Labels, want) {
+				t.Errorf("Labels (-want, +got) =\n%s", cmp.Diff(want, got.Labels))
+			}
+			if want := kmeta.UnionMaps(labels, test.wantPodLabels); !cmp.Equal(got.Spec.Template.Labels, want) {
+				t.Errorf("Pod template labels (-want, +got) =\n%s", cmp.Diff(want, got.Spec.Template.Labels))
+			}
+		})
+	}
+}
+
+func TestMakeDeploymentImagePullSecrets(t *testing.T) {
+	tests := []struct {
+		name        string
+		revSecrets  []corev1.LocalObjectReference
+		cfgSecrets  []string
+		wantSecrets []corev1.LocalObjectReference
+	}{{
+		name: "none",
+	}, {
+		name:        "configured secrets",
+		cfgSecrets:  []string{"mirror-creds", "registry-creds"},
+		wantSecrets: []corev1.LocalObjectReference{{Name: "mirror-creds"}, {Name: "registry-creds"}},
+	}, {
+		name:        "merged with the revision's secrets",
+		revSecrets:  []corev1.LocalObjectReference{{Name: "own-creds"}, {Name: "mirror-creds"}},
+		cfgSecrets:  []string{"mirror-creds", "registry-creds"},
+		wantSecrets: []corev1.LocalObjectReference{{Name: "own-creds"}, {Name: "mirror-creds"}, {Name: "registry-creds"}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rev := revision("bar", "foo",
+				withContainers([]corev1.Container{{
+					Name:           servingContainerName,
+					Image:          "busybox",
+					ReadinessProbe: withTCPReadinessProbe(12345),
+				}}),
+				func(r *v1.Revision) {
+					r.Spec.ImagePullSecrets = test.revSecrets
+				})
+			cfg := revConfig()
+			dc := *cfg.Deployment
+			dc.ImagePullSecrets = test.cfgSecrets
+			cfg.Deployment = &dc
+
+			got, err := MakeDeployment(rev, nil, cfg)
+			if err != nil {
+				t.Fatal("MakeDeployment() =", err)
+			}
+			if got := got.Spec.Template.Spec.ImagePullSecrets; !cmp.Equal(got, test.wantSecrets) {
+				t.Errorf("ImagePullSecrets (-want, +got) =\n%s", cmp.Diff(test.wantSecrets, got))
+			}
+		})
+	}
+}
+
+func TestMakeDeploymentTolerations(t *testing.T) {
+	gpu := corev1.Toleration{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}
+	dedicated := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "serving", Effect: corev1.TaintEffectNoSchedule}
+	tests := []struct {
+		name            string
+		revTolerations  []corev1.Toleration
+		cfgTolerations  []corev1.Toleration
+		wantTolerations []corev1.Toleration
+	}{{
+		name: "none",
+	}, {
+		name:            "default tolerations",
+		cfgTolerations:  []corev1.Toleration{gpu, dedicated},
+		wantTolerations: []corev1.Toleration{gpu, dedicated},
+	}, {
+		name:            "merged with the revision's tolerations",
+		revTolerations:  []corev1.Toleration{dedicated},
+		cfgTolerations:  []corev1.Toleration{gpu, dedicated},
+		wantTolerations: []corev1.Toleration{dedicated, gpu},
+	}, {
+		name: "different toleration seconds",
+		revTolerations: []corev1.Toleration{{
+			Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute, TolerationSeconds: ptr.Int64(60),
+		}},
+		cfgTolerations: []corev1.Toleration{{
+			Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute, TolerationSeconds: ptr.Int64(300),
+		}},
+		wantTolerations: []corev1.Toleration{{
+			Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute, TolerationSeconds: ptr.Int64(60),
+		}, {
+			Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute, TolerationSeconds: ptr.Int64(300),
+		}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rev := revision("bar", "foo",
+				withContainers([]corev1.Container{{
+					Name:           servingContainerName,
+					Image:          "busybox",
+					ReadinessProbe: withTCPReadinessProbe(12345),
+				}}),
+				func(r *v1.Revision) {
+					r.Spec.Tolerations = test.revTolerations
+				})
+			cfg := revConfig()
+			dc := *cfg.Deployment
+			dc.DefaultTolerations = test.cfgTolerations
+			cfg.Deployment = &dc
+
+			got, err := MakeDeployment(rev, nil, cfg)
+			if err != nil {
+				t.Fatal("MakeDeployment() =", err)
+			}
+			if got := got.Spec.Template.Spec.Tolerations; !cmp.Equal(got, test.wantTolerations) {
+				t.Errorf("Tolerations (-want, +got) =\n%s", cmp.Diff(test.wantTolerations, got))
+			}
+			if !cmp.Equal(rev.Spec.Tolerations, test.revTolerations) {
+				t.Errorf("The tolerations of the revision were modified: %v", rev.Spec.Tolerations)
+			}
+		})
+	}
+}
+
+func TestMakeDeploymentDefaultTopologySpreadConstraints(t *testing.T) {
+	revisionSelector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{serving.RevisionLabelKey: "bar"},
+	}
+	zone := corev1.TopologySpreadConstraint{MaxSkew: 1, TopologyKey: corev1.LabelTopologyZone, WhenUnsatisfiable: corev1.ScheduleAnyway}
+	zoneOfRevision := *zone.DeepCopy()
+	zoneOfRevision.LabelSelector = revisionSelector
+	hostOfApp := corev1.TopologySpreadConstraint{
+		MaxSkew:           1,
+		TopologyKey:       corev1.LabelHostname,
+		WhenUnsatisfiable: corev1.ScheduleAnyway,
+		LabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}},
+	}
+	tests := []struct {
+		name            string
+		affinityType    deployment.AffinityType
+		revConstraints  []corev1.TopologySpreadConstraint
+		cfgConstraints  []corev1.TopologySpreadConstraint
+		wantConstraints []corev1.TopologySpreadConstraint
+	}{{
+		name:         "none",
+		affinityType: deployment.None,
+	}, {
+		name:            "default constraints",
+		affinityType:    deployment.None,
+		cfgConstraints:  []corev1.TopologySpreadConstraint{zone},
+		wantConstraints: []corev1.TopologySpreadConstraint{zoneOfRevision},
+	}, {
+		name:            "default constraints with a label selector",
+		affinityType:    deployment.PreferSpreadRevisionOverNodes,
+		cfgConstraints:  []corev1.TopologySpreadConstraint{hostOfApp},
+		wantConstraints: []corev1.TopologySpreadConstraint{hostOfApp},
+	}, {
+		name:            "the revision's constraints take precedence",
+		affinityType:    deployment.None,
+		revConstraints:  []corev1.TopologySpreadConstraint{hostOfApp},
+		cfgConstraints:  []corev1.TopologySpreadConstraint{zone},
+		wantConstraints: []corev1.TopologySpreadConstraint{hostOfApp},
+	}, {
+		name:           "added to the spread over nodes",
+		affinityType:   deployment.SpreadRevisionOverNodes,
+		cfgConstraints: []corev1.TopologySpreadConstraint{zone},
+		wantConstraints: append(makeSpreadRevisionOverNodes("bar", corev1.ScheduleAnyway),
+			zoneOfRevision),
+	}, {
+		name:            "the spread over nodes takes precedence",
+		affinityType:    deployment.SpreadRevisionOverNodes,
+		cfgConstraints:  []corev1.TopologySpreadConstraint{hostOfApp},
+		wantConstraints: makeSpreadRevisionOverNodes("bar", corev1.ScheduleAnyway),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rev := revision("bar", "foo",
+				withContainers([]corev1.Container{{
+					Name:           servingContainerName,
+					Image:          "busybox",
+					ReadinessProbe: withTCPReadinessProbe(12345),
+				}}),
+				func(r *v1.Revision) {
+					r.Spec.TopologySpreadConstraints = test.revConstraints
+				})
+			cfg := revConfig()
+			dc := *cfg.Deployment
+			dc.DefaultAffinityType = test.affinityType
+			dc.TopologySpreadWhenUnsatisfiable = corev1.ScheduleAnyway
+			dc.DefaultTopologySpreadConstraints = test.cfgConstraints
+			cfg.Deployment = &dc
+
+			got, err := MakeDeployment(rev, nil, cfg)
+			if err != nil {
+				t.Fatal("MakeDeployment() =", err)
+			}
+			if got := got.Spec.Template.Spec.TopologySpreadConstraints; !cmp.Equal(got, test.wantConstraints) {
+				t.Errorf("TopologySpreadConstraints (-want, +got) =\n%s", cmp.Diff(test.wantConstraints, got))
+			}
+		})
+	}
+}
+
+func TestAppendImagePullSecrets(t *testing.T) {
+	// The secrets of the service account are de-duplicated against the
+	// configured ones already on the pod.
+	secrets := []corev1.LocalObjectReference{{Name: "mirror-creds"}, {Name: "registry-creds"}}
+	got := AppendImagePullSecrets(secrets, "sa-creds", "mirror-creds", "sa-creds")
+	want := []corev1.LocalObjectReference{{Name: "mirror-creds"}, {Name: "registry-creds"}, {Name: "sa-creds"}}
+	if !cmp.Equal(got, want) {
+		t.Errorf("AppendImagePullSecrets (-want, +got) =\n%s", cmp.Diff(want, got))
+	}
+}
+
+func TestMakeDeploymentSidecarContainers(t *testing.T) {
+	sidecars := map[string]deployment.SidecarContainer{
+		"log-shipper": {
+			Selector:  map[string]string{"team": "payments"},
+			Container: corev1.Container{Image: "example.com/log-shipper:1.0"},
+		},
+		// Colliding with the names of the user and queue-proxy containers.
+		servingContainerName: {
+			Container: corev1.Container{Image: "example.com/impostor"},
+		},
+		QueueContainerName: {
+			Container: corev1.Container{Image: "example.com/impostor"},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		labels       map[string]string
+		wantSidecars []corev1.Container
+	}{{
+		name:   "matching revision",
+		labels: map[string]string{"team": "payments"},
+		wantSidecars: []corev1.Container{{
+			Name:  "log-shipper",
+			Image: "example.com/log-shipper:1.0",
+		}},
+	}, {
+		name:   "non-matching revision",
+		labels: map[string]string{"team": "search"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rev := revision("bar", "foo",
+				withContainers([]corev1.Container{{
+					Name:           servingContainerName,
+					Image:          "busybox",
+					ReadinessProbe: withTCPReadinessProbe(12345),
+				}}),
+				func(r *v1.Revision) {
+					r.Labels = test.labels
+				})
+			cfg := revConfig()
+			dc := *cfg.Deployment
+			dc.SidecarContainers = sidecars
+			cfg.Deployment = &dc
+
+			got, err := MakeDeployment(rev, nil, cfg)
+			if err != nil {
+				t.Fatal("MakeDeployment() =", err)
+			}
+			containers := got.Spec.Template.Spec.Containers
+			if len(containers) < 2 || containers[0].Name != servingContainerName || containers[1].Name != QueueContainerName {
+				t.Fatalf("Containers = %v, want the user and queue-proxy containers first", containers)
+			}
+			if got := containers[2:]; !cmp.Equal(got, test.wantSidecars, cmpopts.EquateEmpty()) {
+				t.Errorf("Sidecars (-want, +got) =\n%s", cmp.Diff(test.wantSidecars, got, cmpopts.EquateEmpty()))
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// LimitRangeViolationError is returned when the resources of the queue-proxy
+// violate a LimitRange of the namespace, in which case the pods wouldn't be
+// admitted.
+type LimitRangeViolationError struct {
+	LimitRange string
+	Resource   corev1.ResourceName
+	// Violation describes how the resource violates the LimitRange, e.g.
+	// "request 25m is below the minimum 50m".
+	Violation string
+}
+
+func (e *LimitRangeViolationError) Error() string {
+	return fmt.Sprintf("queue-proxy %s %s of LimitRange %q", e.Resource, e.Violation, e.LimitRange)
+}
+
+// CheckQueueLimitRanges returns a LimitRangeViolationError if the resources
+// of the queue-proxy container of the given PodSpec violate the container
+// limits of one of the given LimitRanges, which are checked in the order of
+// their names.
+func CheckQueueLimitRanges(podSpec *corev1.PodSpec, limitRanges []*corev1.LimitRange) error {
+	var queue *corev1.Container
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == QueueContainerName {
+			queue = &podSpec.Containers[i]
+			break
+		}
+	}
+	if queue == nil {
+		return nil
+	}
+
+	limitRanges = append([]*corev1.LimitRange(nil), limitRanges...)
+	sort.Slice(limitRanges, func(i, j int) bool {
+		return limitRanges[i].Name < limitRanges[j].Name
+	})
+	for _, lr := range limitRanges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			if violation, name := checkLimitRangeItem(queue.Resources, item); violation != "" {
+				return &LimitRangeViolationError{
+					LimitRange: lr.Name,
+					Resource:   name,
+					Violation:  violation,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkLimitRangeItem returns how and which of the given resources violate
+// the given LimitRange item, or an empty violation.
+func checkLimitRangeItem(res corev1.ResourceRequirements, item corev1.LimitRangeItem) (string, corev1.ResourceName) {
+	for _, name := range sortedResourceNames(item.Min) {
+		lower := item.Min[name]
+		if q, ok := res.Requests[name]; ok && q.Cmp(lower) < 0 {
+			return fmt.Sprintf("request %s is below the minimum %s", q.String(), lower.String()), name
+		}
+		if q, ok := res.Limits[name]; ok && q.Cmp(lower) < 0 {
+			return fmt.Sprintf("limit %s is below the minimum %s", q.String(), lower.String()), name
+		}
+	}
+	for _, name := range sortedResourceNames(item.Max) {
+		upper := item.Max[name]
+		if q, ok := res.Requests[name]; ok && q.Cmp(upper) > 0 {
+			return fmt.Sprintf("request %s exceeds the maximum %s", q.String(), upper.String()), name
+		}
+		if q, ok := res.Limits[name]; ok && q.Cmp(upper) > 0 {
+			return fmt.Sprintf("limit %s exceeds the maximum %s", q.String(), upper.String()), name
+		}
+	}
+	for _, name := range sortedResourceNames(item.MaxLimitRequestRatio) {
+		ratio := item.MaxLimitRequestRatio[name]
+		req, hasReq := res.Requests[name]
+		limit, hasLimit := res.Limits[name]
+		if !hasReq || !hasLimit || req.IsZero() {
+			continue
+		}
+		if float64(limit.MilliValue())/float64(req.MilliValue()) > float64(ratio.MilliValue())/1000 {
+			return fmt.Sprintf("limit %s to request %s ratio exceeds the maximum %s", limit.String(), req.String(), ratio.String()), name
+		}
+	}
+	return "", ""
+}
+
+func sortedResourceNames(rl corev1.ResourceList) []corev1.ResourceName {
+	names := make([]corev1.ResourceName, 0, len(rl))
+	for name := range rl {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckQueueLimitRanges(t *testing.T) {
+	podSpec := &corev1.PodSpec{
+		Containers: []corev1.Container{{
+			Name: "user-container",
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1m")},
+			},
+		}, {
+			Name: QueueContainerName,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("25m"),
+					corev1.ResourceMemory: resource.MustParse("50Mi"),
+				},
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("1"),
+					corev1.ResourceMemory: resource.MustParse("200Mi"),
+				},
+			},
+		}},
+	}
+
+	tests := []struct {
+		name string
+		item corev1.LimitRangeItem
+		want *LimitRangeViolationError
+	}{{
+		name: "satisfied",
+		item: corev1.LimitRangeItem{
+			Type: corev1.LimitTypeContainer,
+			Min:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")},
+			Max:  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+		},
+	}, {
+		name: "pod limits are not checked",
+		item: corev1.LimitRangeItem{
+			Type: corev1.LimitTypePod,
+			Min:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+		},
+	}, {
+		name: "request below the minimum",
+		item: corev1.LimitRangeItem{
+			Type: corev1.LimitTypeContainer,
+			Min:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+		},
+		want: &LimitRangeViolationError{
+			LimitRange: "limits",
+			Resource:   corev1.ResourceCPU,
+			Violation:  "request 25m is below the minimum 50m",
+		},
+	}, {
+		name: "limit above the maximum",
+		item: corev1.LimitRangeItem{
+			Type: corev1.LimitTypeContainer,
+			Max:  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("100Mi")},
+		},
+		want: &LimitRangeViolationError{
+			LimitRange: "limits",
+			Resource:   corev1.ResourceMemory,
+			Violation:  "limit 200Mi exceeds the maximum 100Mi",
+		},
+	}, {
+		name: "limit to request ratio above the maximum",
+		item: corev1.LimitRangeItem{
+			Type:                 corev1.LimitTypeContainer,
+			MaxLimitRequestRatio: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10")},
+		},
+		want: &LimitRangeViolationError{
+			LimitRange: "limits",
+			Resource:   corev1.ResourceCPU,
+			Violation:  "limit 1 to request 25m ratio exceeds the maximum 10",
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckQueueLimitRanges(podSpec, []*corev1.LimitRange{{
+				ObjectMeta: metav1.ObjectMeta{Name: "limits"},
+				Spec:       corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{test.item}},
+			}})
+			if test.want == nil {
+				if err != nil {
+					t.Fatal("CheckQueueLimitRanges() =", err)
+				}
+				return
+			}
+			var got *LimitRangeViolationError
+			if !errors.As(err, &got) {
+				t.Fatalf("CheckQueueLimitRanges() = %v, want a LimitRangeViolationError", err)
+			}
+			if !cmp.Equal(test.want, got) {
+				t.Errorf("LimitRangeViolationError (-want, +got) =\n%s", cmp.Diff(test.want, got))
+			}
+		})
+	}
+}
+
+func TestCheckQueueLimitRangesOrder(t *testing.T) {
+	podSpec := &corev1.PodSpec{
+		Containers: []corev1.Container{{
+			Name: QueueContainerName,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("25m")},
+			},
+		}},
+	}
+	limitRange := func(name string) *corev1.LimitRange {
+		return &corev1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+				Type: corev1.LimitTypeContainer,
+				Min:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+			}}},
+		}
+	}
+
+	// Both limit ranges are violated, the first one by name is reported
+	// whatever the order they are listed in.
+	err := CheckQueueLimitRanges(podSpec, []*corev1.LimitRange{limitRange("b"), limitRange("a")})
+	var got *LimitRangeViolationError
+	if !errors.As(err, &got) {
+		t.Fatalf("CheckQueueLimitRanges() = %v, want a LimitRangeViolationError", err)
+	}
+	if got.LimitRange != "a" {
+		t.Errorf("LimitRange = %q, want: %q", got.LimitRange, "a")
+	}
+}
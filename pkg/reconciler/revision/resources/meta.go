@@ -31,8 +31,10 @@ var (
 	)
 
 	excludeAnnotations = sets.New(
+		serving.DeploymentPausedAnnotationKey,
 		serving.RevisionLastPinnedAnnotationKey,
 		serving.RevisionPreservedAnnotationKey,
+		serving.RevisionReconcilePausedAnnotationKey,
 		serving.RoutingStateModifiedAnnotationKey,
 		serving.RoutesAnnotationKey,
 	)
@@ -48,6 +48,11 @@ const (
 	requestQueueHTTPPortName  = "queue-port"
 	requestQueueHTTPSPortName = "https-port" // must be no more than 15 characters.
 	profilingPortName         = "profiling-port"
+
+	// queueGoMemLimitPercentage is the percentage of the queue-proxy's memory
+	// limit its Go soft memory limit is derived as, leaving headroom for
+	// memory not managed by the Go runtime.
+	queueGoMemLimitPercentage = 90
 )
 
 var (
@@ -93,6 +98,23 @@ var (
 	}
 )
 
+// makeQueueSecurityContext returns the security context of the queue proxy
+// container, with the user, group and non-root requirement of the config.
+func makeQueueSecurityContext(cfg *deployment.Config) *corev1.SecurityContext {
+	if cfg.QueueSidecarRunAsUser == nil && cfg.QueueSidecarRunAsGroup == nil && cfg.QueueSidecarRunsAsNonRoot() {
+		return queueSecurityContext
+	}
+	sc := queueSecurityContext.DeepCopy()
+	if cfg.QueueSidecarRunAsUser != nil {
+		sc.RunAsUser = ptr.Int64(*cfg.QueueSidecarRunAsUser)
+	}
+	if cfg.QueueSidecarRunAsGroup != nil {
+		sc.RunAsGroup = ptr.Int64(*cfg.QueueSidecarRunAsGroup)
+	}
+	sc.RunAsNonRoot = ptr.Bool(cfg.QueueSidecarRunsAsNonRoot())
+	return sc
+}
+
 func createQueueResources(cfg *deployment.Config, annotations map[string]string, userContainer *corev1.Container, useDefaults bool) corev1.ResourceRequirements {
 	resourceRequests := corev1.ResourceList{}
 	resourceLimits := corev1.ResourceList{}
@@ -191,6 +213,12 @@ func computeResourceRequirements(resourceQuantity *resource.Quantity, fraction f
 		return false, resource.Quantity{}
 	}
 
+	newquantity := boundary.applyBoundary(scaleQuantity(resourceQuantity, fraction))
+	return true, newquantity
+}
+
+// scaleQuantity returns the given fraction of the quantity.
+func scaleQuantity(resourceQuantity *resource.Quantity, fraction float64) resource.Quantity {
 	// In case the resourceQuantity MilliValue overflows int64 we use MaxInt64
 	// https://github.com/kubernetes/apimachinery/blob/master/pkg/api/resource/quantity.go
 	scaledValue := resourceQuantity.Value()
@@ -205,9 +233,66 @@ func computeResourceRequirements(resourceQuantity *resource.Quantity, fraction f
 	if percentageValue < math.MaxInt64 {
 		newValue = int64(percentageValue)
 	}
+	return *resource.NewMilliQuantity(newValue, resource.BinarySI)
+}
+
+// queueResourceRationale describes how the queue-proxy resources were computed
+// from the resources of the user container, e.g.
+// "cpu-request: 10% of user 100m = 10m, floored to 25m", or returns an empty
+// string if they weren't.
+func queueResourceRationale(annotations map[string]string, userContainer *corev1.Container) string {
+	fraction, ok := fractionFromPercentage(annotations, serving.QueueSidecarResourcePercentageAnnotation)
+	if !ok {
+		return ""
+	}
+	_, percentage, _ := serving.QueueSidecarResourcePercentageAnnotation.Get(annotations)
 
-	newquantity := boundary.applyBoundary(*resource.NewMilliQuantity(newValue, resource.BinarySI))
-	return true, newquantity
+	var rationale []string
+	for _, r := range []struct {
+		name     string
+		user     *resource.Quantity
+		boundary resourceBoundary
+		override kmap.KeyPriority
+	}{{
+		name:     "cpu-request",
+		user:     userContainer.Resources.Requests.Cpu(),
+		boundary: queueContainerRequestCPU,
+		override: serving.QueueSidecarCPUResourceRequestAnnotation,
+	}, {
+		name:     "cpu-limit",
+		user:     userContainer.Resources.Limits.Cpu(),
+		boundary: queueContainerLimitCPU,
+		override: serving.QueueSidecarCPUResourceLimitAnnotation,
+	}, {
+		name:     "memory-request",
+		user:     userContainer.Resources.Requests.Memory(),
+		boundary: queueContainerRequestMemory,
+		override: serving.QueueSidecarMemoryResourceRequestAnnotation,
+	}, {
+		name:     "memory-limit",
+		user:     userContainer.Resources.Limits.Memory(),
+		boundary: queueContainerLimitMemory,
+		override: serving.QueueSidecarMemoryResourceLimitAnnotation,
+	}} {
+		if r.user.IsZero() {
+			continue
+		}
+		scaled := scaleQuantity(r.user, fraction)
+		bounded := r.boundary.applyBoundary(scaled)
+
+		line := fmt.Sprintf("%s: %s%% of user %s = %s", r.name, percentage, r.user, &scaled)
+		switch bounded.Cmp(scaled) {
+		case 1:
+			line += ", floored to " + bounded.String()
+		case -1:
+			line += ", capped to " + bounded.String()
+		}
+		if q, ok := resourceFromAnnotation(annotations, r.override); ok {
+			line += fmt.Sprintf(", overridden to %s by %s", &q, r.override[0])
+		}
+		rationale = append(rationale, line)
+	}
+	return strings.Join(rationale, "; ")
 }
 
 func resourceFromAnnotation(m map[string]string, key kmap.KeyPriority) (resource.Quantity, bool) {
@@ -222,6 +307,14 @@ func fractionFromPercentage(m map[string]string, key kmap.KeyPriority) (float64,
 	return value / 100, err == nil
 }
 
+// quantityBytes formats the quantity as a number of bytes, a nil quantity is "0".
+func quantityBytes(q *resource.Quantity) string {
+	if q == nil {
+		return "0"
+	}
+	return strconv.FormatInt(q.Value(), 10)
+}
+
 // makeQueueContainer creates the container spec for the queue sidecar.
 func makeQueueContainer(rev *v1.Revision, cfg *config.Config) (*corev1.Container, error) {
 	configName := ""
@@ -338,8 +431,32 @@ func makeQueueContainer(rev *v1.Revision, cfg *config.Config) (*corev1.Container
 		}
 	}
 
+	var queueProxyLivenessProbe *corev1.Probe
+	if cfg.Deployment.QueueSidecarLivenessProbe {
+		queueProxyLivenessProbe = makeQueueLivenessProbe(cfg.Network.SystemInternalTLSEnabled())
+	}
+
 	fullDuplexFeature, fullDuplexExists := rev.Annotations[apicfg.AllowHTTPFullDuplexFeatureKey]
 
+	upstreamProtocolDetection := cfg.Deployment.QueueSidecarUpstreamProtocolDetection
+	if feature, ok := rev.Annotations[apicfg.UpstreamProtocolDetectionFeatureKey]; ok {
+		upstreamProtocolDetection = strings.EqualFold(feature, string(apicfg.Enabled))
+	}
+
+	overloadStatusCode := "0"
+	if _, v, ok := serving.QueueSidecarOverloadStatusCodeAnnotation.Get(rev.Annotations); ok {
+		overloadStatusCode = v
+	}
+	_, overloadBody, _ := serving.QueueSidecarOverloadBodyAnnotation.Get(rev.Annotations)
+	_, dependencyHealthCheck, _ := serving.QueueSidecarDependencyHealthCheckAnnotation.Get(rev.Annotations)
+	_, maintenanceAnnotation, _ := serving.QueueSidecarMaintenanceAnnotation.Get(rev.Annotations)
+	maintenance, _ := strconv.ParseBool(maintenanceAnnotation)
+
+	activatorProxyHeader := deployment.DefaultActivatorProxyHeader
+	if cfg.Deployment.ActivatorProxyHeader != nil {
+		activatorProxyHeader = *cfg.Deployment.ActivatorProxyHeader
+	}
+
 	useQPResourceDefaults := cfg.Features.QueueProxyResourceDefaults == apicfg.Enabled
 	c := &corev1.Container{
 		Name:            QueueContainerName,
@@ -348,7 +465,8 @@ func makeQueueContainer(rev *v1.Revision, cfg *config.Config) (*corev1.Container
 		Ports:           ports,
 		StartupProbe:    nil,
 		ReadinessProbe:  queueProxyReadinessProbe,
-		SecurityContext: queueSecurityContext,
+		LivenessProbe:   queueProxyLivenessProbe,
+		SecurityContext: makeQueueSecurityContext(cfg.Deployment),
 		Env: []corev1.EnvVar{{
 			Name:  "SERVING_NAMESPACE",
 			Value: rev.Namespace,
@@ -464,12 +582,155 @@ func makeQueueContainer(rev *v1.Revision, cfg *config.Config) (*corev1.Container
 		}, {
 			Name:  "ENABLE_MULTI_CONTAINER_PROBES",
 			Value: strconv.FormatBool(multiContainerProbingEnabled),
+		}, {
+			Name:  "SUPPRESS_OVERLOAD_DETAILS",
+			Value: strconv.FormatBool(cfg.Deployment.QueueSidecarSuppressOverloadDetails),
+		}, {
+			Name:  "QUEUE_FULL_STATUS_CODE",
+			Value: strconv.Itoa(cfg.Deployment.QueueSidecarQueueFullStatusCode),
+		}, {
+			Name:  "QUEUE_FULL_RETRY_AFTER_SECONDS",
+			Value: strconv.Itoa(int(cfg.Deployment.QueueSidecarQueueFullRetryAfter.Seconds())),
+		}, {
+			Name:  "QUEUE_FULL_BODY",
+			Value: cfg.Deployment.QueueSidecarQueueFullBody,
+		}, {
+			Name:  "BREAKER_DRAIN_TIMEOUT_SECONDS",
+			Value: strconv.Itoa(int(cfg.Deployment.QueueSidecarBreakerDrainTimeout.Seconds())),
+		}, {
+			Name:  "MAX_RESPONSE_HEADERS",
+			Value: strconv.Itoa(cfg.Deployment.QueueSidecarMaxResponseHeaders),
+		}, {
+			Name:  "MAX_UPSTREAM_CONNECTIONS",
+			Value: strconv.Itoa(cfg.Deployment.QueueSidecarMaxUpstreamConnections),
+		}, {
+			Name:  "H2_MAX_CONCURRENT_STREAMS",
+			Value: strconv.Itoa(cfg.Deployment.QueueSidecarH2MaxConcurrentStreams),
+		}, {
+			Name:  "MAX_REQUEST_BODY_BYTES",
+			Value: strconv.FormatInt(cfg.Deployment.QueueSidecarMaxRequestBodyBytes, 10),
+		}, {
+			Name:  "SLOW_REQUEST_THRESHOLD_MS",
+			Value: strconv.FormatInt(cfg.Deployment.QueueSidecarSlowRequestThreshold.Milliseconds(), 10),
+		}, {
+			Name:  "RESPONSE_HEADER_TIMEOUT_SECONDS",
+			Value: strconv.Itoa(int(cfg.Deployment.QueueSidecarResponseHeaderTimeout.Seconds())),
+		}, {
+			Name:  "VERSION_HEADER",
+			Value: strconv.FormatBool(cfg.Deployment.QueueSidecarVersionHeader),
+		}, {
+			Name:  "COUNT_PROBE_REQUESTS",
+			Value: strconv.FormatBool(cfg.Deployment.QueueSidecarCountProbeRequests),
+		}, {
+			Name:  "REPORT_RESPONSE_CLASSES",
+			Value: strconv.FormatBool(cfg.Deployment.QueueSidecarReportResponseClasses),
+		}, {
+			Name:  "REPORT_BREAKER_PARAMS",
+			Value: strconv.FormatBool(cfg.Deployment.QueueSidecarReportBreakerParams),
+		}, {
+			Name:  "MEMORY_SHEDDING_HIGH_WATER_MARK",
+			Value: quantityBytes(cfg.Deployment.QueueSidecarMemorySheddingHighWaterMark),
+		}, {
+			Name:  "MEMORY_SHEDDING_LOW_WATER_MARK",
+			Value: quantityBytes(cfg.Deployment.QueueSidecarMemorySheddingLowWaterMark),
+		}, {
+			Name:  "UPSTREAM_PROTOCOL_DETECTION",
+			Value: strconv.FormatBool(upstreamProtocolDetection),
+		}, {
+			Name:  "OVERLOAD_STATUS_CODE",
+			Value: overloadStatusCode,
+		}, {
+			Name:  "OVERLOAD_BODY",
+			Value: overloadBody,
+		}, {
+			Name:  "MAINTENANCE",
+			Value: strconv.FormatBool(maintenance),
+		}, {
+			Name:  "MAINTENANCE_STATUS_CODE",
+			Value: strconv.Itoa(cfg.Deployment.QueueSidecarMaintenanceStatusCode),
+		}, {
+			Name:  "MAINTENANCE_BODY",
+			Value: cfg.Deployment.QueueSidecarMaintenanceBody,
+		}, {
+			Name:  "ACTIVATOR_PROXY_HEADER_NAME",
+			Value: activatorProxyHeader.Name,
+		}, {
+			Name:  "ACTIVATOR_PROXY_HEADER_VALUE",
+			Value: activatorProxyHeader.Value,
+		}, {
+			Name:  "DEPENDENCY_HEALTH_CHECK",
+			Value: dependencyHealthCheck,
+		}, {
+			Name:  "REQUEST_ID_HEADER",
+			Value: cfg.Deployment.QueueSidecarRequestIDHeader,
+		}, {
+			Name:  "CLIENT_CONCURRENCY_LIMIT",
+			Value: strconv.Itoa(cfg.Deployment.QueueSidecarClientConcurrencyLimit),
+		}, {
+			Name:  "CLIENT_KEY_HEADER",
+			Value: cfg.Deployment.QueueSidecarClientKeyHeader,
+		}, {
+			Name:  "REJECT_HTTP10",
+			Value: strconv.FormatBool(cfg.Deployment.QueueSidecarHTTP10Handling == deployment.HTTP10Reject),
+		}, {
+			Name:  "PREWARM",
+			Value: strconv.FormatBool(cfg.Deployment.QueueSidecarPrewarm),
+		}, {
+			Name:  "PREWARM_PATH",
+			Value: cfg.Deployment.QueueSidecarPrewarmPath,
+		}, {
+			Name:  "DRAIN_READINESS_PATH",
+			Value: cfg.Deployment.QueueSidecarDrainReadinessPath,
+		}, {
+			Name:  "DRAIN_PATH",
+			Value: cfg.Deployment.QueueSidecarDrainPath,
 		}},
 	}
+	if limit := queueGoMemLimit(cfg.Deployment, c.Resources); limit != "" {
+		c.Env = append(c.Env, corev1.EnvVar{Name: "GOMEMLIMIT", Value: limit})
+	}
 
 	return c, nil
 }
 
+// queueGoMemLimit returns the Go soft memory limit of the queue-proxy with the
+// given resources, in bytes, or an empty string if none is to be set.
+func queueGoMemLimit(cfg *deployment.Config, resources corev1.ResourceRequirements) string {
+	if cfg.QueueSidecarGoMemLimit != nil {
+		return strconv.FormatInt(cfg.QueueSidecarGoMemLimit.Value(), 10)
+	}
+	if !cfg.QueueSidecarGoMemLimitAuto {
+		return ""
+	}
+	memory, ok := resources.Limits[corev1.ResourceMemory]
+	if !ok {
+		return ""
+	}
+	return strconv.FormatInt(memory.Value()*queueGoMemLimitPercentage/100, 10)
+}
+
+// makeQueueLivenessProbe creates the probe restarting the queue-proxy when it
+// stops handling requests. The admin port only serves TLS when
+// system-internal-tls is enabled.
+func makeQueueLivenessProbe(tlsEnabled bool) *corev1.Probe {
+	scheme := corev1.URISchemeHTTP
+	if tlsEnabled {
+		scheme = corev1.URISchemeHTTPS
+	}
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path:   queue.RequestQueueSelfHealthPath,
+				Port:   intstr.FromInt32(networking.QueueAdminPort),
+				Scheme: scheme,
+			},
+		},
+		// The queue-proxy answers by itself after at most a second.
+		TimeoutSeconds:   2,
+		FailureThreshold: 3,
+	}
+}
+
 func applyReadinessProbeDefaults(p *corev1.Probe, port int32) {
 	switch {
 	case p == nil:
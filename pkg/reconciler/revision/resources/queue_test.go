@@ -19,6 +19,7 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"sort"
 	"strconv"
 	"testing"
@@ -46,6 +47,7 @@ import (
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	"knative.dev/serving/pkg/autoscaler/config/autoscalerconfig"
 	"knative.dev/serving/pkg/deployment"
+	servingnetworking "knative.dev/serving/pkg/networking"
 	"knative.dev/serving/pkg/queue"
 	"knative.dev/serving/pkg/reconciler/revision/config"
 
@@ -441,6 +443,409 @@ func TestMakeQueueContainer(t *testing.T) {
 				"ENABLE_MULTI_CONTAINER_PROBES": "true",
 			})
 		}),
+	}, {
+		name: "suppress overload details",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarSuppressOverloadDetails: true,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"SUPPRESS_OVERLOAD_DETAILS": "true",
+			})
+		}),
+	}, {
+		name: "queue full status code",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarQueueFullStatusCode: http.StatusTooManyRequests,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"QUEUE_FULL_STATUS_CODE": "429",
+			})
+		}),
+	}, {
+		name: "queue full response",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarQueueFullRetryAfter: 5 * time.Second,
+			QueueSidecarQueueFullBody:       "come back later",
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"QUEUE_FULL_RETRY_AFTER_SECONDS": "5",
+				"QUEUE_FULL_BODY":                "come back later",
+			})
+		}),
+	}, {
+		name: "breaker drain timeout",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarBreakerDrainTimeout: 20 * time.Second,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"BREAKER_DRAIN_TIMEOUT_SECONDS": "20",
+			})
+		}),
+	}, {
+		name: "overload response annotations",
+		rev: revision("bar", "foo", withContainers(containers),
+			WithRevisionAnnotations(map[string]string{
+				serving.QueueSidecarOverloadStatusCodeAnnotationKey: "429",
+				serving.QueueSidecarOverloadBodyAnnotationKey:       "slow down",
+			})),
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"OVERLOAD_STATUS_CODE": "429",
+				"OVERLOAD_BODY":        "slow down",
+			})
+		}),
+	}, {
+		name: "maintenance annotation",
+		rev: revision("bar", "foo", withContainers(containers),
+			WithRevisionAnnotations(map[string]string{
+				serving.QueueSidecarMaintenanceAnnotationKey: "true",
+			})),
+		dc: deployment.Config{
+			QueueSidecarMaintenanceStatusCode: http.StatusGone,
+			QueueSidecarMaintenanceBody:       "down for maintenance",
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"MAINTENANCE":             "true",
+				"MAINTENANCE_STATUS_CODE": "410",
+				"MAINTENANCE_BODY":        "down for maintenance",
+			})
+		}),
+	}, {
+		name: "maintenance annotation cleared",
+		rev: revision("bar", "foo", withContainers(containers),
+			WithRevisionAnnotations(map[string]string{
+				serving.QueueSidecarMaintenanceAnnotationKey: "false",
+			})),
+		dc: deployment.Config{
+			QueueSidecarMaintenanceStatusCode: http.StatusGone,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"MAINTENANCE_STATUS_CODE": "410",
+			})
+		}),
+	}, {
+		name: "dependency health check annotation",
+		rev: revision("bar", "foo", withContainers(containers),
+			WithRevisionAnnotations(map[string]string{
+				serving.QueueSidecarDependencyHealthCheckAnnotationKey: "tcp://db.default.svc.cluster.local:5432",
+			})),
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"DEPENDENCY_HEALTH_CHECK": "tcp://db.default.svc.cluster.local:5432",
+			})
+		}),
+	}, {
+		name: "customized activator proxy header",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			ActivatorProxyHeader: &deployment.ProxyHeader{Name: "X-Knative-Proxy", Value: "kn-activator"},
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"ACTIVATOR_PROXY_HEADER_NAME":  "X-Knative-Proxy",
+				"ACTIVATOR_PROXY_HEADER_VALUE": "kn-activator",
+			})
+		}),
+	}, {
+		name: "max response headers",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarMaxResponseHeaders: 100,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"MAX_RESPONSE_HEADERS": "100",
+			})
+		}),
+	}, {
+		name: "max upstream connections",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarMaxUpstreamConnections: 50,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"MAX_UPSTREAM_CONNECTIONS": "50",
+			})
+		}),
+	}, {
+		name: "h2 max concurrent streams",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarH2MaxConcurrentStreams: 10,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"H2_MAX_CONCURRENT_STREAMS": "10",
+			})
+		}),
+	}, {
+		name: "max request body bytes",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarMaxRequestBodyBytes: 1 << 20,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"MAX_REQUEST_BODY_BYTES": "1048576",
+			})
+		}),
+	}, {
+		name: "slow request threshold",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarSlowRequestThreshold: 1500 * time.Millisecond,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"SLOW_REQUEST_THRESHOLD_MS": "1500",
+			})
+		}),
+	}, {
+		name: "response header timeout",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarResponseHeaderTimeout: 30 * time.Second,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"RESPONSE_HEADER_TIMEOUT_SECONDS": "30",
+			})
+		}),
+	}, {
+		name: "version header",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarVersionHeader: true,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"VERSION_HEADER": "true",
+			})
+		}),
+	}, {
+		name: "count probe requests",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarCountProbeRequests: true,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"COUNT_PROBE_REQUESTS": "true",
+			})
+		}),
+	}, {
+		name: "report response classes",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarReportResponseClasses: true,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"REPORT_RESPONSE_CLASSES": "true",
+			})
+		}),
+	}, {
+		name: "report breaker params",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarReportBreakerParams: true,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"REPORT_BREAKER_PARAMS": "true",
+			})
+		}),
+	}, {
+		name: "queue sidecar liveness probe",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarLivenessProbe: true,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.LivenessProbe = &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{
+					HTTPGet: &corev1.HTTPGetAction{
+						Path:   queue.RequestQueueSelfHealthPath,
+						Port:   intstr.FromInt32(servingnetworking.QueueAdminPort),
+						Scheme: corev1.URISchemeHTTP,
+					},
+				},
+				TimeoutSeconds:   2,
+				FailureThreshold: 3,
+			}
+			c.Env = env(map[string]string{})
+		}),
+	}, {
+		name: "queue sidecar liveness probe with system internal tls",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		nc: netcfg.Config{
+			SystemInternalTLS: netcfg.EncryptionEnabled,
+		},
+		dc: deployment.Config{
+			QueueSidecarLivenessProbe: true,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.LivenessProbe = &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{
+					HTTPGet: &corev1.HTTPGetAction{
+						Path:   queue.RequestQueueSelfHealthPath,
+						Port:   intstr.FromInt32(servingnetworking.QueueAdminPort),
+						Scheme: corev1.URISchemeHTTPS,
+					},
+				},
+				TimeoutSeconds:   2,
+				FailureThreshold: 3,
+			}
+			c.Env = env(map[string]string{})
+		}),
+	}, {
+		name: "memory pressure shedding",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarMemorySheddingHighWaterMark: resourcePtr(resource.MustParse("700Mi")),
+			QueueSidecarMemorySheddingLowWaterMark:  resourcePtr(resource.MustParse("600Mi")),
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"MEMORY_SHEDDING_HIGH_WATER_MARK": "734003200",
+				"MEMORY_SHEDDING_LOW_WATER_MARK":  "629145600",
+			})
+		}),
+	}, {
+		name: "upstream protocol detection",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarUpstreamProtocolDetection: true,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"UPSTREAM_PROTOCOL_DETECTION": "true",
+			})
+		}),
+	}, {
+		name: "request id header",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarRequestIDHeader: "X-Request-Id",
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"REQUEST_ID_HEADER": "X-Request-Id",
+			})
+		}),
+	}, {
+		name: "client concurrency limit",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarClientConcurrencyLimit: 5,
+			QueueSidecarClientKeyHeader:        "X-Api-Key",
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"CLIENT_CONCURRENCY_LIMIT": "5",
+				"CLIENT_KEY_HEADER":        "X-Api-Key",
+			})
+		}),
+	}, {
+		name: "reject http/1.0",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarHTTP10Handling: deployment.HTTP10Reject,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"REJECT_HTTP10": "true",
+			})
+		}),
+	}, {
+		name: "prewarm",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarPrewarm:     true,
+			QueueSidecarPrewarmPath: "/warmup",
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"PREWARM":      "true",
+				"PREWARM_PATH": "/warmup",
+			})
+		}),
+	}, {
+		name: "drain readiness path",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarDrainReadinessPath: "/drain-ready",
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"DRAIN_READINESS_PATH": "/drain-ready",
+			})
+		}),
+	}, {
+		name: "automatic gomemlimit",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarMemoryLimit:    resourcePtr(resource.MustParse("200Mi")),
+			QueueSidecarGoMemLimitAuto: true,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"GOMEMLIMIT": "188743680",
+			})
+			c.Resources.Limits = corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("200Mi"),
+			}
+		}),
+	}, {
+		name: "automatic gomemlimit without memory limit",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarGoMemLimitAuto: true,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{})
+		}),
+	}, {
+		name: "explicit gomemlimit",
+		rev:  revision("bar", "foo", withContainers(containers)),
+		dc: deployment.Config{
+			QueueSidecarGoMemLimit: resourcePtr(resource.MustParse("100Mi")),
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"GOMEMLIMIT": "104857600",
+			})
+		}),
+	}, {
+		name: "upstream protocol detection enabled by annotation",
+		rev: revision("bar", "foo", withContainers(containers),
+			WithRevisionAnnotations(map[string]string{apicfg.UpstreamProtocolDetectionFeatureKey: string(apicfg.Enabled)})),
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"UPSTREAM_PROTOCOL_DETECTION": "true",
+			})
+		}),
+	}, {
+		name: "upstream protocol detection disabled by annotation",
+		rev: revision("bar", "foo", withContainers(containers),
+			WithRevisionAnnotations(map[string]string{apicfg.UpstreamProtocolDetectionFeatureKey: string(apicfg.Disabled)})),
+		dc: deployment.Config{
+			QueueSidecarUpstreamProtocolDetection: true,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{})
+		}),
 	}}
 
 	for _, test := range tests {
@@ -458,6 +863,7 @@ func TestMakeQueueContainer(t *testing.T) {
 				Logging:       &test.lc,
 				Observability: &test.oc,
 				Deployment:    &test.dc,
+				Network:       &test.nc,
 				Config: &apicfg.Config{
 					Features: &test.fc,
 				},
@@ -734,6 +1140,77 @@ func TestMakeQueueContainerWithResourceAnnotations(t *testing.T) {
 	}
 }
 
+func TestMakeQueueContainerSecurityContext(t *testing.T) {
+	userSecurityContext := &corev1.SecurityContext{
+		RunAsUser:    ptr.Int64(1000),
+		RunAsNonRoot: ptr.Bool(true),
+	}
+	tests := []struct {
+		name string
+		dc   deployment.Config
+		want *corev1.SecurityContext
+	}{{
+		name: "default",
+		want: queueSecurityContext,
+	}, {
+		name: "user and group",
+		dc: deployment.Config{
+			QueueSidecarRunAsUser:  ptr.Int64(65532),
+			QueueSidecarRunAsGroup: ptr.Int64(65533),
+		},
+		want: func() *corev1.SecurityContext {
+			sc := queueSecurityContext.DeepCopy()
+			sc.RunAsUser = ptr.Int64(65532)
+			sc.RunAsGroup = ptr.Int64(65533)
+			return sc
+		}(),
+	}, {
+		name: "root allowed",
+		dc: deployment.Config{
+			QueueSidecarRunAsUser:    ptr.Int64(0),
+			QueueSidecarRunAsNonRoot: ptr.Bool(false),
+		},
+		want: func() *corev1.SecurityContext {
+			sc := queueSecurityContext.DeepCopy()
+			sc.RunAsUser = ptr.Int64(0)
+			sc.RunAsNonRoot = ptr.Bool(false)
+			return sc
+		}(),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rev := revision("bar", "foo",
+				withContainers([]corev1.Container{{
+					Name:            servingContainerName,
+					Image:           "busybox",
+					ReadinessProbe:  withTCPReadinessProbe(12345),
+					SecurityContext: userSecurityContext.DeepCopy(),
+				}}))
+			cfg := revConfig()
+			cfg.Deployment = &test.dc
+
+			got, err := MakeDeployment(rev, nil, cfg)
+			if err != nil {
+				t.Fatal("MakeDeployment() =", err)
+			}
+			for _, c := range got.Spec.Template.Spec.Containers {
+				want := userSecurityContext
+				if c.Name == QueueContainerName {
+					want = test.want
+				}
+				if !cmp.Equal(c.SecurityContext, want) {
+					t.Errorf("SecurityContext of %s (-want, +got) =\n%s", c.Name, cmp.Diff(want, c.SecurityContext))
+				}
+			}
+			// The shared default isn't modified.
+			if got := queueSecurityContext.RunAsUser; got != nil {
+				t.Errorf("The default queue security context was modified: RunAsUser = %d", *got)
+			}
+		})
+	}
+}
+
 func TestProbeGenerationHTTPDefaults(t *testing.T) {
 	rev := revision("bar", "foo",
 		func(revision *v1.Revision) {
@@ -1089,6 +1566,40 @@ var defaultEnv = map[string]string{
 	"USER_PORT":                                        strconv.Itoa(v1.DefaultUserPort),
 	"ROOT_CA":                                          "",
 	"ENABLE_MULTI_CONTAINER_PROBES":                    "false",
+	"SUPPRESS_OVERLOAD_DETAILS":                        "false",
+	"QUEUE_FULL_STATUS_CODE":                           "0",
+	"QUEUE_FULL_RETRY_AFTER_SECONDS":                   "0",
+	"QUEUE_FULL_BODY":                                  "",
+	"BREAKER_DRAIN_TIMEOUT_SECONDS":                    "0",
+	"OVERLOAD_STATUS_CODE":                             "0",
+	"OVERLOAD_BODY":                                    "",
+	"MAINTENANCE":                                      "false",
+	"MAINTENANCE_STATUS_CODE":                          "0",
+	"MAINTENANCE_BODY":                                 "",
+	"ACTIVATOR_PROXY_HEADER_NAME":                      "K-Proxy-Request",
+	"ACTIVATOR_PROXY_HEADER_VALUE":                     "activator",
+	"DEPENDENCY_HEALTH_CHECK":                          "",
+	"REQUEST_ID_HEADER":                                "",
+	"CLIENT_CONCURRENCY_LIMIT":                         "0",
+	"CLIENT_KEY_HEADER":                                "",
+	"REJECT_HTTP10":                                    "false",
+	"PREWARM":                                          "false",
+	"PREWARM_PATH":                                     "",
+	"DRAIN_READINESS_PATH":                             "",
+	"DRAIN_PATH":                                       "",
+	"MAX_RESPONSE_HEADERS":                             "0",
+	"MAX_UPSTREAM_CONNECTIONS":                         "0",
+	"H2_MAX_CONCURRENT_STREAMS":                        "0",
+	"MAX_REQUEST_BODY_BYTES":                           "0",
+	"SLOW_REQUEST_THRESHOLD_MS":                        "0",
+	"RESPONSE_HEADER_TIMEOUT_SECONDS":                  "0",
+	"VERSION_HEADER":                                   "false",
+	"COUNT_PROBE_REQUESTS":                             "false",
+	"REPORT_RESPONSE_CLASSES":                          "false",
+	"REPORT_BREAKER_PARAMS":                            "false",
+	"MEMORY_SHEDDING_HIGH_WATER_MARK":                  "0",
+	"MEMORY_SHEDDING_LOW_WATER_MARK":                   "0",
+	"UPSTREAM_PROTOCOL_DETECTION":                      "false",
 }
 
 func probeJSON(container *corev1.Container) string {
@@ -0,0 +1,73 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// resyncThrottler coalesces the global resyncs triggered in quick succession,
+// e.g. by several config changes, into a single one run after its delay. This
+// bounds the rate of the global resyncs to one per delay, while the last
+// trigger is always followed by a resync. Without a delay, every trigger
+// resyncs right away.
+type resyncThrottler struct {
+	clock  clock.WithDelayedExecution
+	resync func()
+
+	mu      sync.Mutex
+	delay   time.Duration
+	pending bool
+}
+
+func newResyncThrottler(resync func()) *resyncThrottler {
+	return &resyncThrottler{
+		clock:  clock.RealClock{},
+		resync: resync,
+	}
+}
+
+// SetDelay sets the delay of the resyncs triggered from now on.
+func (t *resyncThrottler) SetDelay(delay time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.delay = delay
+}
+
+// Trigger schedules a resync after the delay, unless one is pending already.
+func (t *resyncThrottler) Trigger() {
+	t.mu.Lock()
+	if t.delay <= 0 {
+		t.mu.Unlock()
+		t.resync()
+		return
+	}
+	defer t.mu.Unlock()
+	if t.pending {
+		return
+	}
+	t.pending = true
+	t.clock.AfterFunc(t.delay, func() {
+		t.mu.Lock()
+		t.pending = false
+		t.mu.Unlock()
+		t.resync()
+	})
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clocktest "k8s.io/utils/clock/testing"
+)
+
+func TestResyncThrottler(t *testing.T) {
+	const delay = 10 * time.Second
+	resyncs := atomic.NewInt32(0)
+	clock := clocktest.NewFakeClock(time.Now())
+	throttler := newResyncThrottler(func() { resyncs.Inc() })
+	throttler.clock = clock
+
+	// Without a delay, every change resyncs right away.
+	for i := 0; i < 3; i++ {
+		throttler.Trigger()
+	}
+	if got, want := resyncs.Load(), int32(3); got != want {
+		t.Fatalf("Resyncs = %d, want: %d", got, want)
+	}
+	resyncs.Store(0)
+
+	waitForResyncs := func(want int32) {
+		t.Helper()
+		if err := wait.PollUntilContextTimeout(context.Background(), 5*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+			return resyncs.Load() == want, nil
+		}); err != nil {
+			t.Fatalf("Resyncs = %d, want: %d", resyncs.Load(), want)
+		}
+	}
+
+	// The rapid changes are coalesced into a single resync after the delay.
+	throttler.SetDelay(delay)
+	for i := 0; i < 10; i++ {
+		throttler.Trigger()
+		clock.Step(delay / 20)
+	}
+	if got := resyncs.Load(); got != 0 {
+		t.Fatalf("Resyncs = %d, want no resync before the delay", got)
+	}
+	clock.Step(delay / 2)
+	waitForResyncs(1)
+
+	// The changes keeping on coming resync once per delay.
+	for want := int32(2); want <= 4; want++ {
+		for i := 0; i < 5; i++ {
+			throttler.Trigger()
+		}
+		clock.Step(delay)
+		waitForResyncs(want)
+	}
+	if clock.HasWaiters() {
+		t.Error("A resync is pending after the last change was resynced")
+	}
+}
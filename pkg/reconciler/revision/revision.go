@@ -18,6 +18,8 @@ package revision
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"strings"
 	"time"
 
@@ -27,9 +29,9 @@ import (
 	"go.uber.org/zap/zapcore"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
 	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
 	cachingclientset "knative.dev/caching/pkg/client/clientset/versioned"
 	networkingclientset "knative.dev/networking/pkg/client/clientset/versioned"
 	"knative.dev/pkg/tracker"
@@ -46,10 +48,11 @@ import (
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	palisters "knative.dev/serving/pkg/client/listers/autoscaling/v1alpha1"
 	"knative.dev/serving/pkg/reconciler/revision/config"
+	"knative.dev/serving/pkg/reconciler/revision/resources"
 )
 
 type resolver interface {
-	Resolve(*zap.SugaredLogger, *v1.Revision, k8schain.Options, sets.Set[string], time.Duration) ([]v1.ContainerStatus, []v1.ContainerStatus, error)
+	Resolve(*zap.SugaredLogger, *v1.Revision, resolveOptions) ([]v1.ContainerStatus, []v1.ContainerStatus, map[string]map[string]string, error)
 	Clear(types.NamespacedName)
 	Forget(types.NamespacedName)
 }
@@ -67,6 +70,18 @@ type Reconciler struct {
 	deploymentLister    appsv1listers.DeploymentLister
 	certificateLister   networkinglisters.CertificateLister
 
+	// limitRangeLister is used to check the resources of the queue-proxy
+	// against the limit ranges of the namespace, when enabled.
+	limitRangeLister corev1listers.LimitRangeLister
+
+	// serviceAccountLister is used to merge the image pull secrets of the
+	// service accounts when image pull secrets are configured centrally.
+	serviceAccountLister corev1listers.ServiceAccountLister
+
+	// namespaceLister is used to resolve the deployment labels templated
+	// from the labels of the namespace.
+	namespaceLister corev1listers.NamespaceLister
+
 	tracker  tracker.Interface
 	resolver resolver
 }
@@ -87,37 +102,111 @@ func (c *Reconciler) reconcileDigest(ctx context.Context, rev *v1.Revision) (boo
 		return true, nil
 	}
 
-	imagePullSecrets := make([]string, 0, len(rev.Spec.ImagePullSecrets))
-	for _, s := range rev.Spec.ImagePullSecrets {
+	cfgs := config.FromContext(ctx)
+	// The images are resolved with the same secrets as the pods pull them with.
+	pullSecrets := resources.AppendImagePullSecrets(slices.Clip(rev.Spec.ImagePullSecrets), cfgs.Deployment.ImagePullSecrets...)
+	imagePullSecrets := make([]string, 0, len(pullSecrets))
+	for _, s := range pullSecrets {
 		imagePullSecrets = append(imagePullSecrets, s.Name)
 	}
-	cfgs := config.FromContext(ctx)
-	opt := k8schain.Options{
-		Namespace:          rev.Namespace,
-		ServiceAccountName: rev.Spec.ServiceAccountName,
-		ImagePullSecrets:   imagePullSecrets,
+	opts := resolveOptions{
+		opt: k8schain.Options{
+			Namespace:          rev.Namespace,
+			ServiceAccountName: rev.Spec.ServiceAccountName,
+			ImagePullSecrets:   imagePullSecrets,
+		},
+		registriesToSkip: cfgs.Deployment.RegistriesSkippingTagResolving,
+		labelsToExport:   cfgs.Deployment.ExportedImageLabels,
+		requiredLabels:   cfgs.Deployment.RequiredImageLabels,
+		deniedLabels:     cfgs.Deployment.DeniedImageLabels,
+		verifyLayers:     cfgs.Deployment.DigestResolutionVerifyLayers,
+		timeout:          cfgs.Deployment.DigestResolutionTimeout,
+		maxConcurrency:   cfgs.Deployment.DigestResolutionConcurrency,
 	}
 
 	logger := logging.FromContext(ctx)
-	initContainerStatuses, statuses, err := c.resolver.Resolve(logger, rev, opt, cfgs.Deployment.RegistriesSkippingTagResolving, cfgs.Deployment.DigestResolutionTimeout)
+	initContainerStatuses, statuses, imageLabels, err := c.resolver.Resolve(logger, rev, opts)
+	var labelErr *missingImageLabelError
+	if errors.As(err, &labelErr) {
+		// The image won't change, so there is no point in retrying until the
+		// required labels are reconfigured, which resyncs all the revisions.
+		rev.Status.MarkContainerHealthyFalse(v1.ReasonRequiredImageLabelMissing, err.Error())
+		recordDigestResolutionFailed(ctx, rev, v1.ReasonRequiredImageLabelMissing, err)
+		return true, controller.NewPermanentError(err)
+	}
+	if errors.As(err, new(*deniedImageLabelError)) {
+		// Likewise until the denied labels are reconfigured.
+		rev.Status.MarkContainerHealthyFalse(v1.ReasonDeniedImageLabel, err.Error())
+		recordDigestResolutionFailed(ctx, rev, v1.ReasonDeniedImageLabel, err)
+		return true, controller.NewPermanentError(err)
+	}
 	if err != nil {
 		// Clear the resolver so we can retry the digest resolution rather than
 		// being stuck with this error.
 		c.resolver.Clear(types.NamespacedName{Namespace: rev.Namespace, Name: rev.Name})
-		rev.Status.MarkContainerHealthyFalse(v1.ReasonContainerMissing, err.Error())
+		reason := v1.ReasonContainerMissing
+		switch {
+		case errors.As(err, new(*missingImageLayerError)):
+			// The layer may still be pushed, so keep retrying.
+			reason = v1.ReasonImageLayerMissing
+		case errors.As(err, new(*imagePullSecretsError)):
+			// Likewise, the secrets may still be created or made readable.
+			reason = v1.ReasonImagePullSecretsUnavailable
+		case isResolutionTimeout(err):
+			// A transient network issue, rather than a bad image.
+			reason = v1.ReasonImageResolutionTimeout
+		case isImageUnauthorized(err):
+			reason = v1.ReasonImageUnauthorized
+		case isImageNotFound(err):
+			reason = v1.ReasonImageNotFound
+		}
+		rev.Status.MarkContainerHealthyFalse(reason, err.Error())
+		recordDigestResolutionFailed(ctx, rev, reason, err)
+		if cfgs.Deployment.DigestResolutionFailureUnroutable {
+			rev.Status.MarkTemporarilyUnroutable(err.Error())
+		}
 		return true, err
 	}
 
 	if len(statuses) > 0 || len(initContainerStatuses) > 0 {
+		rev.Status.MarkRoutable()
 		rev.Status.ContainerStatuses = statuses
 		rev.Status.InitContainerStatuses = initContainerStatuses
+		for container, labels := range imageLabels {
+			rev.Status.SetImageLabels(container, labels)
+		}
+		if cfgs.Deployment.DigestResolutionEvents {
+			for _, status := range append(initContainerStatuses, statuses...) {
+				controller.GetEventRecorder(ctx).Eventf(rev, corev1.EventTypeNormal, "DigestResolved",
+					"Resolved the image of container %q to %s", status.Name, status.ImageDigest)
+			}
+		}
 		return true, nil
 	}
 
+	// The revision is marked as resolving its digests until the resolution
+	// completes, so a resolution started by this call is told apart from one
+	// still in flight by the reason.
+	if cfgs.Deployment.DigestResolutionEvents {
+		if cond := rev.Status.GetCondition(v1.RevisionConditionResourcesAvailable); cond == nil || cond.Reason != v1.ReasonResolvingDigests {
+			controller.GetEventRecorder(ctx).Event(rev, corev1.EventTypeNormal, "DigestResolutionStarted",
+				"Started resolving the image tags to digests")
+		}
+	}
+
 	// No digest yet, wait for re-enqueue when resolution is done.
 	return false, nil
 }
 
+// recordDigestResolutionFailed records a DigestResolutionFailed event on the
+// revision if enabled by the configuration.
+func recordDigestResolutionFailed(ctx context.Context, rev *v1.Revision, reason string, err error) {
+	if config.FromContext(ctx).Deployment.DigestResolutionEvents {
+		controller.GetEventRecorder(ctx).Eventf(rev, corev1.EventTypeWarning, "DigestResolutionFailed",
+			"%s: %v", reason, err)
+	}
+}
+
 // ReconcileKind implements Interface.ReconcileKind.
 func (c *Reconciler) ReconcileKind(ctx context.Context, rev *v1.Revision) pkgreconciler.Event {
 	ctx, cancel := context.WithTimeout(ctx, pkgreconciler.DefaultTimeout)
@@ -145,6 +234,17 @@ func (c *Reconciler) ReconcileKind(ctx context.Context, rev *v1.Revision) pkgrec
 		logger.Debug("Revision meta: " + spew.Sdump(rev.ObjectMeta))
 	}
 
+	// Leave the owned resources alone while reconciliation is paused, so that
+	// manual changes to them are not reverted.
+	if rev.IsReconcilePaused() {
+		logger.Info("Reconciliation of owned resources is paused")
+		rev.Status.MarkReconcilePaused()
+		return nil
+	}
+	rev.Status.MarkReconcileResumed()
+	checkProgressDeadlineAnnotation(config.FromContext(ctx), rev)
+	checkProgressDeadline(config.FromContext(ctx), rev)
+
 	// Deploy Knative Certificate for queue-proxy when system-internal-tls is enabled.
 	if config.FromContext(ctx).Network.SystemInternalTLSEnabled() {
 		if err := c.reconcileQueueProxyCertificate(ctx, rev); err != nil {
@@ -161,6 +261,13 @@ func (c *Reconciler) ReconcileKind(ctx context.Context, rev *v1.Revision) pkgrec
 			return err
 		}
 	}
+
+	// A paused deployment doesn't roll out, so don't consider the resources
+	// available until it is resumed, unless they are known to be unavailable.
+	if rev.IsDeploymentPaused() && !rev.Status.GetCondition(v1.RevisionConditionResourcesAvailable).IsFalse() {
+		rev.Status.MarkDeploymentPaused()
+	}
+
 	readyAfterReconcile := rev.Status.GetCondition(v1.RevisionConditionReady).IsTrue()
 	if !readyBeforeReconcile && readyAfterReconcile {
 		logger.Info("Revision became ready")
@@ -174,6 +281,56 @@ func (c *Reconciler) ReconcileKind(ctx context.Context, rev *v1.Revision) pkgrec
 	return nil
 }
 
+// checkProgressDeadlineAnnotation flags the revision if its progress deadline
+// annotation is ignored, in favor of the configured progress deadline.
+func checkProgressDeadlineAnnotation(cfg *config.Config, rev *v1.Revision) {
+	if _, _, err := resources.AnnotatedProgressDeadline(rev, cfg); err != nil {
+		rev.Status.MarkProgressDeadlineIgnored(cfg.Deployment.ProgressDeadline, err.Error())
+	} else {
+		rev.Status.MarkProgressDeadlineHonored()
+	}
+}
+
+// checkProgressDeadline flags the revision if enabled by the configuration and
+// its startup probes may take longer than its progress deadline to succeed.
+func checkProgressDeadline(cfg *config.Config, rev *v1.Revision) {
+	if !cfg.Deployment.ProgressDeadlineAdvisory {
+		rev.Status.MarkProgressDeadlineSufficient()
+		return
+	}
+	startup, deadline := maxStartupDuration(rev), resources.ProgressDeadline(rev, cfg)
+	if startup > deadline {
+		rev.Status.MarkProgressDeadlineTooShort(startup, deadline)
+	} else {
+		rev.Status.MarkProgressDeadlineSufficient()
+	}
+}
+
+// maxStartupDuration returns the longest time the startup probes of the
+// containers of the revision may take before failing, zero if they have none.
+func maxStartupDuration(rev *v1.Revision) time.Duration {
+	var ret time.Duration
+	for _, container := range rev.Spec.Containers {
+		p := container.StartupProbe
+		if p == nil {
+			continue
+		}
+		// The Kubernetes defaults of the probes apply to the pods, not to the
+		// revisions.
+		period, threshold := p.PeriodSeconds, p.FailureThreshold
+		if period == 0 {
+			period = 10
+		}
+		if threshold == 0 {
+			threshold = 3
+		}
+		if d := time.Duration(p.InitialDelaySeconds+period*threshold) * time.Second; d > ret {
+			ret = d
+		}
+	}
+	return ret
+}
+
 func (c *Reconciler) updateRevisionLoggingURL(ctx context.Context, rev *v1.Revision) {
 	config := config.FromContext(ctx)
 	if config.Observability.LoggingURLTemplate == "" {
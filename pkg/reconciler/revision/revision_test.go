@@ -21,6 +21,10 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -32,22 +36,26 @@ import (
 	fakekubeclient "knative.dev/pkg/client/injection/kube/client/fake"
 	fakedeploymentinformer "knative.dev/pkg/client/injection/kube/informers/apps/v1/deployment/fake"
 	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/configmap/fake"
+	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/limitrange/fake"
+	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/namespace/fake"
 	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/service/fake"
+	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/serviceaccount/fake"
 	"knative.dev/pkg/ptr"
 	fakeservingclient "knative.dev/serving/pkg/client/injection/client/fake"
 	fakepainformer "knative.dev/serving/pkg/client/injection/informers/autoscaling/v1alpha1/podautoscaler/fake"
 	fakerevisioninformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/revision/fake"
 
 	"github.com/google/go-cmp/cmp"
-	"github.com/google/go-containerregistry/pkg/authn/k8schain"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"golang.org/x/sync/errgroup"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 
 	netcfg "knative.dev/networking/pkg/config"
 	"knative.dev/pkg/apis"
@@ -93,7 +101,7 @@ func newTestController(t *testing.T, configs []*corev1.ConfigMap, opts ...reconc
 	opts = append([]reconcilerOption{func(r *Reconciler) {
 		r.resolver = &nopResolver{}
 	}}, opts...)
-	controller := newControllerWithOptions(ctx, configMapWatcher, opts...)
+	controller := newControllerWithOptions(ctx, configMapWatcher, deployment.DigestResolutionWorkersDefault, opts...)
 
 	for _, cm := range append([]*corev1.ConfigMap{{
 		ObjectMeta: metav1.ObjectMeta{
@@ -229,7 +237,7 @@ func addResourcesToInformers(t *testing.T, ctx context.Context, rev *v1.Revision
 
 type nopResolver struct{}
 
-func (r *nopResolver) Resolve(_ *zap.SugaredLogger, rev *v1.Revision, _ k8schain.Options, _ sets.Set[string], _ time.Duration) ([]v1.ContainerStatus, []v1.ContainerStatus, error) {
+func (r *nopResolver) Resolve(_ *zap.SugaredLogger, rev *v1.Revision, _ resolveOptions) ([]v1.ContainerStatus, []v1.ContainerStatus, map[string]map[string]string, error) {
 	status := []v1.ContainerStatus{{
 		Name: rev.Spec.Containers[0].Name,
 	}}
@@ -240,9 +248,9 @@ func (r *nopResolver) Resolve(_ *zap.SugaredLogger, rev *v1.Revision, _ k8schain
 				Name: rev.Spec.InitContainers[i].Name,
 			})
 		}
-		return initStatus, status, nil
+		return initStatus, status, nil, nil
 	}
-	return nil, status, nil
+	return nil, status, nil, nil
 }
 
 func (r *nopResolver) Clear(types.NamespacedName)  {}
@@ -340,8 +348,8 @@ func testDefaultsCM() *corev1.ConfigMap {
 
 type notResolvedYetResolver struct{}
 
-func (r *notResolvedYetResolver) Resolve(_ *zap.SugaredLogger, _ *v1.Revision, _ k8schain.Options, _ sets.Set[string], _ time.Duration) ([]v1.ContainerStatus, []v1.ContainerStatus, error) {
-	return nil, nil, nil
+func (r *notResolvedYetResolver) Resolve(_ *zap.SugaredLogger, _ *v1.Revision, _ resolveOptions) ([]v1.ContainerStatus, []v1.ContainerStatus, map[string]map[string]string, error) {
+	return nil, nil, nil, nil
 }
 
 func (r *notResolvedYetResolver) Clear(types.NamespacedName)  {}
@@ -352,8 +360,8 @@ type errorResolver struct {
 	cleared bool
 }
 
-func (r *errorResolver) Resolve(_ *zap.SugaredLogger, _ *v1.Revision, _ k8schain.Options, _ sets.Set[string], _ time.Duration) ([]v1.ContainerStatus, []v1.ContainerStatus, error) {
-	return nil, nil, r.err
+func (r *errorResolver) Resolve(_ *zap.SugaredLogger, _ *v1.Revision, _ resolveOptions) ([]v1.ContainerStatus, []v1.ContainerStatus, map[string]map[string]string, error) {
+	return nil, nil, nil, r.err
 }
 
 func (r *errorResolver) Clear(types.NamespacedName) {
@@ -399,6 +407,580 @@ func TestResolutionFailed(t *testing.T) {
 	}
 }
 
+func TestResolutionFailureReasons(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		reason string
+	}{{
+		name:   "timeout",
+		err:    fmt.Errorf("failed to resolve image to digest: %w", context.DeadlineExceeded),
+		reason: "ImageResolutionTimeout",
+	}, {
+		name:   "unauthorized",
+		err:    fmt.Errorf("failed to resolve image to digest: %w", &transport.Error{StatusCode: http.StatusUnauthorized}),
+		reason: "ImageUnauthorized",
+	}, {
+		name:   "not found",
+		err:    fmt.Errorf("failed to resolve image to digest: %w", &transport.Error{StatusCode: http.StatusNotFound}),
+		reason: "ImageNotFound",
+	}, {
+		name:   "other error",
+		err:    errors.New("connection refused"),
+		reason: "ContainerMissing",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := &errorResolver{err: tc.err}
+			ctx, _, _, controller, _ := newTestController(t, nil /*additional CMs*/, func(r *Reconciler) {
+				r.resolver = resolver
+			})
+
+			rev := testRevision(testPodSpec())
+			createRevision(t, ctx, controller, rev)
+
+			rev, err := fakeservingclient.Get(ctx).ServingV1().Revisions(testNamespace).Get(ctx, rev.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal("Couldn't get revision:", err)
+			}
+
+			got := rev.Status.GetCondition("ContainerHealthy")
+			want := &apis.Condition{
+				Type:               "ContainerHealthy",
+				Status:             corev1.ConditionFalse,
+				Reason:             tc.reason,
+				Message:            tc.err.Error(),
+				LastTransitionTime: got.LastTransitionTime,
+				Severity:           apis.ConditionSeverityError,
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Unexpected revision conditions diff (-want +got):\n%s", diff)
+			}
+
+			// Each of the failures may be transient, so the resolution is retried.
+			if !resolver.cleared {
+				t.Error("resolver.Clear() was not called, wanted a retry")
+			}
+		})
+	}
+}
+
+func TestResolutionFailedTemporarilyUnroutable(t *testing.T) {
+	for _, unroutable := range []bool{false, true} {
+		t.Run(fmt.Sprint("unroutable=", unroutable), func(t *testing.T) {
+			deploymentCM := testDeploymentCM()
+			deploymentCM.Data["digest-resolution-failure-unroutable"] = strconv.FormatBool(unroutable)
+			innerError := errors.New("registry unavailable")
+			var reconciler *Reconciler
+			ctx, _, _, controller, _ := newTestController(t, []*corev1.ConfigMap{deploymentCM}, func(r *Reconciler) {
+				r.resolver = &errorResolver{err: innerError}
+				reconciler = r
+			})
+
+			rev := testRevision(testPodSpec())
+			createRevision(t, ctx, controller, rev)
+
+			rev, err := fakeservingclient.Get(ctx).ServingV1().Revisions(testNamespace).Get(ctx, rev.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal("Couldn't get revision:", err)
+			}
+
+			if got := rev.Status.IsTemporarilyUnroutable(); got != unroutable {
+				t.Errorf("IsTemporarilyUnroutable() = %v, want %v", got, unroutable)
+			}
+			if !unroutable {
+				return
+			}
+			got := rev.Status.GetCondition(v1.RevisionConditionTemporarilyUnroutable)
+			want := &apis.Condition{
+				Type:               v1.RevisionConditionTemporarilyUnroutable,
+				Status:             corev1.ConditionTrue,
+				Reason:             v1.ReasonDigestResolutionFailed,
+				Message:            innerError.Error(),
+				LastTransitionTime: got.LastTransitionTime,
+				Severity:           apis.ConditionSeverityInfo,
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Unexpected TemporarilyUnroutable condition diff (-want +got):\n%s", diff)
+			}
+
+			// The condition is removed once the digests are resolved.
+			reconciler.resolver = &nopResolver{}
+			updateRevision(t, ctx, controller, rev)
+			rev, err = fakeservingclient.Get(ctx).ServingV1().Revisions(testNamespace).Get(ctx, rev.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal("Couldn't get revision:", err)
+			}
+			if got := rev.Status.GetCondition(v1.RevisionConditionTemporarilyUnroutable); got != nil {
+				t.Errorf("GetCondition(TemporarilyUnroutable) = %v, want nil", got)
+			}
+		})
+	}
+}
+
+type digestResolvedResolver struct {
+	digest string
+}
+
+func (r *digestResolvedResolver) Resolve(_ *zap.SugaredLogger, rev *v1.Revision, _ resolveOptions) ([]v1.ContainerStatus, []v1.ContainerStatus, map[string]map[string]string, error) {
+	return nil, []v1.ContainerStatus{{
+		Name:        rev.Spec.Containers[0].Name,
+		ImageDigest: r.digest,
+	}}, nil, nil
+}
+
+func (r *digestResolvedResolver) Clear(types.NamespacedName)  {}
+func (r *digestResolvedResolver) Forget(types.NamespacedName) {}
+
+// pullSecretResolver resolves the images only with the given image pull
+// secret, like a private registry.
+type pullSecretResolver struct {
+	secret string
+	digest string
+}
+
+func (r *pullSecretResolver) Resolve(_ *zap.SugaredLogger, rev *v1.Revision, opts resolveOptions) ([]v1.ContainerStatus, []v1.ContainerStatus, map[string]map[string]string, error) {
+	if !slices.Contains(opts.opt.ImagePullSecrets, r.secret) {
+		return nil, nil, nil, errors.New("UNAUTHORIZED: authentication required")
+	}
+	return nil, []v1.ContainerStatus{{
+		Name:        rev.Spec.Containers[0].Name,
+		ImageDigest: r.digest,
+	}}, nil, nil
+}
+
+func (r *pullSecretResolver) Clear(types.NamespacedName)  {}
+func (r *pullSecretResolver) Forget(types.NamespacedName) {}
+
+func TestResolveWithCentralImagePullSecrets(t *testing.T) {
+	const digest = "private.registry/repo/image@sha256:deadbeef"
+
+	deploymentCM := testDeploymentCM()
+	deploymentCM.Data["image-pull-secrets"] = "central-secret"
+	ctx, _, _, controller, _ := newTestController(t, []*corev1.ConfigMap{deploymentCM}, func(r *Reconciler) {
+		r.resolver = &pullSecretResolver{secret: "central-secret", digest: digest}
+	})
+
+	rev := testRevision(testPodSpec())
+	createRevision(t, ctx, controller, rev)
+
+	rev, err := fakeservingclient.Get(ctx).ServingV1().Revisions(testNamespace).Get(ctx, rev.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("Couldn't get revision:", err)
+	}
+	if len(rev.Status.ContainerStatuses) != 1 || rev.Status.ContainerStatuses[0].ImageDigest != digest {
+		t.Errorf("ContainerStatuses = %v, wanted the image resolved to %s", rev.Status.ContainerStatuses, digest)
+	}
+}
+
+// digestResolutionEvents returns the digest resolution events recorded so far.
+func digestResolutionEvents(ctx context.Context) []string {
+	recorder := controller.GetEventRecorder(ctx).(*record.FakeRecorder)
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			if strings.Contains(event, " Digest") {
+				events = append(events, event)
+			}
+		default:
+			return events
+		}
+	}
+}
+
+func TestDigestResolutionEvents(t *testing.T) {
+	const digest = "gcr.io/repo/image@sha256:deadbeef"
+
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprint("enabled=", enabled), func(t *testing.T) {
+			deploymentCM := testDeploymentCM()
+			deploymentCM.Data["digest-resolution-events"] = strconv.FormatBool(enabled)
+			var reconciler *Reconciler
+			ctx, _, _, controller, _ := newTestController(t, []*corev1.ConfigMap{deploymentCM}, func(r *Reconciler) {
+				r.resolver = &notResolvedYetResolver{}
+				reconciler = r
+			})
+
+			rev := testRevision(testPodSpec())
+			fakeservingclient.Get(ctx).ServingV1().Revisions(rev.Namespace).Create(ctx, rev, metav1.CreateOptions{})
+			reconcile := func() {
+				t.Helper()
+				rev, err := fakeservingclient.Get(ctx).ServingV1().Revisions(rev.Namespace).Get(ctx, rev.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal("Couldn't get revision:", err)
+				}
+				fakerevisioninformer.Get(ctx).Informer().GetIndexer().Add(rev)
+				// The owned resources are not in the informers, so reconciling
+				// them fails once the digests are resolved.
+				controller.Reconciler.Reconcile(ctx, KeyOrDie(rev))
+			}
+
+			// The resolution starts once, even though the revision is
+			// reconciled again while it is in flight.
+			reconcile()
+			reconcile()
+
+			var want []string
+			if enabled {
+				want = []string{"Normal DigestResolutionStarted Started resolving the image tags to digests"}
+			}
+			if diff := cmp.Diff(want, digestResolutionEvents(ctx)); diff != "" {
+				t.Errorf("Unexpected events while resolving (-want +got):\n%s", diff)
+			}
+
+			reconciler.resolver = &digestResolvedResolver{digest: digest}
+			reconcile()
+
+			want = nil
+			if enabled {
+				want = []string{`Normal DigestResolved Resolved the image of container "user-container" to ` + digest}
+			}
+			if diff := cmp.Diff(want, digestResolutionEvents(ctx)); diff != "" {
+				t.Errorf("Unexpected events once resolved (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDigestResolutionFailedEvent(t *testing.T) {
+	deploymentCM := testDeploymentCM()
+	deploymentCM.Data["digest-resolution-events"] = "true"
+	innerError := errors.New("registry unavailable")
+	ctx, _, _, controller, _ := newTestController(t, []*corev1.ConfigMap{deploymentCM}, func(r *Reconciler) {
+		r.resolver = &errorResolver{err: innerError}
+	})
+
+	createRevision(t, ctx, controller, testRevision(testPodSpec()))
+
+	want := []string{"Warning DigestResolutionFailed ContainerMissing: registry unavailable"}
+	if diff := cmp.Diff(want, digestResolutionEvents(ctx)); diff != "" {
+		t.Errorf("Unexpected events (-want +got):\n%s", diff)
+	}
+}
+
+func TestRequiredImageLabelMissing(t *testing.T) {
+	labelErr := &missingImageLabelError{image: "busybox", label: "approved", want: "true"}
+	resolver := &errorResolver{cleared: false, err: labelErr}
+	ctx, _, _, controller, _ := newTestController(t, nil /*additional CMs*/, func(r *Reconciler) {
+		r.resolver = resolver
+	})
+
+	rev := testRevision(testPodSpec())
+	createRevision(t, ctx, controller, rev)
+
+	rev, err := fakeservingclient.Get(ctx).ServingV1().Revisions(testNamespace).Get(ctx, rev.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("Couldn't get revision:", err)
+	}
+
+	// The revision fails, rather than being deployed.
+	for _, ct := range []apis.ConditionType{"ContainerHealthy", "Ready"} {
+		got := rev.Status.GetCondition(ct)
+		want := &apis.Condition{
+			Type:               ct,
+			Status:             corev1.ConditionFalse,
+			Reason:             "RequiredImageLabelMissing",
+			Message:            labelErr.Error(),
+			LastTransitionTime: got.LastTransitionTime,
+			Severity:           apis.ConditionSeverityError,
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Unexpected revision conditions diff (-want +got):\n%s", diff)
+		}
+	}
+
+	if resolver.cleared {
+		t.Error("resolver.Clear() was called, wanted the result to be kept")
+	}
+	if _, err := fakekubeclient.Get(ctx).AppsV1().Deployments(testNamespace).Get(ctx, names.Deployment(rev), metav1.GetOptions{}); !apierrs.IsNotFound(err) {
+		t.Errorf("Deployment Get() = %v, wanted not found", err)
+	}
+}
+
+func TestDeniedImageLabel(t *testing.T) {
+	labelErr := &deniedImageLabelError{image: "busybox", label: "base-deprecated", value: "true"}
+	resolver := &errorResolver{cleared: false, err: labelErr}
+	ctx, _, _, controller, _ := newTestController(t, nil /*additional CMs*/, func(r *Reconciler) {
+		r.resolver = resolver
+	})
+
+	rev := testRevision(testPodSpec())
+	createRevision(t, ctx, controller, rev)
+
+	rev, err := fakeservingclient.Get(ctx).ServingV1().Revisions(testNamespace).Get(ctx, rev.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("Couldn't get revision:", err)
+	}
+
+	// The revision fails, rather than being deployed.
+	for _, ct := range []apis.ConditionType{"ContainerHealthy", "Ready"} {
+		got := rev.Status.GetCondition(ct)
+		want := &apis.Condition{
+			Type:               ct,
+			Status:             corev1.ConditionFalse,
+			Reason:             "DeniedImageLabel",
+			Message:            labelErr.Error(),
+			LastTransitionTime: got.LastTransitionTime,
+			Severity:           apis.ConditionSeverityError,
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Unexpected revision conditions diff (-want +got):\n%s", diff)
+		}
+	}
+
+	if resolver.cleared {
+		t.Error("resolver.Clear() was called, wanted the result to be kept")
+	}
+	if _, err := fakekubeclient.Get(ctx).AppsV1().Deployments(testNamespace).Get(ctx, names.Deployment(rev), metav1.GetOptions{}); !apierrs.IsNotFound(err) {
+		t.Errorf("Deployment Get() = %v, wanted not found", err)
+	}
+}
+
+func TestImageLayerMissing(t *testing.T) {
+	layerErr := &missingImageLayerError{image: "busybox", layer: "sha256:deadbeef"}
+	resolver := &errorResolver{cleared: false, err: layerErr}
+	ctx, _, _, controller, _ := newTestController(t, nil /*additional CMs*/, func(r *Reconciler) {
+		r.resolver = resolver
+	})
+
+	rev := testRevision(testPodSpec())
+	createRevision(t, ctx, controller, rev)
+
+	rev, err := fakeservingclient.Get(ctx).ServingV1().Revisions(testNamespace).Get(ctx, rev.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("Couldn't get revision:", err)
+	}
+
+	// The revision fails early, rather than its pods failing to pull the image.
+	for _, ct := range []apis.ConditionType{"ContainerHealthy", "Ready"} {
+		got := rev.Status.GetCondition(ct)
+		want := &apis.Condition{
+			Type:               ct,
+			Status:             corev1.ConditionFalse,
+			Reason:             "ImageLayerMissing",
+			Message:            layerErr.Error(),
+			LastTransitionTime: got.LastTransitionTime,
+			Severity:           apis.ConditionSeverityError,
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Unexpected revision conditions diff (-want +got):\n%s", diff)
+		}
+	}
+
+	// The layer may still be pushed, so the resolution is retried.
+	if !resolver.cleared {
+		t.Error("resolver.Clear() was not called, wanted a retry")
+	}
+}
+
+func TestImagePullSecretsUnavailable(t *testing.T) {
+	secretsErr := &imagePullSecretsError{namespace: testNamespace, serviceAccount: "default", err: errors.New("forbidden")}
+	resolver := &errorResolver{cleared: false, err: secretsErr}
+	ctx, _, _, controller, _ := newTestController(t, nil /*additional CMs*/, func(r *Reconciler) {
+		r.resolver = resolver
+	})
+
+	rev := testRevision(testPodSpec())
+	createRevision(t, ctx, controller, rev)
+
+	rev, err := fakeservingclient.Get(ctx).ServingV1().Revisions(testNamespace).Get(ctx, rev.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("Couldn't get revision:", err)
+	}
+
+	for _, ct := range []apis.ConditionType{"ContainerHealthy", "Ready"} {
+		got := rev.Status.GetCondition(ct)
+		want := &apis.Condition{
+			Type:               ct,
+			Status:             corev1.ConditionFalse,
+			Reason:             "ImagePullSecretsUnavailable",
+			Message:            secretsErr.Error(),
+			LastTransitionTime: got.LastTransitionTime,
+			Severity:           apis.ConditionSeverityError,
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Unexpected revision conditions diff (-want +got):\n%s", diff)
+		}
+	}
+
+	// The secrets may still be created, so the resolution is retried.
+	if !resolver.cleared {
+		t.Error("resolver.Clear() was not called, wanted a retry")
+	}
+}
+
+func TestProgressDeadlineAdvisory(t *testing.T) {
+	tests := []struct {
+		name         string
+		startupProbe *corev1.Probe
+		annotations  map[string]string
+		want         bool
+	}{{
+		name: "no startup probe",
+	}, {
+		name: "fast startup",
+		startupProbe: &corev1.Probe{
+			PeriodSeconds:    5,
+			FailureThreshold: 12,
+		},
+	}, {
+		name: "slow startup",
+		startupProbe: &corev1.Probe{
+			InitialDelaySeconds: 60,
+			PeriodSeconds:       10,
+			FailureThreshold:    60,
+		},
+		want: true,
+	}, {
+		name: "slow startup with default period",
+		startupProbe: &corev1.Probe{
+			FailureThreshold: 61,
+		},
+		want: true,
+	}, {
+		name: "slow startup with progress deadline annotation",
+		startupProbe: &corev1.Probe{
+			InitialDelaySeconds: 60,
+			PeriodSeconds:       10,
+			FailureThreshold:    60,
+		},
+		annotations: map[string]string{
+			serving.ProgressDeadlineAnnotationKey: "15m",
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			deploymentCM := testDeploymentCM()
+			deploymentCM.Data["progress-deadline-advisory"] = "true"
+			ctx, _, _, controller, _ := newTestController(t, []*corev1.ConfigMap{deploymentCM})
+
+			podSpec := testPodSpec()
+			podSpec.Containers[0].StartupProbe = tc.startupProbe
+			rev := testRevision(podSpec)
+			for k, v := range tc.annotations {
+				rev.Annotations[k] = v
+			}
+			createRevision(t, ctx, controller, rev)
+
+			rev, err := fakeservingclient.Get(ctx).ServingV1().Revisions(testNamespace).Get(ctx, rev.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal("Couldn't get revision:", err)
+			}
+
+			got := rev.Status.GetCondition(v1.RevisionConditionProgressDeadlineTooShort)
+			if !tc.want {
+				if got != nil {
+					t.Errorf("GetCondition(ProgressDeadlineTooShort) = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("GetCondition(ProgressDeadlineTooShort) = nil, want a condition")
+			}
+			want := &apis.Condition{
+				Type:               v1.RevisionConditionProgressDeadlineTooShort,
+				Status:             corev1.ConditionTrue,
+				Reason:             v1.ReasonSlowStartup,
+				Message:            got.Message,
+				LastTransitionTime: got.LastTransitionTime,
+				Severity:           apis.ConditionSeverityInfo,
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Unexpected ProgressDeadlineTooShort condition diff (-want +got):\n%s", diff)
+			}
+			if !strings.Contains(got.Message, serving.ProgressDeadlineAnnotationKey) {
+				t.Errorf("Message = %q, want a suggestion of the %s annotation", got.Message, serving.ProgressDeadlineAnnotationKey)
+			}
+			// The advisory doesn't block the revision.
+			if cond := rev.Status.GetCondition(v1.RevisionConditionReady); cond.IsFalse() {
+				t.Errorf("Ready = %v, want not False", cond)
+			}
+		})
+	}
+}
+
+func TestProgressDeadlineAdvisoryDisabled(t *testing.T) {
+	ctx, _, _, controller, _ := newTestController(t, nil /*additional CMs*/)
+
+	podSpec := testPodSpec()
+	podSpec.Containers[0].StartupProbe = &corev1.Probe{
+		InitialDelaySeconds: 60,
+		PeriodSeconds:       10,
+		FailureThreshold:    60,
+	}
+	rev := testRevision(podSpec)
+	createRevision(t, ctx, controller, rev)
+
+	rev, err := fakeservingclient.Get(ctx).ServingV1().Revisions(testNamespace).Get(ctx, rev.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("Couldn't get revision:", err)
+	}
+	if got := rev.Status.GetCondition(v1.RevisionConditionProgressDeadlineTooShort); got != nil {
+		t.Errorf("GetCondition(ProgressDeadlineTooShort) = %v, want nil", got)
+	}
+}
+
+func TestProgressDeadlineAnnotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotation  string
+		wantSeconds int32
+		wantIgnored bool
+	}{{
+		name:        "override applied",
+		annotation:  "900s",
+		wantSeconds: 900,
+	}, {
+		name:        "over the maximum",
+		annotation:  "20m",
+		wantSeconds: 600,
+		wantIgnored: true,
+	}, {
+		name:        "invalid",
+		annotation:  "soon",
+		wantSeconds: 600,
+		wantIgnored: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			deploymentCM := testDeploymentCM()
+			deploymentCM.Data["progress-deadline-max"] = "15m"
+			ctx, _, _, controller, _ := newTestController(t, []*corev1.ConfigMap{deploymentCM})
+
+			rev := testRevision(testPodSpec())
+			rev.Annotations[serving.ProgressDeadlineAnnotationKey] = tc.annotation
+			createRevision(t, ctx, controller, rev)
+
+			deployment, err := fakekubeclient.Get(ctx).AppsV1().Deployments(testNamespace).Get(ctx, names.Deployment(rev), metav1.GetOptions{})
+			if err != nil {
+				t.Fatal("Couldn't get deployment:", err)
+			}
+			if got := *deployment.Spec.ProgressDeadlineSeconds; got != tc.wantSeconds {
+				t.Errorf("ProgressDeadlineSeconds = %d, want: %d", got, tc.wantSeconds)
+			}
+
+			rev, err = fakeservingclient.Get(ctx).ServingV1().Revisions(testNamespace).Get(ctx, rev.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal("Couldn't get revision:", err)
+			}
+			got := rev.Status.GetCondition(v1.RevisionConditionProgressDeadlineIgnored)
+			if !tc.wantIgnored {
+				if got != nil {
+					t.Errorf("GetCondition(ProgressDeadlineIgnored) = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil || !got.IsTrue() || got.Reason != v1.ReasonInvalidProgressDeadline {
+				t.Errorf("GetCondition(ProgressDeadlineIgnored) = %v, want True with reason %s", got, v1.ReasonInvalidProgressDeadline)
+			}
+		})
+	}
+}
+
 func TestUpdateRevWithWithUpdatedLoggingURL(t *testing.T) {
 	ctx, _, _, controller, watcher := newTestController(t, []*corev1.ConfigMap{{
 		ObjectMeta: metav1.ObjectMeta{
@@ -731,3 +1313,28 @@ func TestNewRevisionCallsSyncHandler(t *testing.T) {
 		t.Error("Failed to see deployment creation:", err)
 	}
 }
+
+func TestDigestResolutionWorkers(t *testing.T) {
+	ctx, _, _ := SetupFakeContextWithCancel(t)
+
+	if got, want := digestResolutionWorkersFromConfig(ctx), deployment.DigestResolutionWorkersDefault; got != want {
+		t.Errorf("digestResolutionWorkersFromConfig() without config map = %d, want %d", got, want)
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: system.Namespace(),
+			Name:      deployment.ConfigName,
+		},
+		Data: map[string]string{
+			deployment.QueueSidecarImageKey: "gcr.io/queue-proxy",
+			"digest-resolution-workers":     "500",
+		},
+	}
+	if _, err := fakekubeclient.Get(ctx).CoreV1().ConfigMaps(system.Namespace()).Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+		t.Fatal("Failed to create config map:", err)
+	}
+	if got, want := digestResolutionWorkersFromConfig(ctx), 500; got != want {
+		t.Errorf("digestResolutionWorkersFromConfig() = %d, want %d", got, want)
+	}
+}
@@ -23,6 +23,7 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgotesting "k8s.io/client-go/testing"
@@ -37,10 +38,12 @@ import (
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/metrics"
+	"knative.dev/pkg/ptr"
 	pkgreconciler "knative.dev/pkg/reconciler"
 	tracingconfig "knative.dev/pkg/tracing/config"
 	autoscalingv1alpha1 "knative.dev/serving/pkg/apis/autoscaling/v1alpha1"
 	defaultconfig "knative.dev/serving/pkg/apis/config"
+	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	"knative.dev/serving/pkg/autoscaler/config/autoscalerconfig"
 	servingclient "knative.dev/serving/pkg/client/injection/client"
@@ -178,6 +181,26 @@ func TestReconcile(t *testing.T) {
 				`failed to create deployment "create-user-deploy-failure-deployment": inducing failure for create deployments`),
 		},
 		Key: "foo/create-user-deploy-failure",
+	}, {
+		Name: "port collision creating user deployment",
+		// Test that a user port colliding with a queue-proxy port fails the
+		// revision rather than creating a deployment whose pods won't start.
+		WantErr: true,
+		Objects: []runtime.Object{
+			Revision("foo", "port-collision", withUserPort(8112)),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "port-collision", withUserPort(8112),
+				WithLogURL, WithInitRevConditions, MarkDeploying("Deploying"),
+				MarkResourcesUnavailable(v1.ReasonPortCollision,
+					`port 8112/TCP is exposed by both container "port-collision" and container "queue-proxy"`),
+				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeWarning, "InternalError",
+				`failed to make deployment: failed to create PodSpec: port 8112/TCP is exposed by both container "port-collision" and container "queue-proxy"`),
+		},
+		Key: "foo/port-collision",
 	}, {
 		Name: "stable revision reconciliation",
 		// Test a simple stable reconciliation of an Active Revision.
@@ -209,6 +232,86 @@ func TestReconcile(t *testing.T) {
 			Object: deploy(t, "foo", "fix-containers"),
 		}},
 		Key: "foo/fix-containers",
+	}, {
+		Name: "paused revision does not fix deployment",
+		// Test that we leave a deployment which disagrees with our desired
+		// spec alone while the reconciliation is paused.
+		Objects: []runtime.Object{
+			Revision("foo", "paused",
+				WithLogURL, allUnknownConditions, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1),
+				WithRevisionAnn(serving.RevisionReconcilePausedAnnotationKey, "true")),
+			pa("foo", "paused", WithReachabilityUnknown),
+			changeContainers(deploy(t, "foo", "paused")),
+			image("foo", "paused"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "paused",
+				WithLogURL, allUnknownConditions, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1),
+				WithRevisionAnn(serving.RevisionReconcilePausedAnnotationKey, "true"),
+				MarkReconcilePaused),
+		}},
+		Key: "foo/paused",
+	}, {
+		Name: "resumed revision fixes deployment",
+		// Test that we update the deployment again once the reconciliation
+		// is resumed.
+		Objects: []runtime.Object{
+			Revision("foo", "resumed",
+				WithLogURL, allUnknownConditions, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1),
+				MarkReconcilePaused),
+			pa("foo", "resumed", WithReachabilityUnknown),
+			changeContainers(deploy(t, "foo", "resumed")),
+			image("foo", "resumed"),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: deploy(t, "foo", "resumed"),
+		}},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "resumed",
+				WithLogURL, allUnknownConditions, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/resumed",
+	}, {
+		Name: "first revision reconciliation with paused deployment",
+		// Test that the deployment is created paused and the revision's
+		// resources aren't considered available.
+		Objects: []runtime.Object{
+			Revision("foo", "first-reconcile-paused",
+				WithRevisionAnn(serving.DeploymentPausedAnnotationKey, "true")),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "first-reconcile-paused"),
+			deploy(t, "foo", "first-reconcile-paused",
+				WithRevisionAnn(serving.DeploymentPausedAnnotationKey, "true")),
+			image("foo", "first-reconcile-paused"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "first-reconcile-paused",
+				WithRevisionAnn(serving.DeploymentPausedAnnotationKey, "true"),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), MarkDeploymentPaused,
+				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/first-reconcile-paused",
+	}, {
+		Name: "unpaused revision resumes deployment",
+		// Test that the deployment is resumed once the annotation is cleared.
+		Objects: []runtime.Object{
+			Revision("foo", "unpaused",
+				WithLogURL, allUnknownConditions, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1),
+				MarkDeploymentPaused),
+			pa("foo", "unpaused", WithReachabilityUnknown),
+			deploy(t, "foo", "unpaused",
+				WithRevisionAnn(serving.DeploymentPausedAnnotationKey, "true")),
+			image("foo", "unpaused"),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: deploy(t, "foo", "unpaused"),
+		}},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "unpaused",
+				WithLogURL, allUnknownConditions, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/unpaused",
 	}, {
 		Name: "failure updating deployment",
 		// Test that we handle an error updating the deployment properly.
@@ -766,6 +869,320 @@ func TestReconcile(t *testing.T) {
 	}))
 }
 
+func TestReconcileQueueLimitRanges(t *testing.T) {
+	table := TableTest{{
+		Name: "queue-proxy resources violate a limit range",
+		// Test that queue-proxy resources violating a LimitRange of the
+		// namespace fail the revision rather than creating a deployment whose
+		// pods won't be admitted.
+		WantErr: true,
+		Objects: []runtime.Object{
+			Revision("foo", "limit-range-violation"),
+			limitRange("foo", corev1.LimitRangeItem{
+				Type: corev1.LimitTypeContainer,
+				Min:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+			}),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "limit-range-violation",
+				WithLogURL, WithInitRevConditions, MarkDeploying("Deploying"),
+				MarkResourcesUnavailable(v1.ReasonLimitRangeViolation,
+					`queue-proxy cpu request 25m is below the minimum 50m of LimitRange "limits"`),
+				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeWarning, "InternalError",
+				`failed to create deployment "limit-range-violation-deployment": failed to make deployment: queue-proxy cpu request 25m is below the minimum 50m of LimitRange "limits"`),
+		},
+		Key: "foo/limit-range-violation",
+	}, {
+		Name: "queue-proxy resources satisfy the limit ranges",
+		Objects: []runtime.Object{
+			Revision("foo", "limit-range-satisfied"),
+			limitRange("foo", corev1.LimitRangeItem{
+				Type: corev1.LimitTypeContainer,
+				Min:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")},
+				Max:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			}),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "limit-range-satisfied"),
+			deploy(t, "foo", "limit-range-satisfied"),
+			image("foo", "limit-range-satisfied"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "limit-range-satisfied",
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"),
+				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/limit-range-satisfied",
+	}}
+
+	cfg := reconcilerTestConfig()
+	dc := *cfg.Deployment
+	dc.QueueSidecarCheckLimitRanges = true
+	cfg.Deployment = &dc
+
+	table.Test(t, MakeFactory(func(ctx context.Context, listers *Listers, _ configmap.Watcher) controller.Reconciler {
+		r := &Reconciler{
+			kubeclient:    kubeclient.Get(ctx),
+			client:        servingclient.Get(ctx),
+			cachingclient: cachingclient.Get(ctx),
+
+			podAutoscalerLister: listers.GetPodAutoscalerLister(),
+			imageLister:         listers.GetImageLister(),
+			deploymentLister:    listers.GetDeploymentLister(),
+			limitRangeLister:    listers.GetLimitRangeLister(),
+			resolver:            &nopResolver{},
+		}
+
+		return revisionreconciler.NewReconciler(ctx, logging.FromContext(ctx), servingclient.Get(ctx),
+			listers.GetRevisionLister(), controller.GetEventRecorder(ctx), r,
+			controller.Options{
+				ConfigStore: &testConfigStore{config: cfg},
+			})
+	}))
+}
+
+func TestReconcileServiceAccountImagePullSecrets(t *testing.T) {
+	withCentralSecret := configOption(func(cfg *config.Config) {
+		dc := *cfg.Deployment
+		dc.ImagePullSecrets = []string{"central-secret"}
+		cfg.Deployment = &dc
+	})
+
+	table := TableTest{{
+		Name: "image pull secrets of the service account are merged",
+		// Test that the image pull secrets of the service account are kept
+		// along with the ones configured centrally.
+		Objects: []runtime.Object{
+			Revision("foo", "sa-secrets"),
+			serviceAccount("foo", "default", "sa-secret"),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "sa-secrets"),
+			appendImagePullSecrets(deploy(t, "foo", "sa-secrets", withCentralSecret), "sa-secret"),
+			image("foo", "sa-secrets"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "sa-secrets",
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"),
+				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/sa-secrets",
+	}, {
+		Name: "missing service account",
+		// Test that only the central image pull secrets are used when the
+		// service account doesn't exist (yet).
+		Objects: []runtime.Object{
+			Revision("foo", "no-sa"),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "no-sa"),
+			deploy(t, "foo", "no-sa", withCentralSecret),
+			image("foo", "no-sa"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "no-sa",
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"),
+				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/no-sa",
+	}}
+
+	cfg := reconcilerTestConfig()
+	withCentralSecret(cfg)
+
+	table.Test(t, MakeFactory(func(ctx context.Context, listers *Listers, _ configmap.Watcher) controller.Reconciler {
+		r := &Reconciler{
+			kubeclient:    kubeclient.Get(ctx),
+			client:        servingclient.Get(ctx),
+			cachingclient: cachingclient.Get(ctx),
+
+			podAutoscalerLister:  listers.GetPodAutoscalerLister(),
+			imageLister:          listers.GetImageLister(),
+			deploymentLister:     listers.GetDeploymentLister(),
+			serviceAccountLister: listers.GetServiceAccountLister(),
+			resolver:             &nopResolver{},
+		}
+
+		return revisionreconciler.NewReconciler(ctx, logging.FromContext(ctx), servingclient.Get(ctx),
+			listers.GetRevisionLister(), controller.GetEventRecorder(ctx), r,
+			controller.Options{
+				ConfigStore: &testConfigStore{config: cfg},
+			})
+	}))
+}
+
+func TestReconcileDeploymentLabels(t *testing.T) {
+	withTeamLabel := configOption(func(cfg *config.Config) {
+		dc := *cfg.Deployment
+		dc.DeploymentLabels = map[string]string{"example.com/team": "{label:team}"}
+		cfg.Deployment = &dc
+	})
+
+	table := TableTest{{
+		Name: "deployment labels from the namespace labels",
+		// Test that the templates of the deployment labels are resolved
+		// against the labels of the namespace of the revision.
+		Objects: []runtime.Object{
+			Revision("foo", "team-labels"),
+			namespace("foo", map[string]string{"team": "payments"}),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "team-labels"),
+			deploy(t, "foo", "team-labels", withTeamLabel, namespaceLabels{"team": "payments"}),
+			image("foo", "team-labels"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "team-labels",
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"),
+				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/team-labels",
+	}, {
+		Name: "invalid deployment label",
+		// Test that a deployment label which isn't a valid label value after
+		// the substitution fails the deployment rather than being dropped.
+		WantErr: true,
+		Objects: []runtime.Object{
+			Revision("foo", "invalid-labels"),
+			namespace("foo", map[string]string{"team": "payments team"}),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "invalid-labels",
+				WithLogURL, WithInitRevConditions, MarkDeploying("Deploying"),
+				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeWarning, "InternalError",
+				`failed to create deployment "invalid-labels-deployment": failed to make deployment: `+
+					`deployment-labels "example.com/team" is not a valid label value in namespace "foo", was "payments team": `+
+					`a valid label must be an empty string or consist of alphanumeric characters, '-', '_' or '.', `+
+					`and must start and end with an alphanumeric character `+
+					`(e.g. 'MyValue',  or 'my_value',  or '12345', regex used for validation is '(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?')`),
+		},
+		Key: "foo/invalid-labels",
+	}}
+
+	cfg := reconcilerTestConfig()
+	withTeamLabel(cfg)
+
+	table.Test(t, MakeFactory(func(ctx context.Context, listers *Listers, _ configmap.Watcher) controller.Reconciler {
+		r := &Reconciler{
+			kubeclient:    kubeclient.Get(ctx),
+			client:        servingclient.Get(ctx),
+			cachingclient: cachingclient.Get(ctx),
+
+			podAutoscalerLister: listers.GetPodAutoscalerLister(),
+			imageLister:         listers.GetImageLister(),
+			deploymentLister:    listers.GetDeploymentLister(),
+			namespaceLister:     listers.GetNamespaceLister(),
+			resolver:            &nopResolver{},
+		}
+
+		return revisionreconciler.NewReconciler(ctx, logging.FromContext(ctx), servingclient.Get(ctx),
+			listers.GetRevisionLister(), controller.GetEventRecorder(ctx), r,
+			controller.Options{
+				ConfigStore: &testConfigStore{config: cfg},
+			})
+	}))
+}
+
+func TestReconcileAdoptExistingDeployments(t *testing.T) {
+	table := TableTest{{
+		Name: "adopt an unowned deployment",
+		// Test that a deployment without an owner, e.g. created by hand, is
+		// adopted and then reconciled like one created by the revision.
+		Objects: []runtime.Object{
+			Revision("foo", "adopt", WithLogURL, allUnknownConditions,
+				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+			pa("foo", "adopt", WithReachabilityUnknown),
+			noOwner(deploy(t, "foo", "adopt")),
+			image("foo", "adopt"),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: deploy(t, "foo", "adopt"),
+		}},
+		Key: "foo/adopt",
+	}, {
+		Name:    "refuse to adopt a deployment controlled by something else",
+		WantErr: true,
+		Objects: []runtime.Object{
+			Revision("foo", "foreign", WithLogURL, MarkRevisionReady),
+			pa("foo", "foreign", WithTraffic),
+			foreignOwner(deploy(t, "foo", "foreign")),
+			image("foo", "foreign"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "foreign", WithLogURL, MarkRevisionReady,
+				MarkResourceNotOwned("Deployment", "foreign-deployment"), withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeWarning, "InternalError", `revision: "foreign" does not own Deployment: "foreign-deployment"`),
+		},
+		Key: "foo/foreign",
+	}}
+
+	cfg := reconcilerTestConfig()
+	dc := *cfg.Deployment
+	dc.AdoptExistingDeployments = true
+	cfg.Deployment = &dc
+
+	table.Test(t, MakeFactory(func(ctx context.Context, listers *Listers, _ configmap.Watcher) controller.Reconciler {
+		r := &Reconciler{
+			kubeclient:    kubeclient.Get(ctx),
+			client:        servingclient.Get(ctx),
+			cachingclient: cachingclient.Get(ctx),
+
+			podAutoscalerLister: listers.GetPodAutoscalerLister(),
+			imageLister:         listers.GetImageLister(),
+			deploymentLister:    listers.GetDeploymentLister(),
+			resolver:            &nopResolver{},
+		}
+
+		return revisionreconciler.NewReconciler(ctx, logging.FromContext(ctx), servingclient.Get(ctx),
+			listers.GetRevisionLister(), controller.GetEventRecorder(ctx), r,
+			controller.Options{
+				ConfigStore: &testConfigStore{config: cfg},
+			})
+	}))
+}
+
+func limitRange(namespace string, item corev1.LimitRangeItem) *corev1.LimitRange {
+	return &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      "limits",
+		},
+		Spec: corev1.LimitRangeSpec{
+			Limits: []corev1.LimitRangeItem{item},
+		},
+	}
+}
+
+func serviceAccount(namespace, name string, secretNames ...string) *corev1.ServiceAccount {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+	}
+	for _, secretName := range secretNames {
+		sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: secretName})
+	}
+	return sa
+}
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+}
+
 func readyDeploy(deploy *appsv1.Deployment) *appsv1.Deployment {
 	deploy.Status.Conditions = []appsv1.DeploymentCondition{{
 		Type:   appsv1.DeploymentProgressing,
@@ -799,6 +1216,17 @@ func noOwner(deploy *appsv1.Deployment) *appsv1.Deployment {
 	return deploy
 }
 
+func foreignOwner(deploy *appsv1.Deployment) *appsv1.Deployment {
+	deploy.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: "apps/v1",
+		Kind:       "ReplicaSet",
+		Name:       "someone-else",
+		UID:        "someone-else",
+		Controller: ptr.Bool(true),
+	}}
+	return deploy
+}
+
 func deployImagePullSecrets(deploy *appsv1.Deployment, secretName string) *appsv1.Deployment {
 	deploy.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{
 		Name: secretName,
@@ -806,6 +1234,13 @@ func deployImagePullSecrets(deploy *appsv1.Deployment, secretName string) *appsv
 	return deploy
 }
 
+func appendImagePullSecrets(deploy *appsv1.Deployment, secretName string) *appsv1.Deployment {
+	deploy.Spec.Template.Spec.ImagePullSecrets = append(deploy.Spec.Template.Spec.ImagePullSecrets, corev1.LocalObjectReference{
+		Name: secretName,
+	})
+	return deploy
+}
+
 func imagePullSecrets(Revision *caching.Image, secretName string) *caching.Image {
 	Revision.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{
 		Name: secretName,
@@ -821,6 +1256,12 @@ func changeContainers(deploy *appsv1.Deployment) *appsv1.Deployment {
 	return deploy
 }
 
+func withUserPort(port int32) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Spec.Containers[0].Ports = []corev1.ContainerPort{{ContainerPort: port}}
+	}
+}
+
 func withDefaultContainerStatuses() RevisionOption {
 	return func(r *v1.Revision) {
 		r.Status.ContainerStatuses = []v1.ContainerStatus{{
@@ -851,14 +1292,21 @@ func allUnknownConditions(r *v1.Revision) {
 
 type configOption func(*config.Config)
 
+// namespaceLabels are the labels of the namespace the deployment is made for.
+type namespaceLabels map[string]string
+
 func deploy(t *testing.T, namespace, name string, opts ...interface{}) *appsv1.Deployment {
 	t.Helper()
 	cfg := reconcilerTestConfig()
 
+	var nsLabels namespaceLabels
 	for _, opt := range opts {
 		if configOpt, ok := opt.(configOption); ok {
 			configOpt(cfg)
 		}
+		if labels, ok := opt.(namespaceLabels); ok {
+			nsLabels = labels
+		}
 	}
 
 	rev := Revision(namespace, name)
@@ -872,7 +1320,7 @@ func deploy(t *testing.T, namespace, name string, opts ...interface{}) *appsv1.D
 	// Do this here instead of in `rev` itself to ensure that we populate defaults
 	// before calling MakeDeployment within Reconcile.
 	rev.SetDefaults(context.Background())
-	deployment, err := resources.MakeDeployment(rev, cfg)
+	deployment, err := resources.MakeDeployment(rev, nsLabels, cfg)
 	if err != nil {
 		t.Fatal("failed to create deployment")
 	}
@@ -198,6 +198,16 @@ func (l *Listers) GetPodsLister() corev1listers.PodLister {
 	return corev1listers.NewPodLister(l.IndexerFor(&corev1.Pod{}))
 }
 
+// GetLimitRangeLister returns a lister for LimitRange objects.
+func (l *Listers) GetLimitRangeLister() corev1listers.LimitRangeLister {
+	return corev1listers.NewLimitRangeLister(l.IndexerFor(&corev1.LimitRange{}))
+}
+
+// GetServiceAccountLister returns a lister for ServiceAccount objects.
+func (l *Listers) GetServiceAccountLister() corev1listers.ServiceAccountLister {
+	return corev1listers.NewServiceAccountLister(l.IndexerFor(&corev1.ServiceAccount{}))
+}
+
 // GetNamespaceLister gets lister for Namespace resource.
 func (l *Listers) GetNamespaceLister() corev1listers.NamespaceLister {
 	return corev1listers.NewNamespaceLister(l.IndexerFor(&corev1.Namespace{}))
@@ -144,6 +144,16 @@ func MarkActivating(reason, message string) RevisionOption {
 	}
 }
 
+// MarkReconcilePaused calls .Status.MarkReconcilePaused on the Revision.
+func MarkReconcilePaused(r *v1.Revision) {
+	r.Status.MarkReconcilePaused()
+}
+
+// MarkDeploymentPaused calls .Status.MarkDeploymentPaused on the Revision.
+func MarkDeploymentPaused(r *v1.Revision) {
+	r.Status.MarkDeploymentPaused()
+}
+
 // MarkDeploying calls .Status.MarkDeploying on the Revision.
 func MarkDeploying(reason string) RevisionOption {
 	return func(r *v1.Revision) {